@@ -22,13 +22,19 @@ import (
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"io"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	logConfig = "/var/log/ibmc-s3fs.log"
+	// defaultCacheMinDiskFreeMB is the space the s3fs caches leave free on the node
+	defaultCacheMinDiskFreeMB = 1024
 )
 
 // Version and Build time will be set during the "make driver"
@@ -51,10 +57,31 @@ var stdout = os.Stdout
 
 // NewS3fsPlugin returns a new instance of the driver that supports mount & unmount operations of s3fs volumes
 func NewS3fsPlugin(logger *zap.Logger) *driver.S3fsPlugin {
-	return &driver.S3fsPlugin{
-		Backend: &backend.COSSessionFactory{},
-		Logger:  logger,
+	timeouts := backend.DefaultOperationTimeouts
+	timeouts.CheckBucketAccess = getDurationFromEnv("COS_CHECK_BUCKET_TIMEOUT", timeouts.CheckBucketAccess, logger)
+	timeouts.CheckObjectPathExistence = getDurationFromEnv("COS_CHECK_OBJECT_PATH_TIMEOUT", timeouts.CheckObjectPathExistence, logger)
+	retry := backend.DefaultRetryPolicy
+	retry.MaxAttempts = getIntFromEnv("COS_RETRY_ATTEMPTS", retry.MaxAttempts, logger)
+	retry.InitialBackoff = getDurationFromEnv("COS_RETRY_INITIAL_BACKOFF", retry.InitialBackoff, logger)
+	retry.MaxBackoff = getDurationFromEnv("COS_RETRY_MAX_BACKOFF", retry.MaxBackoff, logger)
+	cache := driver.CacheConfig{
+		Root:          os.Getenv("S3FS_CACHE_ROOT"),
+		MaxTotalMB:    getIntFromEnv("S3FS_CACHE_MAX_TOTAL_MB", 0, logger),
+		MinDiskFreeMB: getIntFromEnv("S3FS_CACHE_MIN_DISK_FREE_MB", defaultCacheMinDiskFreeMB, logger),
 	}
+	plugin := &driver.S3fsPlugin{
+		Backend:        &backend.COSSessionFactory{Timeouts: timeouts, Retry: &retry},
+		Logger:         logger,
+		Cache:          cache,
+		UnmountTimeout: getDurationFromEnv("S3FS_UNMOUNT_TIMEOUT", driver.DefaultUnmountTimeout, logger),
+		Supervisor:     os.Getenv("S3FS_SUPERVISOR"),
+	}
+	if client := getKubeClient(logger); client != nil {
+		hostname, _ := os.Hostname()
+		plugin.Pods = &driver.KubePodIdentityGetter{Client: client}
+		plugin.Events = &driver.KubeEventRecorder{Client: client, Host: hostname}
+	}
+	return plugin
 }
 
 type versionCommand struct{}
@@ -94,6 +121,9 @@ func maskSecrets(m map[string]string) (map[string]string, []byte, error) {
 	mountOptsLogs["kubernetes.io/secret/service-instance-id"] = "MMM"
 	mountOptsLogs["kubernetes.io/secret/ca-bundle-crt"] = "ZZZ"
 	mountOptsLogs["kubernetes.io/secret/res-conf-apikey"] = "PPP"
+	mountOptsLogs["kubernetes.io/secret/sse-c-key"] = "SSS"
+	mountOptsLogs["kubernetes.io/secret/sse-c-old-keys"] = "OOO"
+	mountOptsLogs["kubernetes.io/secret/encryption-key"] = "EEE"
 	newString, err := json.Marshal(mountOptsLogs)
 
 	return mountOptsLogs, newString, err
@@ -196,6 +226,16 @@ func (u *unmountCommand) Execute(args []string) error {
 	return printResponse(response)
 }
 
+type checkOOMCommand struct{}
+
+func (c *checkOOMCommand) Execute(args []string) error {
+	killed := NewS3fsPlugin(filelogger).CheckOOM()
+	return printResponse(interfaces.FlexVolumeResponse{
+		Status:  interfaces.StatusSuccess,
+		Message: fmt.Sprintf("%d s3fs mount(s) with new OOM kills", killed),
+	})
+}
+
 type flagsOptions struct{}
 
 func main() {
@@ -204,6 +244,7 @@ func main() {
 	var initCommand initCommand
 	var mountCommand mountCommand
 	var unmountCommand unmountCommand
+	var checkOOMCommand checkOOMCommand
 	var options flagsOptions
 	var parser = flags.NewParser(&options, flags.Default&^flags.PrintErrors)
 
@@ -236,6 +277,11 @@ func main() {
 		"Unmount Volume",
 		"UnMount given a mount dir",
 		&unmountCommand)
+	// nolint:errcheck
+	parser.AddCommand("check-oom",
+		"Report s3fs OOM kills",
+		"Logs the OOM kills of the s3fs of the mounted volumes since the previous check.",
+		&checkOOMCommand)
 
 	_, err = parser.Parse()
 	if err != nil {
@@ -309,3 +355,49 @@ func getFromEnv(key string, defaultVal string) string {
 	}
 	return value
 }
+
+func getDurationFromEnv(key string, defaultVal time.Duration, logger *zap.Logger) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultVal
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Warn("Ignoring invalid duration", zap.String("key", key), zap.String("value", value), zap.Error(err))
+		return defaultVal
+	}
+	return d
+}
+
+// getKubeClient returns a client using the kubeconfig of S3FS_KUBECONFIG,
+// or nil when it is not set
+func getKubeClient(logger *zap.Logger) kubernetes.Interface {
+	kubeconfig := os.Getenv("S3FS_KUBECONFIG")
+	if kubeconfig == "" {
+		return nil
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		logger.Warn("Ignoring invalid kubeconfig", zap.String("key", "S3FS_KUBECONFIG"), zap.String("value", kubeconfig), zap.Error(err))
+		return nil
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logger.Warn("Ignoring invalid kubeconfig", zap.String("key", "S3FS_KUBECONFIG"), zap.String("value", kubeconfig), zap.Error(err))
+		return nil
+	}
+	return client
+}
+
+func getIntFromEnv(key string, defaultVal int, logger *zap.Logger) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultVal
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Warn("Ignoring invalid integer", zap.String("key", key), zap.String("value", value), zap.Error(err))
+		return defaultVal
+	}
+	return i
+}
@@ -17,15 +17,21 @@ import (
 	s3fsprovisioner "github.com/IBM/ibmcloud-object-storage-plugin/provisioner"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
 	cfg "github.com/IBM/ibmcloud-object-storage-plugin/utils/config"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/consts"
 	grpcClient "github.com/IBM/ibmcloud-object-storage-plugin/utils/grpc-client"
 	log "github.com/IBM/ibmcloud-object-storage-plugin/utils/logger"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/uuid"
 	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"os"
 	"sigs.k8s.io/sig-storage-lib-external-provisioner/v6/controller"
 	"strings"
 	"time"
@@ -70,6 +76,150 @@ var leaseRetryPeriod = flag.Duration(
 	"How often lease acquisition and renewal should be retried",
 )
 
+var providerCallTimeout = flag.Duration(
+	"providerCallTimeout",
+	grpcClient.DefaultCallTimeout,
+	"Timeout of a single call to the IBM provider",
+)
+
+var providerTypeCacheTTL = flag.Duration(
+	"providerTypeCacheTTL",
+	grpcClient.DefaultProviderTypeCacheTTL,
+	"How long the cluster type returned by the IBM provider is cached",
+)
+
+var cosCheckBucketTimeout = flag.Duration(
+	"cosCheckBucketTimeout",
+	backend.DefaultOperationTimeouts.CheckBucketAccess,
+	"Timeout of a COS bucket access check",
+)
+
+var cosCheckObjectPathTimeout = flag.Duration(
+	"cosCheckObjectPathTimeout",
+	backend.DefaultOperationTimeouts.CheckObjectPathExistence,
+	"Timeout of a COS object path existence check",
+)
+
+var cosCreateBucketTimeout = flag.Duration(
+	"cosCreateBucketTimeout",
+	backend.DefaultOperationTimeouts.CreateBucket,
+	"Timeout of a COS bucket creation",
+)
+
+var cosDeleteBucketTimeout = flag.Duration(
+	"cosDeleteBucketTimeout",
+	backend.DefaultOperationTimeouts.DeleteBucket,
+	"Timeout of a COS bucket deletion, including the deletion of its objects",
+)
+
+var cosSetBucketVersioningTimeout = flag.Duration(
+	"cosSetBucketVersioningTimeout",
+	backend.DefaultOperationTimeouts.SetBucketVersioning,
+	"Timeout of a COS bucket versioning update",
+)
+
+var cosBucketOwnerTimeout = flag.Duration(
+	"cosBucketOwnerTimeout",
+	backend.DefaultOperationTimeouts.BucketOwner,
+	"Timeout of reading or writing the ownership marker of a COS bucket",
+)
+
+var cosCreateObjectPathTimeout = flag.Duration(
+	"cosCreateObjectPathTimeout",
+	backend.DefaultOperationTimeouts.CreateObjectPath,
+	"Timeout of creating the object path of a volume in a shared COS bucket",
+)
+
+var cosCopyObjectsTimeout = flag.Duration(
+	"cosCopyObjectsTimeout",
+	backend.DefaultOperationTimeouts.CopyObjects,
+	"Timeout of copying the objects of a COS bucket to the archive bucket",
+)
+
+var cosObjectPathUsageTimeout = flag.Duration(
+	"cosObjectPathUsageTimeout",
+	backend.DefaultOperationTimeouts.ObjectPathUsage,
+	"Timeout of listing the objects of a volume to measure its usage",
+)
+
+var volumeUsageInterval = flag.Duration(
+	"volumeUsageInterval",
+	0,
+	"Period of the measure of the usage of the bound volumes, exported on the metrics port, 0 disables it",
+)
+
+var volumeUsageMaxObjects = flag.Int(
+	"volumeUsageMaxObjects",
+	s3fsprovisioner.DefaultMaxListedObjects,
+	"Maximum number of objects listed to measure the usage of a volume not reported by the Resource Configuration",
+)
+
+var volumeUsageWorkers = flag.Int(
+	"volumeUsageWorkers",
+	s3fsprovisioner.DefaultUsageWorkers,
+	"Maximum number of volumes whose usage is measured at once",
+)
+
+var quotaWarningThresholds = flag.String(
+	"quotaWarningThresholds",
+	"80,95",
+	"Comma separated percentages of the bucket hard quota at which a Warning event is recorded on the PVC, measured every volumeUsageInterval",
+)
+
+var iamTokenEndpoint = flag.String(
+	"iamTokenEndpoint",
+	"",
+	"IAM token URL used to set bucket access policy and quota limit, defaults to the IBM Cloud endpoint",
+)
+
+var resourceConfigEndpoint = flag.String(
+	"resourceConfigEndpoint",
+	"",
+	"COS Resource Configuration URL used to set bucket access policy and quota limit, defaults to the IBM Cloud endpoint",
+)
+
+var regionEndpointsFile = flag.String(
+	"regionEndpoints",
+	"",
+	"Path of a JSON file mapping node regions to the COS endpoint and location constraint of the buckets created in them",
+)
+
+var kmsKeyAllowlistFile = flag.String(
+	"kmsKeyAllowlist",
+	"",
+	"Path of a JSON file listing by namespace the root key CRNs PVCs may select with ibm.io/kms-root-key-crn, \"*\" for all namespaces",
+)
+
+var cosRetryAttempts = flag.Int(
+	"cosRetryAttempts",
+	backend.DefaultRetryPolicy.MaxAttempts,
+	"Number of attempts of a COS or IAM call failing with a retryable error, 1 disables retries",
+)
+
+var cosRetryInitialBackoff = flag.Duration(
+	"cosRetryInitialBackoff",
+	backend.DefaultRetryPolicy.InitialBackoff,
+	"Wait before the first retry of a COS or IAM call, doubled after each retry",
+)
+
+var cosRetryMaxBackoff = flag.Duration(
+	"cosRetryMaxBackoff",
+	backend.DefaultRetryPolicy.MaxBackoff,
+	"Maximum wait between two attempts of a COS or IAM call",
+)
+
+var cosRetryJitter = flag.Float64(
+	"cosRetryJitter",
+	backend.DefaultRetryPolicy.Jitter,
+	"Fraction of the wait between two attempts of a COS or IAM call that is randomized",
+)
+
+var metricsPort = flag.Int(
+	"metricsPort",
+	0,
+	"Port serving the provisioner metrics on /metrics, 0 disables metrics",
+)
+
 //var leaseTermLimit = flag.Duration(
 //	"leaseTermLimit",
 //	10*time.Minute,
@@ -109,6 +259,12 @@ func main() {
 		"set to 'false' to disable COS secret lookup in namespace other than PVC's namespace",
 	)
 
+	s3fsprovisioner.AllowUnmarkedBucketDeletion = flag.Bool(
+		"allowUnmarkedBucketDeletion",
+		true,
+		"set to 'false' to keep auto-delete-bucket from deleting buckets without ownership marker, such as buckets created before markers were introduced",
+	)
+
 	flag.Parse()
 
 	// Enable debug trace
@@ -146,14 +302,57 @@ func main() {
 		logger.Fatal("Error getting server version:", zap.Error(err))
 	}
 
+	var regionEndpoints s3fsprovisioner.RegionEndpoints
+	if *regionEndpointsFile != "" {
+		regionEndpoints, err = s3fsprovisioner.LoadRegionEndpoints(*regionEndpointsFile)
+		if err != nil {
+			logger.Fatal("Error while loading the region endpoints", zap.Error(err))
+		}
+	}
+
+	var kmsKeyAllowlist s3fsprovisioner.KMSKeyAllowlist
+	if *kmsKeyAllowlistFile != "" {
+		kmsKeyAllowlist, err = s3fsprovisioner.LoadKMSKeyAllowlist(*kmsKeyAllowlistFile)
+		if err != nil {
+			logger.Fatal("Error while loading the root key allowlist", zap.Error(err))
+		}
+	}
+
+	retry := backend.DefaultRetryPolicy
+	retry.MaxAttempts = *cosRetryAttempts
+	retry.InitialBackoff = *cosRetryInitialBackoff
+	retry.MaxBackoff = *cosRetryMaxBackoff
+	retry.Jitter = *cosRetryJitter
+
 	s3fsProvisioner := &s3fsprovisioner.IBMS3fsProvisioner{
-		Backend:       &backend.COSSessionFactory{},
-		GRPCBackend:   &grpcClient.ConnObjFactory{},
-		AccessPolicy:  &backend.UpdateAPFactory{},
-		IBMProvider:   &ibmprovider.IBMProviderClntFactory{},
-		Logger:        logger,
-		Client:        clientset,
-		UUIDGenerator: uuid.NewCryptoGenerator(),
+		Backend: &backend.COSSessionFactory{
+			Timeouts: backend.OperationTimeouts{
+				CheckBucketAccess:        *cosCheckBucketTimeout,
+				CheckObjectPathExistence: *cosCheckObjectPathTimeout,
+				CreateBucket:             *cosCreateBucketTimeout,
+				DeleteBucket:             *cosDeleteBucketTimeout,
+				SetBucketVersioning:      *cosSetBucketVersioningTimeout,
+				BucketOwner:              *cosBucketOwnerTimeout,
+				CopyObjects:              *cosCopyObjectsTimeout,
+				CreateObjectPath:         *cosCreateObjectPathTimeout,
+				ObjectPathUsage:          *cosObjectPathUsageTimeout,
+			},
+			Retry: &retry,
+		},
+		GRPCBackend: &grpcClient.ConnObjFactory{CallTimeout: *providerCallTimeout},
+		AccessPolicy: &backend.UpdateAPFactory{
+			IAMEndpoint:            *iamTokenEndpoint,
+			ResourceConfigEndpoint: *resourceConfigEndpoint,
+			Retry:                  &retry,
+			Logger:                 logger,
+		},
+		IBMProvider:       &ibmprovider.IBMProviderClntFactory{},
+		ProviderTypeCache: grpcClient.NewProviderTypeCache(*providerTypeCacheTTL),
+		Logger:            logger,
+		Client:            clientset,
+		UUIDGenerator:     uuid.NewCryptoGenerator(),
+		RegionEndpoints:   regionEndpoints,
+		KMSKeyAllowlist:   kmsKeyAllowlist,
 	}
 
 	pc := controller.NewProvisionController(
@@ -168,9 +367,48 @@ func main() {
 		controller.LeaseDuration(*leaseDuration),
 		controller.RenewDeadline(*leaseRenewDeadline),
 		controller.RetryPeriod(*leaseRetryPeriod),
+		controller.MetricsPort(int32(*metricsPort)), // #nosec G115 -- port numbers fit in int32
 		//controller.TermLimit(*leaseTermLimit),
 	)
 
+	if *volumeUsageInterval > 0 {
+		thresholds, err := s3fsprovisioner.ParseQuotaThresholds(*quotaWarningThresholds)
+		if err != nil {
+			logger.Fatal("Invalid quota warning thresholds", zap.Error(err))
+		}
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+		usageCollector := &s3fsprovisioner.UsageCollector{
+			Provisioner:      s3fsProvisioner,
+			Interval:         *volumeUsageInterval,
+			MaxListedObjects: *volumeUsageMaxObjects,
+			Workers:          *volumeUsageWorkers,
+			QuotaThresholds:  thresholds,
+			Recorder:         broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: *provisioner}),
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Fatal("Cannot get the hostname identifying the provisioner replica", zap.Error(err))
+		}
+		replicaID, err := uuid.NewCryptoGenerator().New()
+		if err != nil {
+			logger.Fatal("Cannot generate the identity of the provisioner replica", zap.Error(err))
+		}
+		election := s3fsprovisioner.LeaderElection{
+			Namespace:     consts.KubeSystem,
+			Name:          strings.ReplaceAll(*provisioner, "/", "-") + "-volume-usage",
+			Identity:      hostname + "_" + replicaID,
+			LeaseDuration: *leaseDuration,
+			RenewDeadline: *leaseRenewDeadline,
+			RetryPeriod:   *leaseRetryPeriod,
+		}
+		go func() {
+			if err := usageCollector.RunElected(context.Background(), election); err != nil {
+				logger.Fatal("Invalid volume usage leader election", zap.Error(err))
+			}
+		}()
+	}
+
 	pc.Run(context.Background())
 }
 
@@ -2,3 +2,26 @@
 
 apt-get install -q -y libcurl4-openssl-dev
 systemctl restart kubelet.service
+
+# reports every minute the OOM kills of the s3fs of the mounted volumes
+cat > /etc/systemd/system/ibmc-s3fs-oom-check.service <<UNIT
+[Unit]
+Description=Report the OOM kills of s3fs
+
+[Service]
+Type=oneshot
+ExecStart=/usr/libexec/kubernetes/kubelet-plugins/volume/exec/ibm~ibmc-s3fs/ibmc-s3fs check-oom
+UNIT
+cat > /etc/systemd/system/ibmc-s3fs-oom-check.timer <<UNIT
+[Unit]
+Description=Report the OOM kills of s3fs every minute
+
+[Timer]
+OnBootSec=1min
+OnUnitActiveSec=1min
+
+[Install]
+WantedBy=timers.target
+UNIT
+systemctl daemon-reload
+systemctl enable --now ibmc-s3fs-oom-check.timer
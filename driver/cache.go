@@ -0,0 +1,139 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// cacheSizeFileName records in the mount data path the cache size
+	// reserved by a mount, summed to bound the caches of the node
+	cacheSizeFileName = "cache-size-mb"
+	// defaultCacheSizeMB is the cache size of the volumes not setting one
+	defaultCacheSizeMB = 1024
+)
+
+var (
+	readDir  = os.ReadDir
+	readFile = os.ReadFile
+	statfs   = syscall.Statfs
+)
+
+// CacheConfig bounds the s3fs disk caches of the node
+type CacheConfig struct {
+	// Root is the directory holding the cache of each mount, a directory
+	// of the driver data path if empty
+	Root string
+	// MaxTotalMB bounds the sum of the cache sizes of the mounts of the
+	// node, 0 means no bound
+	MaxTotalMB int
+	// MinDiskFreeMB is the space s3fs always leaves free on the filesystem
+	// of the caches
+	MinDiskFreeMB int
+}
+
+// cacheDir returns the cache directory of the mount whose data path is mountPath
+func (c CacheConfig) cacheDir(mountPath string) string {
+	root := c.Root
+	if root == "" {
+		root = path.Join(dataRootPath, cacheDirectoryName)
+	}
+	return path.Join(root, path.Base(mountPath))
+}
+
+// reservedMB returns the cache size reserved by the mounts of the node other
+// than the one whose data path is mountPath
+func reservedMB(mountPath string) (int, error) {
+	entries, err := readDir(dataRootPath)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == path.Base(mountPath) {
+			continue
+		}
+		data, err := readFile(path.Join(dataRootPath, e.Name(), cacheSizeFileName))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		if size, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			total += size
+		}
+	}
+	return total, nil
+}
+
+// setUpCache creates the cache directory of a mount and returns the s3fs
+// options using it. The cache is disabled, with a warning, when the node
+// cache budget is exhausted.
+func (p *S3fsPlugin) setUpCache(mountPath string, options Options) ([]string, error) {
+	sizeMB := options.CacheSizeMB
+	if sizeMB == 0 {
+		sizeMB = defaultCacheSizeMB
+	}
+
+	if p.Cache.MaxTotalMB > 0 {
+		used, err := reservedMB(mountPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the cache sizes of the node: %v", err)
+		}
+		if used+sizeMB > p.Cache.MaxTotalMB {
+			p.Logger.Warn(podUID+":"+"node cache budget exhausted, mounting without cache",
+				zap.Int("cache-size-mb", sizeMB), zap.Int("used-mb", used), zap.Int("max-total-mb", p.Cache.MaxTotalMB))
+			return nil, nil
+		}
+	}
+
+	dir := p.Cache.cacheDir(mountPath)
+	if err := mkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create cache directory: %v", err)
+	}
+
+	// the free space s3fs leaves on the cache filesystem bounds the cache to its size
+	var st syscall.Statfs_t
+	if err := statfs(dir, &st); err != nil {
+		return nil, fmt.Errorf("cannot stat cache filesystem: %v", err)
+	}
+	freeMB := int(st.Bavail * uint64(st.Bsize) >> 20) // nolint:gosec
+	diskFreeMB := freeMB - sizeMB
+	if diskFreeMB < options.CacheDiskFreeMB {
+		diskFreeMB = options.CacheDiskFreeMB
+	}
+	if diskFreeMB < p.Cache.MinDiskFreeMB {
+		diskFreeMB = p.Cache.MinDiskFreeMB
+	}
+
+	if err := writeFile(path.Join(mountPath, cacheSizeFileName), []byte(strconv.Itoa(sizeMB)), 0600); err != nil {
+		return nil, fmt.Errorf("cannot record cache size: %v", err)
+	}
+
+	return []string{
+		"-o", "use_cache=" + dir,
+		"-o", "del_cache",
+		"-o", "ensure_diskfree=" + strconv.Itoa(diskFreeMB),
+	}, nil
+}
+
+// removeCache deletes the cache of the mount whose data path is mountPath
+func (p *S3fsPlugin) removeCache(mountPath string) error {
+	return removeAll(p.Cache.cacheDir(mountPath))
+}
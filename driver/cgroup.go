@@ -0,0 +1,224 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// cgroupParent is the cgroup holding the cgroups of the s3fs processes
+	cgroupParent = "ibmc-s3fs"
+	// cgroupFileName records in the mount data path the cgroup of its s3fs
+	cgroupFileName = "cgroup"
+	// oomReportedFileName records in the mount data path the OOM kills of
+	// its s3fs already reported by CheckOOM
+	oomReportedFileName = "oom_kills"
+	// cpuPeriodUs is the period of the CPU quota of the cgroups
+	cpuPeriodUs = 100000
+	// minMilliCPU is the smallest CPU quota, 1ms per period
+	minMilliCPU = 10
+	// cgroupScript moves the shell in the cgroup whose cgroup.procs file
+	// is $0 then runs s3fs, whose daemon stays in the cgroup
+	cgroupScript = `echo $$ > "$0" && exec s3fs "$@"`
+)
+
+// cgroupRoot is the mount point of the cgroup v2 hierarchy
+var cgroupRoot = "/sys/fs/cgroup"
+
+// resourceLimits bound the memory and CPU of an s3fs process, 0 for no bound
+type resourceLimits struct {
+	MemoryBytes int64
+	MilliCPU    int64
+}
+
+func (l resourceLimits) isSet() bool {
+	return l.MemoryBytes > 0 || l.MilliCPU > 0
+}
+
+// ParseMemoryLimit validates the memory limit of s3fs, a quantity such as 512Mi
+func ParseMemoryLimit(value string) (int64, error) {
+	q, err := resource.ParseQuantity(value)
+	if err != nil || q.Sign() <= 0 {
+		return 0, fmt.Errorf("%q is not a positive memory quantity such as 512Mi", value)
+	}
+	return q.Value(), nil
+}
+
+// ParseCPULimit validates the CPU limit of s3fs, a quantity such as 500m
+// or 2, and returns it in millicores
+func ParseCPULimit(value string) (int64, error) {
+	q, err := resource.ParseQuantity(value)
+	if err != nil || q.MilliValue() < minMilliCPU {
+		return 0, fmt.Errorf("%q is not a CPU quantity of at least %dm, such as 500m", value, minMilliCPU)
+	}
+	return q.MilliValue(), nil
+}
+
+// parseResourceLimits returns the resource limits of the s3fs of a mount
+func parseResourceLimits(options Options) (limits resourceLimits, err error) {
+	if options.S3fsMemoryLimit != "" {
+		if limits.MemoryBytes, err = ParseMemoryLimit(options.S3fsMemoryLimit); err != nil {
+			return limits, fmt.Errorf("bad s3fs-memory-limit: %v", err)
+		}
+	}
+	if options.S3fsCPULimit != "" {
+		if limits.MilliCPU, err = ParseCPULimit(options.S3fsCPULimit); err != nil {
+			return limits, fmt.Errorf("bad s3fs-cpu-limit: %v", err)
+		}
+	}
+	return limits, nil
+}
+
+// createCgroup creates the cgroup limiting the s3fs of the mount whose data
+// path is mountPath and returns its directory
+func createCgroup(mountPath string, limits resourceLimits) (string, error) {
+	if _, err := stat(path.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is not mounted on %s: %v", cgroupRoot, err)
+	}
+	parent := path.Join(cgroupRoot, cgroupParent)
+	if err := mkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	// the cgroups of the mounts get the controllers of their parent
+	if err := writeFile(path.Join(parent, "cgroup.subtree_control"), []byte("+memory +cpu"), 0644); err != nil {
+		return "", fmt.Errorf("cannot enable memory and cpu controllers: %v", err)
+	}
+
+	dir := path.Join(parent, path.Base(mountPath))
+	if err := mkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if limits.MemoryBytes > 0 {
+		if err := writeFile(path.Join(dir, "memory.max"), []byte(strconv.FormatInt(limits.MemoryBytes, 10)), 0644); err != nil {
+			return "", fmt.Errorf("cannot set memory limit: %v", err)
+		}
+	}
+	if limits.MilliCPU > 0 {
+		quota := fmt.Sprintf("%d %d", limits.MilliCPU*cpuPeriodUs/1000, cpuPeriodUs)
+		if err := writeFile(path.Join(dir, "cpu.max"), []byte(quota), 0644); err != nil {
+			return "", fmt.Errorf("cannot set cpu limit: %v", err)
+		}
+	}
+	return dir, nil
+}
+
+// mountCgroup returns the cgroup recorded for the mount whose data path is
+// mountPath, empty if its s3fs has no limits
+func mountCgroup(mountPath string) string {
+	data, err := readFile(path.Join(mountPath, cgroupFileName))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// oomKills returns the number of processes of the cgroup of the mount whose
+// data path is mountPath killed by the OOM killer
+func oomKills(mountPath string) int {
+	cgroup := mountCgroup(mountPath)
+	if cgroup == "" {
+		return 0
+	}
+	data, err := readFile(path.Join(cgroup, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// oomMessage describes the OOM kills of the s3fs of a mount, empty if none
+func oomMessage(mountPath string) string {
+	if n := oomKills(mountPath); n > 0 {
+		return fmt.Sprintf("s3fs was killed %d time(s) by the OOM killer, raise ibm.io/s3fs-memory-limit", n)
+	}
+	return ""
+}
+
+// CheckOOM logs the OOM kills of the s3fs of the volumes mounted on the node
+// since the previous check, and records them as events on the pods mounting
+// the volumes, reporting them before the volumes are unmounted.
+// It returns the number of mounts whose s3fs was killed.
+func (p *S3fsPlugin) CheckOOM() int {
+	entries, err := readDir(dataRootPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			p.Logger.Error("cannot list s3fs mounts", zap.Error(err))
+		}
+		return 0
+	}
+	killed := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		mountPath := path.Join(dataRootPath, e.Name())
+		total := oomKills(mountPath)
+		if total == 0 {
+			continue
+		}
+		reported := 0
+		if data, err := readFile(path.Join(mountPath, oomReportedFileName)); err == nil {
+			reported, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		if total == reported {
+			continue
+		}
+		// the counters restart when systemd recreates the cgroup of a
+		// restarted s3fs
+		n := total
+		if total > reported {
+			n -= reported
+		}
+		killed++
+		p.Logger.Error("s3fs was killed by the OOM killer",
+			zap.String("mountpath", mountPath), zap.String("cgroup", mountCgroup(mountPath)),
+			zap.Int("kills", n))
+		p.podEvent(mountPath, v1.EventTypeWarning, oomKilledReason,
+			fmt.Sprintf("s3fs was killed %d time(s) by the OOM killer since the previous check, raise ibm.io/s3fs-memory-limit", n))
+		if err := writeFile(path.Join(mountPath, oomReportedFileName), []byte(strconv.Itoa(total)), 0600); err != nil {
+			p.Logger.Warn("cannot record reported OOM kills",
+				zap.String("mountpath", mountPath), zap.Error(err))
+		}
+	}
+	return killed
+}
+
+// removeCgroup deletes the cgroup of the mount whose data path is mountPath,
+// which fails while s3fs is still running in it
+func removeCgroup(mountPath string) error {
+	cgroup := mountCgroup(mountPath)
+	if cgroup == "" {
+		return nil
+	}
+	if err := removeAll(cgroup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
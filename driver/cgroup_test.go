@@ -0,0 +1,161 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/driver/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testMountPath = path.Join(dataRootPath, fmt.Sprintf("%x", sha256.Sum256([]byte(testDir))))
+	testCgroup    = path.Join(cgroupRoot, cgroupParent, path.Base(testMountPath))
+)
+
+// recordWrites records the files written by the plugin in written
+func recordWrites(written map[string]string) {
+	writeFile = func(name string, data []byte, perm os.FileMode) error {
+		written[name] = string(data)
+		return nil
+	}
+}
+
+func getLimitsMountRequest() interfaces.FlexVolumeMountRequest {
+	r := getMountRequest()
+	r.Opts["s3fs-memory-limit"] = "512Mi"
+	r.Opts["s3fs-cpu-limit"] = "500m"
+	return r
+}
+
+func Test_ParseResourceLimits(t *testing.T) {
+	memory, err := ParseMemoryLimit("1Gi")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<30), memory)
+	cpu, err := ParseCPULimit("1.5")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), cpu)
+
+	_, err = ParseMemoryLimit("-1Mi")
+	assert.Error(t, err)
+	_, err = ParseCPULimit("5m")
+	assert.Error(t, err)
+}
+
+func Test_Mount_S3fsLimits_Cgroup(t *testing.T) {
+	p := getPlugin()
+	written := map[string]string{}
+	recordWrites(written)
+
+	resp := p.Mount(getLimitsMountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Equal(t, "+memory +cpu", written[path.Join(cgroupRoot, cgroupParent, "cgroup.subtree_control")])
+		assert.Equal(t, "536870912", written[path.Join(testCgroup, "memory.max")])
+		assert.Equal(t, "50000 100000", written[path.Join(testCgroup, "cpu.max")])
+		assert.Equal(t, testCgroup, written[path.Join(testMountPath, cgroupFileName)])
+		assert.Equal(t, []string{"-c", cgroupScript, path.Join(testCgroup, "cgroup.procs")}, commandArgs[:3])
+		assert.Contains(t, commandArgs, "passwd_file="+path.Join(testMountPath, passwordFileName))
+	}
+}
+
+func Test_Mount_S3fsLimits_Systemd(t *testing.T) {
+	var commands []string
+	p := getSupervisedPlugin(&commands)
+	written := map[string]string{}
+	recordWrites(written)
+
+	resp := p.Mount(getLimitsMountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "--property=MemoryMax=536870912")
+		assert.Contains(t, commandArgs, "--property=CPUQuota=50%")
+		assert.Equal(t, path.Join(cgroupRoot, "system.slice", testUnit), written[path.Join(testMountPath, cgroupFileName)])
+	}
+}
+
+func Test_Mount_BadS3fsMemoryLimit(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts["s3fs-memory-limit"] = "lots"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "bad resource limits: bad s3fs-memory-limit")
+	}
+}
+
+func Test_Unmount_S3fsOOMKilled(t *testing.T) {
+	p, flags := getGracefulUnmountPlugin(0)
+	// systemd deletes the cgroup of the service once s3fs exits
+	readFile = func(name string) ([]byte, error) {
+		switch name {
+		case path.Join(testMountPath, cgroupFileName):
+			return []byte(testCgroup + "\n"), nil
+		case path.Join(testCgroup, "memory.events"):
+			if len(*flags) == 0 {
+				return []byte("low 0\nhigh 0\nmax 12\noom 2\noom_kill 2\n"), nil
+			}
+		}
+		return nil, os.ErrNotExist
+	}
+	var removed []string
+	removeAll = func(name string) error {
+		removed = append(removed, name)
+		return nil
+	}
+
+	resp := p.Unmount(getUnmountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.True(t, strings.HasPrefix(resp.Message, "Volume unmounted: "))
+		assert.Contains(t, resp.Message, "s3fs was killed 2 time(s) by the OOM killer")
+	}
+	assert.NotEmpty(t, *flags)
+	assert.Contains(t, removed, testCgroup)
+}
+
+func Test_CheckOOM(t *testing.T) {
+	p := getPlugin()
+	readDir = func(name string) ([]os.DirEntry, error) {
+		assert.Equal(t, dataRootPath, name)
+		return []os.DirEntry{
+			fs.FileInfoToDirEntry(fakeDirInfo(path.Base(testMountPath))),
+			fs.FileInfoToDirEntry(fakeDirInfo("nolimits")),
+		}, nil
+	}
+	kills := "oom_kill 2\n"
+	files := map[string]string{
+		path.Join(testMountPath, cgroupFileName): testCgroup,
+	}
+	readFile = func(name string) ([]byte, error) {
+		if name == path.Join(testCgroup, "memory.events") {
+			return []byte(kills), nil
+		}
+		if data, ok := files[name]; ok {
+			return []byte(data), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	recordWrites(files)
+
+	assert.Equal(t, 1, p.CheckOOM())
+	assert.Equal(t, "2", files[path.Join(testMountPath, oomReportedFileName)])
+	// the kills are reported once
+	assert.Equal(t, 0, p.CheckOOM())
+	kills = "oom_kill 3\n"
+	assert.Equal(t, 1, p.CheckOOM())
+	assert.Equal(t, "3", files[path.Join(testMountPath, oomReportedFileName)])
+}
@@ -11,7 +11,9 @@
 package driver
 
 import (
+	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
@@ -21,18 +23,22 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/IBM/ibmcloud-object-storage-plugin/driver/interfaces"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/endpoints"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/parser"
 	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
 )
 
 const (
 	dataRootPath     = "/var/lib/ibmc-s3fs"
 	passwordFileName = "passwd"
-	//cacheDirectoryName = "cache"
-	caPath = "/tmp"
+	// cacheDirectoryName is the directory of the data path holding the mount caches
+	cacheDirectoryName = "cache"
+	caPath             = "/tmp"
 	// SecretAccessKey is the key name for the AWS Access Key
 	SecretAccessKey = "access-key"
 	// SecretSecretKey is the key name for the AWS Secret Key
@@ -47,6 +53,17 @@ const (
 	defaultIAMEndPoint = "https://iam.cloud.ibm.com"
 	// CrtBundle is the base64 encoded crt bundle
 	CrtBundle = "ca-bundle-crt"
+	// SecretSSECKey is the key name for the SSE-C customer key encrypting the objects
+	SecretSSECKey = "sse-c-key"
+	// SecretSSECOldKeys is the key name for the previous SSE-C customer keys,
+	// one per line, still used to read the objects they encrypted
+	SecretSSECOldKeys = "sse-c-old-keys"
+	// sseCKeysFileName is the file holding the SSE-C keys of a mount
+	sseCKeysFileName = "sse-c-keys"
+	// sseCKeySize is the size of an SSE-C AES256 key
+	sseCKeySize = 32
+	// SecretEncryptionKey is the key name for the passphrase of the client-side encryption
+	SecretEncryptionKey = "encryption-key"
 )
 
 var (
@@ -72,6 +89,12 @@ type Options struct {
 	StatCacheSize           int    `json:"stat-cache-size,string"`
 	FSGroup                 string `json:"kubernetes.io/fsGroup,omitempty"`
 	FSGroupNew              string `json:"kubernetes.io/mounterArgs.FsGroup,omitempty"`
+	PodName                 string `json:"kubernetes.io/pod.name,omitempty"`
+	PodNamespace            string `json:"kubernetes.io/pod.namespace,omitempty"`
+	UID                     string `json:"uid,omitempty"`
+	GID                     string `json:"gid,omitempty"`
+	Umask                   string `json:"umask,omitempty"`
+	MountPointUmask         string `json:"mp-umask,omitempty"`
 	Endpoint                string `json:"endpoint,omitempty"` //Will be deprecated
 	Region                  string `json:"region,omitempty"`   //Will be deprecated
 	Bucket                  string `json:"bucket"`
@@ -87,6 +110,8 @@ type Options struct {
 	APIKeyB64               string `json:"kubernetes.io/secret/api-key,omitempty"`
 	OSEndpoint              string `json:"object-store-endpoint,omitempty"`
 	OSStorageClass          string `json:"object-store-storage-class,omitempty"`
+	OSRegion                string `json:"object-store-region,omitempty"`
+	OSNetwork               string `json:"object-store-network,omitempty"`
 	IAMEndpoint             string `json:"iam-endpoint,omitempty"`
 	ConnectTimeoutSeconds   string `json:"connect-timeout,omitempty"`
 	ReadwriteTimeoutSeconds string `json:"readwrite-timeout,omitempty"`
@@ -94,11 +119,59 @@ type Options struct {
 	AccessMode              string `json:"access-mode,omitempty"`
 	ServiceInstanceIDB64    string `json:"kubernetes.io/secret/service-instance-id,omitempty"`
 	CAbundleB64             string `json:"kubernetes.io/secret/ca-bundle-crt,omitempty"`
+	SSECKeyB64              string `json:"kubernetes.io/secret/sse-c-key,omitempty"`
+	SSECOldKeysB64          string `json:"kubernetes.io/secret/sse-c-old-keys,omitempty"`
 	CosServiceIP            string `json:"service-ip,omitempty"`
 	AutoCache               bool   `json:"auto_cache,string,omitempty"`
+	UseCache                bool   `json:"use-cache,string,omitempty"`
+	CacheSizeMB             int    `json:"cache-size-mb,string,omitempty"`
+	CacheDiskFreeMB         int    `json:"cache-disk-free-mb,string,omitempty"`
+	S3fsMemoryLimit         string `json:"s3fs-memory-limit,omitempty"`
+	S3fsCPULimit            string `json:"s3fs-cpu-limit,omitempty"`
+	AsOf                    string `json:"as-of,omitempty"`
+	ClientSideEncryption    bool   `json:"client-side-encryption,string,omitempty"`
+	EncryptionKeyB64        string `json:"kubernetes.io/secret/encryption-key,omitempty"`
 	AddMountParam           string `json:"add-mount-param,omitempty"`
 }
 
+// parseSSECKeys decodes the SSE-C keys of the secret. It returns the base64
+// encoded keys, the current key first, or nil when SSE-C is not used.
+func parseSSECKeys(keyB64, oldKeysB64 string) ([]string, error) {
+	if keyB64 == "" {
+		if oldKeysB64 != "" {
+			return nil, fmt.Errorf("%s requires %s", SecretSSECOldKeys, SecretSSECKey)
+		}
+		return nil, nil
+	}
+	key, err := parser.DecodeBase64(keyB64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %v", SecretSSECKey, err)
+	}
+	keys := []string{strings.TrimSpace(key)}
+	if oldKeysB64 != "" {
+		oldKeys, err := parser.DecodeBase64(oldKeysB64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %s: %v", SecretSSECOldKeys, err)
+		}
+		for _, k := range strings.Split(oldKeys, "\n") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+	}
+	for i, k := range keys {
+		raw, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(raw) != sseCKeySize {
+			name := SecretSSECKey
+			if i > 0 {
+				name = fmt.Sprintf("%s line %d", SecretSSECOldKeys, i)
+			}
+			return nil, fmt.Errorf("%s must be a base64 encoded %d bytes key", name, sseCKeySize)
+		}
+	}
+	return keys, nil
+}
+
 // PathExists returns true if the specified path exists.
 func pathExists(path string) (bool, error) {
 	if path == "" {
@@ -139,6 +212,16 @@ func isCorruptedMnt(err error) bool {
 type S3fsPlugin struct {
 	Backend backend.ObjectStorageSessionFactory
 	Logger  *zap.Logger
+	Cache   CacheConfig
+	// Pods looks up the security context of the pods, nil if unavailable
+	Pods PodIdentityGetter
+	// UnmountTimeout bounds the wait for the uploads of s3fs on unmount, 0
+	// detaches the mount point without waiting
+	UnmountTimeout time.Duration
+	// Supervisor runs the s3fs processes, SupervisorNone or SupervisorSystemd
+	Supervisor string
+	// Events records events on the pods mounting volumes, nil if unavailable
+	Events EventRecorder
 }
 
 // SetBuildVersion sets the driver version
@@ -237,6 +320,17 @@ func (p *S3fsPlugin) createEmptyMountpoint(mountPath string) error {
 	p.Logger.Info(podUID+":"+"Creating empty mountpoint",
 		zap.String("mountPath", mountPath))
 
+	// s3fs left mounted under the encryption layer by an earlier mount would
+	// have the objects of the volume deleted with the data path
+	if cipherDir := encryptedMount(mountPath); cipherDir != "" {
+		if err := p.unmountPath(cipherDir, false); err != nil {
+			return err
+		}
+		if p.cipherMounted(cipherDir) {
+			return fmt.Errorf("s3fs is still mounted on %s, not deleting %s", cipherDir, mountPath)
+		}
+	}
+
 	err := p.unmountPath(mountPath, true)
 	if err != nil {
 		return err
@@ -282,14 +376,14 @@ func (p *S3fsPlugin) checkBucket(endpoint, region, bucket string, creds *backend
 	p.Logger.Info(podUID+":"+"Checking if bucket exists",
 		zap.String("bucket", bucket))
 	sess := p.Backend.NewObjectStorageSession(endpoint, region, creds, p.Logger)
-	return sess.CheckBucketAccess(bucket)
+	return sess.CheckBucketAccessWithContext(context.Background(), bucket)
 }
 
 func (p *S3fsPlugin) checkObjectPath(endpoint, region, bucket, objectpath string, creds *backend.ObjectStorageCredentials) (bool, error) {
 	p.Logger.Info(podUID+":"+"Checking if object-path exists inside bucket",
 		zap.String("bucket", bucket), zap.String("object-path", objectpath))
 	sess := p.Backend.NewObjectStorageSession(endpoint, region, creds, p.Logger)
-	return sess.CheckObjectPathExistence(bucket, objectpath)
+	return sess.CheckObjectPathExistenceWithContext(context.Background(), bucket, objectpath)
 }
 
 func (p *S3fsPlugin) createDirectoryIfNotExists(path string) error {
@@ -349,6 +443,24 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 		regionValue = "dummy-object-store-storageclass"
 	}
 
+	// endpoints not set explicitly are resolved from the catalog
+	var catalog endpoints.Endpoints
+	if options.OSRegion != "" {
+		network := options.OSNetwork
+		if network == "" {
+			network = endpoints.NetworkPublic
+		}
+		catalog, err = endpoints.Resolve(options.OSRegion, network)
+		if err != nil {
+			p.Logger.Error(podUID+":"+"cannot resolve endpoints of object-store-region",
+				zap.Error(err))
+			return fmt.Errorf("cannot resolve endpoints of object-store-region: %v", err)
+		}
+		if endptValue == "" {
+			endptValue = catalog.S3
+		}
+	}
+
 	if !strings.HasPrefix(endptValue, "https://") && !strings.HasPrefix(endptValue, "http://") {
 		p.Logger.Error(podUID+":"+
 			"bad value for object-store-endpoint: scheme is missing."+
@@ -451,6 +563,9 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 	if apiKey != "" {
 		if options.IAMEndpoint == "" {
 			iamEndpoint = defaultIAMEndPoint
+			if catalog.IAM != "" {
+				iamEndpoint = catalog.IAM
+			}
 		} else {
 			if !strings.HasPrefix(options.IAMEndpoint, "https://") && !strings.HasPrefix(options.IAMEndpoint, "http://") {
 				p.Logger.Error(podUID+":"+
@@ -502,33 +617,39 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 			return fmt.Errorf("cannot set AWS_CA_BUNDLE env var: %v", err)
 		}
 	}
+	creds := &backend.ObjectStorageCredentials{
+		AccessKey:         accessKey,
+		SecretKey:         secretKey,
+		APIKey:            apiKey,
+		ServiceInstanceID: serviceInstanceId,
+		IAMEndpoint:       iamEndpoint,
+	}
 	// check that bucket exists before doing the mount
-	err = p.checkBucket(endptValue, regionValue, options.Bucket,
-		&backend.ObjectStorageCredentials{
-			AccessKey:         accessKey,
-			SecretKey:         secretKey,
-			APIKey:            apiKey,
-			ServiceInstanceID: serviceInstanceId,
-			IAMEndpoint:       iamEndpoint})
+	err = p.checkBucket(endptValue, regionValue, options.Bucket, creds)
 	if err != nil {
 		p.Logger.Error(podUID+":"+" cannot access bucket",
-			zap.Error(err))
-		return fmt.Errorf("cannot access bucket: %v", err)
+			zap.String("reason", backend.ErrorReason(err)), zap.Error(err))
+		switch {
+		case errors.Is(err, backend.ErrBucketNotFound):
+			return fmt.Errorf("cannot access bucket: bucket %s does not exist: %w", options.Bucket, err)
+		case errors.Is(err, backend.ErrBadCredentials):
+			return fmt.Errorf("cannot access bucket: credentials for bucket %s are invalid: %w", options.Bucket, err)
+		case errors.Is(err, backend.ErrAccessDenied):
+			return fmt.Errorf("cannot access bucket: credentials are not authorized for bucket %s: %w", options.Bucket, err)
+		case errors.Is(err, backend.ErrBadEndpoint):
+			return fmt.Errorf("cannot access bucket: endpoint %s cannot be resolved or is not trusted: %w", endptValue, err)
+		}
+		return fmt.Errorf("cannot access bucket: %w", err)
 	}
 
 	// check that object-path exists inside bucket before doing the mount
 	if options.ObjectPath != "" {
-		exist, err := p.checkObjectPath(endptValue, regionValue, options.Bucket, options.ObjectPath,
-			&backend.ObjectStorageCredentials{
-				AccessKey:         accessKey,
-				SecretKey:         secretKey,
-				APIKey:            apiKey,
-				ServiceInstanceID: serviceInstanceId,
-				IAMEndpoint:       iamEndpoint})
+		exist, err := p.checkObjectPath(endptValue, regionValue, options.Bucket, options.ObjectPath, creds)
 		if err != nil {
 			p.Logger.Error(podUID+":"+" cannot access object-path inside bucket",
-				zap.String("bucket", options.Bucket), zap.String("object-path", options.ObjectPath), zap.Error(err))
-			return fmt.Errorf("cannot access object-path \"%s\" inside bucket %s: %v", options.ObjectPath, options.Bucket, err)
+				zap.String("bucket", options.Bucket), zap.String("object-path", options.ObjectPath),
+				zap.String("reason", backend.ErrorReason(err)), zap.Error(err))
+			return fmt.Errorf("cannot access object-path \"%s\" inside bucket %s: %w", options.ObjectPath, options.Bucket, err)
 		} else if !exist {
 			p.Logger.Error(podUID+":"+" object-path not found inside bucket",
 				zap.String("bucket", options.Bucket), zap.String("object-path", options.ObjectPath))
@@ -544,6 +665,40 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 		return fmt.Errorf("cannot create target directory: %v", err)
 	}
 
+	sseCKeys, err := parseSSECKeys(options.SSECKeyB64, options.SSECOldKeysB64)
+	if err != nil {
+		p.Logger.Error(podUID+":"+" bad SSE-C keys",
+			zap.Error(err))
+		return fmt.Errorf("bad SSE-C keys: %v", err)
+	}
+
+	passphrase, err := parseEncryptionKey(options)
+	if err != nil {
+		p.Logger.Error(podUID+":"+" bad encryption key",
+			zap.Error(err))
+		return fmt.Errorf("bad encryption key: %v", err)
+	}
+
+	fsGroup := ""
+	if _, ok := mountRequest.Opts["kubernetes.io/fsGroup"]; ok {
+		fsGroup = options.FSGroup
+	} else if _, ok := mountRequest.Opts["kubernetes.io/mounterArgs.FsGroup"]; ok {
+		fsGroup = options.FSGroupNew
+	}
+	uid, gid, umask, mpUmask, err := p.mountIdentity(options, fsGroup)
+	if err != nil {
+		p.Logger.Error(podUID+":"+" bad ownership options",
+			zap.Error(err))
+		return fmt.Errorf("bad ownership options: %v", err)
+	}
+
+	limits, err := parseResourceLimits(options)
+	if err != nil {
+		p.Logger.Error(podUID+":"+" bad resource limits",
+			zap.Error(err))
+		return fmt.Errorf("bad resource limits: %v", err)
+	}
+
 	// mount data path
 	mountPath := path.Join(dataRootPath, fmt.Sprintf("%x", sha256.Sum256([]byte(mountRequest.MountDir))))
 	done := false
@@ -554,14 +709,41 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 		return fmt.Errorf("cannot create mount point: %v", err)
 	}
 
+	// an encrypted volume mounts s3fs in the data path, under the encryption layer
+	s3fsDir := mountRequest.MountDir
 	defer func() {
 		// try to delete cache upon error or panic
 		if !done {
+			// deleting the data path would delete the objects of the volume
+			// through s3fs still mounted in it
+			if s3fsDir != mountRequest.MountDir {
+				if mounterr := p.unmountPath(s3fsDir, false); mounterr != nil {
+					p.Logger.Error(podUID+":"+"Error unmounting encrypted volume, keeping its data path",
+						zap.Error(mounterr))
+					return
+				}
+				if p.cipherMounted(s3fsDir) {
+					p.Logger.Error(podUID+":"+"s3fs still mounted under the encryption layer, keeping its data path",
+						zap.String("path", s3fsDir))
+					return
+				}
+			}
+			p.releaseS3fs(mountPath)
+			if cgrouperr := removeCgroup(mountPath); cgrouperr != nil {
+				p.Logger.Error(podUID+":"+"Error removing s3fs cgroup",
+					zap.Error(cgrouperr))
+			}
 			mounterr := p.unmountPath(mountPath, true)
 			if mounterr != nil {
 				p.Logger.Error(podUID+":"+"Error unmounting volume",
 					zap.Error(mounterr))
 			}
+			if options.UseCache {
+				if cacheerr := p.removeCache(mountPath); cacheerr != nil {
+					p.Logger.Error(podUID+":"+"Error removing cache",
+						zap.Error(cacheerr))
+				}
+			}
 		}
 	}()
 
@@ -578,6 +760,33 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 		return fmt.Errorf("cannot create password file: %v", err)
 	}
 
+	// create SSE-C key file, the current key first
+	sseCKeysFile := ""
+	if len(sseCKeys) > 0 {
+		sseCKeysFile = path.Join(mountPath, sseCKeysFileName)
+		err = writeFile(sseCKeysFile, []byte(strings.Join(sseCKeys, "\n")+"\n"), 0600)
+		if err != nil {
+			p.Logger.Error(podUID+":"+" cannot create SSE-C key file",
+				zap.Error(err))
+			return fmt.Errorf("cannot create SSE-C key file: %v", err)
+		}
+	}
+
+	if passphrase != "" {
+		cipherDir := path.Join(mountPath, cipherDirName)
+		if err = mkdirAll(cipherDir, 0700); err != nil {
+			p.Logger.Error(podUID+":"+" cannot create encrypted mount point",
+				zap.Error(err))
+			return fmt.Errorf("cannot create encrypted mount point: %v", err)
+		}
+		if err = writeFile(path.Join(mountPath, encryptionFileName), []byte(cipherDir), 0600); err != nil {
+			p.Logger.Error(podUID+":"+" cannot record encrypted mount point",
+				zap.Error(err))
+			return fmt.Errorf("cannot record encrypted mount point: %v", err)
+		}
+		s3fsDir = cipherDir
+	}
+
 	if options.ObjectPath != "" {
 		if strings.HasPrefix(options.ObjectPath, "/") {
 			fullBucketPath = options.Bucket + ":" + options.ObjectPath
@@ -587,7 +796,7 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 	} else {
 		fullBucketPath = options.Bucket
 	}
-	args := []string{fullBucketPath, mountRequest.MountDir,
+	args := []string{fullBucketPath, s3fsDir,
 		"-o", "multireq_max=" + strconv.Itoa(options.MultiReqMax),
 		"-o", "use_path_request_style",
 		"-o", "passwd_file=" + passwordFile,
@@ -599,21 +808,23 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 		"-o", "max_stat_cache_size=" + strconv.Itoa(options.StatCacheSize),
 		"-o", "allow_other",
 		"-o", "max_background=1000",
-		"-o", "mp_umask=002",
+		"-o", "mp_umask=" + mpUmask,
 		"-o", "instance_name=" + mountRequest.MountDir,
 	}
 
-	//if options.FSGroup != "" {
-	if _, ok := mountRequest.Opts["kubernetes.io/fsGroup"]; ok {
-		args = append(args, "-o", "gid="+options.FSGroup)
-		args = append(args, "-o", "uid="+options.FSGroup)
-	} else if _, ok := mountRequest.Opts["kubernetes.io/mounterArgs.FsGroup"]; ok {
-		args = append(args, "-o", "gid="+options.FSGroupNew)
-		args = append(args, "-o", "uid="+options.FSGroupNew)
+	if gid != "" {
+		args = append(args, "-o", "gid="+gid)
+	}
+	if uid != "" {
+		args = append(args, "-o", "uid="+uid)
+	}
+	if umask != "" {
+		args = append(args, "-o", "umask="+umask)
 	}
 
-	// Check if AccessMode is ReadOnlyMany
-	if options.AccessMode == "ReadOnlyMany" {
+	// Check if AccessMode is ReadOnlyMany, a point-in-time view is read-only too
+	readOnly := options.AccessMode == "ReadOnlyMany" || options.AsOf != ""
+	if readOnly {
 		args = append(args, "-o", "ro")
 	}
 
@@ -643,6 +854,16 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 		args = append(args, "-o", "kernel_cache")
 	}
 
+	if options.UseCache {
+		cacheArgs, err := p.setUpCache(mountPath, options)
+		if err != nil {
+			p.Logger.Error(podUID+":"+" cannot set up cache",
+				zap.Error(err))
+			return fmt.Errorf("cannot set up cache: %v", err)
+		}
+		args = append(args, cacheArgs...)
+	}
+
 	if apiKey != "" {
 		args = append(args, "-o", "ibm_iam_auth")
 		args = append(args, "-o", "ibm_iam_endpoint="+iamEndpoint)
@@ -650,6 +871,10 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 		args = append(args, "-o", "default_acl=private")
 	}
 
+	if sseCKeysFile != "" {
+		args = append(args, "-o", "use_sse=custom:"+sseCKeysFile)
+	}
+
 	if options.ConnectTimeoutSeconds != "" {
 		args = append(args, "-o", "connect_timeout="+options.ConnectTimeoutSeconds)
 	}
@@ -688,13 +913,42 @@ func (p *S3fsPlugin) mountInternal(mountRequest interfaces.FlexVolumeMountReques
 	}
 	p.Logger.Info(podUID+":S3FS-Driver info:", zap.String("Version", buildVersion))
 
-	out, err := command("s3fs", args...).CombinedOutput()
+	// the encryption of an empty volume is initialized in the bucket, before
+	// s3fs caches the absence of its configuration
+	if passphrase != "" && !readOnly {
+		sess := p.Backend.NewObjectStorageSession(endptValue, regionValue, creds, p.Logger)
+		if err = p.initEncryption(sess, options.Bucket, options.ObjectPath, passphrase); err != nil {
+			p.Logger.Error(podUID+":"+"Initializing client-side encryption",
+				zap.Error(err))
+			return fmt.Errorf("client-side encryption failed: %v", err)
+		}
+	}
+
+	// the OOM kills of s3fs are reported on the pod
+	if limits.isSet() {
+		p.recordPod(mountPath, mountRequest.MountDir, options)
+	}
+	out, err := p.runS3fs(mountPath, mountRequest.MountDir, args, limits)
 	if err != nil {
+		if len(out) == 0 {
+			out = []byte(err.Error())
+		}
+		if msg := oomMessage(mountPath); msg != "" {
+			out = append(out, []byte(": "+msg)...)
+		}
 		p.Logger.Error(podUID+":"+"Running s3fs",
 			zap.String("Error", string(out)))
 		return fmt.Errorf("s3fs mount failed: %s", string(out))
 	}
 
+	if s3fsDir != mountRequest.MountDir {
+		if err = p.mountEncryption(s3fsDir, mountRequest.MountDir, passphrase, readOnly); err != nil {
+			p.Logger.Error(podUID+":"+"Running gocryptfs",
+				zap.Error(err))
+			return fmt.Errorf("client-side encryption failed: %v", err)
+		}
+	}
+
 	fInfo, err = os.Lstat(mountRequest.MountDir)
 	if err == nil {
 		p.Logger.Info(podUID+":"+"Target directory after-mount: ",
@@ -738,7 +992,7 @@ func (p *S3fsPlugin) Unmount(unmountRequest interfaces.FlexVolumeUnmountRequest)
 	p.Logger.Info(podUID + ":" + "S3fsPlugin-Unmount()-start")
 	defer p.Logger.Info(podUID + ":" + "S3fsPlugin-Unmount()-end")
 
-	err := p.unmountInternal(unmountRequest)
+	warning, err := p.unmountInternal(unmountRequest)
 	if err != nil {
 		p.Logger.Info(podUID+":"+"Error unmounting volume",
 			zap.Reflect("err", err))
@@ -752,29 +1006,85 @@ func (p *S3fsPlugin) Unmount(unmountRequest interfaces.FlexVolumeUnmountRequest)
 	p.Logger.Info(podUID+":"+"Successfully executed unmount",
 		zap.String("mountRequest.MountDir", unmountRequest.MountDir))
 
+	if warning != "" {
+		return interfaces.FlexVolumeResponse{
+			Status:  interfaces.StatusSuccess,
+			Message: "Volume unmounted: " + warning,
+		}
+	}
 	return interfaces.FlexVolumeResponse{
 		Status:  interfaces.StatusSuccess,
 		Message: "Volume unmounted successfully",
 	}
 }
 
-// Unmount methods unmounts the volume/ fileset from the pod
-func (p *S3fsPlugin) unmountInternal(unmountRequest interfaces.FlexVolumeUnmountRequest) error {
-	err := p.unmountPath(unmountRequest.MountDir, false)
+// Unmount methods unmounts the volume/ fileset from the pod.
+// It returns a warning when data may have been lost.
+func (p *S3fsPlugin) unmountInternal(unmountRequest interfaces.FlexVolumeUnmountRequest) (string, error) {
+	mountPath := path.Join(dataRootPath, fmt.Sprintf("%x", sha256.Sum256([]byte(unmountRequest.MountDir))))
+
+	// the OOM kills are counted while the cgroup is there, systemd deletes
+	// the cgroup of the service once s3fs exits
+	oom := oomMessage(mountPath)
+
+	// the encryption layer goes first, flushing its files to s3fs
+	s3fsDir := unmountRequest.MountDir
+	if cipherDir := encryptedMount(mountPath); cipherDir != "" {
+		if err := p.unmountEncryption(unmountRequest.MountDir); err != nil {
+			p.Logger.Error(podUID+":"+"cannot unmount encrypted mount point",
+				zap.String("Request", unmountRequest.MountDir),
+				zap.Error(err))
+			return "", fmt.Errorf("cannot unmount encrypted mount point %s: %v", unmountRequest.MountDir, err)
+		}
+		s3fsDir = cipherDir
+	}
+
+	warning, err := p.unmountS3fs(s3fsDir)
 	if err != nil {
 		p.Logger.Error(podUID+":"+"cannot unmount s3fs mount point",
-			zap.String("Request", unmountRequest.MountDir),
+			zap.String("Request", s3fsDir),
 			zap.Error(err))
-		return fmt.Errorf("cannot unmount s3fs mount point %s: %v", unmountRequest.MountDir, err)
+		return "", fmt.Errorf("cannot unmount s3fs mount point %s: %v", s3fsDir, err)
 	}
 
-	mountPath := path.Join(dataRootPath, fmt.Sprintf("%x", sha256.Sum256([]byte(unmountRequest.MountDir))))
+	if oom != "" {
+		p.Logger.Error(podUID+":"+"s3fs was killed by the OOM killer",
+			zap.String("mountpath", mountPath), zap.String("message", oom))
+		p.podEvent(mountPath, v1.EventTypeWarning, oomKilledReason, oom)
+		if warning != "" {
+			warning += ", "
+		}
+		warning += oom
+	}
+	// systemd must not restart s3fs on a mount point no longer in use, an
+	// s3fs still uploading is left to finish as without the supervisor
+	p.releaseS3fs(mountPath)
+	// the cgroup of an s3fs still uploading is left behind
+	if err = removeCgroup(mountPath); err != nil {
+		p.Logger.Warn(podUID+":"+"cannot delete s3fs cgroup",
+			zap.String("mountpath", mountPath), zap.Error(err))
+	}
+	// deleting the data path would delete the objects of the volume through
+	// s3fs still mounted in it
+	if s3fsDir != unmountRequest.MountDir && p.cipherMounted(s3fsDir) {
+		p.Logger.Error(podUID+":"+"s3fs still mounted under the encryption layer, keeping its data path",
+			zap.String("path", s3fsDir))
+		return warning, fmt.Errorf("s3fs is still mounted on %s, not deleting %s", s3fsDir, mountPath)
+	}
 	err = p.unmountPath(mountPath, true)
 	if err != nil {
 		p.Logger.Error(podUID+":"+"cannot delete data  mount point",
 			zap.String("mountpath", mountPath), zap.Error(err))
-		return fmt.Errorf("cannot delete data mount point %s: %v", mountPath, err)
+		return warning, fmt.Errorf("cannot delete data mount point %s: %v", mountPath, err)
 	}
 
-	return nil
+	// the cache is deleted whether or not the volume used one
+	err = p.removeCache(mountPath)
+	if err != nil {
+		p.Logger.Error(podUID+":"+"cannot delete cache",
+			zap.String("mountpath", mountPath), zap.Error(err))
+		return warning, fmt.Errorf("cannot delete cache of %s: %v", mountPath, err)
+	}
+
+	return warning, nil
 }
@@ -11,21 +11,27 @@
 package driver
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/IBM/ibmcloud-object-storage-plugin/driver/interfaces"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/parser"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
 	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 const (
@@ -39,6 +45,10 @@ const (
 	optionOSEndpoint              = "object-store-endpoint"
 	optionOSStorageClass          = "object-store-storage-class"
 	optionIAMEndpoint             = "iam-endpoint"
+	optionOSRegion                = "object-store-region"
+	optionOSNetwork               = "object-store-network"
+	optionSSECKey                 = "kubernetes.io/secret/sse-c-key"
+	optionSSECOldKeys             = "kubernetes.io/secret/sse-c-old-keys"
 	optionAccessKey               = "kubernetes.io/secret/access-key"
 	optionSecretKey               = "kubernetes.io/secret/secret-key"
 	optionAPIKey                  = "kubernetes.io/secret/api-key"
@@ -105,6 +115,10 @@ func getPlugin() *S3fsPlugin {
 	removeAll = removeAllSuccess
 	unmount = unmountSuccess
 	writeFile = writeFileSuccess
+	statfs = statfsFreeMB(10240)
+	readDir = os.ReadDir
+	readFile = os.ReadFile
+	findS3fsProcess = func(string) (int, error) { return 0, nil }
 	commandArgs = nil
 	command = func(cmd string, args ...string) *exec.Cmd {
 		commandArgs = args
@@ -126,6 +140,25 @@ func getPlugin() *S3fsPlugin {
 	}
 }
 
+// getRecordingPlugin returns a plugin recording the commands it runs as
+// "cmd args..." in commands, failing the commands named in failing
+func getRecordingPlugin(commands *[]string, failing ...string) *S3fsPlugin {
+	p := getPlugin()
+	command = func(cmd string, args ...string) *exec.Cmd {
+		*commands = append(*commands, cmd+" "+strings.Join(args, " "))
+		commandArgs = args
+		ret := exec.Command(os.Args[0], "-test.run=TestHelperProcess", "--", commandOutput)
+		ret.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		for _, f := range failing {
+			if f == cmd {
+				ret.Stdout = io.Discard
+			}
+		}
+		return ret
+	}
+	return p
+}
+
 func TestHelperProcess(t *testing.T) {
 	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
 		return
@@ -288,6 +321,30 @@ func Test_Mount_FailBucketAccess(t *testing.T) {
 	}
 }
 
+func Test_Mount_FailBucketAccess_Classified(t *testing.T) {
+	tests := []struct {
+		kind error
+		msg  string
+	}{
+		{backend.ErrBucketNotFound, "does not exist"},
+		{backend.ErrBadCredentials, "are invalid"},
+		{backend.ErrAccessDenied, "are not authorized"},
+	}
+	for _, tt := range tests {
+		p := &S3fsPlugin{
+			Backend: &fake.ObjectStorageSessionFactory{CheckBucketAccessErr: &backend.Error{Kind: tt.kind, Err: errors.New("")}},
+			Logger:  zap.NewNop(),
+		}
+		r := getMountRequest()
+
+		resp := p.Mount(r)
+		if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+			assert.Contains(t, resp.Message, "cannot access bucket")
+			assert.Contains(t, resp.Message, tt.msg)
+		}
+	}
+}
+
 func Test_Mount_CheckObjectPath_Error(t *testing.T) {
 	p := &S3fsPlugin{
 		Backend: &fake.ObjectStorageSessionFactory{CheckObjectPathExistenceError: true},
@@ -722,6 +779,17 @@ func Test_Mount_fsGroup_Nogroup_Positive(t *testing.T) {
 	}
 }
 
+func Test_Mount_AsOf_ReadOnly(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts["as-of"] = "2025-01-01T00:00:00Z"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, strings.Join(commandArgs, " "), "-o ro")
+	}
+}
+
 func Test_Mount_ReadOnly_Positive(t *testing.T) {
 	p := getPlugin()
 	r := getMountRequest()
@@ -889,6 +957,248 @@ func Test_Mount_IAM_Positive_DefaultIAMEndpoint(t *testing.T) {
 	}
 }
 
+func Test_Mount_IAM_Positive_RegionEndpoints(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts[optionAPIKey] = base64.StdEncoding.EncodeToString([]byte(testAPIKey))
+	r.Opts[optionOSEndpoint] = ""
+	r.Opts[optionIAMEndpoint] = ""
+	r.Opts[optionOSRegion] = "eu-de"
+	r.Opts[optionOSNetwork] = "direct"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "url=https://s3.direct.eu-de.cloud-object-storage.appdomain.cloud")
+		assert.Contains(t, commandArgs, "ibm_iam_endpoint=https://private.iam.cloud.ibm.com")
+	}
+}
+
+func Test_Mount_RegionEndpoints_ExplicitEndpoint(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts[optionOSRegion] = "eu-de"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "url="+testOSEndpoint)
+	}
+}
+
+func Test_Mount_RegionEndpoints_UnknownRegion(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts[optionOSEndpoint] = ""
+	r.Opts[optionOSRegion] = "eu-dee"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "cannot resolve endpoints of object-store-region")
+	}
+}
+
+func getSSECKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, sseCKeySize))
+}
+
+func Test_Mount_SSECKeys(t *testing.T) {
+	p := getPlugin()
+	var files = map[string]string{}
+	writeFile = func(name string, data []byte, perm os.FileMode) error {
+		files[path.Base(name)] = string(data)
+		assert.Equal(t, os.FileMode(0600), perm)
+		return nil
+	}
+	r := getMountRequest()
+	r.Opts[optionSSECKey] = base64.StdEncoding.EncodeToString([]byte(getSSECKey(1)))
+	r.Opts[optionSSECOldKeys] = base64.StdEncoding.EncodeToString([]byte(getSSECKey(2) + "\n\n" + getSSECKey(3) + "\n"))
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Equal(t, getSSECKey(1)+"\n"+getSSECKey(2)+"\n"+getSSECKey(3)+"\n", files[sseCKeysFileName])
+		keysFile := path.Join(dataRootPath, fmt.Sprintf("%x", sha256.Sum256([]byte(testDir))), sseCKeysFileName)
+		assert.Contains(t, commandArgs, "use_sse=custom:"+keysFile)
+	}
+}
+
+func Test_Mount_SSECKeys_BadKey(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts[optionSSECKey] = base64.StdEncoding.EncodeToString([]byte("short-key"))
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "bad SSE-C keys: sse-c-key must be a base64 encoded 32 bytes key")
+	}
+}
+
+func Test_Mount_SSECKeys_BadOldKey(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts[optionSSECKey] = base64.StdEncoding.EncodeToString([]byte(getSSECKey(1)))
+	r.Opts[optionSSECOldKeys] = base64.StdEncoding.EncodeToString([]byte(getSSECKey(2) + "\nshort-key"))
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "sse-c-old-keys line 2 must be a base64 encoded 32 bytes key")
+	}
+}
+
+func Test_Mount_SSECKeys_OldKeysOnly(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts[optionSSECOldKeys] = base64.StdEncoding.EncodeToString([]byte(getSSECKey(2)))
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "sse-c-old-keys requires sse-c-key")
+	}
+}
+
+func Test_Mount_SSECKeys_FailedToWriteKeyFile(t *testing.T) {
+	p := getPlugin()
+	writeFile = func(name string, data []byte, perm os.FileMode) error {
+		if path.Base(name) == sseCKeysFileName {
+			return errors.New("")
+		}
+		return nil
+	}
+	r := getMountRequest()
+	r.Opts[optionSSECKey] = base64.StdEncoding.EncodeToString([]byte(getSSECKey(1)))
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "cannot create SSE-C key file")
+	}
+}
+
+func getCacheMountRequest(sizeMB string) interfaces.FlexVolumeMountRequest {
+	r := getMountRequest()
+	r.Opts["use-cache"] = "true"
+	r.Opts["cache-size-mb"] = sizeMB
+	return r
+}
+
+// statfsFreeMB reports freeMB megabytes available on the cache filesystem
+func statfsFreeMB(freeMB uint64) func(string, *syscall.Statfs_t) error {
+	return func(_ string, st *syscall.Statfs_t) error {
+		st.Bsize = 1 << 20
+		st.Bavail = freeMB
+		return nil
+	}
+}
+
+// readCacheSizes reports the cache size reserved by other mounts of the node
+func readCacheSizes(sizesMB ...string) {
+	readDir = func(string) ([]os.DirEntry, error) {
+		var entries []os.DirEntry
+		for i := range sizesMB {
+			entries = append(entries, fs.FileInfoToDirEntry(fakeDirInfo(strconv.Itoa(i))))
+		}
+		return entries, nil
+	}
+	readFile = func(name string) ([]byte, error) {
+		if path.Base(name) != cacheSizeFileName {
+			return nil, os.ErrNotExist
+		}
+		i, _ := strconv.Atoi(path.Base(path.Dir(name)))
+		return []byte(sizesMB[i]), nil
+	}
+}
+
+type fakeDirInfo string
+
+func (f fakeDirInfo) Name() string       { return string(f) }
+func (f fakeDirInfo) Size() int64        { return 0 }
+func (f fakeDirInfo) Mode() fs.FileMode  { return fs.ModeDir }
+func (f fakeDirInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeDirInfo) IsDir() bool        { return true }
+func (f fakeDirInfo) Sys() interface{}   { return nil }
+
+func Test_Mount_Cache(t *testing.T) {
+	p := getPlugin()
+	p.Cache = CacheConfig{MinDiskFreeMB: 1024}
+	var files = map[string]string{}
+	writeFile = func(name string, data []byte, perm os.FileMode) error {
+		files[path.Base(name)] = string(data)
+		return nil
+	}
+
+	resp := p.Mount(getCacheMountRequest("2048"))
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		dir := path.Join(dataRootPath, cacheDirectoryName, fmt.Sprintf("%x", sha256.Sum256([]byte(testDir))))
+		assert.Contains(t, commandArgs, "use_cache="+dir)
+		assert.Contains(t, commandArgs, "del_cache")
+		assert.Contains(t, commandArgs, "ensure_diskfree=8192")
+		assert.Equal(t, "2048", files[cacheSizeFileName])
+	}
+}
+
+func Test_Mount_Cache_MinDiskFree(t *testing.T) {
+	p := getPlugin()
+	p.Cache = CacheConfig{Root: "/mnt/cache", MinDiskFreeMB: 1024}
+	statfs = statfsFreeMB(2048)
+
+	resp := p.Mount(getCacheMountRequest("2048"))
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "use_cache=/mnt/cache/"+fmt.Sprintf("%x", sha256.Sum256([]byte(testDir))))
+		assert.Contains(t, commandArgs, "ensure_diskfree=1024")
+	}
+}
+
+func Test_Mount_Cache_NodeBudgetExhausted(t *testing.T) {
+	p := getPlugin()
+	p.Cache = CacheConfig{MaxTotalMB: 4096}
+	readCacheSizes("2048", "1024")
+
+	resp := p.Mount(getCacheMountRequest("2048"))
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		for _, arg := range commandArgs {
+			assert.False(t, strings.HasPrefix(arg, "use_cache="))
+		}
+	}
+}
+
+func Test_Mount_Cache_WithinNodeBudget(t *testing.T) {
+	p := getPlugin()
+	p.Cache = CacheConfig{MaxTotalMB: 4096}
+	readCacheSizes("2048")
+
+	resp := p.Mount(getCacheMountRequest("2048"))
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "del_cache")
+	}
+}
+
+func Test_Mount_Cache_FailedToCreateDir(t *testing.T) {
+	p := getPlugin()
+	mkdirAll = func(name string, perm os.FileMode) error {
+		if path.Dir(name) == path.Join(dataRootPath, cacheDirectoryName) {
+			return errors.New("")
+		}
+		return nil
+	}
+
+	resp := p.Mount(getCacheMountRequest("2048"))
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "cannot set up cache: cannot create cache directory")
+	}
+}
+
+func Test_Unmount_RemovesCache(t *testing.T) {
+	p := getPlugin()
+	p.Cache = CacheConfig{Root: "/mnt/cache"}
+	var removed []string
+	removeAll = func(name string) error {
+		removed = append(removed, name)
+		return nil
+	}
+
+	resp := p.Unmount(getUnmountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, removed, "/mnt/cache/"+fmt.Sprintf("%x", sha256.Sum256([]byte(testDir))))
+	}
+}
+
 /* TODO: Need to relook
 this test is failing only in travis.
 func Test_Unmount_UnmountS3fsError(t *testing.T) {
@@ -0,0 +1,175 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/parser"
+	"go.uber.org/zap"
+)
+
+const (
+	// cipherDirName is the directory of the mount data path s3fs is mounted
+	// on when the volume is encrypted client side
+	cipherDirName = "cipher"
+	// encryptionFileName records in the mount data path the s3fs mount point
+	// under the encryption layer
+	encryptionFileName = "encryption"
+	// gocryptfsConfigName is the gocryptfs configuration stored at the root of
+	// an encrypted volume, holding its master key wrapped by the passphrase
+	gocryptfsConfigName = "gocryptfs.conf"
+	// gocryptfsDirIVName is the file holding the IV of the encrypted names of
+	// the files at the root of an encrypted volume
+	gocryptfsDirIVName = "gocryptfs.diriv"
+)
+
+// parseEncryptionKey decodes the passphrase of the client-side encryption of
+// a volume, empty if the volume is not encrypted
+func parseEncryptionKey(options Options) (string, error) {
+	if !options.ClientSideEncryption {
+		return "", nil
+	}
+	if options.EncryptionKeyB64 == "" {
+		return "", fmt.Errorf("client-side-encryption requires %s in the secret", SecretEncryptionKey)
+	}
+	key, err := parser.DecodeBase64(options.EncryptionKeyB64)
+	if err != nil {
+		return "", fmt.Errorf("cannot decode %s: %v", SecretEncryptionKey, err)
+	}
+	// gocryptfs reads a single line on its standard input
+	key = strings.TrimRight(key, "\r\n")
+	if key == "" || strings.ContainsAny(key, "\r\n") {
+		return "", fmt.Errorf("%s must be a non-empty single line", SecretEncryptionKey)
+	}
+	return key, nil
+}
+
+// gocryptfs runs gocryptfs with args, passing it the passphrase on its
+// standard input so that it never shows in a command line or a file
+func gocryptfs(passphrase string, args ...string) error {
+	cmd := command("gocryptfs", args...)
+	cmd.Stdin = strings.NewReader(passphrase + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(out) == 0 {
+			out = []byte(err.Error())
+		}
+		return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// initEncryption initializes the client-side encryption of a volume holding
+// no object yet. gocryptfs writes its configuration in a local directory,
+// whose files are then created in the bucket unless another mount created
+// them meanwhile, so that the master key of a volume is never replaced. The
+// configuration of a volume holding objects is checked once it is mounted.
+func (p *S3fsPlugin) initEncryption(sess backend.ObjectStorageSession, bucket, objectPath, passphrase string) error {
+	ctx := context.Background()
+	usage, err := sess.GetObjectPathUsageWithContext(ctx, bucket, objectPath, 1)
+	if err != nil {
+		return fmt.Errorf("cannot list the objects of the volume: %v", err)
+	}
+	if usage.ObjectCount > 0 {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "ibmc-s3fs-gocryptfs-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	p.Logger.Info(podUID+":"+"Initializing client-side encryption",
+		zap.String("bucket", bucket), zap.String("object-path", objectPath))
+	if err := gocryptfs(passphrase, "-init", "-q", "--", dir); err != nil {
+		return fmt.Errorf("cannot initialize encryption: %v", err)
+	}
+
+	prefix := strings.Trim(objectPath, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	// the configuration goes last, a volume holding it being initialized
+	for _, name := range []string{gocryptfsDirIVName, gocryptfsConfigName} {
+		data, err := readFile(path.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %v", name, err)
+		}
+		created, err := sess.CreateObjectWithContext(ctx, bucket, prefix+name, data)
+		if err != nil {
+			return fmt.Errorf("cannot write %s: %v", name, err)
+		}
+		if !created {
+			p.Logger.Info(podUID+":"+"Encryption initialized by another mount",
+				zap.String("file", prefix+name))
+		}
+	}
+	return nil
+}
+
+// mountEncryption mounts on mountDir the decrypted view of cipherDir, the s3fs
+// mount point of the volume, whose encryption is initialized
+func (p *S3fsPlugin) mountEncryption(cipherDir, mountDir, passphrase string, readOnly bool) error {
+	if _, err := stat(path.Join(cipherDir, gocryptfsConfigName)); os.IsNotExist(err) {
+		return fmt.Errorf("the volume is not encrypted, %s not found", gocryptfsConfigName)
+	} else if err != nil {
+		return fmt.Errorf("cannot stat %s: %v", gocryptfsConfigName, err)
+	}
+
+	args := []string{"-q", "-allow_other"}
+	if readOnly {
+		args = append(args, "-ro")
+	}
+	args = append(args, "--", cipherDir, mountDir)
+	p.Logger.Info(podUID+":"+"Running gocryptfs",
+		zap.Reflect("args", args))
+	return gocryptfs(passphrase, args...)
+}
+
+// encryptedMount returns the s3fs mount point under the encryption layer of
+// the mount whose data path is mountPath, empty if the volume is not encrypted
+func encryptedMount(mountPath string) string {
+	data, err := readFile(path.Join(mountPath, encryptionFileName))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// cipherMounted reports whether s3fs may still be mounted on cipherDir, the
+// mount point under the encryption layer inside the data path of a mount
+func (p *S3fsPlugin) cipherMounted(cipherDir string) bool {
+	if _, err := stat(cipherDir); os.IsNotExist(err) {
+		return false
+	}
+	mounted, err := p.isMountpoint(cipherDir)
+	return mounted || err != nil
+}
+
+// unmountEncryption unmounts the encryption layer mounted on mountDir once
+// its files are written through to s3fs. The mount is detached if it is busy.
+func (p *S3fsPlugin) unmountEncryption(mountDir string) error {
+	if err := syncMount(mountDir); err != nil {
+		p.Logger.Warn(podUID+":"+"cannot sync encrypted mount point",
+			zap.String("Mount path", mountDir), zap.Error(err))
+	}
+	if err := unmount(mountDir, 0); err != nil {
+		p.Logger.Info(podUID+":"+"cannot unmount encrypted mount point, detaching it",
+			zap.String("Mount path", mountDir), zap.Error(err))
+	}
+	return p.unmountPath(mountDir, false)
+}
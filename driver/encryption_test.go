@@ -0,0 +1,333 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/driver/interfaces"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	optionClientSideEncryption = "client-side-encryption"
+	optionEncryptionKey        = "kubernetes.io/secret/encryption-key"
+	testPassphrase             = "correct horse battery staple"
+)
+
+var testCipherDir = path.Join(testMountPath, cipherDirName)
+
+// getEncryptionPlugin returns a plugin recording the commands it runs as
+// "cmd args..." and the written files, failing the commands named in failing.
+// Its volume holds objects, its encryption being initialized.
+func getEncryptionPlugin(commands *[]string, written map[string]string, failing ...string) *S3fsPlugin {
+	p := getRecordingPlugin(commands, failing...)
+	p.Backend = &fake.ObjectStorageSessionFactory{ObjectPathUsage: &backend.Usage{ObjectCount: 2}}
+	commandOutput = "... is not a mountpoint"
+	writeFile = func(name string, data []byte, _ os.FileMode) error {
+		written[name] = string(data)
+		return nil
+	}
+	return p
+}
+
+// mountCipherDir makes mountpoint report s3fs still mounted under the
+// encryption layer
+func mountCipherDir() {
+	record := command
+	command = func(cmd string, args ...string) *exec.Cmd {
+		output := commandOutput
+		defer func() { commandOutput = output }()
+		if cmd == "mountpoint" && args[0] == testCipherDir {
+			commandOutput = testCipherDir + " is a mountpoint"
+		}
+		return record(cmd, args...)
+	}
+}
+
+func getEncryptedMountRequest() interfaces.FlexVolumeMountRequest {
+	r := getMountRequest()
+	r.Opts[optionClientSideEncryption] = "true"
+	r.Opts[optionEncryptionKey] = base64.StdEncoding.EncodeToString([]byte(testPassphrase + "\n"))
+	return r
+}
+
+func Test_Mount_Encryption(t *testing.T) {
+	var commands []string
+	written := map[string]string{}
+	p := getEncryptionPlugin(&commands, written)
+
+	resp := p.Mount(getEncryptedMountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		// s3fs is mounted in the data path, under the encryption layer
+		assert.True(t, strings.HasPrefix(commands[len(commands)-2], "s3fs "+testBucket+" "+testCipherDir+" -o "), commands[len(commands)-2])
+		assert.Contains(t, commands[len(commands)-2], "instance_name="+testDir)
+		assert.Equal(t, "gocryptfs -q -allow_other -- "+testCipherDir+" "+testDir, commands[len(commands)-1])
+		assert.Equal(t, testCipherDir, written[path.Join(testMountPath, encryptionFileName)])
+	}
+	// the passphrase is only given on the standard input of gocryptfs
+	for _, c := range commands {
+		assert.NotContains(t, c, testPassphrase)
+	}
+	for _, data := range written {
+		assert.NotContains(t, data, testPassphrase)
+	}
+}
+
+// initializeEmptyVolume makes the volume of p empty and the files written by
+// gocryptfs -init readable, returning the fake backend of p
+func initializeEmptyVolume(p *S3fsPlugin) *fake.ObjectStorageSessionFactory {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p.Backend = factory
+	readFile = func(name string) ([]byte, error) {
+		switch path.Base(name) {
+		case gocryptfsConfigName, gocryptfsDirIVName:
+			return []byte("new " + path.Base(name)), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	return factory
+}
+
+func Test_Mount_Encryption_Init(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	factory := initializeEmptyVolume(p)
+
+	resp := p.Mount(getEncryptedMountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		// gocryptfs initializes a local directory, never the mounted volume
+		assert.True(t, strings.HasPrefix(commands[len(commands)-3], "gocryptfs -init -q -- "+os.TempDir()), commands[len(commands)-3])
+		assert.True(t, strings.HasPrefix(commands[len(commands)-2], "s3fs "), commands[len(commands)-2])
+		assert.Equal(t, "gocryptfs -q -allow_other -- "+testCipherDir+" "+testDir, commands[len(commands)-1])
+	}
+	assert.Equal(t, map[string][]byte{
+		testBucket + "/" + gocryptfsConfigName: []byte("new " + gocryptfsConfigName),
+		testBucket + "/" + gocryptfsDirIVName:  []byte("new " + gocryptfsDirIVName),
+	}, factory.Objects)
+	assert.Equal(t, testBucket+":", factory.LastMeasuredObjectPath)
+}
+
+func Test_Mount_Encryption_InitObjectPath(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	factory := initializeEmptyVolume(p)
+	r := getEncryptedMountRequest()
+	r.Opts["object-path"] = "/ns/pvc/"
+
+	resp := p.Mount(r)
+	assert.Equal(t, interfaces.StatusSuccess, resp.Status)
+	assert.Contains(t, factory.Objects, testBucket+"/ns/pvc/"+gocryptfsConfigName)
+	assert.Contains(t, factory.Objects, testBucket+"/ns/pvc/"+gocryptfsDirIVName)
+}
+
+func Test_Mount_Encryption_InitRace(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	factory := initializeEmptyVolume(p)
+	// another mount initialized the volume meanwhile
+	factory.Objects = map[string][]byte{testBucket + "/" + gocryptfsConfigName: []byte("other")}
+
+	resp := p.Mount(getEncryptedMountRequest())
+	assert.Equal(t, interfaces.StatusSuccess, resp.Status)
+	assert.Equal(t, "other", string(factory.Objects[testBucket+"/"+gocryptfsConfigName]))
+}
+
+func Test_Mount_Encryption_InitError(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	factory := initializeEmptyVolume(p)
+	factory.CreateObjectErr = errors.New("access denied")
+
+	resp := p.Mount(getEncryptedMountRequest())
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "client-side encryption failed: cannot write "+gocryptfsDirIVName)
+	}
+	// s3fs is not mounted
+	for _, c := range commands {
+		assert.False(t, strings.HasPrefix(c, "s3fs "+testBucket), c)
+	}
+}
+
+func Test_Mount_Encryption_NotEncrypted(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	stat = func(name string) (os.FileInfo, error) {
+		if name == path.Join(testCipherDir, gocryptfsConfigName) {
+			return nil, os.ErrNotExist
+		}
+		return nil, nil
+	}
+
+	resp := p.Mount(getEncryptedMountRequest())
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "client-side encryption failed: the volume is not encrypted")
+	}
+	// a volume holding files is never initialized
+	for _, c := range commands {
+		assert.False(t, strings.HasPrefix(c, "gocryptfs"), c)
+	}
+}
+
+func Test_Mount_Encryption_ReadOnlyNotInitialized(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	stat = statErrNotExist
+	r := getEncryptedMountRequest()
+	r.Opts["access-mode"] = "ReadOnlyMany"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "client-side encryption failed: the volume is not encrypted")
+	}
+	for _, c := range commands {
+		assert.False(t, strings.HasPrefix(c, "gocryptfs"), c)
+	}
+}
+
+func Test_Mount_Encryption_ReadOnly(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	r := getEncryptedMountRequest()
+	r.Opts["access-mode"] = "ReadOnlyMany"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Equal(t, "gocryptfs -q -allow_other -ro -- "+testCipherDir+" "+testDir, commands[len(commands)-1])
+	}
+}
+
+func Test_Mount_Encryption_GocryptfsError(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{}, "gocryptfs")
+
+	resp := p.Mount(getEncryptedMountRequest())
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "client-side encryption failed")
+	}
+}
+
+func Test_Mount_Encryption_MissingKey(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	r := getEncryptedMountRequest()
+	delete(r.Opts, optionEncryptionKey)
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "bad encryption key: client-side-encryption requires encryption-key in the secret")
+	}
+}
+
+func Test_Mount_Encryption_MultilineKey(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	r := getEncryptedMountRequest()
+	r.Opts[optionEncryptionKey] = base64.StdEncoding.EncodeToString([]byte("line1\nline2"))
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "encryption-key must be a non-empty single line")
+	}
+}
+
+func Test_Unmount_Encryption(t *testing.T) {
+	p, _ := getGracefulUnmountPlugin(0)
+	readFile = func(name string) ([]byte, error) {
+		if name == path.Join(testMountPath, encryptionFileName) {
+			return []byte(testCipherDir), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	var synced, unmounted []string
+	syncMount = func(dir string) error {
+		synced = append(synced, dir)
+		return nil
+	}
+	unmount = func(target string, _ int) error {
+		unmounted = append(unmounted, target)
+		return nil
+	}
+	s3fsDir := ""
+	findS3fsProcess = func(dir string) (int, error) {
+		s3fsDir = dir
+		return testS3fsPID, nil
+	}
+
+	resp := p.Unmount(getUnmountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Equal(t, "Volume unmounted successfully", resp.Message)
+	}
+	// the encryption layer is flushed and unmounted before s3fs
+	assert.Equal(t, []string{testDir, testCipherDir}, synced)
+	assert.Equal(t, []string{testDir, testCipherDir}, unmounted)
+	assert.Equal(t, testCipherDir, s3fsDir)
+}
+
+func Test_Unmount_Encryption_CipherStillMounted(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	readFile = func(name string) ([]byte, error) {
+		if name == path.Join(testMountPath, encryptionFileName) {
+			return []byte(testCipherDir), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	mountCipherDir()
+
+	resp := p.Unmount(getUnmountRequest())
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "s3fs is still mounted on "+testCipherDir+", not deleting "+testMountPath)
+	}
+}
+
+func Test_Mount_Encryption_FailureCipherStillMounted(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{}, "gocryptfs")
+	p.Supervisor = SupervisorSystemd
+	mountCipherDir()
+
+	resp := p.Mount(getEncryptedMountRequest())
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "client-side encryption failed")
+	}
+	// the data path holding s3fs is left alone
+	assert.Contains(t, commands, "mountpoint "+testCipherDir)
+	assert.NotContains(t, commands, "systemctl stop "+testUnit)
+}
+
+func Test_Mount_Encryption_StaleCipherMount(t *testing.T) {
+	var commands []string
+	p := getEncryptionPlugin(&commands, map[string]string{})
+	readFile = func(name string) ([]byte, error) {
+		if name == path.Join(testMountPath, encryptionFileName) {
+			return []byte(testCipherDir), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	mountCipherDir()
+
+	resp := p.Mount(getEncryptedMountRequest())
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "s3fs is still mounted on "+testCipherDir+", not deleting "+testMountPath)
+	}
+	for _, c := range commands {
+		assert.False(t, strings.HasPrefix(c, "s3fs "+testBucket), c)
+	}
+}
@@ -0,0 +1,133 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// podFileName records in the mount data path the pod mounting the volume
+	podFileName = "pod"
+	// eventComponent is the source of the events recorded by the driver
+	eventComponent = "ibmc-s3fs-driver"
+	// oomKilledReason is the reason of the events reporting OOM kills of s3fs
+	oomKilledReason = "S3fsOOMKilled"
+	// eventTimeout bounds the recording of an event
+	eventTimeout = 10 * time.Second
+)
+
+// mountedPod is the pod mounting a volume, recorded in its data path
+type mountedPod struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+	// Volume is the mount directory of the volume in the pod
+	Volume string `json:"volume"`
+}
+
+// EventRecorder records events on the pods mounting volumes
+type EventRecorder interface {
+	Event(pod *v1.ObjectReference, eventType, reason, message string) error
+}
+
+// KubeEventRecorder creates events with the Kubernetes API. The driver runs
+// for a single request, the events are created synchronously rather than
+// through a broadcaster.
+type KubeEventRecorder struct {
+	Client kubernetes.Interface
+	// Host is the node reported as the source of the events
+	Host string
+}
+
+// Event creates an event on pod
+func (r *KubeEventRecorder) Event(pod *v1.ObjectReference, eventType, reason, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	now := metav1.Now()
+	_, err := r.Client.CoreV1().Events(pod.Namespace).Create(ctx, &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pod.Name + ".",
+			Namespace:    pod.Namespace,
+		},
+		InvolvedObject: *pod,
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         v1.EventSource{Component: eventComponent, Host: r.Host},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// recordPod records in the data path of a mount the pod mounting it, for
+// the events reported once the mount request returned
+func (p *S3fsPlugin) recordPod(mountPath, mountDir string, options Options) {
+	if p.Events == nil || options.PodName == "" {
+		return
+	}
+	data, err := json.Marshal(mountedPod{
+		Namespace: options.PodNamespace,
+		Name:      options.PodName,
+		UID:       types.UID(podUID),
+		Volume:    mountDir,
+	})
+	if err == nil {
+		err = writeFile(path.Join(mountPath, podFileName), data, 0600)
+	}
+	if err != nil {
+		p.Logger.Warn(podUID+":"+"cannot record the pod of the mount, its events are only logged",
+			zap.String("mountpath", mountPath), zap.Error(err))
+	}
+}
+
+// podEvent records an event on the pod mounting the volume whose data path
+// is mountPath. Failures are only logged, the caller logging the event too.
+func (p *S3fsPlugin) podEvent(mountPath, eventType, reason, message string) {
+	if p.Events == nil {
+		return
+	}
+	data, err := readFile(path.Join(mountPath, podFileName))
+	if err != nil {
+		return
+	}
+	var pod mountedPod
+	if err := json.Unmarshal(data, &pod); err != nil {
+		p.Logger.Warn("cannot read the pod of the mount",
+			zap.String("mountpath", mountPath), zap.Error(err))
+		return
+	}
+	ref := &v1.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+	// the mount directory of the volume is named after its PV
+	message = "volume " + path.Base(pod.Volume) + ": " + message
+	if err := p.Events.Event(ref, eventType, reason, message); err != nil {
+		p.Logger.Warn("cannot record event on pod",
+			zap.String("namespace", pod.Namespace), zap.String("pod", pod.Name),
+			zap.String("reason", reason), zap.Error(err))
+	}
+}
@@ -0,0 +1,136 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/driver/interfaces"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8fake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testPodRecord = `{"namespace":"` + testPodNamespace + `","name":"` + testPodName + `","uid":"pod-uid","volume":"/var/lib/kubelet/pods/pod-uid/volumes/ibm~ibmc-s3fs/pvc-1"}`
+
+// getEventsPlugin returns a plugin recording events in a fake cluster
+func getEventsPlugin() (*S3fsPlugin, *k8fake.Clientset) {
+	client := k8fake.NewSimpleClientset()
+	p := getPlugin()
+	p.Events = &KubeEventRecorder{Client: client, Host: "test-node"}
+	return p, client
+}
+
+// podEvents returns the events recorded on the test pod
+func podEvents(t *testing.T, client *k8fake.Clientset) []v1.Event {
+	events, err := client.CoreV1().Events(testPodNamespace).List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	return events.Items
+}
+
+func Test_Mount_S3fsLimits_RecordsPod(t *testing.T) {
+	p, _ := getEventsPlugin()
+	written := map[string]string{}
+	recordWrites(written)
+	r := getLimitsMountRequest()
+	r.Opts["kubernetes.io/pod.name"] = testPodName
+	r.Opts["kubernetes.io/pod.namespace"] = testPodNamespace
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.JSONEq(t, `{"namespace":"`+testPodNamespace+`","name":"`+testPodName+`","volume":"`+testDir+`"}`,
+			written[path.Join(testMountPath, podFileName)])
+	}
+}
+
+func Test_CheckOOM_PodEvent(t *testing.T) {
+	p, client := getEventsPlugin()
+	readDir = func(name string) ([]os.DirEntry, error) {
+		return []os.DirEntry{fs.FileInfoToDirEntry(fakeDirInfo(path.Base(testMountPath)))}, nil
+	}
+	files := map[string]string{
+		path.Join(testMountPath, cgroupFileName): testCgroup,
+		path.Join(testMountPath, podFileName):    testPodRecord,
+		path.Join(testCgroup, "memory.events"):   "oom_kill 2\n",
+	}
+	readFile = func(name string) ([]byte, error) {
+		if data, ok := files[name]; ok {
+			return []byte(data), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	recordWrites(files)
+
+	assert.Equal(t, 1, p.CheckOOM())
+	events := podEvents(t, client)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, v1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: testPodNamespace, Name: testPodName, UID: "pod-uid"}, events[0].InvolvedObject)
+		assert.Equal(t, v1.EventTypeWarning, events[0].Type)
+		assert.Equal(t, oomKilledReason, events[0].Reason)
+		assert.Equal(t, "volume pvc-1: s3fs was killed 2 time(s) by the OOM killer since the previous check, raise ibm.io/s3fs-memory-limit", events[0].Message)
+		assert.Equal(t, v1.EventSource{Component: eventComponent, Host: "test-node"}, events[0].Source)
+	}
+
+	// the kills are reported once
+	assert.Equal(t, 0, p.CheckOOM())
+	assert.Len(t, podEvents(t, client), 1)
+}
+
+func Test_Unmount_S3fsOOMKilled_PodEvent(t *testing.T) {
+	p, client := getEventsPlugin()
+	commandOutput = "... is not a mountpoint"
+	readFile = func(name string) ([]byte, error) {
+		switch name {
+		case path.Join(testMountPath, cgroupFileName):
+			return []byte(testCgroup), nil
+		case path.Join(testMountPath, podFileName):
+			return []byte(testPodRecord), nil
+		case path.Join(testCgroup, "memory.events"):
+			return []byte("oom_kill 1\n"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	resp := p.Unmount(getUnmountRequest())
+	assert.Equal(t, interfaces.StatusSuccess, resp.Status)
+	events := podEvents(t, client)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, oomKilledReason, events[0].Reason)
+		assert.Contains(t, events[0].Message, "volume pvc-1: s3fs was killed 1 time(s) by the OOM killer")
+	}
+}
+
+func Test_CheckOOM_PodNotRecorded(t *testing.T) {
+	p, client := getEventsPlugin()
+	readDir = func(name string) ([]os.DirEntry, error) {
+		return []os.DirEntry{fs.FileInfoToDirEntry(fakeDirInfo(path.Base(testMountPath)))}, nil
+	}
+	files := map[string]string{
+		path.Join(testMountPath, cgroupFileName): testCgroup,
+		path.Join(testCgroup, "memory.events"):   "oom_kill 2\n",
+	}
+	readFile = func(name string) ([]byte, error) {
+		if data, ok := files[name]; ok {
+			return []byte(data), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	recordWrites(files)
+
+	// the kills of a volume mounted without its pod recorded are only logged
+	assert.Equal(t, 1, p.CheckOOM())
+	assert.Empty(t, podEvents(t, client))
+}
@@ -0,0 +1,159 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// maxID is the largest uid or gid, (uid_t)-1 being reserved
+	maxID = 1<<32 - 2
+	// defaultMountPointUmask is the umask of the mount point directory
+	defaultMountPointUmask = "002"
+	// podLookupTimeout bounds the lookup of the pod mounting a volume
+	podLookupTimeout = 10 * time.Second
+)
+
+// PodIdentity is the security context of the pod mounting a volume. Unset
+// fields are nil.
+type PodIdentity struct {
+	RunAsUser  *int64
+	RunAsGroup *int64
+	FSGroup    *int64
+}
+
+// PodIdentityGetter looks up the security context of the pods mounting volumes
+type PodIdentityGetter interface {
+	PodIdentity(namespace, name string) (*PodIdentity, error)
+}
+
+// KubePodIdentityGetter reads the security context of pods from the Kubernetes API
+type KubePodIdentityGetter struct {
+	Client kubernetes.Interface
+}
+
+// PodIdentity returns the security context of the pod: the user and group
+// all its containers run as, else those of the pod.
+func (g *KubePodIdentityGetter) PodIdentity(namespace, name string) (*PodIdentity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), podLookupTimeout)
+	defer cancel()
+	pod, err := g.Client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &PodIdentity{}
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		identity.RunAsUser, identity.RunAsGroup, identity.FSGroup = sc.RunAsUser, sc.RunAsGroup, sc.FSGroup
+	}
+	if id := containersID(pod.Spec.Containers, func(sc *v1.SecurityContext) *int64 { return sc.RunAsUser }); id != nil {
+		identity.RunAsUser = id
+	}
+	if id := containersID(pod.Spec.Containers, func(sc *v1.SecurityContext) *int64 { return sc.RunAsGroup }); id != nil {
+		identity.RunAsGroup = id
+	}
+	return identity, nil
+}
+
+// containersID returns the id set by the security context of every
+// container if they all agree, else nil
+func containersID(containers []v1.Container, id func(*v1.SecurityContext) *int64) *int64 {
+	var common *int64
+	for _, c := range containers {
+		if c.SecurityContext == nil || id(c.SecurityContext) == nil {
+			return nil
+		}
+		if common != nil && *common != *id(c.SecurityContext) {
+			return nil
+		}
+		common = id(c.SecurityContext)
+	}
+	return common
+}
+
+// ParseID validates a uid or gid
+func ParseID(value string) (string, error) {
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || id > maxID {
+		return "", fmt.Errorf("%q is not a uid or gid between 0 and %d", value, maxID)
+	}
+	return strconv.FormatUint(id, 10), nil
+}
+
+// ParseUmask validates an octal umask such as 022 or 0027
+func ParseUmask(value string) (string, error) {
+	umask, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || umask > 0777 {
+		return "", fmt.Errorf("%q is not an octal umask between 000 and 777", value)
+	}
+	return fmt.Sprintf("%03o", umask), nil
+}
+
+// mountIdentity returns the uid, gid and umasks s3fs mounts a volume with.
+// Ids set on the volume take precedence over those of the pod, then over
+// its fsGroup. Empty ids are left to s3fs.
+func (p *S3fsPlugin) mountIdentity(options Options, fsGroup string) (uid, gid, umask, mpUmask string, err error) {
+	if options.UID != "" {
+		if uid, err = ParseID(options.UID); err != nil {
+			return "", "", "", "", fmt.Errorf("bad uid: %v", err)
+		}
+	}
+	if options.GID != "" {
+		if gid, err = ParseID(options.GID); err != nil {
+			return "", "", "", "", fmt.Errorf("bad gid: %v", err)
+		}
+	}
+	if options.Umask != "" {
+		if umask, err = ParseUmask(options.Umask); err != nil {
+			return "", "", "", "", fmt.Errorf("bad umask: %v", err)
+		}
+	}
+	mpUmask = defaultMountPointUmask
+	if options.MountPointUmask != "" {
+		if mpUmask, err = ParseUmask(options.MountPointUmask); err != nil {
+			return "", "", "", "", fmt.Errorf("bad mount point umask: %v", err)
+		}
+	}
+
+	if (uid == "" || gid == "") && p.Pods != nil && options.PodName != "" {
+		pod, err := p.Pods.PodIdentity(options.PodNamespace, options.PodName)
+		if err != nil {
+			// the volume is still mounted, with the ids of the fsGroup
+			p.Logger.Warn(podUID + ":" + "cannot look up the security context of the pod: " + err.Error())
+		} else {
+			if fsGroup == "" && pod.FSGroup != nil {
+				fsGroup = strconv.FormatInt(*pod.FSGroup, 10)
+			}
+			if uid == "" && pod.RunAsUser != nil {
+				uid = strconv.FormatInt(*pod.RunAsUser, 10)
+			}
+			if gid == "" && fsGroup == "" && pod.RunAsGroup != nil {
+				gid = strconv.FormatInt(*pod.RunAsGroup, 10)
+			}
+		}
+	}
+
+	if uid == "" {
+		uid = fsGroup
+	}
+	if gid == "" {
+		gid = fsGroup
+	}
+	return uid, gid, umask, mpUmask, nil
+}
@@ -0,0 +1,165 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/driver/interfaces"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8fake "k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testPodName      = "test-pod"
+	testPodNamespace = "test-namespace"
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func getPodIdentityGetter(spec v1.PodSpec) PodIdentityGetter {
+	return &KubePodIdentityGetter{Client: k8fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: testPodName, Namespace: testPodNamespace},
+		Spec:       spec,
+	})}
+}
+
+func getPodMountRequest() interfaces.FlexVolumeMountRequest {
+	r := getMountRequest()
+	r.Opts["kubernetes.io/pod.name"] = testPodName
+	r.Opts["kubernetes.io/pod.namespace"] = testPodNamespace
+	return r
+}
+
+func Test_ParseID(t *testing.T) {
+	id, err := ParseID("1000")
+	assert.NoError(t, err)
+	assert.Equal(t, "1000", id)
+
+	for _, bad := range []string{"-1", "abc", "4294967295"} {
+		_, err := ParseID(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func Test_ParseUmask(t *testing.T) {
+	umask, err := ParseUmask("0027")
+	assert.NoError(t, err)
+	assert.Equal(t, "027", umask)
+
+	for _, bad := range []string{"8", "1000", "rwx"} {
+		_, err := ParseUmask(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func Test_PodIdentity_Containers(t *testing.T) {
+	g := getPodIdentityGetter(v1.PodSpec{
+		SecurityContext: &v1.PodSecurityContext{RunAsUser: int64Ptr(1000), RunAsGroup: int64Ptr(1000), FSGroup: int64Ptr(2000)},
+		Containers: []v1.Container{
+			{Name: "app", SecurityContext: &v1.SecurityContext{RunAsUser: int64Ptr(1001)}},
+			{Name: "sidecar", SecurityContext: &v1.SecurityContext{RunAsUser: int64Ptr(1001), RunAsGroup: int64Ptr(3000)}},
+		},
+	})
+
+	identity, err := g.PodIdentity(testPodNamespace, testPodName)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1001), *identity.RunAsUser)
+		assert.Equal(t, int64(1000), *identity.RunAsGroup)
+		assert.Equal(t, int64(2000), *identity.FSGroup)
+	}
+}
+
+func Test_Mount_Identity_Options(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts["kubernetes.io/fsGroup"] = "65534"
+	r.Opts["uid"] = "1000"
+	r.Opts["gid"] = "2000"
+	r.Opts["umask"] = "0027"
+	r.Opts["mp-umask"] = "022"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "uid=1000")
+		assert.Contains(t, commandArgs, "gid=2000")
+		assert.Contains(t, commandArgs, "umask=027")
+		assert.Contains(t, commandArgs, "mp_umask=022")
+	}
+}
+
+func Test_Mount_Identity_Pod(t *testing.T) {
+	p := getPlugin()
+	p.Pods = getPodIdentityGetter(v1.PodSpec{
+		SecurityContext: &v1.PodSecurityContext{RunAsUser: int64Ptr(1000), RunAsGroup: int64Ptr(3000)},
+	})
+
+	resp := p.Mount(getPodMountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "uid=1000")
+		assert.Contains(t, commandArgs, "gid=3000")
+		assert.Contains(t, commandArgs, "mp_umask=002")
+	}
+}
+
+func Test_Mount_Identity_PodFSGroup(t *testing.T) {
+	p := getPlugin()
+	p.Pods = getPodIdentityGetter(v1.PodSpec{
+		SecurityContext: &v1.PodSecurityContext{RunAsUser: int64Ptr(1000), RunAsGroup: int64Ptr(3000)},
+	})
+	r := getPodMountRequest()
+	r.Opts["kubernetes.io/mounterArgs.FsGroup"] = "2000"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "uid=1000")
+		assert.Contains(t, commandArgs, "gid=2000")
+	}
+}
+
+func Test_Mount_Identity_PodNotFound(t *testing.T) {
+	p := getPlugin()
+	p.Pods = &KubePodIdentityGetter{Client: k8fake.NewSimpleClientset()}
+	r := getPodMountRequest()
+	r.Opts["kubernetes.io/fsGroup"] = "65534"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commandArgs, "uid=65534")
+		assert.Contains(t, commandArgs, "gid=65534")
+	}
+}
+
+func Test_Mount_Identity_BadUID(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts["uid"] = "-1"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "bad ownership options: bad uid")
+	}
+}
+
+func Test_Mount_Identity_BadUmask(t *testing.T) {
+	p := getPlugin()
+	r := getMountRequest()
+	r.Opts["umask"] = "999"
+
+	resp := p.Mount(r)
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "bad ownership options: bad umask")
+	}
+}
@@ -0,0 +1,134 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// SupervisorNone runs s3fs as a daemon of the driver
+	SupervisorNone = ""
+	// SupervisorSystemd runs s3fs in a transient systemd service per mount,
+	// out of the cgroup of kubelet and of the driver
+	SupervisorSystemd = "systemd"
+
+	// unitPrefix prefixes the name of the systemd services running s3fs
+	unitPrefix = "ibmc-s3fs-"
+	// unitRestartSec is the delay before a crashed s3fs is restarted
+	unitRestartSec = "5"
+	// unitLogLines is the number of lines of the service log reported when
+	// s3fs fails to start
+	unitLogLines = "20"
+	// releasedFileName marks in the data path a mount whose s3fs must not be
+	// restarted any more
+	releasedFileName = "released"
+	// remountScript lazily unmounts the mount point left by a crashed s3fs
+	// before running s3fs again, its name being the data path of the mount
+	// and its arguments those of s3fs. It exits instead once the volume was
+	// unmounted, i.e. its data path is released or deleted.
+	remountScript = `[ -d "$0" ] && [ ! -e "$0/` + releasedFileName + `" ] || exit 0; umount -l "$2" 2>/dev/null; exec s3fs "$@"`
+)
+
+// unitName returns the systemd service running the s3fs of the mount whose
+// data path is mountPath
+func unitName(mountPath string) string {
+	return unitPrefix + path.Base(mountPath) + ".service"
+}
+
+// runS3fs mounts s3fs with args, under the supervisor of the plugin and
+// within limits. It returns the output of s3fs.
+func (p *S3fsPlugin) runS3fs(mountPath, mountDir string, args []string, limits resourceLimits) ([]byte, error) {
+	switch p.Supervisor {
+	case SupervisorNone:
+		if !limits.isSet() {
+			return command("s3fs", args...).CombinedOutput()
+		}
+		cgroup, err := createCgroup(mountPath, limits)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create s3fs cgroup: %v", err)
+		}
+		if err := writeFile(path.Join(mountPath, cgroupFileName), []byte(cgroup), 0600); err != nil {
+			return nil, fmt.Errorf("cannot record s3fs cgroup: %v", err)
+		}
+		p.Logger.Info(podUID+":"+"Running s3fs in cgroup",
+			zap.String("cgroup", cgroup))
+		return command("/bin/sh", append([]string{"-c", cgroupScript, path.Join(cgroup, "cgroup.procs")}, args...)...).CombinedOutput()
+	case SupervisorSystemd:
+	default:
+		return nil, fmt.Errorf("unknown s3fs supervisor %q", p.Supervisor)
+	}
+
+	unit := unitName(mountPath)
+	// a failed service of a previous mount would hold the name
+	_ = command("systemctl", "reset-failed", unit).Run()
+	if err := removeAll(path.Join(mountPath, releasedFileName)); err != nil {
+		return nil, fmt.Errorf("cannot clear the released mark of %s: %v", mountPath, err)
+	}
+
+	runArgs := []string{
+		"--unit=" + unit,
+		"--description=s3fs mount of " + mountDir,
+		"--collect",
+		// systemd-run returns once s3fs forked, i.e. once the volume is mounted
+		"--property=Type=forking",
+		"--property=Restart=on-failure",
+		"--property=RestartSec=" + unitRestartSec,
+	}
+	if limits.MemoryBytes > 0 {
+		runArgs = append(runArgs, "--property=MemoryMax="+strconv.FormatInt(limits.MemoryBytes, 10))
+	}
+	if limits.MilliCPU > 0 {
+		runArgs = append(runArgs, "--property=CPUQuota="+strconv.FormatInt(limits.MilliCPU/10, 10)+"%")
+	}
+	if limits.isSet() {
+		// systemd creates the cgroup of the service in the system slice
+		cgroup := path.Join(cgroupRoot, "system.slice", unit)
+		if err := writeFile(path.Join(mountPath, cgroupFileName), []byte(cgroup), 0600); err != nil {
+			return nil, fmt.Errorf("cannot record s3fs cgroup: %v", err)
+		}
+	}
+	runArgs = append(runArgs, "--", "/bin/sh", "-c", remountScript, mountPath)
+	p.Logger.Info(podUID+":"+"Running s3fs in systemd service",
+		zap.String("unit", unit))
+	out, err := command("systemd-run", append(runArgs, args...)...).CombinedOutput()
+	if err != nil {
+		logs, _ := command("journalctl", "--unit="+unit, "--lines="+unitLogLines, "--no-pager", "--output=cat").CombinedOutput()
+		// s3fs did not mount the volume, the service would only restart it
+		if stopOut, stopErr := command("systemctl", "stop", unit).CombinedOutput(); stopErr != nil {
+			p.Logger.Info(podUID+":"+"cannot stop s3fs service",
+				zap.String("unit", unit), zap.String("output", string(stopOut)), zap.Error(stopErr))
+		}
+		return append(out, logs...), err
+	}
+	return out, nil
+}
+
+// releaseS3fs marks the mount whose data path is mountPath as unmounted, so
+// that the systemd service no longer restarts its s3fs. The service is left
+// running: like s3fs run without the supervisor, an s3fs still uploading
+// after the unmount timeout finishes its uploads and exits on its own, the
+// service being collected then.
+func (p *S3fsPlugin) releaseS3fs(mountPath string) {
+	if p.Supervisor != SupervisorSystemd {
+		return
+	}
+	if err := writeFile(path.Join(mountPath, releasedFileName), nil, 0600); err != nil && !os.IsNotExist(err) {
+		// the data path is deleted next, which releases the mount as well
+		p.Logger.Warn(podUID+":"+"cannot mark s3fs mount as released",
+			zap.String("mountpath", mountPath), zap.Error(err))
+	}
+}
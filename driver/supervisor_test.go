@@ -0,0 +1,127 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/driver/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+var testUnit = unitPrefix + fmt.Sprintf("%x", sha256.Sum256([]byte(testDir))) + ".service"
+
+// getSupervisedPlugin returns a plugin running s3fs under systemd, whose
+// commands are recorded in commands. The commands named in failing fail.
+func getSupervisedPlugin(commands *[]string, failing ...string) *S3fsPlugin {
+	p := getRecordingPlugin(commands, failing...)
+	p.Supervisor = SupervisorSystemd
+	return p
+}
+
+func Test_Mount_Supervisor_Systemd(t *testing.T) {
+	var commands []string
+	p := getSupervisedPlugin(&commands)
+
+	resp := p.Mount(getMountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, commands, "systemctl reset-failed "+testUnit)
+		assert.Equal(t, "--unit="+testUnit, commandArgs[0])
+		assert.Contains(t, commandArgs, "--property=Restart=on-failure")
+		assert.Contains(t, commandArgs, "--property=Type=forking")
+		assert.Contains(t, commandArgs, "passwd_file=/var/lib/ibmc-s3fs/"+fmt.Sprintf("%x", sha256.Sum256([]byte(testDir)))+"/passwd")
+	}
+}
+
+func Test_Mount_Supervisor_Systemd_Failure(t *testing.T) {
+	var commands []string
+	p := getSupervisedPlugin(&commands, "systemd-run")
+
+	resp := p.Mount(getMountRequest())
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "s3fs mount failed")
+	}
+	assert.Contains(t, commands, "journalctl --unit="+testUnit+" --lines=20 --no-pager --output=cat")
+	// a failed service is not restarted
+	assert.Contains(t, commands, "systemctl stop "+testUnit)
+}
+
+func Test_Mount_Supervisor_Unknown(t *testing.T) {
+	p := getPlugin()
+	p.Supervisor = "runit"
+
+	resp := p.Mount(getMountRequest())
+	if assert.Equal(t, interfaces.StatusFailure, resp.Status) {
+		assert.Contains(t, resp.Message, "unknown s3fs supervisor")
+	}
+}
+
+func Test_Unmount_Supervisor_Systemd(t *testing.T) {
+	var commands []string
+	p := getSupervisedPlugin(&commands)
+	commandOutput = "... is not a mountpoint"
+
+	written := map[string]string{}
+	recordWrites(written)
+
+	resp := p.Unmount(getUnmountRequest())
+	assert.Equal(t, interfaces.StatusSuccess, resp.Status)
+	// systemd no longer restarts s3fs, which exits on its own once unmounted
+	assert.Contains(t, written, path.Join(testMountPath, releasedFileName))
+	assert.NotContains(t, commands, "systemctl stop "+testUnit)
+}
+
+func Test_Unmount_Supervisor_Systemd_Timeout(t *testing.T) {
+	var commands []string
+	p := getSupervisedPlugin(&commands)
+	commandOutput = "... is not a mountpoint"
+	p.UnmountTimeout = 10 * time.Millisecond
+	unmountPollInterval = time.Millisecond
+	findS3fsProcess = func(string) (int, error) { return testS3fsPID, nil }
+	syncMount = func(string) error { return nil }
+	kill = func(int, syscall.Signal) error { return nil }
+
+	written := map[string]string{}
+	recordWrites(written)
+
+	resp := p.Unmount(getUnmountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, resp.Message, "data may have been lost")
+	}
+	// the s3fs left uploading is neither stopped nor restarted by systemd
+	assert.Contains(t, written, path.Join(testMountPath, releasedFileName))
+	assert.NotContains(t, commands, "systemctl stop "+testUnit)
+}
+
+func Test_RemountScript(t *testing.T) {
+	dataPath := t.TempDir()
+	remount := func() error {
+		// s3fs is not found when the script runs it
+		cmd := exec.Command("/bin/sh", "-c", remountScript, dataPath, "bucket", path.Join(dataPath, "mnt"))
+		cmd.Env = []string{"PATH=" + dataPath}
+		return cmd.Run()
+	}
+
+	assert.Error(t, remount())
+
+	assert.NoError(t, os.WriteFile(path.Join(dataPath, releasedFileName), nil, 0600))
+	assert.NoError(t, remount(), "released mount is not remounted")
+
+	assert.NoError(t, os.RemoveAll(dataPath))
+	assert.NoError(t, remount(), "deleted mount is not remounted")
+}
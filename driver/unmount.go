@@ -0,0 +1,122 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultUnmountTimeout is how long an unmount waits for s3fs to finish its uploads
+const DefaultUnmountTimeout = 30 * time.Second
+
+var (
+	// procPath lists the processes of the node
+	procPath            = "/proc"
+	findS3fsProcess     = s3fsProcess
+	syncMount           = syncFilesystem
+	kill                = syscall.Kill
+	unmountPollInterval = 100 * time.Millisecond
+)
+
+// s3fsProcess returns the pid of the s3fs process serving mountDir, 0 if none
+func s3fsProcess(mountDir string) (int, error) {
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		return 0, err
+	}
+	mountDir = path.Clean(mountDir)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// processes may exit while the list is read
+		cmdline, err := os.ReadFile(path.Join(procPath, e.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0})
+		if len(args) < 3 || path.Base(string(args[0])) != "s3fs" {
+			continue
+		}
+		for _, arg := range args[1:] {
+			if path.Clean(string(arg)) == mountDir {
+				return pid, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// syncFilesystem flushes the files of the filesystem mounted on dir
+func syncFilesystem(dir string) error {
+	f, err := os.Open(dir) // #nosec G304 -- dir is the mount point given by kubelet
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint:errcheck
+	return unix.Syncfs(int(f.Fd()))
+}
+
+// unmountS3fs unmounts the s3fs mount point mountDir once the files being
+// written are flushed. The mount is detached if it is busy. It returns a
+// warning when s3fs was still running, possibly uploading, after
+// UnmountTimeout.
+func (p *S3fsPlugin) unmountS3fs(mountDir string) (string, error) {
+	pid := 0
+	if p.UnmountTimeout > 0 {
+		var err error
+		if pid, err = findS3fsProcess(mountDir); err != nil {
+			p.Logger.Warn(podUID+":"+"cannot look up s3fs process, not waiting for its uploads",
+				zap.String("Mount path", mountDir), zap.Error(err))
+		}
+	}
+
+	if pid != 0 {
+		if err := syncMount(mountDir); err != nil {
+			p.Logger.Warn(podUID+":"+"cannot sync s3fs mount point",
+				zap.String("Mount path", mountDir), zap.Error(err))
+		}
+		// a regular unmount lets s3fs process the pending requests and exit,
+		// unmountPath detaches the mount point if it is busy
+		if err := unmount(mountDir, 0); err != nil {
+			p.Logger.Info(podUID+":"+"cannot unmount s3fs mount point, detaching it",
+				zap.String("Mount path", mountDir), zap.Error(err))
+		}
+	}
+
+	if err := p.unmountPath(mountDir, false); err != nil {
+		return "", err
+	}
+	if pid == 0 {
+		return "", nil
+	}
+
+	deadline := time.Now().Add(p.UnmountTimeout)
+	for kill(pid, 0) != syscall.ESRCH {
+		if time.Now().After(deadline) {
+			p.Logger.Error(podUID+":"+"s3fs still running after unmount, data may have been lost",
+				zap.String("Mount path", mountDir), zap.Int("pid", pid), zap.Duration("timeout", p.UnmountTimeout))
+			return fmt.Sprintf("s3fs was still uploading %s after %s, data may have been lost", mountDir, p.UnmountTimeout), nil
+		}
+		time.Sleep(unmountPollInterval)
+	}
+	return "", nil
+}
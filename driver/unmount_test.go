@@ -0,0 +1,108 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/driver/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+const testS3fsPID = 42
+
+// getGracefulUnmountPlugin returns a plugin whose s3fs process exits after
+// running polls
+func getGracefulUnmountPlugin(running int) (*S3fsPlugin, *[]int) {
+	p := getPlugin()
+	p.UnmountTimeout = time.Second
+	unmountPollInterval = time.Millisecond
+	commandOutput = "... is not a mountpoint"
+	findS3fsProcess = func(string) (int, error) { return testS3fsPID, nil }
+	syncMount = func(string) error { return nil }
+	kill = func(pid int, sig syscall.Signal) error {
+		if running > 0 {
+			running--
+			return nil
+		}
+		return syscall.ESRCH
+	}
+	var flags []int
+	unmount = func(target string, f int) error {
+		flags = append(flags, f)
+		return nil
+	}
+	return p, &flags
+}
+
+func Test_s3fsProcess(t *testing.T) {
+	procPath = t.TempDir()
+	defer func() { procPath = "/proc" }()
+	for pid, cmdline := range map[string]string{
+		"10":   "/usr/bin/s3fs\x00other-bucket\x00/other/mount\x00",
+		"11":   "/usr/bin/s3fs\x00test-bucket\x00/tmp/mount\x00-o\x00allow_other\x00",
+		"12":   "/bin/sh\x00-c\x00ls /tmp/mount\x00",
+		"self": "",
+	} {
+		assert.NoError(t, os.MkdirAll(path.Join(procPath, pid), 0755))
+		assert.NoError(t, os.WriteFile(path.Join(procPath, pid, "cmdline"), []byte(cmdline), 0600))
+	}
+
+	pid, err := s3fsProcess("/tmp/mount/")
+	assert.NoError(t, err)
+	assert.Equal(t, 11, pid)
+
+	pid, err = s3fsProcess("/tmp/none")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pid)
+}
+
+func Test_Unmount_WaitsForS3fs(t *testing.T) {
+	p, flags := getGracefulUnmountPlugin(3)
+	synced := ""
+	syncMount = func(dir string) error {
+		synced = dir
+		return nil
+	}
+
+	resp := p.Unmount(getUnmountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Equal(t, "Volume unmounted successfully", resp.Message)
+	}
+	assert.Equal(t, testDir, synced)
+	// the mount point is not detached first
+	assert.Equal(t, 0, (*flags)[0])
+}
+
+func Test_Unmount_S3fsTimeout(t *testing.T) {
+	p, _ := getGracefulUnmountPlugin(1 << 30)
+	p.UnmountTimeout = 10 * time.Millisecond
+
+	resp := p.Unmount(getUnmountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Contains(t, resp.Message, "data may have been lost")
+	}
+}
+
+func Test_Unmount_NoTimeout(t *testing.T) {
+	p, flags := getGracefulUnmountPlugin(1 << 30)
+	p.UnmountTimeout = 0
+
+	resp := p.Unmount(getUnmountRequest())
+	if assert.Equal(t, interfaces.StatusSuccess, resp.Status) {
+		assert.Equal(t, "Volume unmounted successfully", resp.Message)
+	}
+	assert.Empty(t, *flags)
+}
@@ -0,0 +1,234 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	v1 "k8s.io/api/core/v1"
+)
+
+// errBucketNotVersioned is returned when a point-in-time volume is requested
+// on a bucket without versioning
+var errBucketNotVersioned = errors.New("bucket versioning is not enabled")
+
+// parseAsOf returns the time of an ibm.io/as-of value, or the object version
+// it names when it is not an RFC 3339 timestamp
+func parseAsOf(value string, now time.Time) (time.Time, string, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		if t.After(now) {
+			return time.Time{}, "", fmt.Errorf("as-of %s is in the future", value)
+		}
+		return t, "", nil
+	}
+	// a version id never holds a colon, a mistyped timestamp always does
+	if strings.ContainsAny(value, ": \t\n") {
+		return time.Time{}, "", fmt.Errorf("invalid value for as-of %q, expects an RFC 3339 timestamp or an object version id", value)
+	}
+	return time.Time{}, value, nil
+}
+
+// validateAsOf checks that a point-in-time volume is a read-only view of an
+// existing bucket that the volume neither deletes nor archives
+func validateAsOf(pvc *pvcAnnotations, accessModes []v1.PersistentVolumeAccessMode) error {
+	if _, _, err := parseAsOf(pvc.AsOf, time.Now()); err != nil {
+		return err
+	}
+	if len(accessModes) != 1 || accessModes[0] != v1.ReadOnlyMany {
+		return fmt.Errorf("as-of requires the %s access mode", v1.ReadOnlyMany)
+	}
+	if pvc.SharedBucket != "" {
+		return errors.New("as-of cannot be used with a shared-bucket storage class")
+	}
+	if pvc.AsOfBucket == "" {
+		return errors.New("as-of requires ibm.io/as-of-bucket in the storage class")
+	}
+	if pvc.AsOfBucket == pvc.Bucket {
+		return errors.New("as-of-bucket cannot be the bucket of the volume")
+	}
+	if pvc.AutoCreateBucket != "false" {
+		return errors.New("as-of requires an existing bucket, auto-create-bucket must be false")
+	}
+	if pvc.AutoDeleteBucket == "true" || pvc.OnDelete != "" {
+		return errors.New("as-of cannot be used with auto-delete-bucket or on-delete")
+	}
+	return nil
+}
+
+// snapshotPath returns the object path of the as-of bucket holding the
+// point-in-time copy of the objects of a volume
+func snapshotPath(pvName string) string {
+	return "/" + backend.SnapshotPrefix + pvName
+}
+
+// snapshotCopyWait bounds how long Provision waits for the copy of a
+// point-in-time volume before reporting it in progress
+var snapshotCopyWait = 5 * time.Second
+
+// snapshotCheckpointInterval is the number of copied objects between two
+// saves of the copy checkpoint
+const snapshotCheckpointInterval = 100
+
+// errSnapshotCopying is returned while the copy of a point-in-time volume is
+// running in the background
+var errSnapshotCopying = errors.New("copy in progress")
+
+// snapshotCheckpoint records how far the copy of a point-in-time volume got.
+// It is kept in the as-of bucket next to the copy, out of the mounted path,
+// so that a copy interrupted by a timeout or a restart of the provisioner
+// resumes after the last saved key.
+type snapshotCheckpoint struct {
+	Bucket     string `json:"bucket"`
+	ObjectPath string `json:"objectPath,omitempty"`
+	AsOf       string `json:"asOf"`
+	ClaimUID   string `json:"claimUID"`
+	// After is the last copied key of the source bucket
+	After  string `json:"after,omitempty"`
+	Copied int    `json:"copied"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// snapshotJob is a copy running in the background
+type snapshotJob struct {
+	done   chan struct{}
+	copied atomic.Int64
+	n      int
+	err    error
+}
+
+// snapshotCheckpointKey returns the key of the checkpoint of the copy at
+// snapshot in the as-of bucket
+func snapshotCheckpointKey(snapshot string) string {
+	return strings.Trim(snapshot, "/") + ".copy"
+}
+
+// copySnapshot runs createSnapshot in the background, at most once at a time
+// per volume, and returns its result if it completes within snapshotCopyWait.
+// Otherwise it returns errSnapshotCopying, and the result is returned by the
+// first call after the copy completed.
+func (p *IBMS3fsProvisioner) copySnapshot(sess backend.ObjectStorageSession, pvc *pvcAnnotations, owner *backend.BucketOwner) (int, error) {
+	p.snapshotMu.Lock()
+	job, ok := p.snapshotJobs[owner.PVName]
+	if !ok {
+		job = &snapshotJob{done: make(chan struct{})}
+		if p.snapshotJobs == nil {
+			p.snapshotJobs = map[string]*snapshotJob{}
+		}
+		p.snapshotJobs[owner.PVName] = job
+		snapshot := *pvc
+		// the copy is bounded by the copy timeout of the session, not by the request
+		go func() {
+			defer close(job.done)
+			job.n, job.err = createSnapshot(context.Background(), sess, &snapshot, owner, &job.copied)
+		}()
+	}
+	p.snapshotMu.Unlock()
+
+	select {
+	case <-job.done:
+	case <-time.After(snapshotCopyWait):
+		return 0, fmt.Errorf("%w, %d objects copied", errSnapshotCopying, job.copied.Load())
+	}
+	p.snapshotMu.Lock()
+	if p.snapshotJobs[owner.PVName] == job {
+		delete(p.snapshotJobs, owner.PVName)
+	}
+	p.snapshotMu.Unlock()
+	return job.n, job.err
+}
+
+// createSnapshot copies the objects of the object path of the versioned
+// bucket of a volume as of pvc.AsOf to pvc.AsOfSnapshot in pvc.AsOfBucket,
+// stamped with the ownership marker of owner. s3fs can only serve the current
+// version of an object, so the volume mounts the copy, which is kept out of
+// the versioned bucket to leave its objects and versions untouched. The copy
+// resumes from its checkpoint, and copied counts the objects copied so far.
+// It returns the number of copied objects.
+func createSnapshot(ctx context.Context, sess backend.ObjectStorageSession, pvc *pvcAnnotations, owner *backend.BucketOwner, copied *atomic.Int64) (int, error) {
+	asOf, versionID, err := parseAsOf(pvc.AsOf, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	versioned, err := sess.GetBucketVersioningWithContext(ctx, pvc.Bucket)
+	if err != nil {
+		return 0, err
+	}
+	if !versioned {
+		return 0, fmt.Errorf("as-of requires ibm.io/bucket-versioning on bucket %s: %w", pvc.Bucket, errBucketNotVersioned)
+	}
+
+	key := snapshotCheckpointKey(pvc.AsOfSnapshot)
+	checkpoint := snapshotCheckpoint{Bucket: pvc.Bucket, ObjectPath: pvc.ObjectPath, AsOf: pvc.AsOf, ClaimUID: owner.ClaimUID}
+	data, err := sess.ReadObjectWithContext(ctx, pvc.AsOfBucket, key)
+	if err != nil {
+		return 0, err
+	}
+	if data != nil {
+		var saved snapshotCheckpoint
+		if err := json.Unmarshal(data, &saved); err == nil &&
+			saved.Bucket == checkpoint.Bucket && saved.ObjectPath == checkpoint.ObjectPath &&
+			saved.AsOf == checkpoint.AsOf && saved.ClaimUID == checkpoint.ClaimUID {
+			checkpoint = saved
+		} else if err := sess.DeleteObjectPathWithContext(ctx, pvc.AsOfBucket, pvc.AsOfSnapshot); err != nil {
+			// the copy was started for another claim or point in time
+			return 0, err
+		}
+	}
+	copied.Store(int64(checkpoint.Copied))
+	if checkpoint.Done {
+		return checkpoint.Copied, nil
+	}
+
+	// the path is created with its marker first, so that a partial copy is
+	// still deleted with the volume
+	if err := sess.SetObjectPathOwnerWithContext(ctx, pvc.AsOfBucket, pvc.AsOfSnapshot, owner); err != nil {
+		return 0, err
+	}
+
+	save := func() error {
+		data, err := json.Marshal(checkpoint)
+		if err != nil {
+			return err
+		}
+		return sess.WriteObjectWithContext(ctx, pvc.AsOfBucket, key, data)
+	}
+	prefix := strings.Trim(pvc.ObjectPath, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	destPrefix := strings.TrimPrefix(pvc.AsOfSnapshot, "/") + "/"
+	_, err = sess.CopyObjectsAsOfWithContext(ctx, pvc.Bucket, prefix, pvc.AsOfBucket, destPrefix, asOf, versionID, checkpoint.After, func(key string) error {
+		checkpoint.After = key
+		checkpoint.Copied++
+		copied.Store(int64(checkpoint.Copied))
+		if checkpoint.Copied%snapshotCheckpointInterval == 0 {
+			return save()
+		}
+		return nil
+	})
+	if err != nil {
+		// the next attempt resumes from the last copied object
+		_ = save()
+		return checkpoint.Copied, err
+	}
+	checkpoint.Done = true
+	if err := save(); err != nil {
+		return checkpoint.Copied, err
+	}
+	return checkpoint.Copied, nil
+}
@@ -0,0 +1,330 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	fakeProvider "github.com/IBM/ibmcloud-object-storage-plugin/ibm-provider/provider/fake-provider"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake"
+	fakeGrpcClient "github.com/IBM/ibmcloud-object-storage-plugin/utils/grpc-client/fake-grpc"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v6/controller"
+)
+
+const (
+	annotationAsOf         = "ibm.io/as-of"
+	annotationAsOfSnapshot = "ibm.io/as-of-snapshot"
+	annotationAsOfBucket   = "ibm.io/as-of-bucket"
+	testAsOf               = "2025-01-01T00:00:00Z"
+	testAsOfBucket         = "test-as-of-bucket"
+)
+
+var testSnapshotPath = "/" + backend.SnapshotPrefix + testPVName
+
+func getAsOfVolumeOptions() controller.ProvisionOptions {
+	v := getVolumeOptions()
+	v.PVName = testPVName
+	v.PVC.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadOnlyMany}
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationObjectPath] = testObjectPath
+	v.PVC.Annotations[annotationQuotaLimit] = "false"
+	v.PVC.Annotations[annotationAsOf] = testAsOf
+	v.StorageClass.Parameters[annotationAsOfBucket] = testAsOfBucket
+	return v
+}
+
+func getAsOfProvisioner(factory *fake.ObjectStorageSessionFactory) *IBMS3fsProvisioner {
+	return getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+}
+
+func Test_ParseAsOf(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	asOf, versionID, err := parseAsOf("2025-01-01T12:00:00+02:00", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC), asOf.UTC())
+	assert.Empty(t, versionID)
+
+	_, versionID, err = parseAsOf("L0001nSBUIAtP5Z2T", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "L0001nSBUIAtP5Z2T", versionID)
+
+	_, _, err = parseAsOf("2025-07-01T00:00:00Z", now)
+	assert.ErrorContains(t, err, "is in the future")
+	_, _, err = parseAsOf("2025-01-01 00:00", now)
+	assert.ErrorContains(t, err, "expects an RFC 3339 timestamp or an object version id")
+}
+
+func Test_Provision_AsOf(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{VersionedBuckets: map[string]bool{testBucket: true}}
+	p := getAsOfProvisioner(factory)
+
+	pv, _, err := p.Provision(context.Background(), getAsOfVolumeOptions())
+	if assert.NoError(t, err) {
+		assert.Equal(t, testAsOfBucket, pv.Spec.FlexVolume.Options[optionBucket])
+		assert.Equal(t, testSnapshotPath, pv.Spec.FlexVolume.Options[optionObjectPath])
+		assert.Equal(t, testAsOf, pv.Spec.FlexVolume.Options["as-of"])
+		assert.Equal(t, testObjectPath, pv.Annotations[annotationObjectPath])
+		assert.Equal(t, testAsOf, pv.Annotations[annotationAsOf])
+		assert.Equal(t, testSnapshotPath, pv.Annotations[annotationAsOfSnapshot])
+		assert.Equal(t, testBucket, pv.Annotations[annotationBucket])
+		assert.Equal(t, testAsOfBucket, pv.Annotations[annotationAsOfBucket])
+	}
+	assert.Equal(t, testBucket+"/test/object-path/", factory.LastCopiedPrefix)
+	assert.Equal(t, testAsOfBucket+"/"+backend.SnapshotPrefix+testPVName+"/", factory.LastCopyDestination)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), factory.LastCopyAsOf.UTC())
+	assert.Equal(t, testAsOfBucket+":"+testSnapshotPath, factory.LastCreatedObjectPath)
+	assert.Equal(t, testPVName, factory.ObjectPathOwners[testAsOfBucket+":"+testSnapshotPath].PVName)
+	checkpoint := readSnapshotCheckpoint(t, factory)
+	assert.True(t, checkpoint.Done)
+	assert.Equal(t, 1, checkpoint.Copied)
+}
+
+var testCheckpointKey = testAsOfBucket + "/" + backend.SnapshotPrefix + testPVName + ".copy"
+
+func readSnapshotCheckpoint(t *testing.T, factory *fake.ObjectStorageSessionFactory) snapshotCheckpoint {
+	var checkpoint snapshotCheckpoint
+	assert.NoError(t, json.Unmarshal(factory.Objects[testCheckpointKey], &checkpoint))
+	return checkpoint
+}
+
+func writeSnapshotCheckpoint(t *testing.T, factory *fake.ObjectStorageSessionFactory, checkpoint snapshotCheckpoint) {
+	data, err := json.Marshal(checkpoint)
+	assert.NoError(t, err)
+	factory.Objects = map[string][]byte{testCheckpointKey: data}
+}
+
+func Test_Provision_AsOf_InBackground(t *testing.T) {
+	defer func(wait time.Duration) { snapshotCopyWait = wait }(snapshotCopyWait)
+	snapshotCopyWait = 10 * time.Millisecond
+	block := make(chan struct{})
+	factory := &fake.ObjectStorageSessionFactory{VersionedBuckets: map[string]bool{testBucket: true}, CopyObjectsAsOfBlock: block}
+	p := getAsOfProvisioner(factory)
+
+	_, state, err := p.Provision(context.Background(), getAsOfVolumeOptions())
+	assert.ErrorIs(t, err, errSnapshotCopying)
+	assert.Equal(t, controller.ProvisioningInBackground, state)
+	// a retry waits for the running copy instead of starting another one
+	_, state, err = p.Provision(context.Background(), getAsOfVolumeOptions())
+	assert.ErrorIs(t, err, errSnapshotCopying)
+	assert.Equal(t, controller.ProvisioningInBackground, state)
+
+	close(block)
+	snapshotCopyWait = time.Minute
+	pv, _, err := p.Provision(context.Background(), getAsOfVolumeOptions())
+	if assert.NoError(t, err) {
+		assert.Equal(t, testSnapshotPath, pv.Spec.FlexVolume.Options[optionObjectPath])
+	}
+	assert.Equal(t, map[string]int{"test/object-path/object": 1}, factory.CopiedAsOfKeys)
+	assert.Empty(t, p.snapshotJobs)
+}
+
+func Test_Provision_AsOf_Resume(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{
+		VersionedBuckets:         map[string]bool{testBucket: true},
+		AsOfKeys:                 []string{"test/object-path/a", "test/object-path/b", "test/object-path/c"},
+		CopyObjectsAsOfErr:       context.DeadlineExceeded,
+		CopyObjectsAsOfFailAfter: 2,
+	}
+	p := getAsOfProvisioner(factory)
+	v := getAsOfVolumeOptions()
+	v.PVC.UID = "claim-1"
+
+	_, state, err := p.Provision(context.Background(), v)
+	assert.Error(t, err)
+	assert.Equal(t, controller.ProvisioningInBackground, state)
+	checkpoint := readSnapshotCheckpoint(t, factory)
+	assert.Equal(t, snapshotCheckpoint{Bucket: testBucket, ObjectPath: testObjectPath, AsOf: testAsOf, ClaimUID: "claim-1", After: "test/object-path/b", Copied: 2}, checkpoint)
+
+	factory.CopyObjectsAsOfErr = nil
+	_, _, err = p.Provision(context.Background(), v)
+	assert.NoError(t, err)
+	assert.Equal(t, "test/object-path/b", factory.LastCopyStartAfter)
+	assert.Equal(t, map[string]int{"test/object-path/a": 1, "test/object-path/b": 1, "test/object-path/c": 1}, factory.CopiedAsOfKeys)
+	checkpoint = readSnapshotCheckpoint(t, factory)
+	assert.True(t, checkpoint.Done)
+	assert.Equal(t, 3, checkpoint.Copied)
+
+	// a completed copy is not copied again
+	factory.LastCopiedPrefix = ""
+	_, _, err = p.Provision(context.Background(), v)
+	assert.NoError(t, err)
+	assert.Empty(t, factory.LastCopiedPrefix)
+}
+
+func Test_Provision_AsOf_OtherCheckpoint(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{VersionedBuckets: map[string]bool{testBucket: true}}
+	writeSnapshotCheckpoint(t, factory, snapshotCheckpoint{
+		Bucket: testBucket, ObjectPath: testObjectPath, AsOf: "2024-01-01T00:00:00Z", ClaimUID: "claim-1", After: "test/object-path/zzz", Copied: 7, Done: true,
+	})
+	p := getAsOfProvisioner(factory)
+	v := getAsOfVolumeOptions()
+	v.PVC.UID = "claim-1"
+
+	_, _, err := p.Provision(context.Background(), v)
+	assert.NoError(t, err)
+	// the copy of another point in time is deleted and the copy restarts
+	assert.Equal(t, testAsOfBucket+":"+testSnapshotPath, factory.LastDeletedObjectPath)
+	assert.Empty(t, factory.LastCopyStartAfter)
+	checkpoint := readSnapshotCheckpoint(t, factory)
+	assert.Equal(t, testAsOf, checkpoint.AsOf)
+	assert.Equal(t, 1, checkpoint.Copied)
+}
+
+func Test_Provision_AsOf_VersionID(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{VersionedBuckets: map[string]bool{testBucket: true}}
+	p := getAsOfProvisioner(factory)
+	v := getAsOfVolumeOptions()
+	v.PVC.Annotations[annotationAsOf] = "v42"
+
+	_, _, err := p.Provision(context.Background(), v)
+	assert.NoError(t, err)
+	assert.Equal(t, "v42", factory.LastCopyVersionID)
+	assert.True(t, factory.LastCopyAsOf.IsZero())
+}
+
+func Test_Provision_AsOf_NotVersioned(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getAsOfProvisioner(factory)
+
+	_, state, err := p.Provision(context.Background(), getAsOfVolumeOptions())
+	assert.ErrorIs(t, err, errBucketNotVersioned)
+	assert.Equal(t, controller.ProvisioningFinished, state)
+	assert.Empty(t, factory.LastCopiedPrefix)
+}
+
+func Test_Provision_AsOf_CopyFailure(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{
+		VersionedBuckets:   map[string]bool{testBucket: true},
+		CopyObjectsAsOfErr: errors.New("version not found"),
+	}
+	p := getAsOfProvisioner(factory)
+
+	_, state, err := p.Provision(context.Background(), getAsOfVolumeOptions())
+	assert.ErrorContains(t, err, "cannot copy bucket "+testBucket+" as of "+testAsOf)
+	assert.Equal(t, controller.ProvisioningFinished, state)
+	// the partial copy is not left behind
+	assert.Equal(t, testAsOfBucket+":"+testSnapshotPath, factory.LastDeletedObjectPath)
+	assert.NotContains(t, factory.Objects, testCheckpointKey)
+}
+
+func Test_Provision_AsOf_Invalid(t *testing.T) {
+	for name, tc := range map[string]struct {
+		update func(v *controller.ProvisionOptions)
+		err    string
+	}{
+		"read-write": {
+			update: func(v *controller.ProvisionOptions) {
+				v.PVC.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}
+			},
+			err: "as-of requires the ReadOnlyMany access mode",
+		},
+		"auto-create-bucket": {
+			update: func(v *controller.ProvisionOptions) { delete(v.PVC.Annotations, annotationAutoCreateBucket) },
+			err:    "as-of requires an existing bucket",
+		},
+		"shared-bucket": {
+			update: func(v *controller.ProvisionOptions) {
+				delete(v.PVC.Annotations, annotationBucket)
+				delete(v.PVC.Annotations, annotationObjectPath)
+				v.StorageClass.Parameters[annotationSharedBucket] = testSharedBucket
+			},
+			err: "as-of cannot be used with a shared-bucket storage class",
+		},
+		"no-as-of-bucket": {
+			update: func(v *controller.ProvisionOptions) { delete(v.StorageClass.Parameters, annotationAsOfBucket) },
+			err:    "as-of requires ibm.io/as-of-bucket in the storage class",
+		},
+		"same-bucket": {
+			update: func(v *controller.ProvisionOptions) { v.StorageClass.Parameters[annotationAsOfBucket] = testBucket },
+			err:    "as-of-bucket cannot be the bucket of the volume",
+		},
+		"bad-timestamp": {
+			update: func(v *controller.ProvisionOptions) { v.PVC.Annotations[annotationAsOf] = "2025-01-01 00:00" },
+			err:    "invalid value for as-of",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			factory := &fake.ObjectStorageSessionFactory{VersionedBuckets: map[string]bool{testBucket: true}}
+			p := getAsOfProvisioner(factory)
+			v := getAsOfVolumeOptions()
+			tc.update(&v)
+
+			_, _, err := p.Provision(context.Background(), v)
+			assert.ErrorContains(t, err, tc.err)
+			assert.Empty(t, factory.LastCopiedPrefix)
+		})
+	}
+}
+
+func getAsOfPV() *v1.PersistentVolume {
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: testPVName,
+			Annotations: map[string]string{
+				annotationBucket:             testBucket,
+				annotationObjectPath:         testObjectPath,
+				annotationAutoDeleteBucket:   "false",
+				annotationDeletionProtection: "true",
+				annotationSecretName:         testSecretName,
+				annotationSecretNamespace:    testNamespace,
+				annotationAsOf:               testAsOf,
+				annotationAsOfSnapshot:       testSnapshotPath,
+				annotationAsOfBucket:         testAsOfBucket,
+			},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				FlexVolume: &v1.FlexPersistentVolumeSource{
+					Options: map[string]string{"object-store-endpoint": testOSEndpoint, "object-store-storage-class": testStorageClass},
+				},
+			},
+		},
+	}
+}
+
+func Test_Delete_AsOf(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{ObjectPathOwners: map[string]*backend.BucketOwner{
+		testAsOfBucket + ":" + testSnapshotPath: {ClusterID: os.Getenv("CLUSTER_ID"), PVName: testPVName},
+	}}
+	writeSnapshotCheckpoint(t, factory, snapshotCheckpoint{Bucket: testBucket, AsOf: testAsOf, Done: true})
+	p := getAsOfProvisioner(factory)
+
+	err := p.Delete(context.Background(), getAsOfPV())
+	assert.NoError(t, err)
+	// the copy goes with the volume, the buckets are kept
+	assert.Equal(t, testAsOfBucket+":"+testSnapshotPath, factory.LastDeletedObjectPath)
+	assert.NotContains(t, factory.Objects, testCheckpointKey)
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Delete_AsOf_InVersionedBucket(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{ObjectPathOwners: map[string]*backend.BucketOwner{
+		testBucket + ":" + testSnapshotPath: {ClusterID: os.Getenv("CLUSTER_ID"), PVName: testPVName},
+	}}
+	p := getAsOfProvisioner(factory)
+	pv := getAsOfPV()
+	delete(pv.Annotations, annotationAsOfBucket)
+
+	err := p.Delete(context.Background(), pv)
+	assert.NoError(t, err)
+	assert.Equal(t, testBucket+":"+testSnapshotPath, factory.LastDeletedObjectPath)
+}
@@ -0,0 +1,98 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/endpoints"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/kms"
+)
+
+// allNamespaces is the key of the root keys usable in every namespace
+const allNamespaces = "*"
+
+// KMSKeyAllowlist lists, by namespace, the root key CRNs PVCs may select
+// with ibm.io/kms-root-key-crn. The keys listed under "*" are allowed in
+// every namespace.
+type KMSKeyAllowlist map[string][]string
+
+// LoadKMSKeyAllowlist reads a JSON root key allowlist from path
+func LoadKMSKeyAllowlist(path string) (KMSKeyAllowlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var allowlist KMSKeyAllowlist
+	if err := json.Unmarshal(data, &allowlist); err != nil {
+		return nil, fmt.Errorf("cannot parse root key allowlist %s: %v", path, err)
+	}
+	for namespace, crns := range allowlist {
+		for _, crn := range crns {
+			if _, err := kms.ParseRootKeyCRN(crn); err != nil {
+				return nil, fmt.Errorf("namespace %s: %v", namespace, err)
+			}
+		}
+	}
+	return allowlist, nil
+}
+
+func (a KMSKeyAllowlist) allows(namespace, crn string) bool {
+	return containsString(a[namespace], crn) || containsString(a[allNamespaces], crn)
+}
+
+// rootKeyCRN returns the root key encrypting the bucket created for a PVC:
+// the key selected by the PVC if allowed in its namespace, else the key of
+// the secret. The key is checked against the region of the bucket.
+func (p *IBMS3fsProvisioner) rootKeyCRN(namespace string, pvc *pvcAnnotations, secretCRN, locationConstraint string) (string, error) {
+	crn := secretCRN
+	if pvc.KMSRootKeyCRN != "" {
+		if p.KMSKeyAllowlist == nil {
+			return "", errors.New("ibm.io/kms-root-key-crn is not enabled, ask the cluster administrator to configure a root key allowlist")
+		}
+		if !p.KMSKeyAllowlist.allows(namespace, pvc.KMSRootKeyCRN) {
+			return "", fmt.Errorf("root key %s is not allowed in namespace %s", pvc.KMSRootKeyCRN, namespace)
+		}
+		crn = pvc.KMSRootKeyCRN
+	}
+	if crn == "" {
+		return "", nil
+	}
+
+	key, err := kms.ParseRootKeyCRN(crn)
+	if err != nil {
+		return "", err
+	}
+	// location constraints outside the catalog are not checked
+	if region, _, err := endpoints.ParseLocationConstraint(locationConstraint); err == nil {
+		if err := key.CheckBucketRegion(region); err != nil {
+			return "", err
+		}
+	}
+	return crn, nil
+}
+
+// verifyBucketEncryption checks that bucket reports the root key it was created with
+func verifyBucketEncryption(ctx context.Context, sess backend.ObjectStorageSession, bucket, crn string) error {
+	enc, err := sess.GetBucketEncryptionWithContext(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("cannot verify the encryption of bucket %s: %w", bucket, err)
+	}
+	if !enc.KPEnabled || enc.RootKeyCRN != crn {
+		return fmt.Errorf("bucket %s is not encrypted with root key %s, it reports key %q", bucket, crn, enc.RootKeyCRN)
+	}
+	return nil
+}
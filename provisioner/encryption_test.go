@@ -0,0 +1,169 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fakeProvider "github.com/IBM/ibmcloud-object-storage-plugin/ibm-provider/provider/fake-provider"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake"
+	fakeGrpcClient "github.com/IBM/ibmcloud-object-storage-plugin/utils/grpc-client/fake-grpc"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/uuid"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v6/controller"
+)
+
+const (
+	annotationKMSRootKeyCRN = "ibm.io/kms-root-key-crn"
+	testKPRootKeyCRN        = "crn:v1:bluemix:public:kms:us-south:a/test-account:test-kp-instance:key:test-key"
+	testHPCSRootKeyCRN      = "crn:v1:bluemix:public:hs-crypto:us-south:a/test-account:test-hpcs-instance:key:test-hpcs-key"
+)
+
+func getEncryptionProvisioner(factory *fake.ObjectStorageSessionFactory, withSecretKey bool) *IBMS3fsProvisioner {
+	return getCustomProvisioner(
+		&clientGoConfig{withKPRootKeyCRN: withSecretKey},
+		factory,
+		&fakeGrpcClient.FakeGrpcSessionFactory{},
+		&fake.FakeAccessPolicyFactory{},
+		&fakeProvider.FakeIBMProviderClientFactory{},
+		uuid.NewCryptoGenerator(),
+	)
+}
+
+func getEncryptionVolumeOptions() controller.ProvisionOptions {
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.StorageClass.Parameters[parameterStorageClass] = "us-south-standard"
+	return v
+}
+
+func Test_LoadKMSKeyAllowlist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"*": ["`+testKPRootKeyCRN+`"], "team-a": ["`+testHPCSRootKeyCRN+`"]}`), 0600))
+
+	allowlist, err := LoadKMSKeyAllowlist(path)
+	if assert.NoError(t, err) {
+		assert.True(t, allowlist.allows("team-a", testHPCSRootKeyCRN))
+		assert.True(t, allowlist.allows("team-b", testKPRootKeyCRN))
+		assert.False(t, allowlist.allows("team-b", testHPCSRootKeyCRN))
+	}
+}
+
+func Test_LoadKMSKeyAllowlist_BadCRN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"team-a": ["test-key"]}`), 0600))
+
+	_, err := LoadKMSKeyAllowlist(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "namespace team-a: bad root key CRN")
+	}
+}
+
+func Test_Provision_SecretRootKey(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getEncryptionProvisioner(factory, true)
+
+	_, _, err := p.Provision(context.Background(), getEncryptionVolumeOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, testKPRootKeyCRN, factory.LastRootKeyCRN)
+}
+
+func Test_Provision_PVCRootKey(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getEncryptionProvisioner(factory, true)
+	p.KMSKeyAllowlist = KMSKeyAllowlist{testNamespace: {testHPCSRootKeyCRN}}
+	v := getEncryptionVolumeOptions()
+	v.PVC.Annotations[annotationKMSRootKeyCRN] = testHPCSRootKeyCRN
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testHPCSRootKeyCRN, pv.Annotations[annotationKMSRootKeyCRN])
+	}
+	assert.Equal(t, testHPCSRootKeyCRN, factory.LastRootKeyCRN)
+}
+
+func Test_Provision_PVCRootKey_AllNamespaces(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getEncryptionProvisioner(factory, false)
+	p.KMSKeyAllowlist = KMSKeyAllowlist{allNamespaces: {testHPCSRootKeyCRN}}
+	v := getEncryptionVolumeOptions()
+	v.PVC.Annotations[annotationKMSRootKeyCRN] = testHPCSRootKeyCRN
+
+	_, _, err := p.Provision(context.Background(), v)
+	assert.NoError(t, err)
+	assert.Equal(t, testHPCSRootKeyCRN, factory.LastRootKeyCRN)
+}
+
+func Test_Provision_PVCRootKey_NotAllowed(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getEncryptionProvisioner(factory, false)
+	p.KMSKeyAllowlist = KMSKeyAllowlist{"other-namespace": {testHPCSRootKeyCRN}}
+	v := getEncryptionVolumeOptions()
+	v.PVC.Annotations[annotationKMSRootKeyCRN] = testHPCSRootKeyCRN
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "is not allowed in namespace "+testNamespace)
+	}
+	assert.Empty(t, factory.LastCreatedBucket)
+}
+
+func Test_Provision_PVCRootKey_AllowlistDisabled(t *testing.T) {
+	p := getEncryptionProvisioner(&fake.ObjectStorageSessionFactory{}, false)
+	v := getEncryptionVolumeOptions()
+	v.PVC.Annotations[annotationKMSRootKeyCRN] = testHPCSRootKeyCRN
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "ibm.io/kms-root-key-crn is not enabled")
+	}
+}
+
+func Test_Provision_PVCRootKey_WithoutAutoCreate(t *testing.T) {
+	p := getEncryptionProvisioner(&fake.ObjectStorageSessionFactory{}, false)
+	v := getEncryptionVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	v.PVC.Annotations[annotationKMSRootKeyCRN] = testHPCSRootKeyCRN
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "ibm.io/kms-root-key-crn can only be set when auto-create is enabled")
+	}
+}
+
+func Test_Provision_RootKey_RegionMismatch(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getEncryptionProvisioner(factory, true)
+	v := getEncryptionVolumeOptions()
+	v.StorageClass.Parameters[parameterStorageClass] = "eu-de-smart"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Key Protect root key of us-south cannot encrypt buckets of eu-de")
+	}
+	assert.Empty(t, factory.LastCreatedBucket)
+}
+
+func Test_Provision_RootKey_NotReported(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{BucketEncryption: &backend.BucketEncryption{}}
+	p := getEncryptionProvisioner(factory, true)
+
+	_, _, err := p.Provision(context.Background(), getEncryptionVolumeOptions())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bucket "+testBucket+" is not encrypted with root key "+testKPRootKeyCRN)
+	}
+	assert.Equal(t, testBucket, factory.LastDeletedBucket)
+}
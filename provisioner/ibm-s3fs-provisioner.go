@@ -12,27 +12,29 @@ package provisioner
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"net"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/IBM/ibmcloud-object-storage-plugin/driver"
 	"github.com/IBM/ibmcloud-object-storage-plugin/ibm-provider/provider"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/endpoints"
 	grpcClient "github.com/IBM/ibmcloud-object-storage-plugin/utils/grpc-client"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/logger"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/parser"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/uuid"
 	"go.uber.org/zap"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/sig-storage-lib-external-provisioner/v6/controller"
 )
@@ -69,6 +71,24 @@ type pvcAnnotations struct {
 	AddMountParam           string `json:"ibm.io/add-mount-param,omitempty"`
 	QuotaLimit              string `json:"ibm.io/quota-limit,omitempty"`
 	BucketVersioning        string `json:"ibm.io/bucket-versioning,omitempty"`
+	DeletionProtection      string `json:"ibm.io/deletion-protection,omitempty"`
+	OnDelete                string `json:"ibm.io/on-delete,omitempty"`
+	ArchiveBucket           string `json:"ibm.io/archive-bucket,omitempty"`
+	ArchivePrefix           string `json:"ibm.io/archive-prefix,omitempty"`
+	ArchivePath             string `json:"ibm.io/archive-path,omitempty"`
+	SharedBucket            string `json:"ibm.io/shared-bucket,omitempty"`
+	KMSRootKeyCRN           string `json:"ibm.io/kms-root-key-crn,omitempty"`
+	UseCache                string `json:"ibm.io/use-cache,omitempty"`
+	CacheSizeMB             string `json:"ibm.io/cache-size-mb,omitempty"`
+	CacheDiskFreeMB         string `json:"ibm.io/cache-disk-free-mb,omitempty"`
+	UID                     string `json:"ibm.io/uid,omitempty"`
+	GID                     string `json:"ibm.io/gid,omitempty"`
+	Umask                   string `json:"ibm.io/umask,omitempty"`
+	MountPointUmask         string `json:"ibm.io/mp-umask,omitempty"`
+	PerformanceProfile      string `json:"ibm.io/performance-profile,omitempty"`
+	AsOf                    string `json:"ibm.io/as-of,omitempty"`
+	AsOfSnapshot            string `json:"ibm.io/as-of-snapshot,omitempty"`
+	AsOfBucket              string `json:"ibm.io/as-of-bucket,omitempty"`
 }
 
 // Storage Class options
@@ -92,11 +112,28 @@ type scOptions struct {
 	IAMEndpoint             string `json:"ibm.io/iam-endpoint,omitempty"`
 	OSEndpoint              string `json:"ibm.io/object-store-endpoint,omitempty"`
 	OSStorageClass          string `json:"ibm.io/object-store-storage-class,omitempty"`
+	OSRegion                string `json:"ibm.io/object-store-region,omitempty"`
+	OSNetwork               string `json:"ibm.io/object-store-network,omitempty"`
 	ConnectTimeoutSeconds   string `json:"ibm.io/connect-timeout,omitempty"`
 	ReadwriteTimeoutSeconds string `json:"ibm.io/readwrite-timeout,omitempty"`
 	UseXattr                bool   `json:"ibm.io/use-xattr,string"`
 	AddMountParam           string `json:"ibm.io/add-mount-param,omitempty"`
 	BucketVersioning        string `json:"ibm.io/bucket-versioning,omitempty"`
+	OnDelete                string `json:"ibm.io/on-delete,omitempty"`
+	ArchiveBucket           string `json:"ibm.io/archive-bucket,omitempty"`
+	ArchivePrefix           string `json:"ibm.io/archive-prefix,omitempty"`
+	AsOfBucket              string `json:"ibm.io/as-of-bucket,omitempty"`
+	SharedBucket            string `json:"ibm.io/shared-bucket,omitempty"`
+	UseCache                bool   `json:"ibm.io/use-cache,string,omitempty"`
+	CacheSizeMB             int    `json:"ibm.io/cache-size-mb,string,omitempty"`
+	CacheDiskFreeMB         int    `json:"ibm.io/cache-disk-free-mb,string,omitempty"`
+	UID                     string `json:"ibm.io/uid,omitempty"`
+	GID                     string `json:"ibm.io/gid,omitempty"`
+	Umask                   string `json:"ibm.io/umask,omitempty"`
+	MountPointUmask         string `json:"ibm.io/mp-umask,omitempty"`
+	S3fsMemoryLimit         string `json:"ibm.io/s3fs-memory-limit,omitempty"`
+	S3fsCPULimit            string `json:"ibm.io/s3fs-cpu-limit,omitempty"`
+	ClientSideEncryption    bool   `json:"ibm.io/client-side-encryption,string,omitempty"`
 }
 
 const (
@@ -109,12 +146,19 @@ const (
 	clusterTypeClassic   = "cruiser"
 	ResConfApiKey        = "res-conf-apikey" // #nosec G101 -- False positive
 	KPRootKeyCRN         = "kp-root-key-crn"
+	// onDeleteArchive copies the data of a volume to the archive bucket before deleting its bucket
+	onDeleteArchive = "archive"
+	// archiveTimeFormat timestamps the archive of a volume
+	archiveTimeFormat = "20060102T150405Z"
+	// annotationArchivePath records on the PV the archive path of its volume
+	annotationArchivePath = "ibm.io/archive-path"
 )
 
 var SockEndpoint *string
 var ConfigBucketAccessPolicy *bool
 var ConfigQuotaLimit *bool
 var AllowCrossNsSecret *bool
+var AllowUnmarkedBucketDeletion *bool
 
 // IBMS3fsProvisioner is a dynamic provisioner of persistent volumes backed by Object Storage via s3fs
 type IBMS3fsProvisioner struct {
@@ -126,6 +170,8 @@ type IBMS3fsProvisioner struct {
 	AccessPolicy backend.AccessPolicyFactory
 	// IBMProvider is the ibm provider client
 	IBMProvider provider.IBMProviderClientFactory
+	// ProviderTypeCache caches the cluster type returned by the ibm provider, nil disables caching
+	ProviderTypeCache *grpcClient.ProviderTypeCache
 
 	// Logger will be used for logging
 	Logger *zap.Logger
@@ -133,16 +179,32 @@ type IBMS3fsProvisioner struct {
 	Client kubernetes.Interface
 	// UUIDGenerator is a UUID generator that will be used to generate bucket names
 	UUIDGenerator uuid.Generator
+	// KMSKeyAllowlist lists the root keys PVCs may select, nil disables
+	// ibm.io/kms-root-key-crn
+	KMSKeyAllowlist KMSKeyAllowlist
+	// RegionEndpoints selects the COS endpoint of created buckets from the
+	// region of the volume topology, nil disables topology awareness
+	RegionEndpoints RegionEndpoints
+
+	// snapshotMu guards snapshotJobs
+	snapshotMu sync.Mutex
+	// snapshotJobs are the copies of point-in-time volumes running in the background, by PV name
+	snapshotJobs map[string]*snapshotJob
 }
 
 var _ controller.Provisioner = &IBMS3fsProvisioner{}
+
+var (
+	// errBucketNotOwned is returned when deleting a bucket that was not created for the volume
+	errBucketNotOwned = errors.New("bucket was not created for this volume, delete it manually if it is no longer needed")
+	// errDeletionProtected is returned when deleting a volume annotated with ibm.io/deletion-protection
+	errDeletionProtected = errors.New("deletion protection is enabled, remove the ibm.io/deletion-protection annotation of the PV to delete it")
+)
 var writeFile = os.WriteFile
+var readFile = os.ReadFile
 
-func UnixConnect(addr string, t time.Duration) (net.Conn, error) {
-	unix_addr, _ := net.ResolveUnixAddr("unix", addr)
-	conn, err := net.DialUnix("unix", nil, unix_addr)
-	return conn, err
-}
+// crtFileMu serializes the writes of the CA bundles
+var crtFileMu sync.Mutex
 
 func parseSecret(secret *v1.Secret, keyName string) (string, error) {
 	bytesVal, ok := secret.Data[keyName]
@@ -166,11 +228,18 @@ func (p *IBMS3fsProvisioner) writeCrtFile(ctx context.Context, secretName, secre
 		//CA Cert not provided, try default one
 		return nil
 	}
-	if err = writeFile(crtFile, []byte(crtKey), 0600); err != nil {
-		return err
+	// the bundle is read for every volume measured, it is only rewritten when it changes
+	crtFileMu.Lock()
+	defer crtFileMu.Unlock()
+	if current, err := readFile(crtFile); err != nil || string(current) != crtKey {
+		if err = writeFile(crtFile, []byte(crtKey), 0600); err != nil {
+			return err
+		}
 	}
-	if err = os.Setenv("AWS_CA_BUNDLE", crtFile); err != nil {
-		return err
+	if os.Getenv("AWS_CA_BUNDLE") != crtFile {
+		if err = os.Setenv("AWS_CA_BUNDLE", crtFile); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -225,6 +294,57 @@ func (p *IBMS3fsProvisioner) getCredentials(ctx context.Context, secretName, sec
 	}, allowedNamespace, resConfApiKey, kpRootKeyCrn, nil
 }
 
+// getProviderType returns the cluster type, served from ProviderTypeCache when possible
+func (p *IBMS3fsProvisioner) getProviderType(ctx context.Context, providerClient provider.IBMProviderClient, name string) (string, error) {
+	if providerType, ok := p.ProviderTypeCache.Get(); ok {
+		return providerType, nil
+	}
+	clusterTypeResp, err := providerClient.GetProviderType(ctx, &provider.ProviderTypeRequest{Id: name})
+	if err != nil {
+		return "", err
+	}
+	providerType := clusterTypeResp.GetType()
+	p.ProviderTypeCache.Set(providerType)
+	return providerType, nil
+}
+
+// checkLocationConstraint checks the location constraint of buckets served by
+// an IBM COS endpoint against the catalog. Other endpoints are not checked.
+func checkLocationConstraint(locationConstraint, osEndpoint string) error {
+	endpointRegion := endpoints.RegionOf(osEndpoint)
+	if endpointRegion == "" || locationConstraint == "" {
+		return nil
+	}
+	region, _, err := endpoints.ParseLocationConstraint(locationConstraint)
+	if err != nil {
+		return err
+	}
+	if region != endpointRegion {
+		return fmt.Errorf("location constraint %q is in region %s but endpoint %s serves region %s, use %s-<tier>",
+			locationConstraint, region, osEndpoint, endpointRegion, endpointRegion)
+	}
+	return nil
+}
+
+// resolveEndpoints fills the endpoints not set in the storage class from the
+// catalog entry of its region. The network type defaults to public.
+func resolveEndpoints(sc *scOptions) error {
+	if sc.OSNetwork == "" {
+		sc.OSNetwork = endpoints.NetworkPublic
+	}
+	eps, err := endpoints.Resolve(sc.OSRegion, sc.OSNetwork)
+	if err != nil {
+		return err
+	}
+	if sc.OSEndpoint == "" {
+		sc.OSEndpoint = eps.S3
+	}
+	if sc.IAMEndpoint == "" {
+		sc.IAMEndpoint = eps.IAM
+	}
+	return nil
+}
+
 func (p *IBMS3fsProvisioner) validateAnnotations(ctx context.Context, options controller.ProvisionOptions) (pvcAnnotations, scOptions, string, error) {
 	var pvc pvcAnnotations
 	var sc scOptions
@@ -240,9 +360,17 @@ func (p *IBMS3fsProvisioner) validateAnnotations(ctx context.Context, options co
 		return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":cannot unmarshal PVC annotations: %v", err)
 	}
 
-	if err := parser.UnmarshalMap(&options.StorageClass.Parameters, &sc); err != nil {
+	scParams, profile, err := expandPerformanceProfile(options.StorageClass.Parameters, options.PVC.Annotations)
+	if err != nil {
+		return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":%v", err)
+	}
+	if err := parser.UnmarshalMap(&scParams, &sc); err != nil {
 		return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":cannot unmarshal storage class parameters: %v", err)
 	}
+	if profile != "" {
+		pvc.PerformanceProfile = profile
+		contextLogger.Info(pvcName+":"+clusterID+":expanded performance profile "+profile, zap.Any("parameters", scParams))
+	}
 
 	if pvc.SecretName == "" {
 		if sc.SecretName != "" {
@@ -301,6 +429,20 @@ func (p *IBMS3fsProvisioner) validateAnnotations(ctx context.Context, options co
 		return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for auto-delete-bucket, expects true/false: %v", err)
 	}
 
+	// with a shared bucket every claim gets its own object path in the
+	// bucket of the storage class, which is neither created nor deleted. The
+	// path is named after the volume too, so that a claim recreated with the
+	// same name never lands in the path of the previous one.
+	pvc.SharedBucket = sc.SharedBucket
+	if pvc.SharedBucket != "" {
+		if (pvc.Bucket != "" && pvc.Bucket != pvc.SharedBucket) || pvc.ObjectPath != "" {
+			return pvc, sc, svcIp, errors.New(pvcName + ":" + clusterID + ":bucket and object-path cannot be set with a shared-bucket storage class")
+		}
+		pvc.Bucket = pvc.SharedBucket
+		pvc.ObjectPath = "/" + options.PVC.Namespace + "/" + pvcName + "-" + options.PVName
+		pvc.AutoCreateBucket = "false"
+	}
+
 	if pvc.Bucket == "" && sc.Bucket != "" {
 		pvc.Bucket = sc.Bucket
 	}
@@ -328,6 +470,42 @@ func (p *IBMS3fsProvisioner) validateAnnotations(ctx context.Context, options co
 		}
 	}
 
+	if pvc.DeletionProtection != "" {
+		if _, err := strconv.ParseBool(pvc.DeletionProtection); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for deletion-protection, expects true/false: %v", err)
+		}
+	}
+
+	if pvc.OnDelete == "" {
+		pvc.OnDelete = sc.OnDelete
+	}
+	// the archive is chosen by the storage class, not by the claim
+	pvc.ArchiveBucket, pvc.ArchivePrefix = sc.ArchiveBucket, strings.Trim(sc.ArchivePrefix, "/")
+	switch pvc.OnDelete {
+	case "":
+	case onDeleteArchive:
+		if pvc.ArchiveBucket == "" {
+			return pvc, sc, svcIp, errors.New(pvcName + ":" + clusterID + ":on-delete archive requires ibm.io/archive-bucket in the storage class")
+		}
+		if pvc.ArchiveBucket == pvc.Bucket {
+			return pvc, sc, svcIp, errors.New(pvcName + ":" + clusterID + ":archive-bucket cannot be the bucket of the volume")
+		}
+		// archiving deletes the bucket, existing buckets carry no ownership marker
+		if pvc.AutoCreateBucket != "true" && pvc.SharedBucket == "" {
+			return pvc, sc, svcIp, errors.New(pvcName + ":" + clusterID + ":on-delete archive requires auto-create-bucket or a shared-bucket storage class")
+		}
+	default:
+		return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for on-delete, expects %s: %s", onDeleteArchive, pvc.OnDelete)
+	}
+
+	if pvc.AsOf != "" {
+		pvc.AsOfBucket = sc.AsOfBucket
+		if err := validateAsOf(&pvc, options.PVC.Spec.AccessModes); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":%v", err)
+		}
+		pvc.AsOfSnapshot = snapshotPath(options.PVName)
+	}
+
 	if pvc.CosServiceName != "" {
 		// TLS enabled COS Service
 		if pvc.CosServiceNamespace != "" {
@@ -347,6 +525,15 @@ func (p *IBMS3fsProvisioner) validateAnnotations(ctx context.Context, options co
 		return pvc, sc, svcIp, fmt.Errorf("cannot retrieve secret: %v", err)
 	}
 
+	if sc.OSNetwork != "" && sc.OSRegion == "" {
+		return pvc, sc, svcIp, errors.New(pvcName + ":" + clusterID + ":ibm.io/object-store-network requires ibm.io/object-store-region")
+	}
+	if sc.OSRegion != "" {
+		if err := resolveEndpoints(&sc); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":cannot resolve endpoints of ibm.io/object-store-region: %v", err)
+		}
+	}
+
 	//Override value of EndPoint defined in storageclass
 	// EndPoint should be defined in storage class.
 	if pvc.Endpoint != "" {
@@ -443,10 +630,81 @@ func (p *IBMS3fsProvisioner) validateAnnotations(ctx context.Context, options co
 		sc.ReadwriteTimeoutSeconds = pvc.ReadwriteTimeoutSeconds
 	}
 
+	//Override the disk cache parameters defined in storageclass
+	if pvc.UseCache != "" {
+		if sc.UseCache, err = strconv.ParseBool(pvc.UseCache); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for use-cache, expects true/false: %v", err)
+		}
+	}
+	if pvc.CacheSizeMB != "" {
+		if sc.CacheSizeMB, err = strconv.Atoi(pvc.CacheSizeMB); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":Cannot convert value of cache-size-mb into integer: %v", err)
+		}
+	}
+	if pvc.CacheDiskFreeMB != "" {
+		if sc.CacheDiskFreeMB, err = strconv.Atoi(pvc.CacheDiskFreeMB); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":Cannot convert value of cache-disk-free-mb into integer: %v", err)
+		}
+	}
+	if sc.CacheSizeMB < 0 || sc.CacheDiskFreeMB < 0 {
+		return pvc, sc, svcIp, errors.New(pvcName + ":" + clusterID + ":values of cache-size-mb and cache-disk-free-mb should be >= 0")
+	}
+
+	//Override the ownership of the mount defined in storageclass, the
+	//driver defaults to the user and group of the pod
+	if pvc.UID != "" {
+		sc.UID = pvc.UID
+	}
+	if pvc.GID != "" {
+		sc.GID = pvc.GID
+	}
+	if pvc.Umask != "" {
+		sc.Umask = pvc.Umask
+	}
+	if pvc.MountPointUmask != "" {
+		sc.MountPointUmask = pvc.MountPointUmask
+	}
+	if sc.UID != "" {
+		if sc.UID, err = driver.ParseID(sc.UID); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for uid: %v", err)
+		}
+	}
+	if sc.GID != "" {
+		if sc.GID, err = driver.ParseID(sc.GID); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for gid: %v", err)
+		}
+	}
+	if sc.Umask != "" {
+		if sc.Umask, err = driver.ParseUmask(sc.Umask); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for umask: %v", err)
+		}
+	}
+	if sc.MountPointUmask != "" {
+		if sc.MountPointUmask, err = driver.ParseUmask(sc.MountPointUmask); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for mp-umask: %v", err)
+		}
+	}
+
+	//The resource limits of s3fs are only set by the storageclass
+	if sc.S3fsMemoryLimit != "" {
+		if _, err = driver.ParseMemoryLimit(sc.S3fsMemoryLimit); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for s3fs-memory-limit: %v", err)
+		}
+	}
+	if sc.S3fsCPULimit != "" {
+		if _, err = driver.ParseCPULimit(sc.S3fsCPULimit); err != nil {
+			return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":invalid value for s3fs-cpu-limit: %v", err)
+		}
+	}
+
 	if pvc.AutoCreateBucket == "true" && pvc.ObjectPath != "" {
 		return pvc, sc, svcIp, fmt.Errorf(pvcName+":"+clusterID+":object-path cannot be set when auto-create is enabled, got: %s", pvc.ObjectPath)
 	}
 
+	if pvc.KMSRootKeyCRN != "" && pvc.AutoCreateBucket != "true" {
+		return pvc, sc, svcIp, errors.New(pvcName + ":" + clusterID + ":ibm.io/kms-root-key-crn can only be set when auto-create is enabled")
+	}
+
 	// Additional parameter should be of form "-o opt1 -o opt2=xxx -o opt3"
 	if pvc.AddMountParam != "" {
 		sc.AddMountParam = pvc.AddMountParam
@@ -462,7 +720,7 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 	var pvcName = options.PVC.Name
 	var pvcNamespace = options.PVC.Namespace
 	var clusterID = os.Getenv("CLUSTER_ID")
-	var msg, resConfApiKey, kpRootKeyCrn, providerType, vpcServiceEndpoints string
+	var resConfApiKey, kpRootKeyCrn, providerType, vpcServiceEndpoints string
 	var valBucket = true // nolint:ineffassign
 	var allowedNamespace []string
 	var creds *backend.ObjectStorageCredentials
@@ -477,6 +735,8 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 
 	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
+	// a bucket created by this request is still removed when ctx has expired
+	rollbackCtx := context.WithoutCancel(ctx)
 	contextLogger, _ := logger.GetZapDefaultContextLogger()
 	contextLogger.Info(pvcName + ":" + clusterID + ":Provisioning storage with these spec")
 	contextLogger.Info(pvcName+":"+clusterID+":PVC Details: ", zap.String("pvc", options.PVName))
@@ -485,9 +745,20 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 	if err != nil {
 		return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+":cannot validate annotations: %v", err)
 	}
+	regionKey, region, err := p.applyRegionEndpoint(options, &pvc, &sc)
+	if err != nil {
+		return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+":cannot select region: %v", err)
+	}
+	if region != "" {
+		contextLogger.Info(pvcName+":"+clusterID+":selected COS endpoint of region "+region,
+			zap.String("endpoint", sc.OSEndpoint), zap.String("location", sc.OSStorageClass))
+	}
+	progress := p.loadProgress(ctx, options.PVC)
 
+	// bucketGenerated is set when the bucket name is generated by the provisioner
+	bucketGenerated := false
 	//this handles the case where AutoDeleteBucket is set to true
-	if pvc.AutoDeleteBucket == "true" {
+	if pvc.AutoDeleteBucket == "true" && pvc.SharedBucket == "" {
 		if pvc.AutoCreateBucket == "false" {
 			return nil, controller.ProvisioningFinished, errors.New(pvcName + ":" + clusterID + ":bucket auto-create must be enabled when bucket auto-delete is enabled")
 		}
@@ -497,15 +768,14 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 		//}
 
 		if pvc.Bucket == "" {
-			id, err := p.UUIDGenerator.New()
-			if err != nil {
+			if pvc.Bucket, err = p.newBucketName(progress); err != nil {
 				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+":cannot create UUID for bucket name: %v", err)
 			}
-			pvc.Bucket = autoBucketNamePrefix + id
+			bucketGenerated = true
 		}
 	}
 
-	if pvc.ValidateBucket == "no" && pvc.AutoCreateBucket == "false" {
+	if pvc.ValidateBucket == "no" && pvc.AutoCreateBucket == "false" && pvc.SharedBucket == "" && pvc.AsOf == "" {
 		valBucket = false
 	} else {
 		valBucket = true
@@ -538,7 +808,7 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 
 	contextLogger.Info(pvcName + ":" + clusterID + " ConfigBucketAccessPolicy: " + strconv.FormatBool(*ConfigBucketAccessPolicy) + ", SetQuotaLimit: " + strconv.FormatBool(*ConfigQuotaLimit))
 
-	if ConfigQuotaLimit != nil && *ConfigQuotaLimit && pvc.QuotaLimit != "false" {
+	if ConfigQuotaLimit != nil && *ConfigQuotaLimit && pvc.QuotaLimit != "false" && pvc.SharedBucket == "" {
 
 		updateAP = p.AccessPolicy.NewAccessPolicy()
 		rcc = &backend.UpdateAPObj{}
@@ -553,6 +823,8 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 	} else {
 		if pvc.QuotaLimit == "false" {
 			contextLogger.Info(pvcName + ":" + clusterID + " bucket :'" + pvc.Bucket + " quota-limit annotation is set to false for this PVC. bucket quota limit will not be set for this PVC")
+		} else if pvc.SharedBucket != "" {
+			contextLogger.Info(pvcName + ":" + clusterID + " bucket :'" + pvc.Bucket + " is shared. bucket quota limit will not be set for this PVC")
 		}
 	}
 
@@ -560,28 +832,24 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 	if ConfigBucketAccessPolicy != nil && *ConfigBucketAccessPolicy && pvc.SetAccessPolicy != "false" {
 		grpcSess = p.GRPCBackend.NewGrpcSession()
 		cc := &grpcClient.GrpcSes{}
-		// nolint:staticcheck // WithBlock and WithDialer are deprecated but required with grpc.Dial until NewClient is available
-		conn, err := grpcSess.GrpcDial(cc, *SockEndpoint, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock(), grpc.WithDialer(UnixConnect))
+		// the connection is shared across provision requests and must not be closed here
+		conn, err := grpcSess.GrpcDial(cc, *SockEndpoint)
 
 		if err != nil {
 			return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+":failed to establish grpc-client connection: %v", err)
 		}
 
 		providerClient = p.IBMProvider.NewIBMProviderClient(conn)
-		if conn != nil {
-			defer func() { _ = conn.Close() }()
-		}
 
 		name := defaultName
 		if len(os.Args) > 1 {
 			name = os.Args[1]
 		}
 
-		clusterTypeResp, err := providerClient.GetProviderType(ctx, &provider.ProviderTypeRequest{Id: name})
+		providerType, err = p.getProviderType(ctx, providerClient, name)
 		if err != nil {
 			return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :failed to get provider type for cluster: %v", err)
 		}
-		providerType = clusterTypeResp.GetType()
 		contextLogger.Info(pvcName + ":" + clusterID + " : ClusterType  : " + providerType)
 
 		if strings.Contains(providerType, clusterTypeVpcG2) {
@@ -624,132 +892,229 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 	}
 
 	if pvc.AutoCreateBucket == "true" {
-		var deleteBucket = true
+		// only the buckets created here are held to the catalog, existing
+		// buckets may carry legacy location constraints
+		if err := checkLocationConstraint(sc.OSStorageClass, sc.OSEndpoint); err != nil {
+			return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+":Bad value for ibm.io/object-store-storage-class: %v", err)
+		}
 		if pvc.AutoDeleteBucket != "true" && pvc.Bucket == "" { //this handles the cases where AutoDeleteBucket is set false and bucket is not specified.
-			id, err := p.UUIDGenerator.New()
-			if err != nil {
+			if pvc.Bucket, err = p.newBucketName(progress); err != nil {
 				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+":cannot create UUID for bucket name: %v", err)
 			}
-			pvc.Bucket = autoBucketNamePrefix + id
+			bucketGenerated = true
 		}
 
 		if creds.APIKey != "" && creds.ServiceInstanceID == "" {
 			return nil, controller.ProvisioningFinished, errors.New(pvcName + ":" + clusterID + " :cannot create bucket using API key without service-instance-id")
 		}
 
+		if progress.Bucket != pvc.Bucket {
+			// record a generated bucket name before creating the bucket, so
+			// that the next attempt does not create another one
+			progress = &provisioningProgress{Bucket: pvc.Bucket}
+			if err := p.saveProgress(ctx, options.PVC, progress); err != nil {
+				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :cannot record provisioning progress: %v", err)
+			}
+		} else if len(progress.Done) > 0 || progress.BucketCreated {
+			contextLogger.Info(pvcName+":"+clusterID+" :resuming provisioning of bucket: "+pvc.Bucket, zap.Strings("done", progress.Done))
+		}
+
+		kpRootKeyCrn, err = p.rootKeyCRN(pvcNamespace, &pvc, kpRootKeyCrn, sc.OSStorageClass)
+		if err != nil {
+			return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :cannot encrypt bucket %s: %v", pvc.Bucket, err)
+		}
+
 		contextLogger.Info(pvcName + ":" + clusterID + " :creating bucket: " + pvc.Bucket)
 		if kpRootKeyCrn != "" {
 			contextLogger.Info("key protect root key crn provided for bucket" + pvc.Bucket)
 		}
-		msg, err = sess.CreateBucket(pvc.Bucket, sc.OSStorageClass, kpRootKeyCrn)
-		if msg != "" {
-			contextLogger.Info(pvcName + ":" + clusterID + " : " + msg)
-		}
+		_, err = sess.CreateBucketWithContext(ctx, pvc.Bucket, sc.OSStorageClass, kpRootKeyCrn)
+		owner := &backend.BucketOwner{ClusterID: clusterID, PVName: options.PVName, ClaimUID: string(options.PVC.UID)}
 		// When using existing bucket with auto-create-bucket: true
 		if err != nil {
-			if strings.Contains(fmt.Sprintf("%v", err), "BucketAlreadyExists") {
+			switch {
+			case errors.Is(err, backend.ErrBucketExists):
 				valBucket = true
-				deleteBucket = false
-				contextLogger.Info(pvcName + ":" + clusterID + " :bucket '" + pvc.Bucket + "' already exists")
-			} else {
-				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :cannot create bucket %s: %v", pvc.Bucket, err)
+				if errors.Is(err, backend.ErrBucketNotOwned) {
+					contextLogger.Info(pvcName + ":" + clusterID + " :bucket '" + pvc.Bucket + "' already exists and is owned by another service instance")
+				} else if progress.BucketCreated, err = bucketOwnedBy(ctx, sess, pvc.Bucket, owner); err != nil {
+					return nil, provisioningState(err), fmt.Errorf(pvcName+":"+clusterID+" :cannot read owner of bucket %s: %w", pvc.Bucket, err)
+				} else if progress.BucketCreated {
+					contextLogger.Info(pvcName + ":" + clusterID + " :bucket '" + pvc.Bucket + "' was created for this claim by a previous attempt")
+				} else {
+					contextLogger.Info(pvcName + ":" + clusterID + " :bucket '" + pvc.Bucket + "' already exists")
+				}
+				// a generated name is only reused for the bucket of this claim,
+				// the next attempt generates another one
+				if bucketGenerated && !progress.BucketCreated {
+					if err := p.saveProgress(ctx, options.PVC, nil); err != nil {
+						contextLogger.Warn(pvcName+":"+clusterID+" :cannot clear provisioning progress", zap.Error(err))
+					}
+					return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :generated bucket %s already exists and was not created for this claim", pvc.Bucket)
+				}
+			case errors.Is(err, backend.ErrBadCredentials):
+				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :cannot create bucket %s, check the credentials in secret %s/%s: %w", pvc.Bucket, pvc.SecretNamespace, pvc.SecretName, err)
+			case errors.Is(err, backend.ErrQuotaExceeded):
+				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :cannot create bucket %s, bucket quota of the service instance reached: %w", pvc.Bucket, err)
+			case errors.Is(err, backend.ErrBadEndpoint):
+				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :cannot create bucket %s, check the object store endpoint %s: %w", pvc.Bucket, sc.OSEndpoint, err)
+			default:
+				return nil, provisioningState(err), fmt.Errorf(pvcName+":"+clusterID+" :cannot create bucket %s: %w", pvc.Bucket, err)
+			}
+		} else {
+			// the marker of the claim is what proves to the next attempt that
+			// the bucket was created for it, so it is stamped first and the
+			// bucket is not kept without it
+			if err := sess.SetBucketOwnerWithContext(ctx, pvc.Bucket, owner); err != nil {
+				err = fmt.Errorf(pvcName+":"+clusterID+" :cannot stamp bucket %s with its owner: %w", pvc.Bucket, err)
+				if err1 := sess.DeleteBucketWithContext(rollbackCtx, pvc.Bucket); err1 != nil {
+					return nil, controller.ProvisioningFinished, fmt.Errorf("%w, and cannot delete bucket %s: %v", err, pvc.Bucket, err1)
+				}
+				return nil, provisioningState(err), err
+			}
+			progress.BucketCreated = true
+			p.recordStep(ctx, options.PVC, progress, stepOwnerMarker)
+		}
+
+		// a bucket created without the requested encryption is not used
+		if progress.BucketCreated && kpRootKeyCrn != "" && !progress.done(stepEncryption) {
+			if err := verifyBucketEncryption(ctx, sess, pvc.Bucket, kpRootKeyCrn); err != nil {
+				state, err := p.failProvisioning(rollbackCtx, options.PVC, sess, progress,
+					fmt.Errorf(pvcName+":"+clusterID+" :%w", err))
+				return nil, state, err
 			}
+			p.recordStep(ctx, options.PVC, progress, stepEncryption)
+		}
+
+		// only buckets stamped with the marker of their volume are deleted with it
+		if !progress.BucketCreated && pvc.AutoDeleteBucket == "true" {
+			contextLogger.Warn(pvcName + ":" + clusterID + " :bucket '" + pvc.Bucket + "' was not created by the provisioner and will not be deleted with the volume")
 		}
 
-		if pvc.BucketVersioning != "" {
+		if pvc.BucketVersioning != "" && !progress.done(stepBucketVersioning) {
 			enable := strings.ToLower(strings.TrimSpace(pvc.BucketVersioning)) == "true"
 			contextLogger.Info(fmt.Sprintf("%s:%s : bucket versioning value evaluated to: %t", pvcName, clusterID, enable))
 
-			err := sess.SetBucketVersioning(pvc.Bucket, enable)
+			err := sess.SetBucketVersioningWithContext(ctx, pvc.Bucket, enable)
 			if err != nil {
-				if deleteBucket {
-					err1 := sess.DeleteBucket(pvc.Bucket)
-					if err1 != nil {
-						return nil, controller.ProvisioningFinished, fmt.Errorf("%s : %s : cannot set bucket versioning: %v and cannot delete bucket %s: %v", pvcName, clusterID, err, pvc.Bucket, err1)
-					}
-				}
-				return nil, controller.ProvisioningFinished, fmt.Errorf("%s:%s : failed to set versioning %t for bucket %s: %v", pvcName, clusterID, enable, pvc.Bucket, err)
+				state, err := p.failProvisioning(rollbackCtx, options.PVC, sess, progress,
+					fmt.Errorf("%s:%s : failed to set versioning %t for bucket %s: %w", pvcName, clusterID, enable, pvc.Bucket, err))
+				return nil, state, err
 			}
 			contextLogger.Info(fmt.Sprintf("%s:%s : bucket versioning set to '%t' for bucket %s", pvcName, clusterID, enable, pvc.Bucket))
+			p.recordStep(ctx, options.PVC, progress, stepBucketVersioning)
 		}
 
-		if setBucketAccessPolicy {
+		if setBucketAccessPolicy && !progress.done(stepAccessPolicy) {
 			err := updateAP.UpdateAccessPolicy(vpcServiceEndpoints, resConfApiKey, pvc.Bucket, rcc)
 			if err != nil {
 				//revert bucket creation if updating bucket access policy fails
-				if deleteBucket {
-					err1 := sess.DeleteBucket(pvc.Bucket)
-					if err1 != nil {
-						return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+" : "+clusterID+" :cannot set access policy %v", err1, " and cannot delete bucket %s :  %v", pvc.Bucket, err)
-					}
-				}
-				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+" : "+clusterID+" :failed to set access policy for bucket %s : %v", pvc.Bucket, err)
+				state, err := p.failProvisioning(rollbackCtx, options.PVC, sess, progress,
+					fmt.Errorf(pvcName+" : "+clusterID+" :failed to set access policy for bucket %s : %w", pvc.Bucket, err))
+				return nil, state, err
 			}
 			contextLogger.Info(pvcName + ":" + clusterID + " bucket :'" + pvc.Bucket + "' access policy configured successfully")
+			p.recordStep(ctx, options.PVC, progress, stepAccessPolicy)
 		}
 
-		if setQuotaLimit {
+		if setQuotaLimit && !progress.done(stepQuotaLimit) {
 			err := updateAP.UpdateQuotaLimit(quotaLimit, resConfApiKey, pvc.Bucket, sc.OSEndpoint, sc.IAMEndpoint, rcc)
 			if err != nil {
-				//revert bucket creation if updating bucket access policy fails
-				if deleteBucket {
-					err1 := sess.DeleteBucket(pvc.Bucket)
-					if err1 != nil {
-						return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+" : "+clusterID+" :cannot set quota limit %v", err1, " and cannot delete bucket %s :  %v", pvc.Bucket, err)
-					}
-				}
-				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+" : "+clusterID+" :failed to set quota limit for bucket %s : %v", pvc.Bucket, err)
+				//revert bucket creation if updating bucket quota limit fails
+				state, err := p.failProvisioning(rollbackCtx, options.PVC, sess, progress,
+					fmt.Errorf(pvcName+" : "+clusterID+" :failed to set quota limit for bucket %s : %w", pvc.Bucket, err))
+				return nil, state, err
 			}
 			contextLogger.Info(pvcName + ":" + clusterID + " bucket :'" + pvc.Bucket + "' quota limit configured successfully")
+			p.recordStep(ctx, options.PVC, progress, stepQuotaLimit)
 		}
 	} else {
 		if pvc.Bucket == "" {
 			return nil, controller.ProvisioningFinished, errors.New(pvcName + ":" + clusterID + " :bucket name not specified")
 		}
+		if progress.Bucket != pvc.Bucket {
+			progress = &provisioningProgress{Bucket: pvc.Bucket}
+		}
 
-		if pvc.BucketVersioning != "" {
+		if pvc.BucketVersioning != "" && !progress.done(stepBucketVersioning) {
 			enable := strings.ToLower(strings.TrimSpace(pvc.BucketVersioning)) == "true"
-			err := sess.SetBucketVersioning(pvc.Bucket, enable)
+			err := sess.SetBucketVersioningWithContext(ctx, pvc.Bucket, enable)
 			if err != nil {
-				return nil, controller.ProvisioningFinished, fmt.Errorf("%s:%s : failed to set versioning for bucket %s: %v", pvcName, clusterID, pvc.Bucket, err)
+				return nil, provisioningState(err), fmt.Errorf("%s:%s : failed to set versioning for bucket %s: %w", pvcName, clusterID, pvc.Bucket, err)
 			}
 			contextLogger.Info(fmt.Sprintf("%s:%s : bucket versioning set to '%t' for bucket %s", pvcName, clusterID, enable, pvc.Bucket))
+			p.recordStep(ctx, options.PVC, progress, stepBucketVersioning)
 		}
 
 		// this enables to set access policy for existing bucket
 		// when AutoCreateBucket is false, AutoDeleteBucket is false and SetAccessPolicy is true
-		if setBucketAccessPolicy {
+		if setBucketAccessPolicy && !progress.done(stepAccessPolicy) {
 			err := updateAP.UpdateAccessPolicy(vpcServiceEndpoints, resConfApiKey, pvc.Bucket, rcc)
 			if err != nil {
-				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+" : "+clusterID+" :failed to set access policy for bucket %s : %v", pvc.Bucket, err)
+				return nil, provisioningState(err), fmt.Errorf(pvcName+" : "+clusterID+" :failed to set access policy for bucket %s : %w", pvc.Bucket, err)
 			}
-			valBucket = true
 			contextLogger.Info(pvcName + ":" + clusterID + " :bucket '" + pvc.Bucket + "' access policy configured successfully")
+			p.recordStep(ctx, options.PVC, progress, stepAccessPolicy)
+		}
+		if setBucketAccessPolicy {
+			valBucket = true
 		}
-		if setQuotaLimit {
+		if setQuotaLimit && !progress.done(stepQuotaLimit) {
 			err := updateAP.UpdateQuotaLimit(quotaLimit, resConfApiKey, pvc.Bucket, sc.OSEndpoint, sc.IAMEndpoint, rcc)
 			if err != nil {
-				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+" : "+clusterID+" :failed to set quota limit for bucket %s : %v", pvc.Bucket, err)
+				return nil, provisioningState(err), fmt.Errorf(pvcName+" : "+clusterID+" :failed to set quota limit for bucket %s : %w", pvc.Bucket, err)
 			}
 			contextLogger.Info(pvcName + ":" + clusterID + " bucket :'" + pvc.Bucket + "' quota limit configured successfully")
+			p.recordStep(ctx, options.PVC, progress, stepQuotaLimit)
 		}
 	}
 
 	if valBucket {
-		if err := sess.CheckBucketAccess(pvc.Bucket); err != nil {
-			return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+" : "+clusterID+" :cannot access bucket %s: %v", pvc.Bucket, err)
+		if err := sess.CheckBucketAccessWithContext(ctx, pvc.Bucket); err != nil {
+			if errors.Is(err, backend.ErrBucketNotFound) {
+				return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+" : "+clusterID+" :cannot access bucket %s, bucket does not exist: %w", pvc.Bucket, err)
+			}
+			return nil, provisioningState(err), fmt.Errorf(pvcName+" : "+clusterID+" :cannot access bucket %s: %w", pvc.Bucket, err)
 		}
 	}
 
-	if pvc.ObjectPath != "" {
-		exist, err := sess.CheckObjectPathExistence(pvc.Bucket, pvc.ObjectPath)
+	if pvc.SharedBucket != "" {
+		owner := &backend.BucketOwner{ClusterID: clusterID, PVName: options.PVName, ClaimUID: string(options.PVC.UID)}
+		if err := createObjectPath(ctx, sess, &pvc, owner); err != nil {
+			return nil, provisioningState(err), fmt.Errorf(pvcName+":"+clusterID+" :cannot create object-path \"%s\" inside bucket %s: %w", pvc.ObjectPath, pvc.Bucket, err)
+		}
+		contextLogger.Info(pvcName + ":" + clusterID + " :object-path '" + pvc.ObjectPath + "' created inside shared bucket '" + pvc.Bucket + "'")
+	} else if pvc.ObjectPath != "" {
+		exist, err := sess.CheckObjectPathExistenceWithContext(ctx, pvc.Bucket, pvc.ObjectPath)
 		if err != nil {
-			return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :cannot access object-path \"%s\" inside bucket %s: %v", pvc.ObjectPath, pvc.Bucket, err)
+			return nil, provisioningState(err), fmt.Errorf(pvcName+":"+clusterID+" :cannot access object-path \"%s\" inside bucket %s: %w", pvc.ObjectPath, pvc.Bucket, err)
 		} else if !exist {
 			return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+" :object-path \"%s\" not found inside bucket %s", pvc.ObjectPath, pvc.Bucket)
 		}
 	}
 
+	if pvc.AsOf != "" {
+		owner := &backend.BucketOwner{ClusterID: clusterID, PVName: options.PVName, ClaimUID: string(options.PVC.UID)}
+		n, err := p.copySnapshot(sess, &pvc, owner)
+		if errors.Is(err, errSnapshotCopying) {
+			return nil, controller.ProvisioningInBackground, fmt.Errorf(pvcName+":"+clusterID+" :copying bucket %s as of %s: %w", pvc.Bucket, pvc.AsOf, err)
+		}
+		if err != nil {
+			state := provisioningState(err)
+			if state == controller.ProvisioningFinished {
+				if err := sess.DeleteObjectPathWithContext(rollbackCtx, pvc.AsOfBucket, pvc.AsOfSnapshot); err != nil {
+					contextLogger.Warn(pvcName+":"+clusterID+" :cannot delete partial copy "+pvc.AsOfSnapshot+" of bucket "+pvc.AsOfBucket, zap.Error(err))
+				}
+				if err := sess.DeleteObjectWithContext(rollbackCtx, pvc.AsOfBucket, snapshotCheckpointKey(pvc.AsOfSnapshot)); err != nil {
+					contextLogger.Warn(pvcName+":"+clusterID+" :cannot delete checkpoint of copy "+pvc.AsOfSnapshot+" of bucket "+pvc.AsOfBucket, zap.Error(err))
+				}
+			}
+			return nil, state, fmt.Errorf(pvcName+":"+clusterID+" :cannot copy bucket %s as of %s: %w", pvc.Bucket, pvc.AsOf, err)
+		}
+		contextLogger.Info(pvcName+":"+clusterID+" :bucket '"+pvc.Bucket+"' copied as of "+pvc.AsOf,
+			zap.String("snapshot", pvc.AsOfBucket+pvc.AsOfSnapshot), zap.Int("objects", n))
+	}
+
 	if pvc.UseXattr {
 		sc.UseXattr = pvc.UseXattr
 	}
@@ -778,6 +1143,12 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 		sc.KernelCache = false
 	}
 
+	// a point-in-time volume mounts the copy of its objects
+	mountBucket, mountObjectPath := pvc.Bucket, pvc.ObjectPath
+	if pvc.AsOfSnapshot != "" {
+		mountBucket, mountObjectPath = pvc.AsOfBucket, pvc.AsOfSnapshot
+	}
+
 	driverOptions, err := parser.MarshalToMap(&driver.Options{
 		ChunkSizeMB:             sc.ChunkSizeMB,
 		ParallelCount:           sc.ParallelCount,
@@ -792,15 +1163,28 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 		IAMEndpoint:             sc.IAMEndpoint,
 		OSEndpoint:              sc.OSEndpoint,
 		OSStorageClass:          sc.OSStorageClass,
-		Bucket:                  pvc.Bucket,
-		ObjectPath:              pvc.ObjectPath,
+		OSRegion:                sc.OSRegion,
+		OSNetwork:               sc.OSNetwork,
+		Bucket:                  mountBucket,
+		ObjectPath:              mountObjectPath,
 		ReadwriteTimeoutSeconds: sc.ReadwriteTimeoutSeconds,
 		ConnectTimeoutSeconds:   sc.ConnectTimeoutSeconds,
 		UseXattr:                sc.UseXattr,
 		AccessMode:              string(accessMode[0]),
 		CosServiceIP:            svcIp,
 		AutoCache:               pvc.AutoCache,
+		UseCache:                sc.UseCache,
+		CacheSizeMB:             sc.CacheSizeMB,
+		CacheDiskFreeMB:         sc.CacheDiskFreeMB,
+		UID:                     sc.UID,
+		GID:                     sc.GID,
+		Umask:                   sc.Umask,
+		MountPointUmask:         sc.MountPointUmask,
+		S3fsMemoryLimit:         sc.S3fsMemoryLimit,
+		S3fsCPULimit:            sc.S3fsCPULimit,
 		AddMountParam:           sc.AddMountParam,
+		AsOf:                    pvc.AsOf,
+		ClientSideEncryption:    sc.ClientSideEncryption,
 	})
 	if err != nil {
 		return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+":cannot marshal driver options: %v", err)
@@ -831,12 +1215,40 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 		CosServiceName:          pvc.CosServiceName,
 		SetAccessPolicy:         pvc.SetAccessPolicy,
 		AddMountParam:           pvc.AddMountParam,
+		DeletionProtection:      pvc.DeletionProtection,
+		OnDelete:                pvc.OnDelete,
+		ArchiveBucket:           pvc.ArchiveBucket,
+		ArchivePrefix:           pvc.ArchivePrefix,
+		SharedBucket:            pvc.SharedBucket,
+		KMSRootKeyCRN:           pvc.KMSRootKeyCRN,
+		UseCache:                pvc.UseCache,
+		CacheSizeMB:             pvc.CacheSizeMB,
+		CacheDiskFreeMB:         pvc.CacheDiskFreeMB,
+		UID:                     pvc.UID,
+		GID:                     pvc.GID,
+		Umask:                   pvc.Umask,
+		MountPointUmask:         pvc.MountPointUmask,
+		PerformanceProfile:      pvc.PerformanceProfile,
+		AsOf:                    pvc.AsOf,
+		AsOfSnapshot:            pvc.AsOfSnapshot,
+		AsOfBucket:              pvc.AsOfBucket,
 	})
 
 	if err != nil {
 		return nil, controller.ProvisioningFinished, fmt.Errorf(pvcName+":"+clusterID+":cannot marshal pv options: %v", err)
 	}
 
+	if progress.saved {
+		if err := p.saveProgress(ctx, options.PVC, nil); err != nil {
+			contextLogger.Warn(pvcName+":"+clusterID+" :cannot clear provisioning progress", zap.Error(err))
+		}
+	}
+
+	var nodeAffinity *v1.VolumeNodeAffinity
+	if region != "" {
+		nodeAffinity = regionNodeAffinity(regionKey, region)
+	}
+
 	reclaimPolicy := options.StorageClass.ReclaimPolicy
 	return &v1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
@@ -846,6 +1258,7 @@ func (p *IBMS3fsProvisioner) Provision(ctx context.Context, options controller.P
 		Spec: v1.PersistentVolumeSpec{
 			PersistentVolumeReclaimPolicy: *reclaimPolicy,
 			AccessModes:                   options.PVC.Spec.AccessModes,
+			NodeAffinity:                  nodeAffinity,
 			Capacity: v1.ResourceList{
 				v1.ResourceStorage: options.PVC.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)],
 			},
@@ -878,9 +1291,29 @@ func (p *IBMS3fsProvisioner) Delete(ctx context.Context, pv *v1.PersistentVolume
 		return fmt.Errorf("cannot unmarshal PV annotations: %v", err)
 	}
 
-	if pvcAnnots.AutoDeleteBucket == "true" {
-		if err = p.deleteBucket(ctx, &pvcAnnots, endpointValue, regionValue, iamEndpoint); err != nil {
-			return fmt.Errorf("cannot delete bucket: %v", err)
+	// archiving a volume deletes its bucket once the data is copied, the
+	// point-in-time copy of a volume is deleted but never its bucket
+	if pvcAnnots.AutoDeleteBucket == "true" || pvcAnnots.OnDelete == onDeleteArchive || pvcAnnots.AsOfSnapshot != "" {
+		if protected, _ := strconv.ParseBool(pvcAnnots.DeletionProtection); protected && pvcAnnots.AsOfSnapshot == "" {
+			return fmt.Errorf("cannot delete bucket %s: %w", pvcAnnots.Bucket, errDeletionProtected)
+		}
+		owner := &backend.BucketOwner{ClusterID: os.Getenv("CLUSTER_ID"), PVName: pv.Name}
+		if pv.Spec.ClaimRef != nil {
+			owner.ClaimUID = string(pv.Spec.ClaimRef.UID)
+		}
+		// the archive path is chosen once, a retried deletion completes the same archive
+		if pvcAnnots.OnDelete == onDeleteArchive && pvcAnnots.ArchivePath == "" {
+			pvcAnnots.ArchivePath = archivePath(&pvcAnnots, pv.Name)
+			if err := p.saveArchivePath(ctx, pv, pvcAnnots.ArchivePath); err != nil {
+				return fmt.Errorf("cannot record archive path of bucket %s: %v", pvcAnnots.Bucket, err)
+			}
+		}
+		if err = p.deleteBucket(ctx, &pvcAnnots, owner, endpointValue, regionValue, iamEndpoint); err != nil {
+			switch {
+			case errors.Is(err, backend.ErrBadCredentials), errors.Is(err, backend.ErrAccessDenied):
+				return fmt.Errorf("cannot delete bucket %s, check the credentials in secret %s/%s: %w", pvcAnnots.Bucket, pvcAnnots.SecretNamespace, pvcAnnots.SecretName, err)
+			}
+			return fmt.Errorf("cannot delete bucket: %w", err)
 		}
 	} else if _, err = strconv.ParseBool(pvcAnnots.AutoDeleteBucket); err != nil {
 		return fmt.Errorf("invalid value for auto-delete-bucket, expects true/false: %v", err)
@@ -888,7 +1321,20 @@ func (p *IBMS3fsProvisioner) Delete(ctx context.Context, pv *v1.PersistentVolume
 	return nil
 }
 
-func (p *IBMS3fsProvisioner) deleteBucket(ctx context.Context, pvcAnnots *pvcAnnotations, endpointValue, regionValue, iamEndpoint string) error {
+// provisioningState returns the state reported with a failed provisioning
+// request. Throttling, timeouts and transient errors may have left the bucket
+// half created, so the claim is kept in progress and retried even if it is
+// deleted in the meantime.
+func provisioningState(err error) controller.ProvisioningState {
+	if errors.Is(err, backend.ErrThrottled) || errors.Is(err, backend.ErrTransient) || backend.ErrorReason(err) == "Timeout" {
+		return controller.ProvisioningInBackground
+	}
+	return controller.ProvisioningFinished
+}
+
+// deleteBucket deletes the bucket of a volume, or its object path in a shared
+// bucket, provided it carries the ownership marker of owner
+func (p *IBMS3fsProvisioner) deleteBucket(ctx context.Context, pvcAnnots *pvcAnnotations, owner *backend.BucketOwner, endpointValue, regionValue, iamEndpoint string) error {
 	contextLogger, _ := logger.GetZapDefaultContextLogger()
 	contextLogger.Info("Deleting the bucket..")
 	// Retrieve CA Cert if provided in secert
@@ -902,6 +1348,158 @@ func (p *IBMS3fsProvisioner) deleteBucket(ctx context.Context, pvcAnnots *pvcAnn
 	}
 	creds.IAMEndpoint = iamEndpoint
 	sess := p.Backend.NewObjectStorageSession(endpointValue, regionValue, creds, p.Logger)
+	if pvcAnnots.AsOfSnapshot != "" {
+		snapshot := *pvcAnnots
+		snapshot.ObjectPath, snapshot.OnDelete = pvcAnnots.AsOfSnapshot, ""
+		// the copies of earlier volumes are inside their versioned bucket
+		if pvcAnnots.AsOfBucket == "" {
+			return deleteObjectPath(ctx, sess, &snapshot, owner)
+		}
+		snapshot.Bucket = pvcAnnots.AsOfBucket
+		if err := deleteObjectPath(ctx, sess, &snapshot, owner); err != nil {
+			return err
+		}
+		return sess.DeleteObjectWithContext(ctx, snapshot.Bucket, snapshotCheckpointKey(snapshot.ObjectPath))
+	}
+	if pvcAnnots.SharedBucket != "" {
+		return deleteObjectPath(ctx, sess, pvcAnnots, owner)
+	}
+
+	marker, err := sess.GetBucketOwnerWithContext(ctx, pvcAnnots.Bucket)
+	switch {
+	case errors.Is(err, backend.ErrBucketNotFound):
+		contextLogger.Warn("bucket " + pvcAnnots.Bucket + " is already deleted")
+		return nil
+	case err != nil:
+		return err
+	case marker == nil && AllowUnmarkedBucketDeletion != nil && *AllowUnmarkedBucketDeletion:
+		contextLogger.Warn("deleting bucket " + pvcAnnots.Bucket + " without ownership marker")
+	case marker == nil:
+		return fmt.Errorf("bucket %s has no ownership marker: %w", pvcAnnots.Bucket, errBucketNotOwned)
+	case !ownsBucket(marker, owner):
+		return fmt.Errorf("bucket %s belongs to volume %s of cluster %s: %w", pvcAnnots.Bucket, marker.PVName, marker.ClusterID, errBucketNotOwned)
+	}
 
-	return sess.DeleteBucket(pvcAnnots.Bucket)
+	if pvcAnnots.OnDelete == onDeleteArchive {
+		if err := archiveBucket(ctx, sess, pvcAnnots); err != nil {
+			return err
+		}
+	}
+
+	return sess.DeleteBucketWithContext(ctx, pvcAnnots.Bucket)
+}
+
+// createObjectPath creates the object path of a volume in a shared bucket,
+// stamped with the ownership marker of owner. A path left by a previous
+// attempt for the same volume is reused, any other existing path is refused.
+func createObjectPath(ctx context.Context, sess backend.ObjectStorageSession, pvc *pvcAnnotations, owner *backend.BucketOwner) error {
+	marker, err := sess.GetObjectPathOwnerWithContext(ctx, pvc.Bucket, pvc.ObjectPath)
+	if err != nil {
+		return err
+	}
+	if marker != nil && !ownsBucket(marker, owner) {
+		return fmt.Errorf("object path belongs to volume %s of cluster %s", marker.PVName, marker.ClusterID)
+	}
+	if marker == nil {
+		exist, err := sess.CheckObjectPathExistenceWithContext(ctx, pvc.Bucket, pvc.ObjectPath)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return errors.New("object path already exists and was not created for this volume")
+		}
+		// the path is created with its marker, so that a retried attempt recognizes it
+		return sess.SetObjectPathOwnerWithContext(ctx, pvc.Bucket, pvc.ObjectPath, owner)
+	}
+	return nil
+}
+
+// deleteObjectPath deletes the object path of a volume in a shared bucket,
+// provided it carries the ownership marker of owner
+func deleteObjectPath(ctx context.Context, sess backend.ObjectStorageSession, pvcAnnots *pvcAnnotations, owner *backend.BucketOwner) error {
+	contextLogger, _ := logger.GetZapDefaultContextLogger()
+
+	marker, err := sess.GetObjectPathOwnerWithContext(ctx, pvcAnnots.Bucket, pvcAnnots.ObjectPath)
+	switch {
+	case errors.Is(err, backend.ErrBucketNotFound):
+		contextLogger.Warn("bucket " + pvcAnnots.Bucket + " is already deleted")
+		return nil
+	case err != nil:
+		return err
+	case marker == nil:
+		// the marker is deleted last, without it the path is either gone or not ours
+		exist, err := sess.CheckObjectPathExistenceWithContext(ctx, pvcAnnots.Bucket, pvcAnnots.ObjectPath)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return fmt.Errorf("object path %s of bucket %s has no ownership marker: %w", pvcAnnots.ObjectPath, pvcAnnots.Bucket, errBucketNotOwned)
+		}
+		contextLogger.Warn("object path " + pvcAnnots.ObjectPath + " of bucket " + pvcAnnots.Bucket + " is already deleted")
+		return nil
+	case !ownsBucket(marker, owner):
+		return fmt.Errorf("object path %s of bucket %s belongs to volume %s of cluster %s: %w", pvcAnnots.ObjectPath, pvcAnnots.Bucket, marker.PVName, marker.ClusterID, errBucketNotOwned)
+	}
+
+	if pvcAnnots.OnDelete == onDeleteArchive {
+		if err := archiveBucket(ctx, sess, pvcAnnots); err != nil {
+			return err
+		}
+	}
+	return sess.DeleteObjectPathWithContext(ctx, pvcAnnots.Bucket, pvcAnnots.ObjectPath)
+}
+
+// archivePath returns the key prefix of the archive of a volume in the archive
+// bucket, <archive-prefix>/<bucket>/<pv>-<timestamp>/
+func archivePath(pvcAnnots *pvcAnnotations, pvName string) string {
+	destPrefix := path.Join(pvcAnnots.ArchivePrefix, pvcAnnots.Bucket, pvName+"-"+time.Now().UTC().Format(archiveTimeFormat)) + "/"
+	return strings.TrimPrefix(destPrefix, "/")
+}
+
+// saveArchivePath records the archive path of a volume in the annotations of its PV
+func (p *IBMS3fsProvisioner) saveArchivePath(ctx context.Context, pv *v1.PersistentVolume, archivePath string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotationArchivePath: archivePath},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.Client.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		p.Logger.Warn("Cannot record archive path, PV not found", zap.String("pv", pv.Name))
+		return nil
+	}
+	return err
+}
+
+// archiveBucket copies the objects of a volume, those under its object path
+// if it has one, to its archive path in the archive bucket. Retention of the
+// archive is left to the lifecycle policy of the archive bucket.
+func archiveBucket(ctx context.Context, sess backend.ObjectStorageSession, pvcAnnots *pvcAnnotations) error {
+	contextLogger, _ := logger.GetZapDefaultContextLogger()
+
+	prefix := strings.TrimPrefix(pvcAnnots.ObjectPath, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	destPrefix := pvcAnnots.ArchivePath
+
+	n, err := sess.CopyObjectsWithContext(ctx, pvcAnnots.Bucket, prefix, pvcAnnots.ArchiveBucket, destPrefix)
+	if err != nil {
+		return fmt.Errorf("cannot archive bucket %s to %s/%s: %w", pvcAnnots.Bucket, pvcAnnots.ArchiveBucket, destPrefix, err)
+	}
+	contextLogger.Info("bucket "+pvcAnnots.Bucket+" archived",
+		zap.String("archive", pvcAnnots.ArchiveBucket+"/"+destPrefix), zap.Int("versions", n))
+	return nil
+}
+
+// ownsBucket reports whether the ownership marker of a bucket names owner.
+// The claim is only compared when both sides know it.
+func ownsBucket(marker, owner *backend.BucketOwner) bool {
+	if marker.ClusterID != owner.ClusterID || marker.PVName != owner.PVName {
+		return false
+	}
+	return marker.ClaimUID == "" || owner.ClaimUID == "" || marker.ClaimUID == owner.ClaimUID
 }
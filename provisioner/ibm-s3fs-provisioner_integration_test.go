@@ -0,0 +1,319 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	fakeProvider "github.com/IBM/ibmcloud-object-storage-plugin/ibm-provider/provider/fake-provider"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	fakeRC "github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake-rc"
+	fakeS3 "github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake-s3"
+	fakeGrpcClient "github.com/IBM/ibmcloud-object-storage-plugin/utils/grpc-client/fake-grpc"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v6/controller"
+)
+
+const testQuota = "1Gi"
+
+// getIntegrationProvisioner returns a provisioner talking to local COS,
+// IAM and Resource Configuration stand-ins, with access policy and quota
+// limit enabled.
+func getIntegrationProvisioner(t *testing.T) (*IBMS3fsProvisioner, *fakeS3.Server, *fakeRC.Server) {
+	s3Srv := fakeS3.NewServer()
+	t.Cleanup(s3Srv.Close)
+	s3Srv.AccessKey = testAccessKey
+
+	rcSrv := fakeRC.NewServer()
+	t.Cleanup(rcSrv.Close)
+	rcSrv.AddAPIKey(testResConAPIKey)
+	rcSrv.BucketExists = func(name string) bool {
+		_, ok := s3Srv.Bucket(name)
+		return ok
+	}
+
+	retries := 0
+	p := getCustomProvisioner(
+		&clientGoConfig{withResConfAPIKey: true},
+		&backend.COSSessionFactory{MaxRetries: &retries},
+		&fakeGrpcClient.FakeGrpcSessionFactory{},
+		&backend.UpdateAPFactory{IAMEndpoint: rcSrv.IAMEndpoint(), ResourceConfigEndpoint: rcSrv.ConfigEndpoint()},
+		&fakeProvider.FakeIBMProviderClientFactory{ClusterTypeVpcG2: true, TestSvcEndpoint: true},
+		uuid.NewCryptoGenerator(),
+	)
+
+	accessPlcy, quotaLmt := *ConfigBucketAccessPolicy, *ConfigQuotaLimit
+	enabled := true
+	ConfigBucketAccessPolicy = &enabled
+	ConfigQuotaLimit = &enabled
+	t.Cleanup(func() {
+		ConfigBucketAccessPolicy = &accessPlcy
+		ConfigQuotaLimit = &quotaLmt
+	})
+	return p, s3Srv, rcSrv
+}
+
+func getIntegrationVolumeOptions(s3Srv *fakeS3.Server, rcSrv *fakeRC.Server) controller.ProvisionOptions {
+	v := getVolumeOptions()
+	v.StorageClass.Parameters[parameterOSEndpoint] = s3Srv.URL
+	v.StorageClass.Parameters[parameterIAMEndpoint] = rcSrv.URL
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse(testQuota)}
+	v.PVName = testPVName
+	return v
+}
+
+func Test_Integration_Provision_AccessPolicyAndQuota(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, testBucket, pv.Spec.FlexVolume.Options[optionBucket])
+
+	_, ok := s3Srv.Bucket(testBucket)
+	assert.True(t, ok)
+	cfg, ok := rcSrv.Bucket(testBucket)
+	if assert.True(t, ok) {
+		if assert.NotNil(t, cfg.Firewall) {
+			assert.Equal(t, []string{"10.10.10.10"}, cfg.Firewall.AllowedIP)
+		}
+		q := resource.MustParse(testQuota)
+		assert.Equal(t, q.Value(), cfg.HardQuota)
+	}
+}
+
+func Test_Integration_Provision_AccessPolicyFails_BucketRolledBack(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	rcSrv.InjectFault(fakeRC.OpUpdateBucketConfig, fakeRC.Fault{Status: http.StatusForbidden, Code: "forbidden", Message: "not authorized to configure bucket"}, 1)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to set access policy")
+		assert.Contains(t, err.Error(), "not authorized to configure bucket")
+	}
+	_, ok := s3Srv.Bucket(testBucket)
+	assert.False(t, ok)
+}
+
+func Test_Integration_Provision_InvalidResConfAPIKey(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	rcSrv.InjectFault(fakeRC.OpGetToken, fakeRC.Fault{Status: http.StatusBadRequest, Code: "BXNIM0415E", Message: "Provided API key could not be found."}, -1)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+	v.PVC.Annotations[annotationSetAccessPolicy] = "false"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to set quota limit")
+	}
+	_, ok := s3Srv.Bucket(testBucket)
+	assert.False(t, ok)
+	assert.Equal(t, 0, rcSrv.Count(fakeRC.OpUpdateBucketConfig))
+}
+
+// createIntegrationClaim stores the claim of v so that provisioning progress can be recorded on it
+func createIntegrationClaim(t *testing.T, p *IBMS3fsProvisioner, v controller.ProvisionOptions) {
+	v.PVC.Name = "test-pvc"
+	_, err := p.Client.CoreV1().PersistentVolumeClaims(v.PVC.Namespace).Create(context.Background(), v.PVC, metav1.CreateOptions{})
+	assert.NoError(t, err)
+}
+
+func getIntegrationProgress(t *testing.T, p *IBMS3fsProvisioner, v controller.ProvisionOptions) *provisioningProgress {
+	pvc, err := p.Client.CoreV1().PersistentVolumeClaims(v.PVC.Namespace).Get(context.Background(), v.PVC.Name, metav1.GetOptions{})
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	value, ok := pvc.Annotations[ProgressAnnotation]
+	if !ok {
+		return nil
+	}
+	progress := &provisioningProgress{}
+	assert.NoError(t, json.Unmarshal([]byte(value), progress))
+	return progress
+}
+
+func Test_Integration_Provision_ResumesAfterTransientFailure(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+	delete(v.PVC.Annotations, annotationBucket)
+	createIntegrationClaim(t, p, v)
+	rcSrv.InjectFault(fakeRC.OpUpdateBucketConfig, fakeRC.Fault{Status: http.StatusServiceUnavailable, Code: "unavailable", Message: "service unavailable"}, 1)
+
+	_, state, err := p.Provision(context.Background(), v)
+	assert.Error(t, err)
+	assert.Equal(t, controller.ProvisioningInBackground, state)
+
+	progress := getIntegrationProgress(t, p, v)
+	if !assert.NotNil(t, progress) {
+		return
+	}
+	assert.Equal(t, []string{stepOwnerMarker}, progress.Done)
+	_, ok := s3Srv.Bucket(progress.Bucket)
+	assert.True(t, ok, "bucket must be kept for the next attempt")
+
+	pv, state, err := p.Provision(context.Background(), v)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, controller.ProvisioningFinished, state)
+	// the generated bucket name is reused, no other bucket is created
+	assert.Equal(t, progress.Bucket, pv.Spec.FlexVolume.Options[optionBucket])
+	assert.Equal(t, 2, s3Srv.Count(fakeS3.OpCreateBucket))
+	cfg, _ := rcSrv.Bucket(progress.Bucket)
+	if assert.NotNil(t, cfg.Firewall) {
+		assert.Equal(t, []string{"10.10.10.10"}, cfg.Firewall.AllowedIP)
+	}
+	q := resource.MustParse(testQuota)
+	assert.Equal(t, q.Value(), cfg.HardQuota)
+	assert.Nil(t, getIntegrationProgress(t, p, v))
+}
+
+func Test_Integration_Provision_ExistingBucketNotRolledBack(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+	createIntegrationClaim(t, p, v)
+	sess := p.Backend.NewObjectStorageSession(s3Srv.URL, testStorageClass, &backend.ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	_, err := sess.CreateBucket(testBucket, testStorageClass, "")
+	assert.NoError(t, err)
+	rcSrv.InjectFault(fakeRC.OpUpdateBucketConfig, fakeRC.Fault{Status: http.StatusForbidden, Code: "forbidden", Message: "not authorized to configure bucket"}, 1)
+
+	_, state, err := p.Provision(context.Background(), v)
+	assert.Error(t, err)
+	assert.Equal(t, controller.ProvisioningFinished, state)
+	_, ok := s3Srv.Bucket(testBucket)
+	assert.True(t, ok)
+	if progress := getIntegrationProgress(t, p, v); assert.NotNil(t, progress) {
+		assert.Equal(t, testBucket, progress.Bucket)
+		assert.NotContains(t, progress.Done, stepOwnerMarker)
+	}
+}
+
+func Test_Integration_Provision_CreatedBucketRolledBack_ProgressCleared(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+	createIntegrationClaim(t, p, v)
+	rcSrv.InjectFault(fakeRC.OpUpdateBucketConfig, fakeRC.Fault{Status: http.StatusForbidden, Code: "forbidden", Message: "not authorized to configure bucket"}, 1)
+
+	_, _, err := p.Provision(context.Background(), v)
+	assert.Error(t, err)
+	_, ok := s3Srv.Bucket(testBucket)
+	assert.False(t, ok)
+	assert.Nil(t, getIntegrationProgress(t, p, v))
+}
+
+func Test_Integration_Delete_ExistingBucketNotDeleted(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+	v.PVName = testPVName
+	v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+	sess := p.Backend.NewObjectStorageSession(s3Srv.URL, testStorageClass, &backend.ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	_, err := sess.CreateBucket(testBucket, testStorageClass, "")
+	assert.NoError(t, err)
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = p.Delete(context.Background(), pv)
+	assert.ErrorIs(t, err, errBucketNotOwned)
+	_, ok := s3Srv.Bucket(testBucket)
+	assert.True(t, ok)
+}
+
+func Test_Integration_Delete_CreatedBucketDeleted(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+	v.PVName = testPVName
+	v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = p.Delete(context.Background(), pv)
+	assert.NoError(t, err)
+	_, ok := s3Srv.Bucket(testBucket)
+	assert.False(t, ok)
+}
+
+func Test_Integration_Delete_Archive(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+	v.PVName = testPVName
+	v.StorageClass.Parameters[annotationOnDelete] = "archive"
+	v.StorageClass.Parameters[annotationArchiveBucket] = testArchiveBucket
+	sess := p.Backend.NewObjectStorageSession(s3Srv.URL, testStorageClass, &backend.ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	_, err := sess.CreateBucket(testArchiveBucket, testStorageClass, "")
+	assert.NoError(t, err)
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, s3Srv.PutObject(testBucket, "app/data", []byte("data")))
+
+	err = p.Delete(context.Background(), pv)
+	assert.NoError(t, err)
+	_, ok := s3Srv.Bucket(testBucket)
+	assert.False(t, ok)
+	if archived := s3Srv.Objects(testArchiveBucket); assert.Len(t, archived, 1) {
+		assert.Regexp(t, "^"+testBucket+"/"+testPVName+"-[0-9]{8}T[0-9]{6}Z/app/data$", archived[0])
+	}
+}
+
+func Test_Integration_SharedBucket(t *testing.T) {
+	p, s3Srv, rcSrv := getIntegrationProvisioner(t)
+	sess := p.Backend.NewObjectStorageSession(s3Srv.URL, testStorageClass, &backend.ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	_, err := sess.CreateBucket(testSharedBucket, testStorageClass, "")
+	assert.NoError(t, err)
+
+	var pvs []*v1.PersistentVolume
+	for _, name := range []string{"pvc-a", "pvc-b"} {
+		v := getIntegrationVolumeOptions(s3Srv, rcSrv)
+		delete(v.PVC.Annotations, annotationBucket)
+		delete(v.PVC.Annotations, annotationAutoCreateBucket)
+		v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+		v.StorageClass.Parameters[annotationSharedBucket] = testSharedBucket
+		v.PVC.Name = name
+		v.PVName = "pv-" + name
+
+		pv, _, err := p.Provision(context.Background(), v)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "/"+testNamespace+"/"+name+"-"+v.PVName, pv.Spec.FlexVolume.Options[optionObjectPath])
+		assert.NoError(t, s3Srv.PutObject(testSharedBucket, testNamespace+"/"+name+"-"+v.PVName+"/data", []byte(name)))
+		pvs = append(pvs, pv)
+	}
+	// the quota of a claim is not applied to the shared bucket
+	if cfg, ok := rcSrv.Bucket(testSharedBucket); assert.True(t, ok) {
+		assert.Zero(t, cfg.HardQuota)
+	}
+
+	err = p.Delete(context.Background(), pvs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		testNamespace + "/pvc-b-pv-pvc-b/",
+		testNamespace + "/pvc-b-pv-pvc-b/data",
+	}, s3Srv.Objects(testSharedBucket))
+}
@@ -16,6 +16,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 
 	"github.com/IBM/ibmcloud-object-storage-plugin/driver"
 	"github.com/IBM/ibmcloud-object-storage-plugin/ibm-provider/provider"
@@ -37,6 +38,7 @@ import (
 	//"k8s.io/client-go/pkg/runtime"
 	"strconv"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -49,6 +51,9 @@ const (
 	testAPIKey            = "apikey"
 	testServiceInstanceID = "sid"
 	testBucket            = "test-bucket"
+	testPVName            = "test-pv"
+	testArchiveBucket     = "test-archive-bucket"
+	testSharedBucket      = "test-shared-bucket"
 	testOSEndpoint        = "https://test-object-store-endpoint"
 	testIAMEndpoint       = "https://test-iam-endpoint"
 	testServiceName       = "test-service"
@@ -90,6 +95,12 @@ const (
 	annotationAddMountParam           = "ibm.io/add-mount-param"
 	annotationAccessPolicyAllowedIps  = "ibm.io/access-policy-allowed-ips"
 	annotationQuotaLimit              = "ibm.io/quota-limit"
+	annotationBucketVersioning        = "ibm.io/bucket-versioning"
+	annotationDeletionProtection      = "ibm.io/deletion-protection"
+	annotationOnDelete                = "ibm.io/on-delete"
+	annotationArchiveBucket           = "ibm.io/archive-bucket"
+	annotationArchivePrefix           = "ibm.io/archive-prefix"
+	annotationSharedBucket            = "ibm.io/shared-bucket"
 
 	parameterChunkSizeMB            = "ibm.io/chunk-size-mb"
 	parameterParallelCount          = "ibm.io/parallel-count"
@@ -102,6 +113,8 @@ const (
 	parameterKernelCache            = "ibm.io/kernel-cache"
 	parameterOSEndpoint             = "ibm.io/object-store-endpoint"
 	parameterIAMEndpoint            = "ibm.io/iam-endpoint"
+	parameterOSRegion               = "ibm.io/object-store-region"
+	parameterOSNetwork              = "ibm.io/object-store-network"
 	parameterStorageClass           = "ibm.io/object-store-storage-class"
 	parameterStatCacheExpireSeconds = "ibm.io/stat-cache-expire-seconds"
 	parameterAutoCache              = "ibm.io/auto_cache"
@@ -121,6 +134,7 @@ const (
 	optionObjectPath              = "object-path"
 	optionStorageClass            = "object-store-storage-class"
 	optionIAMEndpoint             = "iam-endpoint"
+	optionOSNetwork               = "object-store-network"
 	optionReadwriteTimeoutSeconds = "readwrite-timeout"
 	optionConnectTimeoutSeconds   = "connect-timeout"
 	optionUseXattr                = "use-xattr"
@@ -141,11 +155,13 @@ type clientGoConfig struct {
 	isTLS                 bool
 	withcaBundle          bool
 	withResConfAPIKey     bool
+	withKPRootKeyCRN      bool
 }
 
 var (
 	writeFileError   = func(string, []byte, os.FileMode) error { return errors.New("") }
 	writeFileSuccess = func(string, []byte, os.FileMode) error { return nil }
+	readFileMissing  = func(string) ([]byte, error) { return nil, os.ErrNotExist }
 	testNamespace    = "test-namespace"
 )
 
@@ -155,9 +171,13 @@ func init() {
 	accessPlcy := false
 	quotaLmt := false
 	allowCrossNsSect := true
+	allowUnmarked := false
 	ConfigBucketAccessPolicy = &accessPlcy
 	ConfigQuotaLimit = &quotaLmt
 	AllowCrossNsSecret = &allowCrossNsSect
+	AllowUnmarkedBucketDeletion = &allowUnmarked
+	// the CA bundles are written by every test
+	readFile = readFileMissing
 }
 
 func getFakeClientGo(cfg *clientGoConfig) kubernetes.Interface {
@@ -214,6 +234,10 @@ func getFakeClientGo(cfg *clientGoConfig) kubernetes.Interface {
 		if cfg.withResConfAPIKey {
 			secret.Data[ResConfApiKey] = []byte(testResConAPIKey)
 		}
+
+		if cfg.withKPRootKeyCRN {
+			secret.Data[KPRootKeyCRN] = []byte(testKPRootKeyCRN)
+		}
 		objects = append(objects, runtime.Object(secret))
 	}
 
@@ -310,10 +334,19 @@ func getVolumeOptions() controller.ProvisionOptions {
 	return v
 }
 
+// getTestBucketOwners returns the ownership marker of the bucket of getAutoDeletePersistentVolume
+func getTestBucketOwners() map[string]*backend.BucketOwner {
+	return map[string]*backend.BucketOwner{
+		testBucket: {ClusterID: os.Getenv("CLUSTER_ID"), PVName: testPVName},
+	}
+}
+
 func getAutoDeletePersistentVolume() *v1.PersistentVolume {
 	return &v1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
+			Name: testPVName,
 			Annotations: map[string]string{
+				annotationBucket:           testBucket,
 				annotationAutoDeleteBucket: "true",
 				annotationSecretName:       testSecretName,
 				annotationSecretNamespace:  testNamespace,
@@ -917,6 +950,30 @@ func Test_Provision_ConfigBucketAccessPolicy_FailFetchProviderType(t *testing.T)
 	}
 }
 
+func Test_Provision_ConfigBucketAccessPolicy_CachedProviderType(t *testing.T) {
+
+	p := getCustomProvisioner(
+		&clientGoConfig{withResConfAPIKey: true},
+		&fake.ObjectStorageSessionFactory{},
+		&fakeGrpcClient.FakeGrpcSessionFactory{},
+		&fake.FakeAccessPolicyFactory{PassUpdateAccessPolicy: true},
+		&fakeProvider.FakeIBMProviderClientFactory{FailClusterType: true, FailClusterTypeErrMsg: "failed to get provider type"},
+		uuid.NewCryptoGenerator(),
+	)
+	p.ProviderTypeCache = grpcClient.NewProviderTypeCache(time.Minute)
+	p.ProviderTypeCache.Set(clusterTypeClassic)
+	v := getVolumeOptions()
+	accessPlcy := true
+	quotalimt := false
+	ConfigBucketAccessPolicy = &accessPlcy
+	ConfigQuotaLimit = &quotalimt
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "set-access-policy not supported for classic cluster")
+	}
+}
+
 func Test_Provision_ConfigBucketAccessPolicy_FailFetchVPCEndpoints(t *testing.T) {
 
 	p := getCustomProvisioner(
@@ -1121,7 +1178,7 @@ func Test_Provision_AllowCrossNsSecret_False_SetSameSecretNS(t *testing.T) {
 	assert.Equal(t, testNamespace, pv.Annotations[annotationSecretNamespace])
 }
 
-func Test_Provision_CreateBucket_BucketAlreadyOwnedByYou_Positive(t *testing.T) {
+func Test_Provision_CreateBucket_BucketAlreadyExists_Positive(t *testing.T) {
 	p := getFakeBackendProvisioner(&fake.ObjectStorageSessionFactory{FailCreateBucket: true, FailCreateBucketErrMsg: "BucketAlreadyExists"}, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
 	v := getVolumeOptions()
 	allowCrossNsSect := true
@@ -1130,15 +1187,30 @@ func Test_Provision_CreateBucket_BucketAlreadyOwnedByYou_Positive(t *testing.T)
 	ConfigBucketAccessPolicy = &accessPlcy
 
 	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
 
 	_, _, err := p.Provision(context.Background(), v)
 	assert.NoError(t, err)
 }
 
+func Test_Provision_CreateBucket_GeneratedBucketAlreadyExists(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{FailCreateBucket: true, FailCreateBucketErrMsg: "BucketAlreadyExists"}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "already exists and was not created for this claim")
+	}
+	assert.Empty(t, factory.BucketOwners)
+}
+
 func Test_Provision_FailCreateBucket_BucketOwnedByOther(t *testing.T) {
 	p := getFakeBackendProvisioner(&fake.ObjectStorageSessionFactory{FailCreateBucket: true, FailCreateBucketErrMsg: "BucketAlreadyExists", FailCheckBucketAccess: true}, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
 	v := getVolumeOptions()
 	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
 
 	_, _, err := p.Provision(context.Background(), v)
 	if assert.Error(t, err) {
@@ -1146,6 +1218,30 @@ func Test_Provision_FailCreateBucket_BucketOwnedByOther(t *testing.T) {
 	}
 }
 
+func Test_Provision_FailCreateBucket_Classified(t *testing.T) {
+	tests := []struct {
+		code  string
+		msg   string
+		state controller.ProvisioningState
+	}{
+		{"InvalidAccessKeyId", "check the credentials in secret", controller.ProvisioningFinished},
+		{"QuotaExceeded", "bucket quota of the service instance reached", controller.ProvisioningFinished},
+		{"SlowDown", "cannot create bucket", controller.ProvisioningInBackground},
+		{"InternalError", "cannot create bucket", controller.ProvisioningInBackground},
+	}
+	for _, tt := range tests {
+		p := getFakeBackendProvisioner(&fake.ObjectStorageSessionFactory{FailCreateBucket: true, FailCreateBucketErrMsg: tt.code}, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+		v := getVolumeOptions()
+		v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+
+		_, state, err := p.Provision(context.Background(), v)
+		if assert.Error(t, err, tt.code) {
+			assert.Contains(t, err.Error(), tt.msg)
+			assert.Equal(t, tt.state, state, tt.code)
+		}
+	}
+}
+
 func Test_Provision_FailCreateBucket(t *testing.T) {
 	p := getFakeBackendProvisioner(&fake.ObjectStorageSessionFactory{FailCreateBucket: true}, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
 	v := getVolumeOptions()
@@ -1378,7 +1474,7 @@ func Test_Delete_MissingSecret(t *testing.T) {
 }
 
 func Test_Delete_FailDeleteBucket(t *testing.T) {
-	p := getFakeBackendProvisioner(&fake.ObjectStorageSessionFactory{FailDeleteBucket: true}, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	p := getFakeBackendProvisioner(&fake.ObjectStorageSessionFactory{FailDeleteBucket: true, BucketOwners: getTestBucketOwners()}, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
 	pv := getAutoDeletePersistentVolume()
 	err := p.Delete(context.Background(), pv)
 	if assert.Error(t, err) {
@@ -1386,6 +1482,162 @@ func Test_Delete_FailDeleteBucket(t *testing.T) {
 	}
 }
 
+func Test_Provision_ContextCanceled(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := p.Provision(ctx, v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot create bucket")
+		assert.Contains(t, err.Error(), context.Canceled.Error())
+	}
+	assert.Equal(t, testBucket, factory.LastCreatedBucket)
+}
+
+func Test_Delete_ContextCanceled(t *testing.T) {
+	p := getProvisioner()
+	pv := getAutoDeletePersistentVolume()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := p.Delete(ctx, pv)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot delete bucket")
+	}
+}
+
+func Test_Delete_AccessDenied(t *testing.T) {
+	p := getFakeBackendProvisioner(&fake.ObjectStorageSessionFactory{DeleteBucketErr: &backend.Error{Kind: backend.ErrAccessDenied, Err: errors.New("AccessDenied")}, BucketOwners: getTestBucketOwners()}, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	pv := getAutoDeletePersistentVolume()
+	err := p.Delete(context.Background(), pv)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "check the credentials in secret")
+		assert.ErrorIs(t, err, backend.ErrAccessDenied)
+	}
+}
+
+func Test_Delete_UnmarkedBucket(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	err := p.Delete(context.Background(), getAutoDeletePersistentVolume())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "has no ownership marker")
+		assert.ErrorIs(t, err, errBucketNotOwned)
+	}
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Delete_UnmarkedBucket_Allowed(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	oldAllowUnmarked := AllowUnmarkedBucketDeletion
+	allowUnmarked := true
+	AllowUnmarkedBucketDeletion = &allowUnmarked
+	defer func() {
+		AllowUnmarkedBucketDeletion = oldAllowUnmarked
+	}()
+
+	err := p.Delete(context.Background(), getAutoDeletePersistentVolume())
+	assert.NoError(t, err)
+	assert.Equal(t, testBucket, factory.LastDeletedBucket)
+}
+
+func Test_Delete_BucketOfOtherVolume(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{BucketOwners: getTestBucketOwners()}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	pv := getAutoDeletePersistentVolume()
+	pv.Name = "other-pv"
+	err := p.Delete(context.Background(), pv)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "belongs to volume "+testPVName)
+		assert.ErrorIs(t, err, errBucketNotOwned)
+	}
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Delete_BucketOfOtherClaim(t *testing.T) {
+	owners := getTestBucketOwners()
+	owners[testBucket].ClaimUID = "claim-1"
+	factory := &fake.ObjectStorageSessionFactory{BucketOwners: owners}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	pv := getAutoDeletePersistentVolume()
+	pv.Spec.ClaimRef = &v1.ObjectReference{Name: "test-pvc", Namespace: testNamespace, UID: "claim-2"}
+	err := p.Delete(context.Background(), pv)
+	assert.ErrorIs(t, err, errBucketNotOwned)
+	assert.Empty(t, factory.LastDeletedBucket)
+
+	pv.Spec.ClaimRef.UID = "claim-1"
+	err = p.Delete(context.Background(), pv)
+	assert.NoError(t, err)
+	assert.Equal(t, testBucket, factory.LastDeletedBucket)
+}
+
+func Test_Delete_DeletionProtection(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{BucketOwners: getTestBucketOwners()}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	pv := getAutoDeletePersistentVolume()
+	pv.Annotations[annotationDeletionProtection] = "true"
+	err := p.Delete(context.Background(), pv)
+	assert.ErrorIs(t, err, errDeletionProtected)
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Delete_BucketAlreadyDeleted(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{GetBucketOwnerErr: &backend.Error{Kind: backend.ErrBucketNotFound, Err: errors.New("NoSuchBucket")}}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	err := p.Delete(context.Background(), getAutoDeletePersistentVolume())
+	assert.NoError(t, err)
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Provision_BadPVCAnnotations_DeletionProtection(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationDeletionProtection] = "non-true-value"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid value for deletion-protection, expects true/false")
+	}
+}
+
+func Test_Provision_BucketOwnerMarker(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getVolumeOptions()
+	v.PVName = testPVName
+	v.PVC.UID = "claim-1"
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationDeletionProtection] = "false"
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "false", pv.Annotations[annotationDeletionProtection])
+	}
+	assert.Equal(t, &backend.BucketOwner{ClusterID: os.Getenv("CLUSTER_ID"), PVName: testPVName, ClaimUID: "claim-1"}, factory.BucketOwners[testBucket])
+}
+
+func Test_Provision_FailSetBucketOwner(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{FailSetBucketOwner: true}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot stamp bucket "+testBucket+" with its owner")
+	}
+	assert.Equal(t, testBucket, factory.LastDeletedBucket)
+}
+
 func Test_Provision_Delete_Positive(t *testing.T) {
 	factory := &fake.ObjectStorageSessionFactory{}
 	grpcFac := &fakeGrpcClient.FakeGrpcSessionFactory{}
@@ -1529,6 +1781,159 @@ func Test_Provision_PVCAnnotations_UseXattr(t *testing.T) {
 	assert.Equal(t, "true", pv.Spec.FlexVolume.Options[optionUseXattr])
 }
 
+func Test_Provision_PVCAnnotations_UseCache(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters["ibm.io/use-cache"] = "true"
+	v.StorageClass.Parameters["ibm.io/cache-size-mb"] = "2048"
+	v.PVC.Annotations["ibm.io/cache-size-mb"] = "512"
+	v.PVC.Annotations["ibm.io/cache-disk-free-mb"] = "4096"
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "true", pv.Spec.FlexVolume.Options["use-cache"])
+		assert.Equal(t, "512", pv.Spec.FlexVolume.Options["cache-size-mb"])
+		assert.Equal(t, "4096", pv.Spec.FlexVolume.Options["cache-disk-free-mb"])
+	}
+}
+
+func Test_Provision_PVCAnnotations_BadUseCache(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations["ibm.io/use-cache"] = "yes-please"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid value for use-cache, expects true/false")
+	}
+}
+
+func Test_Provision_PVCAnnotations_NegativeCacheSizeMB(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations["ibm.io/cache-size-mb"] = "-1"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "values of cache-size-mb and cache-disk-free-mb should be >= 0")
+	}
+}
+
+func Test_Provision_PVCAnnotations_Identity(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters["ibm.io/uid"] = "1000"
+	v.StorageClass.Parameters["ibm.io/umask"] = "022"
+	v.PVC.Annotations["ibm.io/uid"] = "1001"
+	v.PVC.Annotations["ibm.io/gid"] = "2000"
+	v.PVC.Annotations["ibm.io/mp-umask"] = "0027"
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1001", pv.Spec.FlexVolume.Options["uid"])
+		assert.Equal(t, "2000", pv.Spec.FlexVolume.Options["gid"])
+		assert.Equal(t, "022", pv.Spec.FlexVolume.Options["umask"])
+		assert.Equal(t, "027", pv.Spec.FlexVolume.Options["mp-umask"])
+	}
+}
+
+func Test_Provision_PVCAnnotations_BadGID(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations["ibm.io/gid"] = "staff"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid value for gid")
+	}
+}
+
+func Test_Provision_StorageClass_BadUmask(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters["ibm.io/umask"] = "0800"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid value for umask")
+	}
+}
+
+func Test_Provision_StorageClass_S3fsLimits(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters["ibm.io/s3fs-memory-limit"] = "512Mi"
+	v.StorageClass.Parameters["ibm.io/s3fs-cpu-limit"] = "500m"
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "512Mi", pv.Spec.FlexVolume.Options["s3fs-memory-limit"])
+		assert.Equal(t, "500m", pv.Spec.FlexVolume.Options["s3fs-cpu-limit"])
+	}
+}
+
+func Test_Provision_StorageClass_BadS3fsCPULimit(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters["ibm.io/s3fs-cpu-limit"] = "1m"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid value for s3fs-cpu-limit")
+	}
+}
+
+func Test_Provision_StorageClass_ClientSideEncryption(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters["ibm.io/client-side-encryption"] = "true"
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "true", pv.Spec.FlexVolume.Options["client-side-encryption"])
+	}
+}
+
+func Test_Provision_StorageClass_PerformanceProfile(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters[annotationPerformanceProfile] = "large-sequential"
+	delete(v.StorageClass.Parameters, parameterChunkSizeMB)
+	v.PVC.Annotations["ibm.io/multireq-max"] = "6"
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "64", pv.Spec.FlexVolume.Options[optionChunkSizeMB])
+		assert.Equal(t, "120", pv.Spec.FlexVolume.Options["readwrite-timeout"])
+		// parameters set on the storage class and the PVC override the profile
+		assert.Equal(t, strconv.Itoa(testParallelCount), pv.Spec.FlexVolume.Options[optionParallelCount])
+		assert.Equal(t, "6", pv.Spec.FlexVolume.Options["multireq-max"])
+		assert.Equal(t, "large-sequential", pv.Annotations[annotationPerformanceProfile])
+	}
+}
+
+func Test_Provision_PVCAnnotations_PerformanceProfile(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters[annotationPerformanceProfile] = "large-sequential"
+	v.PVC.Annotations[annotationPerformanceProfile] = "read-mostly"
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		// the profile of the PVC overrides the storage class parameters
+		assert.Equal(t, "16", pv.Spec.FlexVolume.Options[optionChunkSizeMB])
+		assert.Equal(t, "8", pv.Spec.FlexVolume.Options[optionParallelCount])
+		assert.Equal(t, "true", pv.Spec.FlexVolume.Options[optionKernelCache])
+		assert.Equal(t, "120", pv.Spec.FlexVolume.Options["readwrite-timeout"])
+		assert.Equal(t, "read-mostly", pv.Annotations[annotationPerformanceProfile])
+	}
+}
+
+func Test_Provision_PVCAnnotations_BadPerformanceProfile(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationPerformanceProfile] = "fast"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid value for performance-profile \"fast\", expects one of large-sequential, ml-training, read-mostly, small-files")
+	}
+}
+
 func Test_Provision_PVCAnnotations_DebugLevel(t *testing.T) {
 	p := getProvisioner()
 	v := getVolumeOptions()
@@ -1609,7 +2014,36 @@ func Test_Provision_CACrtSecretWriteError(t *testing.T) {
 	}
 }
 
+func Test_WriteCrtFile_Unchanged(t *testing.T) {
+	p := getFakeClientGoProvisioner(&clientGoConfig{isTLS: true, withcaBundle: true})
+	written := map[string][]byte{}
+	writes := 0
+	writeFile = func(name string, data []byte, _ os.FileMode) error {
+		writes++
+		written[name] = data
+		return nil
+	}
+	readFile = func(name string) ([]byte, error) {
+		if data, ok := written[name]; ok {
+			return data, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	defer func() {
+		writeFile = writeFileSuccess
+		readFile = readFileMissing
+	}()
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, p.writeCrtFile(context.Background(), testSecretName, testNamespace, testServiceName))
+	}
+	// the bundle is only written again when it changes
+	assert.Equal(t, 1, writes)
+	assert.Equal(t, testCAKey, string(written[path.Join(caBundlePath, testServiceName)]))
+}
+
 func Test_Delete_TLS_Negative(t *testing.T) {
+	writeFile = writeFileError
 	p := getFakeClientGoProvisioner(&clientGoConfig{isTLS: true, withcaBundle: true})
 	pv := getAutoDeletePersistentVolume()
 	pv.Annotations[annotationServiceName] = testServiceName
@@ -1622,6 +2056,7 @@ func Test_Delete_TLS_Negative(t *testing.T) {
 
 func Test_Delete_TLS_Positive(t *testing.T) {
 	p := getFakeClientGoProvisioner(&clientGoConfig{isTLS: true, withcaBundle: true})
+	p.Backend.(*fake.ObjectStorageSessionFactory).BucketOwners = getTestBucketOwners()
 	pv := getAutoDeletePersistentVolume()
 	pv.Annotations[annotationServiceName] = testServiceName
 	pv.Annotations[annotationServiceNamespace] = testServiceNamespace
@@ -1649,3 +2084,389 @@ func Test_Provision_PVCAnnotations_AddMountParam(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, testAddMountParam, pv.Spec.FlexVolume.Options[optionAddMountParam])
 }
+
+func Test_Provision_OnDelete_Archive(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters[annotationOnDelete] = "archive"
+	v.StorageClass.Parameters[annotationArchiveBucket] = testArchiveBucket
+	v.StorageClass.Parameters[annotationArchivePrefix] = "/decommissioned/"
+	v.PVC.Annotations[annotationArchiveBucket] = "chosen-by-claim"
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "archive", pv.Annotations[annotationOnDelete])
+		assert.Equal(t, testArchiveBucket, pv.Annotations[annotationArchiveBucket])
+		assert.Equal(t, "decommissioned", pv.Annotations[annotationArchivePrefix])
+	}
+}
+
+func Test_Provision_BadPVCAnnotations_OnDelete(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationOnDelete] = "recycle"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid value for on-delete, expects archive")
+	}
+}
+
+func Test_Provision_OnDelete_ArchiveBucketMissing(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationOnDelete] = "archive"
+	v.PVC.Annotations[annotationArchiveBucket] = testArchiveBucket
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "on-delete archive requires ibm.io/archive-bucket in the storage class")
+	}
+}
+
+func Test_Provision_OnDelete_ArchiveToOwnBucket(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters[annotationOnDelete] = "archive"
+	v.StorageClass.Parameters[annotationArchiveBucket] = testBucket
+	v.PVC.Annotations[annotationBucket] = testBucket
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "archive-bucket cannot be the bucket of the volume")
+	}
+}
+
+func getArchivePersistentVolume() *v1.PersistentVolume {
+	pv := getAutoDeletePersistentVolume()
+	pv.Annotations[annotationAutoDeleteBucket] = "false"
+	pv.Annotations[annotationOnDelete] = "archive"
+	pv.Annotations[annotationArchiveBucket] = testArchiveBucket
+	pv.Annotations[annotationArchivePrefix] = "decommissioned"
+	return pv
+}
+
+func Test_Delete_Archive(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{BucketOwners: getTestBucketOwners()}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	pv := getArchivePersistentVolume()
+	pv.Annotations[annotationObjectPath] = "/data"
+
+	err := p.Delete(context.Background(), pv)
+	assert.NoError(t, err)
+	assert.Equal(t, testBucket+"/data/", factory.LastCopiedPrefix)
+	assert.Regexp(t, "^"+testArchiveBucket+"/decommissioned/"+testBucket+"/"+testPVName+"-[0-9]{8}T[0-9]{6}Z/$", factory.LastCopyDestination)
+	assert.Equal(t, testBucket, factory.LastDeletedBucket)
+}
+
+func Test_Delete_Archive_CopyFails(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{BucketOwners: getTestBucketOwners(), CopyObjectsErr: &backend.Error{Kind: backend.ErrBucketNotFound, Err: errors.New("NoSuchBucket")}}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	err := p.Delete(context.Background(), getArchivePersistentVolume())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot archive bucket "+testBucket+" to "+testArchiveBucket)
+	}
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Delete_Archive_UnmarkedBucket(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	err := p.Delete(context.Background(), getArchivePersistentVolume())
+	assert.ErrorIs(t, err, errBucketNotOwned)
+	assert.Empty(t, factory.LastCopiedPrefix)
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Delete_Archive_PathRecordedOnce(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{BucketOwners: getTestBucketOwners(), CopyObjectsErr: &backend.Error{Kind: backend.ErrTransient, Err: errors.New("InternalError")}}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	pv := getArchivePersistentVolume()
+	_, err := p.Client.CoreV1().PersistentVolumes().Create(context.Background(), pv, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	assert.Error(t, p.Delete(context.Background(), pv))
+	saved, err := p.Client.CoreV1().PersistentVolumes().Get(context.Background(), pv.Name, metav1.GetOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	archivePath := saved.Annotations[annotationArchivePath]
+	assert.Regexp(t, "^decommissioned/"+testBucket+"/"+testPVName+"-[0-9]{8}T[0-9]{6}Z/$", archivePath)
+	assert.Equal(t, testArchiveBucket+"/"+archivePath, factory.LastCopyDestination)
+
+	// the retry completes the same archive
+	factory.CopyObjectsErr = nil
+	assert.NoError(t, p.Delete(context.Background(), saved))
+	assert.Equal(t, testArchiveBucket+"/"+archivePath, factory.LastCopyDestination)
+	assert.Equal(t, testBucket, factory.LastDeletedBucket)
+}
+
+func Test_Provision_OnDelete_ArchiveExistingBucket(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters[annotationOnDelete] = "archive"
+	v.StorageClass.Parameters[annotationArchiveBucket] = testArchiveBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	v.PVC.Annotations[annotationBucket] = testBucket
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "on-delete archive requires auto-create-bucket or a shared-bucket storage class")
+	}
+}
+
+// getSharedObjectPath returns the object path of the claim of getSharedBucketVolumeOptions
+func getSharedObjectPath() string {
+	return "/" + testNamespace + "/test-pvc-" + testPVName
+}
+
+func getSharedBucketVolumeOptions() controller.ProvisionOptions {
+	v := getVolumeOptions()
+	v.PVName = testPVName
+	v.PVC.Name = "test-pvc"
+	v.PVC.UID = "claim-1"
+	v.StorageClass.Parameters[annotationSharedBucket] = testSharedBucket
+	return v
+}
+
+func Test_Provision_SharedBucket(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{CheckObjectPathExistencePathNotFound: true}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getSharedBucketVolumeOptions()
+	v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testSharedBucket, pv.Spec.FlexVolume.Options[optionBucket])
+		assert.Equal(t, getSharedObjectPath(), pv.Spec.FlexVolume.Options[optionObjectPath])
+		assert.Equal(t, testSharedBucket, pv.Annotations[annotationSharedBucket])
+		assert.Equal(t, "false", pv.Annotations[annotationAutoCreateBucket])
+	}
+	assert.Empty(t, factory.LastCreatedBucket)
+	assert.Equal(t, testSharedBucket, factory.LastCheckedBucket)
+	assert.Equal(t, testSharedBucket+":"+getSharedObjectPath(), factory.LastCreatedObjectPath)
+	assert.Equal(t, &backend.BucketOwner{ClusterID: os.Getenv("CLUSTER_ID"), PVName: testPVName, ClaimUID: "claim-1"},
+		factory.ObjectPathOwners[testSharedBucket+":"+getSharedObjectPath()])
+}
+
+func Test_Provision_SharedBucket_BucketSet(t *testing.T) {
+	p := getProvisioner()
+	v := getSharedBucketVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bucket and object-path cannot be set with a shared-bucket storage class")
+	}
+}
+
+func Test_Provision_SharedBucket_ExistingObjectPath(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	_, _, err := p.Provision(context.Background(), getSharedBucketVolumeOptions())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "object path already exists and was not created for this volume")
+	}
+	assert.Empty(t, factory.LastCreatedObjectPath)
+}
+
+func Test_Provision_SharedBucket_ObjectPathOfOtherVolume(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{ObjectPathOwners: map[string]*backend.BucketOwner{
+		testSharedBucket + ":" + getSharedObjectPath(): {ClusterID: os.Getenv("CLUSTER_ID"), PVName: "other-pv"},
+	}}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	_, _, err := p.Provision(context.Background(), getSharedBucketVolumeOptions())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "object path belongs to volume other-pv")
+	}
+	assert.Empty(t, factory.LastCreatedObjectPath)
+}
+
+func Test_Provision_SharedBucket_Retried(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{ObjectPathOwners: map[string]*backend.BucketOwner{
+		testSharedBucket + ":" + getSharedObjectPath(): {ClusterID: os.Getenv("CLUSTER_ID"), PVName: testPVName, ClaimUID: "claim-1"},
+	}}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	_, _, err := p.Provision(context.Background(), getSharedBucketVolumeOptions())
+	assert.NoError(t, err)
+	// the path of the previous attempt is reused as is, rewriting it would drop its marker
+	assert.Empty(t, factory.LastCreatedObjectPath)
+	assert.Equal(t, "claim-1", factory.ObjectPathOwners[testSharedBucket+":"+getSharedObjectPath()].ClaimUID)
+}
+
+func getSharedBucketPersistentVolume() *v1.PersistentVolume {
+	pv := getAutoDeletePersistentVolume()
+	pv.Annotations[annotationBucket] = testSharedBucket
+	pv.Annotations[annotationObjectPath] = getSharedObjectPath()
+	pv.Annotations[annotationSharedBucket] = testSharedBucket
+	return pv
+}
+
+func Test_Delete_SharedBucket(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{ObjectPathOwners: map[string]*backend.BucketOwner{
+		testSharedBucket + ":" + getSharedObjectPath(): {ClusterID: os.Getenv("CLUSTER_ID"), PVName: testPVName},
+	}}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	err := p.Delete(context.Background(), getSharedBucketPersistentVolume())
+	assert.NoError(t, err)
+	assert.Equal(t, testSharedBucket+":"+getSharedObjectPath(), factory.LastDeletedObjectPath)
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Delete_SharedBucket_ObjectPathOfOtherVolume(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{ObjectPathOwners: map[string]*backend.BucketOwner{
+		testSharedBucket + ":" + getSharedObjectPath(): {ClusterID: os.Getenv("CLUSTER_ID"), PVName: "other-pv"},
+	}}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	err := p.Delete(context.Background(), getSharedBucketPersistentVolume())
+	assert.ErrorIs(t, err, errBucketNotOwned)
+	assert.Empty(t, factory.LastDeletedObjectPath)
+}
+
+func Test_Delete_SharedBucket_UnmarkedObjectPath(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	err := p.Delete(context.Background(), getSharedBucketPersistentVolume())
+	assert.ErrorIs(t, err, errBucketNotOwned)
+	assert.Empty(t, factory.LastDeletedObjectPath)
+
+	// a path whose marker is gone was deleted by a previous attempt
+	factory.CheckObjectPathExistencePathNotFound = true
+	err = p.Delete(context.Background(), getSharedBucketPersistentVolume())
+	assert.NoError(t, err)
+	assert.Empty(t, factory.LastDeletedObjectPath)
+}
+
+func getRegionVolumeOptions(region, network string) controller.ProvisionOptions {
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	delete(v.StorageClass.Parameters, parameterOSEndpoint)
+	delete(v.StorageClass.Parameters, parameterIAMEndpoint)
+	v.StorageClass.Parameters[parameterOSRegion] = region
+	v.StorageClass.Parameters[parameterStorageClass] = region + "-standard"
+	if network != "" {
+		v.StorageClass.Parameters[parameterOSNetwork] = network
+	}
+	return v
+}
+
+func Test_Provision_RegionCatalog(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getRegionVolumeOptions("eu-de", "private")
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://s3.private.eu-de.cloud-object-storage.appdomain.cloud", pv.Spec.FlexVolume.Options[optionOSEndpoint])
+		assert.Equal(t, "https://private.iam.cloud.ibm.com", pv.Spec.FlexVolume.Options[optionIAMEndpoint])
+	}
+	assert.Equal(t, "https://s3.private.eu-de.cloud-object-storage.appdomain.cloud", factory.LastEndpoint)
+}
+
+func Test_Provision_RegionCatalog_DefaultNetwork(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	// the cluster type is not looked up to pick the network
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{FailGrpcConnection: true}, &fake.FakeAccessPolicyFactory{},
+		&fakeProvider.FakeIBMProviderClientFactory{FailClusterType: true})
+	v := getRegionVolumeOptions("us-south", "")
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://s3.us-south.cloud-object-storage.appdomain.cloud", pv.Spec.FlexVolume.Options[optionOSEndpoint])
+		assert.Equal(t, "public", pv.Spec.FlexVolume.Options[optionOSNetwork])
+	}
+}
+
+func Test_Provision_RegionCatalog_EndpointOverride(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getRegionVolumeOptions("eu-de", "public")
+	v.StorageClass.Parameters[parameterOSEndpoint] = testOSEndpoint
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testOSEndpoint, pv.Spec.FlexVolume.Options[optionOSEndpoint])
+		assert.Equal(t, "https://iam.cloud.ibm.com", pv.Spec.FlexVolume.Options[optionIAMEndpoint])
+	}
+}
+
+func Test_Provision_RegionCatalog_UnknownRegion(t *testing.T) {
+	p := getProvisioner()
+	v := getRegionVolumeOptions("eu-dee", "public")
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot resolve endpoints of ibm.io/object-store-region")
+		assert.Contains(t, err.Error(), "unknown COS region \"eu-dee\"")
+	}
+}
+
+func Test_Provision_RegionCatalog_NetworkWithoutRegion(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.StorageClass.Parameters[parameterOSNetwork] = "direct"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "ibm.io/object-store-network requires ibm.io/object-store-region")
+	}
+}
+
+func Test_Provision_BadLocationConstraint_Tier(t *testing.T) {
+	p := getProvisioner()
+	v := getRegionVolumeOptions("eu-de", "public")
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.StorageClass.Parameters[parameterStorageClass] = "eu-de-flex"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Bad value for ibm.io/object-store-storage-class")
+		assert.Contains(t, err.Error(), "unknown tier \"flex\"")
+	}
+}
+
+func Test_Provision_BadLocationConstraint_RegionMismatch(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.StorageClass.Parameters[parameterOSEndpoint] = "https://s3.direct.eu-de.cloud-object-storage.appdomain.cloud"
+	v.StorageClass.Parameters[parameterStorageClass] = "us-south-standard"
+
+	_, _, err := p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "location constraint \"us-south-standard\" is in region us-south")
+		assert.Contains(t, err.Error(), "use eu-de-<tier>")
+	}
+}
+
+func Test_Provision_LocationConstraint_ExistingBucket(t *testing.T) {
+	p := getProvisioner()
+	v := getRegionVolumeOptions("eu-de", "public")
+	// legacy location constraints still work with existing buckets
+	v.StorageClass.Parameters[parameterStorageClass] = "eu-de-flex"
+
+	_, _, err := p.Provision(context.Background(), v)
+	assert.NoError(t, err)
+}
+
+func Test_Provision_LocationConstraint_PVCRegion(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationRegion] = "eu-de-vault"
+	v.StorageClass.Parameters[parameterOSEndpoint] = "https://s3.direct.eu-de.cloud-object-storage.appdomain.cloud"
+	v.StorageClass.Parameters[parameterStorageClass] = "us-south-standard"
+
+	_, _, err := p.Provision(context.Background(), v)
+	assert.NoError(t, err)
+}
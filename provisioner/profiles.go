@@ -0,0 +1,105 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// annotationPerformanceProfile selects a performance profile, on the storage
+// class or on the PVC
+const annotationPerformanceProfile = "ibm.io/performance-profile"
+
+// performanceProfiles are the tuned storage class parameters of each profile
+var performanceProfiles = map[string]map[string]string{
+	// few large objects read or written from start to end
+	"large-sequential": {
+		"ibm.io/chunk-size-mb":     "64",
+		"ibm.io/parallel-count":    "16",
+		"ibm.io/multireq-max":      "4",
+		"ibm.io/stat-cache-size":   "1000",
+		"ibm.io/kernel-cache":      "false",
+		"ibm.io/readwrite-timeout": "120",
+	},
+	// many small objects, dominated by metadata requests
+	"small-files": {
+		"ibm.io/chunk-size-mb":             "8",
+		"ibm.io/parallel-count":            "4",
+		"ibm.io/multireq-max":              "32",
+		"ibm.io/stat-cache-size":           "100000",
+		"ibm.io/stat-cache-expire-seconds": "300",
+		"ibm.io/kernel-cache":              "false",
+		"ibm.io/connect-timeout":           "10",
+	},
+	// objects read often and seldom rewritten
+	"read-mostly": {
+		"ibm.io/chunk-size-mb":             "16",
+		"ibm.io/parallel-count":            "8",
+		"ibm.io/multireq-max":              "20",
+		"ibm.io/stat-cache-size":           "100000",
+		"ibm.io/stat-cache-expire-seconds": "3600",
+		"ibm.io/kernel-cache":              "true",
+	},
+	// large data sets read repeatedly by training epochs
+	"ml-training": {
+		"ibm.io/chunk-size-mb":             "32",
+		"ibm.io/parallel-count":            "16",
+		"ibm.io/multireq-max":              "32",
+		"ibm.io/stat-cache-size":           "200000",
+		"ibm.io/stat-cache-expire-seconds": "86400",
+		"ibm.io/kernel-cache":              "true",
+		"ibm.io/readwrite-timeout":         "120",
+	},
+}
+
+// profileNames lists the performance profiles
+func profileNames() string {
+	names := make([]string, 0, len(performanceProfiles))
+	for name := range performanceProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// expandPerformanceProfile returns the storage class parameters with the
+// parameters of the performance profile of the storage class, then of the
+// PVC, and the profile in use. The parameters set on the storage class
+// override the profile of the storage class, the profile of the PVC
+// overrides both, and the PVC annotations override them all.
+func expandPerformanceProfile(scParams, pvcAnnots map[string]string) (map[string]string, string, error) {
+	scProfile, pvcProfile := scParams[annotationPerformanceProfile], pvcAnnots[annotationPerformanceProfile]
+	if scProfile == "" && pvcProfile == "" {
+		return scParams, "", nil
+	}
+	for _, profile := range []string{scProfile, pvcProfile} {
+		if _, ok := performanceProfiles[profile]; profile != "" && !ok {
+			return nil, "", fmt.Errorf("invalid value for performance-profile %q, expects one of %s", profile, profileNames())
+		}
+	}
+
+	params := map[string]string{}
+	for k, v := range performanceProfiles[scProfile] {
+		params[k] = v
+	}
+	for k, v := range scParams {
+		params[k] = v
+	}
+	if pvcProfile == "" {
+		return params, scProfile, nil
+	}
+	for k, v := range performanceProfiles[pvcProfile] {
+		params[k] = v
+	}
+	return params, pvcProfile, nil
+}
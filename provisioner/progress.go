@@ -0,0 +1,176 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v6/controller"
+)
+
+// ProgressAnnotation records on the PVC how far the provisioning of its
+// volume got, so that a retried Provision resumes at the failed step
+const ProgressAnnotation = "ibm.io/provisioning-progress"
+
+// Provisioning steps recorded in the progress checkpoint
+const (
+	stepEncryption       = "encryption"
+	stepOwnerMarker      = "owner-marker"
+	stepBucketVersioning = "bucket-versioning"
+	stepAccessPolicy     = "access-policy"
+	stepQuotaLimit       = "quota-limit"
+)
+
+// provisioningProgress is the checkpoint of a provisioning request
+type provisioningProgress struct {
+	// Bucket is the bucket of the volume, recorded before it is created so
+	// that a generated name is reused by the next attempt. The bucket of that
+	// name is only owned if it carries the ownership marker of the claim.
+	Bucket string `json:"bucket"`
+	// BucketCreated is set once the bucket is known to be created by the
+	// provisioner for this claim. Only such buckets are deleted when
+	// provisioning fails. It is not read from the claim, which its users can
+	// edit, but from the ownership marker of the bucket.
+	BucketCreated bool `json:"-"`
+	// Done lists the completed configuration steps
+	Done []string `json:"done,omitempty"`
+
+	// saved is set once the checkpoint is stored on the claim
+	saved bool
+}
+
+func (pp *provisioningProgress) done(step string) bool {
+	for _, s := range pp.Done {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+func (pp *provisioningProgress) markDone(step string) {
+	if !pp.done(step) {
+		pp.Done = append(pp.Done, step)
+	}
+}
+
+// loadProgress returns the checkpoint left on the claim by a previous
+// attempt, or an empty one. The claim is read from the API server as the
+// copy passed to Provision may predate the last checkpoint.
+func (p *IBMS3fsProvisioner) loadProgress(ctx context.Context, claim *v1.PersistentVolumeClaim) *provisioningProgress {
+	annotations := claim.Annotations
+	latest, err := p.Client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+	if err == nil {
+		annotations = latest.Annotations
+	}
+
+	progress := &provisioningProgress{}
+	value, ok := annotations[ProgressAnnotation]
+	if !ok {
+		return progress
+	}
+	if err := json.Unmarshal([]byte(value), progress); err != nil {
+		p.Logger.Warn("Ignoring invalid provisioning progress", zap.String("pvc", claim.Name), zap.String("value", value), zap.Error(err))
+		return &provisioningProgress{}
+	}
+	progress.saved = true
+	return progress
+}
+
+// saveProgress records progress on the claim, nil removes the checkpoint.
+// A claim that no longer exists has nothing to resume and is not an error.
+func (p *IBMS3fsProvisioner) saveProgress(ctx context.Context, claim *v1.PersistentVolumeClaim, progress *provisioningProgress) error {
+	var value interface{}
+	if progress != nil {
+		buf, err := json.Marshal(progress)
+		if err != nil {
+			return err
+		}
+		value = string(buf)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{ProgressAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.Client.CoreV1().PersistentVolumeClaims(claim.Namespace).Patch(ctx, claim.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		p.Logger.Warn("Cannot record provisioning progress, PVC not found", zap.String("pvc", claim.Name), zap.String("namespace", claim.Namespace))
+		return nil
+	}
+	if err == nil && progress != nil {
+		progress.saved = true
+	}
+	return err
+}
+
+// recordStep marks step as done. The steps are idempotent, so failing to
+// record one only means that it is applied again by the next attempt.
+func (p *IBMS3fsProvisioner) recordStep(ctx context.Context, claim *v1.PersistentVolumeClaim, progress *provisioningProgress, step string) {
+	progress.markDone(step)
+	if err := p.saveProgress(ctx, claim, progress); err != nil {
+		p.Logger.Warn("Cannot record provisioning progress", zap.String("pvc", claim.Name), zap.String("step", step), zap.Error(err))
+	}
+}
+
+// newBucketName returns the bucket name generated by a previous attempt, or a new one
+func (p *IBMS3fsProvisioner) newBucketName(progress *provisioningProgress) (string, error) {
+	if strings.HasPrefix(progress.Bucket, autoBucketNamePrefix) {
+		return progress.Bucket, nil
+	}
+	id, err := p.UUIDGenerator.New()
+	if err != nil {
+		return "", err
+	}
+	return autoBucketNamePrefix + id, nil
+}
+
+// bucketOwnedBy reports whether bucket carries the ownership marker of owner
+func bucketOwnedBy(ctx context.Context, sess backend.ObjectStorageSession, bucket string, owner *backend.BucketOwner) (bool, error) {
+	marker, err := sess.GetBucketOwnerWithContext(ctx, bucket)
+	if err != nil {
+		return false, err
+	}
+	return marker != nil && ownsBucket(marker, owner), nil
+}
+
+// failProvisioning ends a failed provisioning step. When the failure is
+// expected to go away the bucket and the checkpoint are kept for the next
+// attempt to resume. Otherwise a bucket created by provisioning is deleted
+// and the checkpoint cleared, buckets that existed before are left alone.
+func (p *IBMS3fsProvisioner) failProvisioning(ctx context.Context, claim *v1.PersistentVolumeClaim, sess backend.ObjectStorageSession,
+	progress *provisioningProgress, err error) (controller.ProvisioningState, error) {
+	state := provisioningState(err)
+	if state == controller.ProvisioningInBackground || !progress.BucketCreated {
+		return state, err
+	}
+
+	if err1 := sess.DeleteBucketWithContext(ctx, progress.Bucket); err1 != nil {
+		return controller.ProvisioningFinished, fmt.Errorf("%w, and cannot delete bucket %s: %v", err, progress.Bucket, err1)
+	}
+	if err1 := p.saveProgress(ctx, claim, nil); err1 != nil {
+		p.Logger.Warn("Cannot clear provisioning progress", zap.String("pvc", claim.Name), zap.Error(err1))
+	}
+	return controller.ProvisioningFinished, err
+}
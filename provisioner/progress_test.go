@@ -0,0 +1,174 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	fakeProvider "github.com/IBM/ibmcloud-object-storage-plugin/ibm-provider/provider/fake-provider"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake"
+	fakeGrpcClient "github.com/IBM/ibmcloud-object-storage-plugin/utils/grpc-client/fake-grpc"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/uuid"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testGeneratedBucket = autoBucketNamePrefix + "previous-attempt"
+
+func Test_Provision_ResumeSkipsDoneSteps(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getCustomProvisioner(
+		&clientGoConfig{withResConfAPIKey: true},
+		factory,
+		&fakeGrpcClient.FakeGrpcSessionFactory{},
+		&fake.FakeAccessPolicyFactory{FailUpdateAccessPolicy: true, FailUpdateAccessPolicyErrMsg: "must not be called"},
+		&fakeProvider.FakeIBMProviderClientFactory{ClusterTypeVpcG2: true, TestSvcEndpoint: true},
+		uuid.NewCryptoGenerator(),
+	)
+	oldAccessPlcy, oldQuotaLmt := ConfigBucketAccessPolicy, ConfigQuotaLimit
+	enabled := true
+	ConfigBucketAccessPolicy, ConfigQuotaLimit = &enabled, &enabled
+	defer func() {
+		ConfigBucketAccessPolicy, ConfigQuotaLimit = oldAccessPlcy, oldQuotaLmt
+	}()
+
+	v := getVolumeOptions()
+	v.PVC.Name = "test-pvc"
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+	v.PVC.Annotations[ProgressAnnotation] = `{"bucket":"` + testGeneratedBucket + `","bucketCreated":true,"done":["access-policy","quota-limit"]}`
+	_, err := p.Client.CoreV1().PersistentVolumeClaims(testNamespace).Create(context.Background(), v.PVC, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testGeneratedBucket, pv.Spec.FlexVolume.Options[optionBucket])
+	}
+	assert.Equal(t, testGeneratedBucket, factory.LastCreatedBucket)
+
+	pvc, err := p.Client.CoreV1().PersistentVolumeClaims(testNamespace).Get(context.Background(), v.PVC.Name, metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, pvc.Annotations, ProgressAnnotation)
+	}
+}
+
+func Test_Provision_ProgressOfOtherBucketIgnored(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{FailSetBucketVersioning: true}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	v := getVolumeOptions()
+	v.PVC.Name = "test-pvc"
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationBucketVersioning] = "true"
+	v.PVC.Annotations[ProgressAnnotation] = `{"bucket":"other-bucket","bucketCreated":true,"done":["bucket-versioning"]}`
+	_, err := p.Client.CoreV1().PersistentVolumeClaims(testNamespace).Create(context.Background(), v.PVC, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	_, _, err = p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to set versioning")
+	}
+	// the bucket was created by this attempt and is rolled back
+	assert.Equal(t, testBucket, factory.LastDeletedBucket)
+}
+
+func Test_Provision_GeneratedBucketCreatedByPreviousAttempt(t *testing.T) {
+	// the previous attempt stamped the bucket with the marker of the claim
+	factory := &fake.ObjectStorageSessionFactory{FailCreateBucket: true, FailCreateBucketErrMsg: "BucketAlreadyOwnedByYou", FailSetBucketVersioning: true}
+	factory.BucketOwners = map[string]*backend.BucketOwner{
+		testGeneratedBucket: {ClusterID: os.Getenv("CLUSTER_ID"), PVName: testPVName, ClaimUID: "claim-1"},
+	}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	v := getVolumeOptions()
+	v.PVName = testPVName
+	v.PVC.Name = "test-pvc"
+	v.PVC.UID = "claim-1"
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+	v.PVC.Annotations[annotationBucketVersioning] = "true"
+	v.PVC.Annotations[ProgressAnnotation] = `{"bucket":"` + testGeneratedBucket + `"}`
+	_, err := p.Client.CoreV1().PersistentVolumeClaims(testNamespace).Create(context.Background(), v.PVC, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	_, _, err = p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to set versioning")
+	}
+	assert.Equal(t, testGeneratedBucket, factory.LastCreatedBucket)
+	assert.Equal(t, testGeneratedBucket, factory.LastDeletedBucket)
+}
+
+func Test_Provision_ForgedProgressOfOtherClaimBucket(t *testing.T) {
+	// the checkpoint names a generated bucket stamped for another claim
+	other := &backend.BucketOwner{ClusterID: os.Getenv("CLUSTER_ID"), PVName: "pvc-other", ClaimUID: "claim-2"}
+	factory := &fake.ObjectStorageSessionFactory{FailCreateBucket: true, FailCreateBucketErrMsg: "BucketAlreadyOwnedByYou", FailSetBucketVersioning: true}
+	factory.BucketOwners = map[string]*backend.BucketOwner{testGeneratedBucket: other}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	v := getVolumeOptions()
+	v.PVName = testPVName
+	v.PVC.Name = "test-pvc"
+	v.PVC.UID = "claim-1"
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+	v.PVC.Annotations[annotationBucketVersioning] = "true"
+	v.PVC.Annotations[ProgressAnnotation] = `{"bucket":"` + testGeneratedBucket + `","bucketCreated":true}`
+	_, err := p.Client.CoreV1().PersistentVolumeClaims(testNamespace).Create(context.Background(), v.PVC, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	_, _, err = p.Provision(context.Background(), v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "already exists and was not created for this claim")
+	}
+	assert.Empty(t, factory.LastDeletedBucket)
+	assert.Same(t, other, factory.BucketOwners[testGeneratedBucket])
+
+	// the next attempt generates another name
+	pvc, err := p.Client.CoreV1().PersistentVolumeClaims(testNamespace).Get(context.Background(), v.PVC.Name, metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, pvc.Annotations, ProgressAnnotation)
+	}
+}
+
+func Test_Provision_NamedBucketAlreadyExistsNotRolledBack(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{FailCreateBucket: true, FailCreateBucketErrMsg: "BucketAlreadyOwnedByYou", FailSetBucketVersioning: true}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationBucketVersioning] = "true"
+
+	_, _, err := p.Provision(context.Background(), v)
+	assert.Error(t, err)
+	assert.Empty(t, factory.LastDeletedBucket)
+}
+
+func Test_Provision_InvalidProgressIgnored(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationAutoDeleteBucket] = "true"
+	v.PVC.Annotations[ProgressAnnotation] = "{"
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, testGeneratedBucket, pv.Spec.FlexVolume.Options[optionBucket])
+		assert.Contains(t, pv.Spec.FlexVolume.Options[optionBucket], autoBucketNamePrefix)
+	}
+}
@@ -0,0 +1,139 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// quotaThresholdReason is the reason of the events warning that a volume
+// crossed a quota threshold
+const quotaThresholdReason = "QuotaThresholdReached"
+
+// annotationQuotaThreshold records in the PV the last quota threshold its PVC
+// was warned of
+const annotationQuotaThreshold = "ibm.io/quota-threshold"
+
+var volumeQuotaUsedRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "ibmc_s3fs",
+	Subsystem: "volume",
+	Name:      "quota_used_ratio",
+	Help:      "Bytes stored in the bucket of the volume divided by its hard quota.",
+}, volumeLabels)
+
+func init() {
+	prometheus.MustRegister(volumeQuotaUsedRatio)
+}
+
+// ParseQuotaThresholds parses a comma separated list of percentages of the
+// hard quota, e.g. "80,95", into sorted thresholds
+func ParseQuotaThresholds(value string) ([]int, error) {
+	var thresholds []int
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		t, err := strconv.Atoi(s)
+		if err != nil || t <= 0 || t > 100 {
+			return nil, fmt.Errorf("%q is not a percentage between 1 and 100", s)
+		}
+		thresholds = append(thresholds, t)
+	}
+	sort.Ints(thresholds)
+	return thresholds, nil
+}
+
+// crossedThreshold returns the highest of thresholds reached by usage, 0 if
+// none is or the bucket has no hard quota
+func crossedThreshold(thresholds []int, usage *VolumeUsage) int {
+	if usage.HardQuota <= 0 {
+		return 0
+	}
+	crossed := 0
+	for _, t := range thresholds {
+		if usage.BytesUsed*100 >= usage.HardQuota*int64(t) {
+			crossed = t
+		}
+	}
+	return crossed
+}
+
+// checkQuota exports the quota used by a volume and warns its PVC once per
+// crossed threshold. The last warned threshold is recorded in the PV, so that
+// neither a restart nor a new leader warns it again. A volume falling back
+// below a threshold is warned again when it crosses it anew.
+func (c *UsageCollector) checkQuota(ctx context.Context, pv *v1.PersistentVolume, labels prometheus.Labels, usage *VolumeUsage) {
+	if usage.HardQuota <= 0 {
+		volumeQuotaUsedRatio.Delete(labels)
+		return
+	}
+	volumeQuotaUsedRatio.With(labels).Set(float64(usage.BytesUsed) / float64(usage.HardQuota))
+
+	usage.QuotaThreshold = crossedThreshold(c.QuotaThresholds, usage)
+	if c.Recorder == nil {
+		return
+	}
+	warned, _ := strconv.Atoi(pv.Annotations[annotationQuotaThreshold])
+	if warned == usage.QuotaThreshold {
+		return
+	}
+	if err := c.saveQuotaThreshold(ctx, pv, usage.QuotaThreshold); err != nil {
+		// warned on the next measure rather than on each of them
+		c.Provisioner.Logger.Warn("cannot record the quota threshold of volume "+pv.Name, zap.Error(err))
+		return
+	}
+	if usage.QuotaThreshold < warned {
+		return
+	}
+	claim := &v1.ObjectReference{
+		Kind:       "PersistentVolumeClaim",
+		APIVersion: "v1",
+		Namespace:  pv.Spec.ClaimRef.Namespace,
+		Name:       pv.Spec.ClaimRef.Name,
+		UID:        pv.Spec.ClaimRef.UID,
+	}
+	c.Recorder.Eventf(claim, v1.EventTypeWarning, quotaThresholdReason,
+		"volume %s uses %d%% of its %s quota (threshold %d%%), writes fail once the quota is reached",
+		pv.Name, usage.BytesUsed*100/usage.HardQuota,
+		resource.NewQuantity(usage.HardQuota, resource.BinarySI).String(), usage.QuotaThreshold)
+}
+
+// saveQuotaThreshold records the last warned quota threshold of a volume in
+// the annotations of its PV, removing it when the volume crossed none
+func (c *UsageCollector) saveQuotaThreshold(ctx context.Context, pv *v1.PersistentVolume, threshold int) error {
+	var value interface{}
+	if threshold > 0 {
+		value = strconv.Itoa(threshold)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotationQuotaThreshold: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Provisioner.Client.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,68 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const provisionerRBACFile = "../deploy/provisioner-sa.yaml"
+
+// clusterRoleVerbs returns the verbs granted by the ClusterRole name of the
+// deployment manifest, by resource
+func clusterRoleVerbs(t *testing.T, name string) map[string][]string {
+	f, err := os.Open(provisionerRBACFile)
+	if err != nil {
+		t.Fatalf("cannot open %s: %v", provisionerRBACFile, err)
+	}
+	defer f.Close()
+
+	verbs := map[string][]string{}
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var role rbacv1.ClusterRole
+		if err := decoder.Decode(&role); err == io.EOF {
+			return verbs
+		} else if err != nil {
+			t.Fatalf("cannot decode %s: %v", provisionerRBACFile, err)
+		}
+		if role.Kind != "ClusterRole" || role.Name != name {
+			continue
+		}
+		for _, rule := range role.Rules {
+			for _, resource := range rule.Resources {
+				verbs[resource] = append(verbs[resource], rule.Verbs...)
+			}
+		}
+	}
+}
+
+// The fake clientset of the tests does not check permissions, the requests
+// the provisioner sends are checked against its ClusterRole instead.
+func Test_ClusterRole_GrantsProvisionerRequests(t *testing.T) {
+	verbs := clusterRoleVerbs(t, "ibmcloud-object-storage-plugin")
+
+	// the provisioning checkpoint is patched on the claim
+	assert.Subset(t, verbs["persistentvolumeclaims"], []string{"get", "patch"})
+	// the archive path is patched on the volume before it is deleted
+	assert.Subset(t, verbs["persistentvolumes"], []string{"get", "create", "delete", "patch"})
+	// the node selected by the scheduler gives the region of the volume
+	assert.Subset(t, verbs["nodes"], []string{"get"})
+	assert.Subset(t, verbs["events"], []string{"create"})
+	// a single replica measures the volume usage
+	assert.Subset(t, verbs["leases"], []string{"get", "create", "update"})
+}
@@ -0,0 +1,164 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v6/controller"
+)
+
+// RegionEndpoint is the COS endpoint serving the buckets of a region
+type RegionEndpoint struct {
+	// Endpoint is the COS S3 endpoint of the region
+	Endpoint string `json:"endpoint"`
+	// LocationConstraint is the location constraint of the buckets created
+	// in the region, e.g. us-south-standard
+	LocationConstraint string `json:"locationConstraint,omitempty"`
+	// IAMEndpoint is the IAM endpoint used with the region, optional
+	IAMEndpoint string `json:"iamEndpoint,omitempty"`
+}
+
+// RegionEndpoints maps the topology.kubernetes.io/region label of the
+// nodes to the COS endpoint of their region
+type RegionEndpoints map[string]RegionEndpoint
+
+// LoadRegionEndpoints reads a JSON region table from path
+func LoadRegionEndpoints(path string) (RegionEndpoints, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table RegionEndpoints
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("cannot parse region endpoints %s: %v", path, err)
+	}
+	for region, re := range table {
+		if !hasHTTPScheme(re.Endpoint) {
+			return nil, fmt.Errorf("bad endpoint %q for region %s: must be of the form http://<hostname> or https://<hostname>", re.Endpoint, region)
+		}
+		if err := checkLocationConstraint(re.LocationConstraint, re.Endpoint); err != nil {
+			return nil, fmt.Errorf("bad location constraint for region %s: %v", region, err)
+		}
+		if re.IAMEndpoint != "" && !hasHTTPScheme(re.IAMEndpoint) {
+			return nil, fmt.Errorf("bad IAM endpoint %q for region %s: must be of the form http://<hostname> or https://<hostname>", re.IAMEndpoint, region)
+		}
+	}
+	return table, nil
+}
+
+func hasHTTPScheme(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "https://") || strings.HasPrefix(endpoint, "http://")
+}
+
+// topologyRegion returns the region the volume should be provisioned in,
+// with the node label key it was found under: the region of the node
+// selected by the scheduler, or else the only region allowed by the storage
+// class topologies. Both are empty when neither is known.
+func topologyRegion(options controller.ProvisionOptions) (string, string, error) {
+	if options.SelectedNode != nil {
+		for _, key := range []string{v1.LabelTopologyRegion, v1.LabelFailureDomainBetaRegion} {
+			if region := options.SelectedNode.Labels[key]; region != "" {
+				return key, region, nil
+			}
+		}
+	}
+	if options.StorageClass == nil {
+		return "", "", nil
+	}
+
+	var regions []string
+	key := ""
+	for _, term := range options.StorageClass.AllowedTopologies {
+		for _, expr := range term.MatchLabelExpressions {
+			if expr.Key != v1.LabelTopologyRegion && expr.Key != v1.LabelFailureDomainBetaRegion {
+				continue
+			}
+			if key == "" {
+				key = expr.Key
+			}
+			for _, value := range expr.Values {
+				if !containsString(regions, value) {
+					regions = append(regions, value)
+				}
+			}
+		}
+	}
+	if len(regions) > 1 {
+		return "", "", fmt.Errorf("allowedTopologies lists several regions %v, use volumeBindingMode WaitForFirstConsumer to select one", regions)
+	}
+	if len(regions) == 1 {
+		return key, regions[0], nil
+	}
+	return "", "", nil
+}
+
+// applyRegionEndpoint selects the endpoint and location constraint of the
+// bucket created for the volume from the region of its topology. It returns
+// the region the volume is bound to with its node label key, or "" when no
+// mapping applies.
+func (p *IBMS3fsProvisioner) applyRegionEndpoint(options controller.ProvisionOptions, pvc *pvcAnnotations, sc *scOptions) (string, string, error) {
+	// existing and shared buckets stay in the region they were created in
+	if len(p.RegionEndpoints) == 0 || pvc.AutoCreateBucket != "true" || pvc.SharedBucket != "" {
+		return "", "", nil
+	}
+	key, region, err := topologyRegion(options)
+	if err != nil || region == "" {
+		return "", "", err
+	}
+	re, ok := p.RegionEndpoints[region]
+	if !ok {
+		p.Logger.Warn("no COS endpoint configured for region, using the storage class endpoint",
+			zap.String("pvc", options.PVC.Name), zap.String("region", region))
+		return "", "", nil
+	}
+
+	// endpoints set on the PVC still take precedence
+	if pvc.Endpoint == "" {
+		sc.OSEndpoint = re.Endpoint
+	}
+	if pvc.Region == "" && re.LocationConstraint != "" {
+		sc.OSStorageClass = re.LocationConstraint
+	}
+	if pvc.IAMEndpoint == "" && re.IAMEndpoint != "" {
+		sc.IAMEndpoint = re.IAMEndpoint
+	}
+	return key, region, nil
+}
+
+// regionNodeAffinity restricts the volume to the nodes whose label key is region
+func regionNodeAffinity(key, region string) *v1.VolumeNodeAffinity {
+	return &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{
+				MatchExpressions: []v1.NodeSelectorRequirement{{
+					Key:      key,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{region},
+				}},
+			}},
+		},
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fakeProvider "github.com/IBM/ibmcloud-object-storage-plugin/ibm-provider/provider/fake-provider"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake"
+	fakeGrpcClient "github.com/IBM/ibmcloud-object-storage-plugin/utils/grpc-client/fake-grpc"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testRegion         = "eu-de"
+	testRegionEndpoint = "https://s3.eu-de.cloud-object-storage.appdomain.cloud"
+	testRegionLocation = "eu-de-standard"
+)
+
+func getRegionEndpoints() RegionEndpoints {
+	return RegionEndpoints{
+		testRegion: {Endpoint: testRegionEndpoint, LocationConstraint: testRegionLocation},
+	}
+}
+
+func getRegionNode(region string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{v1.LabelTopologyRegion: region},
+	}}
+}
+
+func writeRegionEndpoints(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "regions.json")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func Test_LoadRegionEndpoints(t *testing.T) {
+	path := writeRegionEndpoints(t, `{"eu-de": {"endpoint": "`+testRegionEndpoint+`", "locationConstraint": "`+testRegionLocation+`"}}`)
+
+	table, err := LoadRegionEndpoints(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, getRegionEndpoints(), table)
+	}
+}
+
+func Test_LoadRegionEndpoints_BadEndpoint(t *testing.T) {
+	path := writeRegionEndpoints(t, `{"eu-de": {"endpoint": "s3.eu-de.cloud-object-storage.appdomain.cloud"}}`)
+
+	_, err := LoadRegionEndpoints(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bad endpoint")
+	}
+}
+
+func Test_LoadRegionEndpoints_BadJSON(t *testing.T) {
+	_, err := LoadRegionEndpoints(writeRegionEndpoints(t, `eu-de`))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot parse region endpoints")
+	}
+}
+
+func Test_LoadRegionEndpoints_BadLocationConstraint(t *testing.T) {
+	path := writeRegionEndpoints(t, `{"eu-de": {"endpoint": "`+testRegionEndpoint+`", "locationConstraint": "us-south-standard"}}`)
+
+	_, err := LoadRegionEndpoints(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bad location constraint for region eu-de")
+	}
+}
+
+func Test_TopologyRegion_SelectedNode(t *testing.T) {
+	v := getVolumeOptions()
+	v.SelectedNode = getRegionNode(testRegion)
+
+	key, region, err := topologyRegion(v)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.LabelTopologyRegion, key)
+	assert.Equal(t, testRegion, region)
+}
+
+func Test_TopologyRegion_SelectedNodeBetaLabel(t *testing.T) {
+	v := getVolumeOptions()
+	v.SelectedNode = &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{v1.LabelFailureDomainBetaRegion: testRegion},
+	}}
+
+	key, region, err := topologyRegion(v)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.LabelFailureDomainBetaRegion, key)
+	assert.Equal(t, testRegion, region)
+}
+
+func Test_TopologyRegion_AllowedTopologies(t *testing.T) {
+	v := getVolumeOptions()
+	v.StorageClass.AllowedTopologies = []v1.TopologySelectorTerm{{
+		MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+			{Key: v1.LabelTopologyZone, Values: []string{"eu-de-1", "eu-de-2"}},
+			{Key: v1.LabelTopologyRegion, Values: []string{testRegion}},
+		},
+	}}
+
+	key, region, err := topologyRegion(v)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.LabelTopologyRegion, key)
+	assert.Equal(t, testRegion, region)
+}
+
+func Test_TopologyRegion_SeveralAllowedRegions(t *testing.T) {
+	v := getVolumeOptions()
+	v.StorageClass.AllowedTopologies = []v1.TopologySelectorTerm{{
+		MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+			{Key: v1.LabelTopologyRegion, Values: []string{testRegion, "us-south"}},
+		},
+	}}
+
+	_, _, err := topologyRegion(v)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "several regions")
+	}
+}
+
+func Test_Provision_RegionEndpoint(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	p.RegionEndpoints = getRegionEndpoints()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.SelectedNode = getRegionNode(testRegion)
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testRegionEndpoint, pv.Spec.FlexVolume.Options[optionOSEndpoint])
+		assert.Equal(t, testRegionLocation, pv.Spec.FlexVolume.Options[optionStorageClass])
+		assert.Equal(t, regionNodeAffinity(v1.LabelTopologyRegion, testRegion), pv.Spec.NodeAffinity)
+	}
+	assert.Equal(t, testRegionEndpoint, factory.LastEndpoint)
+	assert.Equal(t, testRegionLocation, factory.LastRegion)
+	assert.Equal(t, testBucket, factory.LastCreatedBucket)
+}
+
+func Test_Provision_RegionEndpoint_BetaLabel(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	p.RegionEndpoints = getRegionEndpoints()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.SelectedNode = &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{v1.LabelFailureDomainBetaRegion: testRegion},
+	}}
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) && assert.NotNil(t, pv.Spec.NodeAffinity) {
+		// the volume is bound with the label the nodes of the cluster carry
+		expr := pv.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0]
+		assert.Equal(t, v1.LabelFailureDomainBetaRegion, expr.Key)
+		assert.Equal(t, []string{testRegion}, expr.Values)
+	}
+}
+
+func Test_Provision_RegionEndpoint_UnknownRegion(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	p.RegionEndpoints = getRegionEndpoints()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.SelectedNode = getRegionNode("us-south")
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testOSEndpoint, pv.Spec.FlexVolume.Options[optionOSEndpoint])
+		assert.Nil(t, pv.Spec.NodeAffinity)
+	}
+	assert.Equal(t, testOSEndpoint, factory.LastEndpoint)
+}
+
+func Test_Provision_RegionEndpoint_ExistingBucket(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	p.RegionEndpoints = getRegionEndpoints()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.SelectedNode = getRegionNode(testRegion)
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testOSEndpoint, pv.Spec.FlexVolume.Options[optionOSEndpoint])
+		assert.Nil(t, pv.Spec.NodeAffinity)
+	}
+}
+
+func Test_Provision_RegionEndpoint_PVCEndpoint(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	p.RegionEndpoints = getRegionEndpoints()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationAutoCreateBucket] = "true"
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationEndpoint] = testOSEndpoint
+	v.SelectedNode = getRegionNode(testRegion)
+
+	pv, _, err := p.Provision(context.Background(), v)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testOSEndpoint, pv.Spec.FlexVolume.Options[optionOSEndpoint])
+		assert.Equal(t, testRegionLocation, pv.Spec.FlexVolume.Options[optionStorageClass])
+		assert.Equal(t, regionNodeAffinity(v1.LabelTopologyRegion, testRegion), pv.Spec.NodeAffinity)
+	}
+}
@@ -0,0 +1,321 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/parser"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+// DefaultMaxListedObjects bounds the listing measuring the volumes whose
+// usage is not reported by the Resource Configuration
+const DefaultMaxListedObjects = 100000
+
+// DefaultUsageWorkers is the number of volumes measured at once
+const DefaultUsageWorkers = 4
+
+var (
+	volumeLabels = []string{"persistentvolume", "namespace", "persistentvolumeclaim"}
+
+	volumeUsedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ibmc_s3fs",
+		Subsystem: "volume",
+		Name:      "used_bytes",
+		Help:      "Bytes stored in the bucket, or object path, of the volume.",
+	}, volumeLabels)
+
+	volumeObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ibmc_s3fs",
+		Subsystem: "volume",
+		Name:      "objects",
+		Help:      "Number of objects in the bucket, or object path, of the volume.",
+	}, volumeLabels)
+
+	volumeUsageTruncated = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ibmc_s3fs",
+		Subsystem: "volume",
+		Name:      "usage_truncated",
+		Help:      "1 when the listing measuring the volume stopped at its bound, its usage being a lower bound.",
+	}, volumeLabels)
+
+	volumeUsageErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ibmc_s3fs",
+		Subsystem: "volume",
+		Name:      "usage_errors_total",
+		Help:      "Number of failed measures of the usage of the volume.",
+	}, volumeLabels)
+)
+
+func init() {
+	prometheus.MustRegister(volumeUsedBytes, volumeObjects, volumeUsageTruncated, volumeUsageErrorsTotal)
+}
+
+// VolumeUsage is the last measured usage of a volume
+type VolumeUsage struct {
+	backend.Usage
+	Namespace  string
+	Claim      string
+	MeasuredAt time.Time
+	// QuotaThreshold is the highest quota threshold the volume crossed
+	QuotaThreshold int
+}
+
+// UsageCollector periodically measures the storage used by the bound volumes
+// of the provisioner and exports it as Prometheus gauges. The usage of a bucket
+// is read from its Resource Configuration when the secret of the volume holds
+// an API key, the object paths and the buckets accessed with HMAC keys are
+// listed. Each volume is measured once per Interval. The PVC of a volume is
+// warned by an event when the usage of its bucket crosses one of
+// QuotaThresholds of its hard quota. A single replica of the provisioner
+// should run the collector, see RunElected.
+type UsageCollector struct {
+	Provisioner *IBMS3fsProvisioner
+	// Interval is the period of the measures
+	Interval time.Duration
+	// MaxListedObjects bounds the listing of a volume, DefaultMaxListedObjects if 0
+	MaxListedObjects int
+	// Workers bounds the volumes measured at once, DefaultUsageWorkers if 0
+	Workers int
+	// QuotaThresholds are the percentages of the hard quota warned on the
+	// PVC, in increasing order
+	QuotaThresholds []int
+	// Recorder records the quota warnings, nil disables them
+	Recorder record.EventRecorder
+
+	mu    sync.Mutex
+	usage map[string]*VolumeUsage
+}
+
+// Run measures the volumes every Interval until ctx is done
+func (c *UsageCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		c.Collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LeaderElection configures the lease electing the replica of the provisioner
+// running the UsageCollector
+type LeaderElection struct {
+	// Namespace and Name of the lease
+	Namespace string
+	Name      string
+	// Identity of the replica in the lease
+	Identity      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// RunElected runs the collector with the context of the leadership while the
+// replica holds the lease of election, and competes for the lease again once
+// it lost it, until ctx is done. The usage measured by a former leader is
+// forgotten.
+func (c *UsageCollector) RunElected(ctx context.Context, election LeaderElection) error {
+	for ctx.Err() == nil {
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta:  metav1.ObjectMeta{Namespace: election.Namespace, Name: election.Name},
+				Client:     c.Provisioner.Client.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{Identity: election.Identity},
+			},
+			LeaseDuration:   election.LeaseDuration,
+			RenewDeadline:   election.RenewDeadline,
+			RetryPeriod:     election.RetryPeriod,
+			ReleaseOnCancel: true,
+			Name:            election.Name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					c.Provisioner.Logger.Info("measuring the volume usage", zap.String("identity", election.Identity))
+					c.Run(ctx)
+				},
+				OnStoppedLeading: func() {
+					c.Provisioner.Logger.Info("stopped measuring the volume usage", zap.String("identity", election.Identity))
+					c.Reset()
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		elector.Run(ctx)
+	}
+	return nil
+}
+
+// Usage returns the last measured usage of a volume
+func (c *UsageCollector) Usage(pvName string) (*VolumeUsage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.usage[pvName]
+	return u, ok
+}
+
+// Collect measures the bound volumes of the provisioner whose cached usage
+// is older than Interval, Workers at a time, and forgets the deleted ones
+func (c *UsageCollector) Collect(ctx context.Context) {
+	p := c.Provisioner
+	pvs, err := p.Client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		p.Logger.Warn("cannot list persistent volumes to measure their usage", zap.Error(err))
+		return
+	}
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = DefaultUsageWorkers
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	seen := map[string]bool{}
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if pv.Spec.FlexVolume == nil || pv.Spec.FlexVolume.Driver != driverName ||
+			pv.Status.Phase != v1.VolumeBound || pv.Spec.ClaimRef == nil {
+			continue
+		}
+		seen[pv.Name] = true
+		previous, ok := c.Usage(pv.Name)
+		if (ok && time.Since(previous.MeasuredAt) < c.Interval) || ctx.Err() != nil {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c.collect(ctx, pv)
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, u := range c.usage {
+		if !seen[name] {
+			c.forget(name, u)
+		}
+	}
+}
+
+// Reset forgets the usage of every volume and stops exporting it, so that
+// only the replica measuring the volumes exports their usage
+func (c *UsageCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, u := range c.usage {
+		c.forget(name, u)
+	}
+}
+
+// forget drops the usage of a volume and its gauges, c.mu being held
+func (c *UsageCollector) forget(name string, u *VolumeUsage) {
+	labels := prometheus.Labels{"persistentvolume": name, "namespace": u.Namespace, "persistentvolumeclaim": u.Claim}
+	volumeUsedBytes.Delete(labels)
+	volumeObjects.Delete(labels)
+	volumeUsageTruncated.Delete(labels)
+	volumeUsageErrorsTotal.Delete(labels)
+	volumeQuotaUsedRatio.Delete(labels)
+	delete(c.usage, name)
+}
+
+// collect measures a volume and exports its usage
+func (c *UsageCollector) collect(ctx context.Context, pv *v1.PersistentVolume) {
+	labels := prometheus.Labels{
+		"persistentvolume":      pv.Name,
+		"namespace":             pv.Spec.ClaimRef.Namespace,
+		"persistentvolumeclaim": pv.Spec.ClaimRef.Name,
+	}
+	usage, err := c.measure(ctx, pv)
+	if err != nil {
+		volumeUsageErrorsTotal.With(labels).Inc()
+		c.Provisioner.Logger.Warn("cannot measure the usage of volume "+pv.Name, zap.Error(err))
+		return
+	}
+	u := &VolumeUsage{
+		Usage:      *usage,
+		Namespace:  pv.Spec.ClaimRef.Namespace,
+		Claim:      pv.Spec.ClaimRef.Name,
+		MeasuredAt: time.Now(),
+	}
+	c.checkQuota(ctx, pv, labels, u)
+	c.mu.Lock()
+	if c.usage == nil {
+		c.usage = map[string]*VolumeUsage{}
+	}
+	c.usage[pv.Name] = u
+	c.mu.Unlock()
+
+	volumeUsedBytes.With(labels).Set(float64(usage.BytesUsed))
+	volumeObjects.With(labels).Set(float64(usage.ObjectCount))
+	truncated := 0.0
+	if usage.Truncated {
+		truncated = 1
+	}
+	volumeUsageTruncated.With(labels).Set(truncated)
+}
+
+// measure reads the usage of the bucket, or object path, of a volume
+func (c *UsageCollector) measure(ctx context.Context, pv *v1.PersistentVolume) (*backend.Usage, error) {
+	p := c.Provisioner
+	var pvcAnnots pvcAnnotations
+	if err := parser.UnmarshalMap(&pv.Annotations, &pvcAnnots); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal PV annotations: %v", err)
+	}
+	endpointValue := pv.Spec.FlexVolume.Options["object-store-endpoint"]
+	regionValue := pv.Spec.FlexVolume.Options["object-store-storage-class"]
+	iamEndpoint := pv.Spec.FlexVolume.Options["iam-endpoint"]
+
+	if err := p.writeCrtFile(ctx, pvcAnnots.SecretName, pvcAnnots.SecretNamespace, pvcAnnots.CosServiceName); err != nil {
+		return nil, fmt.Errorf("cannot retrieve secret: %v", err)
+	}
+	creds, _, resConfApiKey, _, err := p.getCredentials(ctx, pvcAnnots.SecretName, pvcAnnots.SecretNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get credentials: %v", err)
+	}
+
+	if pvcAnnots.ObjectPath == "" {
+		apiKey := resConfApiKey
+		if apiKey == "" {
+			apiKey = creds.APIKey
+		}
+		if apiKey != "" {
+			return p.AccessPolicy.NewAccessPolicy().GetBucketUsage(ctx, apiKey, pvcAnnots.Bucket, endpointValue, iamEndpoint, &backend.UpdateAPObj{})
+		}
+	}
+
+	maxObjects := c.MaxListedObjects
+	if maxObjects == 0 {
+		maxObjects = DefaultMaxListedObjects
+	}
+	creds.IAMEndpoint = iamEndpoint
+	sess := p.Backend.NewObjectStorageSession(endpointValue, regionValue, creds, p.Logger)
+	return sess.GetObjectPathUsageWithContext(ctx, pvcAnnots.Bucket, pvcAnnots.ObjectPath, maxObjects)
+}
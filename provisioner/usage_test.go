@@ -0,0 +1,275 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fakeProvider "github.com/IBM/ibmcloud-object-storage-plugin/ibm-provider/provider/fake-provider"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake"
+	fakeGrpcClient "github.com/IBM/ibmcloud-object-storage-plugin/utils/grpc-client/fake-grpc"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v6/controller"
+)
+
+const testUsagePVName = "pv-usage"
+
+// createBoundPV provisions a volume with v and stores its PV, bound, in the fake cluster
+func createBoundPV(t *testing.T, p *IBMS3fsProvisioner, v controller.ProvisionOptions) *v1.PersistentVolume {
+	// the quota limit set by the provisioner is faked by the usage read
+	v.PVC.Annotations[annotationQuotaLimit] = "false"
+	pv, _, err := p.Provision(context.Background(), v)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	pv.Name = testUsagePVName
+	pv.Spec.ClaimRef = &v1.ObjectReference{Namespace: testNamespace, Name: "test-pvc"}
+	pv.Status.Phase = v1.VolumeBound
+	pv, err = p.Client.CoreV1().PersistentVolumes().Create(context.Background(), pv, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	return pv
+}
+
+func usageLabels() prometheus.Labels {
+	return prometheus.Labels{"persistentvolume": testUsagePVName, "namespace": testNamespace, "persistentvolumeclaim": "test-pvc"}
+}
+
+func Test_UsageCollector_ResourceConfiguration(t *testing.T) {
+	apFactory := &fake.FakeAccessPolicyFactory{BucketUsage: map[string]*backend.Usage{
+		testBucket: {BytesUsed: 2048, ObjectCount: 3, HardQuota: 4096},
+	}}
+	factory := &fake.ObjectStorageSessionFactory{}
+	p := getCustomProvisioner(&clientGoConfig{withAPIKey: true, withServiceInstanceID: true}, factory,
+		&fakeGrpcClient.FakeGrpcSessionFactory{}, apFactory, &fakeProvider.FakeIBMProviderClientFactory{}, uuid.NewCryptoGenerator())
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	createBoundPV(t, p, v)
+	c := &UsageCollector{Provisioner: p, Interval: time.Hour}
+
+	c.Collect(context.Background())
+	usage, ok := c.Usage(testUsagePVName)
+	if assert.True(t, ok) {
+		assert.Equal(t, backend.Usage{BytesUsed: 2048, ObjectCount: 3, HardQuota: 4096}, usage.Usage)
+	}
+	assert.Equal(t, float64(2048), testutil.ToFloat64(volumeUsedBytes.With(usageLabels())))
+	assert.Equal(t, float64(3), testutil.ToFloat64(volumeObjects.With(usageLabels())))
+	assert.Equal(t, 0, factory.UsageReads)
+
+	// the usage is cached for Interval
+	c.Collect(context.Background())
+	assert.Equal(t, 1, apFactory.UsageReads)
+}
+
+func Test_UsageCollector_ObjectPath(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{ObjectPathUsage: &backend.Usage{BytesUsed: 10, ObjectCount: 1, Truncated: true}}
+	apFactory := &fake.FakeAccessPolicyFactory{}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, apFactory, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	v.PVC.Annotations[annotationObjectPath] = testObjectPath
+	createBoundPV(t, p, v)
+	c := &UsageCollector{Provisioner: p, Interval: time.Hour}
+
+	c.Collect(context.Background())
+	assert.Equal(t, testBucket+":"+testObjectPath, factory.LastMeasuredObjectPath)
+	assert.Equal(t, 0, apFactory.UsageReads)
+	assert.Equal(t, float64(10), testutil.ToFloat64(volumeUsedBytes.With(usageLabels())))
+	assert.Equal(t, float64(1), testutil.ToFloat64(volumeUsageTruncated.With(usageLabels())))
+}
+
+func Test_UsageCollector_Error(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{GetObjectPathUsageErr: errors.New("listing failed")}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	createBoundPV(t, p, v)
+	c := &UsageCollector{Provisioner: p, Interval: time.Hour}
+	failures := testutil.ToFloat64(volumeUsageErrorsTotal.With(usageLabels()))
+
+	c.Collect(context.Background())
+	_, ok := c.Usage(testUsagePVName)
+	assert.False(t, ok)
+	assert.Equal(t, failures+1, testutil.ToFloat64(volumeUsageErrorsTotal.With(usageLabels())))
+
+	// the next collection retries
+	c.Collect(context.Background())
+	assert.Equal(t, 2, factory.UsageReads)
+}
+
+func Test_UsageCollector_DeletedVolume(t *testing.T) {
+	p := getProvisioner()
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	createBoundPV(t, p, v)
+	c := &UsageCollector{Provisioner: p, Interval: time.Hour}
+	c.Collect(context.Background())
+
+	assert.NoError(t, p.Client.CoreV1().PersistentVolumes().Delete(context.Background(), testUsagePVName, metav1.DeleteOptions{}))
+	c.Collect(context.Background())
+	_, ok := c.Usage(testUsagePVName)
+	assert.False(t, ok)
+	assert.Equal(t, 0, testutil.CollectAndCount(volumeUsedBytes))
+}
+
+func Test_UsageCollector_Workers(t *testing.T) {
+	factory := &fake.ObjectStorageSessionFactory{ObjectPathUsageDelay: 20 * time.Millisecond}
+	p := getFakeBackendProvisioner(factory, &fakeGrpcClient.FakeGrpcSessionFactory{}, &fake.FakeAccessPolicyFactory{}, &fakeProvider.FakeIBMProviderClientFactory{})
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	pv := createBoundPV(t, p, v)
+	names := []string{testUsagePVName, testUsagePVName + "-2", testUsagePVName + "-3"}
+	for _, name := range names[1:] {
+		other := pv.DeepCopy()
+		other.Name = name
+		other.ResourceVersion = ""
+		_, err := p.Client.CoreV1().PersistentVolumes().Create(context.Background(), other, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+	c := &UsageCollector{Provisioner: p, Interval: time.Hour, Workers: 2}
+
+	c.Collect(context.Background())
+	assert.Equal(t, 3, factory.UsageReads)
+	assert.Equal(t, 2, factory.MaxUsageReadsInFlight)
+
+	// forget the volumes and their gauges
+	for _, name := range names {
+		assert.NoError(t, p.Client.CoreV1().PersistentVolumes().Delete(context.Background(), name, metav1.DeleteOptions{}))
+	}
+	c.Collect(context.Background())
+}
+
+func Test_ParseQuotaThresholds(t *testing.T) {
+	thresholds, err := ParseQuotaThresholds("95, 80")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{80, 95}, thresholds)
+
+	thresholds, err = ParseQuotaThresholds("")
+	assert.NoError(t, err)
+	assert.Empty(t, thresholds)
+
+	for _, bad := range []string{"0", "101", "80,high"} {
+		_, err := ParseQuotaThresholds(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func Test_UsageCollector_QuotaWarnings(t *testing.T) {
+	usage := &backend.Usage{BytesUsed: 50, HardQuota: 100}
+	apFactory := &fake.FakeAccessPolicyFactory{BucketUsage: map[string]*backend.Usage{testBucket: usage}}
+	p := getCustomProvisioner(&clientGoConfig{withAPIKey: true, withServiceInstanceID: true}, &fake.ObjectStorageSessionFactory{},
+		&fakeGrpcClient.FakeGrpcSessionFactory{}, apFactory, &fakeProvider.FakeIBMProviderClientFactory{}, uuid.NewCryptoGenerator())
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	createBoundPV(t, p, v)
+	recorder := record.NewFakeRecorder(10)
+	c := &UsageCollector{Provisioner: p, QuotaThresholds: []int{80, 95}, Recorder: recorder}
+
+	c.Collect(context.Background())
+	assert.Equal(t, 0.5, testutil.ToFloat64(volumeQuotaUsedRatio.With(usageLabels())))
+	assert.Empty(t, recorder.Events)
+
+	usage.BytesUsed = 85
+	c.Collect(context.Background())
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "Warning QuotaThresholdReached volume "+testUsagePVName+" uses 85% of its 100 quota (threshold 80%)")
+	}
+
+	// a threshold is warned once
+	c.Collect(context.Background())
+	assert.Empty(t, recorder.Events)
+
+	usage.BytesUsed = 97
+	c.Collect(context.Background())
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "threshold 95%")
+	}
+
+	// the warned threshold survives a restart of the provisioner
+	c = &UsageCollector{Provisioner: p, QuotaThresholds: []int{80, 95}, Recorder: recorder}
+	c.Collect(context.Background())
+	assert.Empty(t, recorder.Events)
+	pv, err := p.Client.CoreV1().PersistentVolumes().Get(context.Background(), testUsagePVName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "95", pv.Annotations[annotationQuotaThreshold])
+
+	// the thresholds are warned again once the usage fell below them
+	usage.BytesUsed = 10
+	c.Collect(context.Background())
+	pv, err = p.Client.CoreV1().PersistentVolumes().Get(context.Background(), testUsagePVName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, pv.Annotations, annotationQuotaThreshold)
+	usage.BytesUsed = 90
+	c.Collect(context.Background())
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "threshold 80%")
+	}
+}
+
+func Test_UsageCollector_RunElected(t *testing.T) {
+	usage := &backend.Usage{BytesUsed: 85, HardQuota: 100}
+	apFactory := &fake.FakeAccessPolicyFactory{BucketUsage: map[string]*backend.Usage{testBucket: usage}}
+	p := getCustomProvisioner(&clientGoConfig{withAPIKey: true, withServiceInstanceID: true}, &fake.ObjectStorageSessionFactory{},
+		&fakeGrpcClient.FakeGrpcSessionFactory{}, apFactory, &fakeProvider.FakeIBMProviderClientFactory{}, uuid.NewCryptoGenerator())
+	v := getVolumeOptions()
+	v.PVC.Annotations[annotationBucket] = testBucket
+	v.PVC.Annotations[annotationAutoCreateBucket] = "false"
+	createBoundPV(t, p, v)
+	election := func(identity string) LeaderElection {
+		return LeaderElection{
+			Namespace:     testNamespace,
+			Name:          "volume-usage",
+			Identity:      identity,
+			LeaseDuration: time.Second,
+			RenewDeadline: 500 * time.Millisecond,
+			RetryPeriod:   100 * time.Millisecond,
+		}
+	}
+	leader := &UsageCollector{Provisioner: p, Interval: time.Hour, QuotaThresholds: []int{80}, Recorder: record.NewFakeRecorder(10)}
+	follower := &UsageCollector{Provisioner: p, Interval: time.Hour, QuotaThresholds: []int{80}, Recorder: record.NewFakeRecorder(10)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- leader.RunElected(ctx, election("leader")) }()
+	assert.Eventually(t, func() bool {
+		_, ok := leader.Usage(testUsagePVName)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the other replica does not measure the volumes while the lease is held
+	followerCtx, stopFollower := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer stopFollower()
+	assert.NoError(t, follower.RunElected(followerCtx, election("follower")))
+	_, ok := follower.Usage(testUsagePVName)
+	assert.False(t, ok)
+	assert.Len(t, leader.Recorder.(*record.FakeRecorder).Events, 1)
+	assert.Empty(t, follower.Recorder.(*record.FakeRecorder).Events)
+
+	cancel()
+	assert.NoError(t, <-done)
+	_, ok = leader.Usage(testUsagePVName)
+	assert.False(t, ok, "usage of a former leader is forgotten")
+}
@@ -2,7 +2,7 @@
  * IBM Confidential
  * OCO Source Materials
  * IBM Cloud Kubernetes Service, 5737-D43
- * (C) Copyright IBM Corp. 2017, 2023 All Rights Reserved.
+ * (C) Copyright IBM Corp. 2017, 2025 All Rights Reserved.
  * The source code for this program is not published or otherwise divested of
  * its trade secrets, irrespective of what has been deposited with
  * the U.S. Copyright Office.
@@ -11,19 +11,25 @@
 package backend
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/IBM/go-sdk-core/v5/core"
 	rc "github.com/IBM/ibm-cos-sdk-go-config/v2/resourceconfigurationv1"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/endpoints"
+	"go.uber.org/zap"
 )
 
-const ResourceConfigEPDirect = "https://config.direct.cloud-object-storage.cloud.ibm.com/v1"
-const ResourceConfigEPPrivate = "https://config.private.cloud-object-storage.cloud.ibm.com/v1"
 const IAMEPForVPC = "https://private.iam.cloud.ibm.com/identity/token"
 const Private = "private"
 
+// iamComponentName is the problem component of errors returned by the IAM token service
+const iamComponentName = "iam_identity_services"
+
 type AccessPolicyFactory interface {
 	NewAccessPolicy() AccessPolicy
 }
@@ -31,29 +37,109 @@ type AccessPolicyFactory interface {
 type AccessPolicy interface {
 	UpdateAccessPolicy(allowedIps, apiKey, bucketName string, rcc ResourceConfigurationV1) error
 	UpdateQuotaLimit(quota int64, apiKey, bucketName, osEndpoint, iamEndpoint string, rcc ResourceConfigurationV1) error
+	GetBucketUsage(ctx context.Context, apiKey, bucketName, osEndpoint, iamEndpoint string, rcr BucketConfigReader) (*Usage, error)
 }
 
-type UpdateAPFactory struct{}
+// UpdateAPFactory creates access policy sessions. The endpoints default to
+// the IBM Cloud ones and can be overridden, e.g. to target a local stand-in.
+type UpdateAPFactory struct {
+	// IAMEndpoint is the IAM token endpoint, IAMEPForVPC for access policies
+	// and the storage class iam-endpoint for quota limits if empty
+	IAMEndpoint string
+	// ResourceConfigEndpoint is the Resource Configuration endpoint,
+	// derived from the object store endpoint if empty
+	ResourceConfigEndpoint string
+	// Retry retries the bucket configuration updates, a single attempt if nil
+	Retry *RetryPolicy
+	// Logger receives the retry logs, discarded if nil
+	Logger *zap.Logger
+}
 
 type ResourceConfigurationV1 interface {
 	// UpdateBucketConfig updates the bucket access policy configuration with given ips
 	UpdateBucketConfig(*rc.ResourceConfigurationV1, *rc.UpdateBucketConfigOptions) (*core.DetailedResponse, error)
 }
 
+// BucketConfigReader reads the configuration of a bucket
+type BucketConfigReader interface {
+	// GetBucketConfig returns the configuration and usage of a bucket
+	GetBucketConfig(context.Context, *rc.ResourceConfigurationV1, *rc.GetBucketConfigOptions) (*rc.Bucket, *core.DetailedResponse, error)
+}
+
 type UpdateAPObj struct {
-	rcv1 ResourceConfigurationV1
+	rcv1           ResourceConfigurationV1
+	iamEndpoint    string
+	configEndpoint string
+	retry          *RetryPolicy
+	logger         *zap.Logger
 }
 
 func (uc *UpdateAPObj) UpdateBucketConfig(service *rc.ResourceConfigurationV1, options *rc.UpdateBucketConfigOptions) (res *core.DetailedResponse, err error) {
 	return service.UpdateBucketConfig(options)
 }
 
+func (uc *UpdateAPObj) GetBucketConfig(ctx context.Context, service *rc.ResourceConfigurationV1, options *rc.GetBucketConfigOptions) (*rc.Bucket, *core.DetailedResponse, error) {
+	return service.GetBucketConfigWithContext(ctx, options)
+}
+
 func (c *UpdateAPFactory) NewAccessPolicy() AccessPolicy {
 
-	return &UpdateAPObj{}
+	return &UpdateAPObj{
+		iamEndpoint:    c.IAMEndpoint,
+		configEndpoint: c.ResourceConfigEndpoint,
+		retry:          c.Retry,
+		logger:         c.Logger,
+	}
+}
+
+// iamTokenEndpoint returns the IAM token URL, preferring the configured override
+func (c *UpdateAPObj) iamTokenEndpoint(defaultEndpoint string) string {
+	if c.iamEndpoint != "" {
+		return c.iamEndpoint
+	}
+	return defaultEndpoint
+}
+
+// resourceConfigEndpoint returns the Resource Configuration URL, preferring the configured override
+func (c *UpdateAPObj) resourceConfigEndpoint(defaultEndpoint string) string {
+	if c.configEndpoint != "" {
+		return c.configEndpoint
+	}
+	return defaultEndpoint
 }
 
-//var rcc ResourceConfigurationV1 = &UpdateAPObj{}
+// updateBucketConfig calls rcc according to the retry policy
+func (c *UpdateAPObj) updateBucketConfig(operation string, rcc ResourceConfigurationV1, service *rc.ResourceConfigurationV1,
+	options *rc.UpdateBucketConfigOptions) (response *core.DetailedResponse, err error) {
+	err = c.retry.Do(context.Background(), c.logger, operation, func(ctx context.Context) error {
+		response, err = rcc.UpdateBucketConfig(service, options)
+		return classifyConfigError(err)
+	})
+	return response, err
+}
+
+// classifyConfigError classifies a Resource Configuration failure like
+// ClassifyError does for COS. IAM rejecting the API key to issue a token
+// is reported as bad credentials.
+func classifyConfigError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var httpProb *core.HTTPProblem
+	if !errors.As(err, &httpProb) || httpProb.Response == nil {
+		return ClassifyError(err)
+	}
+	status := httpProb.Response.StatusCode
+	kind := classifyStatusCode(status)
+	if httpProb.Component != nil && httpProb.Component.Name == iamComponentName &&
+		status >= http.StatusBadRequest && status < http.StatusInternalServerError && status != http.StatusTooManyRequests {
+		kind = ErrBadCredentials
+	}
+	if kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
 
 // UpdateAccessPolicy updates the bucket access policy configuration with given ips
 func (c *UpdateAPObj) UpdateAccessPolicy(allowedIps, apiKey, bucketName string, rcc ResourceConfigurationV1) error {
@@ -65,12 +151,12 @@ func (c *UpdateAPObj) UpdateAccessPolicy(allowedIps, apiKey, bucketName string,
 
 	authenticator := &core.IamAuthenticator{
 		ApiKey: apiKey,
-		URL:    IAMEPForVPC,
+		URL:    c.iamTokenEndpoint(IAMEPForVPC),
 	}
 
 	service, _ := rc.NewResourceConfigurationV1(&rc.ResourceConfigurationV1Options{
 		Authenticator: authenticator,
-		URL:           ResourceConfigEPDirect,
+		URL:           c.resourceConfigEndpoint(endpoints.ResourceConfigDirect),
 	})
 
 	// Create a map to hold the bucket patch
@@ -86,24 +172,27 @@ func (c *UpdateAPObj) UpdateAccessPolicy(allowedIps, apiKey, bucketName string,
 		BucketPatch: bucketPatchMap,
 	}
 
-	response, err := rcc.UpdateBucketConfig(service, updateConfigOptions)
+	response, err := c.updateBucketConfig("UpdateAccessPolicy", rcc, service, updateConfigOptions)
 	if response != nil {
 		fmt.Println("UpdateAccessPolicy Response ", strconv.Itoa(response.StatusCode))
 	}
 	return err
 }
 
+// bucketConfigEndpoints returns the IAM token and Resource Configuration URLs
+// used with the buckets of osEndpoint
+func (c *UpdateAPObj) bucketConfigEndpoints(osEndpoint, iamEndpoint string) (string, string) {
+	network := endpoints.NetworkDirect
+	if strings.Contains(osEndpoint, Private) {
+		network = endpoints.NetworkPrivate
+	}
+	return c.iamTokenEndpoint(iamEndpoint + "/identity/token"), c.resourceConfigEndpoint(endpoints.ResourceConfig(network))
+}
+
 // UpdateQuotaLimit updates the bucket quota limits
 func (c *UpdateAPObj) UpdateQuotaLimit(quota int64, apiKey, bucketName, osEndpoint, iamEndpoint string, rcc ResourceConfigurationV1) error {
 
-	ConfigEP := ""
-	IAMEP := iamEndpoint + "/identity/token"
-
-	if strings.Contains(osEndpoint, Private) {
-		ConfigEP = ResourceConfigEPPrivate
-	} else {
-		ConfigEP = ResourceConfigEPDirect
-	}
+	IAMEP, ConfigEP := c.bucketConfigEndpoints(osEndpoint, iamEndpoint)
 
 	fmt.Println("ConfigEP used: ", ConfigEP)
 	fmt.Println("IAMEndpoint used: ", IAMEP)
@@ -129,9 +218,47 @@ func (c *UpdateAPObj) UpdateQuotaLimit(quota int64, apiKey, bucketName, osEndpoi
 		BucketPatch: bucketPatchMap,
 	}
 
-	response, err := rcc.UpdateBucketConfig(service, updateConfigOptions)
+	response, err := c.updateBucketConfig("UpdateQuotaLimit", rcc, service, updateConfigOptions)
 	if response != nil {
 		fmt.Println("UpdateQuotaLimit Response ", strconv.Itoa(response.StatusCode))
 	}
 	return err
 }
+
+// GetBucketUsage returns the bytes used, object count and quota reported by
+// the Resource Configuration of a bucket
+func (c *UpdateAPObj) GetBucketUsage(ctx context.Context, apiKey, bucketName, osEndpoint, iamEndpoint string, rcr BucketConfigReader) (*Usage, error) {
+	iamEP, configEP := c.bucketConfigEndpoints(osEndpoint, iamEndpoint)
+	service, _ := rc.NewResourceConfigurationV1(&rc.ResourceConfigurationV1Options{
+		Authenticator: &core.IamAuthenticator{
+			ApiKey: apiKey,
+			URL:    iamEP,
+		},
+		URL: configEP,
+	})
+
+	var bucket *rc.Bucket
+	err := c.retry.Do(ctx, c.logger, "GetBucketUsage", func(ctx context.Context) error {
+		var err error
+		bucket, _, err = rcr.GetBucketConfig(ctx, service, &rc.GetBucketConfigOptions{Bucket: core.StringPtr(bucketName)})
+		return classifyConfigError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bucket == nil {
+		return nil, fmt.Errorf("no configuration returned for bucket %s", bucketName)
+	}
+	return &Usage{
+		BytesUsed:   int64Value(bucket.BytesUsed),
+		ObjectCount: int64Value(bucket.ObjectCount),
+		HardQuota:   int64Value(bucket.HardQuota),
+	}, nil
+}
+
+func int64Value(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
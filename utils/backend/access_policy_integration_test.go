@@ -0,0 +1,177 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package backend
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	fakeRC "github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake-rc"
+	"github.com/stretchr/testify/assert"
+)
+
+func getIntegrationAccessPolicy(t *testing.T) (*fakeRC.Server, *UpdateAPObj) {
+	srv := fakeRC.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddAPIKey(resConfApiKey)
+	srv.AddBucket(fakeRC.BucketConfig{Name: testBucket})
+	f := &UpdateAPFactory{IAMEndpoint: srv.IAMEndpoint(), ResourceConfigEndpoint: srv.ConfigEndpoint()}
+	return srv, f.NewAccessPolicy().(*UpdateAPObj)
+}
+
+func Test_Integration_UpdateAccessPolicy_Positive(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+
+	err := ap.UpdateAccessPolicy("10.0.0.1, 10.1.0.0/16", resConfApiKey, testBucket, ap)
+	assert.NoError(t, err)
+
+	b, _ := srv.Bucket(testBucket)
+	if assert.NotNil(t, b.Firewall) {
+		assert.Equal(t, []string{"10.0.0.1", "10.1.0.0/16"}, b.Firewall.AllowedIP)
+	}
+	assert.Equal(t, 1, srv.Count(fakeRC.OpGetToken))
+}
+
+func Test_Integration_UpdateAccessPolicy_InvalidIP(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+
+	err := ap.UpdateAccessPolicy(allowedIps, resConfApiKey, testBucket, ap)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not a valid IP address")
+	}
+	b, _ := srv.Bucket(testBucket)
+	assert.Nil(t, b.Firewall)
+}
+
+func Test_Integration_UpdateAccessPolicy_InvalidAPIKey(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+
+	err := ap.UpdateAccessPolicy("10.0.0.1", "wrong-key", testBucket, ap)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "API key could not be found")
+	}
+	assert.Equal(t, 0, srv.Count(fakeRC.OpUpdateBucketConfig))
+}
+
+func Test_Integration_UpdateAccessPolicy_NoSuchBucket(t *testing.T) {
+	_, ap := getIntegrationAccessPolicy(t)
+
+	err := ap.UpdateAccessPolicy("10.0.0.1", resConfApiKey, "missing-bucket", ap)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "does not exist")
+	}
+}
+
+func Test_Integration_UpdateQuotaLimit_Positive(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+
+	err := ap.UpdateQuotaLimit(quota, resConfApiKey, testBucket, osEndpoint, iamEndpoint, ap)
+	assert.NoError(t, err)
+
+	b, _ := srv.Bucket(testBucket)
+	assert.Equal(t, quota, b.HardQuota)
+}
+
+func Test_Integration_UpdateQuotaLimit_BelowUsage(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+	srv.SetUsage(testBucket, 10, quota+1)
+
+	err := ap.UpdateQuotaLimit(quota, resConfApiKey, testBucket, osEndpoint, iamEndpoint, ap)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "hard_quota")
+	}
+}
+
+func Test_Integration_UpdateQuotaLimit_InjectedFault(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+	srv.InjectFault(fakeRC.OpUpdateBucketConfig, fakeRC.Fault{Status: http.StatusServiceUnavailable, Code: "unavailable", Message: "service unavailable"}, 1)
+
+	err := ap.UpdateQuotaLimit(quota, resConfApiKey, testBucket, osEndpoint, iamEndpoint, ap)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "service unavailable")
+	}
+	b, _ := srv.Bucket(testBucket)
+	assert.Zero(t, b.HardQuota)
+}
+
+func Test_Integration_UpdateQuotaLimit_RetryInjectedFault(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+	ap.retry = noWaitRetryPolicy(3)
+	srv.InjectFault(fakeRC.OpUpdateBucketConfig, fakeRC.Fault{Status: http.StatusServiceUnavailable, Code: "unavailable", Message: "service unavailable"}, 1)
+
+	err := ap.UpdateQuotaLimit(quota, resConfApiKey, testBucket, osEndpoint, iamEndpoint, ap)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, srv.Count(fakeRC.OpUpdateBucketConfig))
+	b, _ := srv.Bucket(testBucket)
+	assert.Equal(t, quota, b.HardQuota)
+}
+
+func Test_Integration_UpdateAccessPolicy_RetryIAMOutage(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+	ap.retry = noWaitRetryPolicy(3)
+	srv.InjectFault(fakeRC.OpGetToken, fakeRC.Fault{Status: http.StatusServiceUnavailable, Code: "BXNIM0500E", Message: "IAM unavailable"}, 1)
+
+	err := ap.UpdateAccessPolicy("10.0.0.1", resConfApiKey, testBucket, ap)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, srv.Count(fakeRC.OpGetToken))
+	assert.Equal(t, 1, srv.Count(fakeRC.OpUpdateBucketConfig))
+}
+
+func Test_Integration_UpdateAccessPolicy_NoRetryInvalidAPIKey(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+	ap.retry = noWaitRetryPolicy(3)
+
+	err := ap.UpdateAccessPolicy("10.0.0.1", "wrong-key", testBucket, ap)
+	assert.ErrorIs(t, err, ErrBadCredentials)
+	assert.Equal(t, 1, srv.Count(fakeRC.OpGetToken))
+}
+
+func Test_Integration_UpdateQuotaLimit_RetryExhausted(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+	ap.retry = noWaitRetryPolicy(3)
+	srv.InjectFault(fakeRC.OpUpdateBucketConfig, fakeRC.Fault{Status: http.StatusTooManyRequests, Code: "too_many_requests", Message: "slow down"}, -1)
+
+	err := ap.UpdateQuotaLimit(quota, resConfApiKey, testBucket, osEndpoint, iamEndpoint, ap)
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, 3, srv.Count(fakeRC.OpUpdateBucketConfig))
+}
+
+func Test_Integration_GetBucketUsage(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+	srv.SetUsage(testBucket, 12, 3456)
+	assert.NoError(t, ap.UpdateQuotaLimit(quota, resConfApiKey, testBucket, osEndpoint, iamEndpoint, ap))
+
+	usage, err := ap.GetBucketUsage(context.Background(), resConfApiKey, testBucket, osEndpoint, iamEndpoint, ap)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Usage{BytesUsed: 3456, ObjectCount: 12, HardQuota: quota}, usage)
+	}
+	assert.Equal(t, 1, srv.Count(fakeRC.OpGetBucketConfig))
+}
+
+func Test_Integration_GetBucketUsage_Canceled(t *testing.T) {
+	srv, ap := getIntegrationAccessPolicy(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ap.GetBucketUsage(ctx, resConfApiKey, testBucket, osEndpoint, iamEndpoint, ap)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, srv.Count(fakeRC.OpGetBucketConfig))
+}
+
+func Test_Integration_GetBucketUsage_NoSuchBucket(t *testing.T) {
+	_, ap := getIntegrationAccessPolicy(t)
+
+	_, err := ap.GetBucketUsage(context.Background(), resConfApiKey, "missing-bucket", osEndpoint, iamEndpoint, ap)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "does not exist")
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/IBM/go-sdk-core/v5/core"
 	rc "github.com/IBM/ibm-cos-sdk-go-config/v2/resourceconfigurationv1"
+	"github.com/IBM/ibmcloud-object-storage-plugin/utils/endpoints"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -109,3 +110,29 @@ func Test_UpdateQuotaLimit_Error(t *testing.T) {
 		assert.Contains(t, err.Error(), errTestMsg)
 	}
 }
+
+// recordingResourceConfigurationV1 records the URL of the service it is called with
+type recordingResourceConfigurationV1 struct {
+	serviceURL string
+}
+
+func (rc *recordingResourceConfigurationV1) UpdateBucketConfig(service *rc.ResourceConfigurationV1, options *rc.UpdateBucketConfigOptions) (*core.DetailedResponse, error) {
+	rc.serviceURL = service.GetServiceURL()
+	return &core.DetailedResponse{StatusCode: statusCode}, nil
+}
+
+func Test_UpdateQuotaLimit_ConfigEndpointOfNetwork(t *testing.T) {
+	for osEndpoint, configEndpoint := range map[string]string{
+		"https://s3.us-south.cloud-object-storage.appdomain.cloud":         endpoints.ResourceConfigDirect,
+		"https://s3.private.us-south.cloud-object-storage.appdomain.cloud": endpoints.ResourceConfigPrivate,
+		"https://s3.direct.us-south.cloud-object-storage.appdomain.cloud":  endpoints.ResourceConfigDirect,
+		"https://s3.private.example.com":                                   endpoints.ResourceConfigPrivate,
+		"https://s3.example.com":                                           endpoints.ResourceConfigDirect,
+	} {
+		rcc := &recordingResourceConfigurationV1{}
+		rcSess := getFakeAccessPolicySession(rcc)
+		err := rcSess.UpdateQuotaLimit(quota, resConfApiKey, testBucket, osEndpoint, iamEndpoint, rcc)
+		assert.NoError(t, err)
+		assert.Equal(t, configEndpoint, rcc.serviceURL, osEndpoint)
+	}
+}
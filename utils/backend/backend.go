@@ -11,13 +11,21 @@
 package backend
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/IBM/ibm-cos-sdk-go/aws"
 	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
 	"github.com/IBM/ibm-cos-sdk-go/aws/credentials"
 	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
 	"github.com/IBM/ibm-cos-sdk-go/aws/session"
 	"github.com/IBM/ibm-cos-sdk-go/service/s3"
 	"go.uber.org/zap"
@@ -53,7 +61,7 @@ type ObjectStorageSession interface {
 	// CheckObjectPathExistence method checks that object-path exists inside bucket
 	CheckObjectPathExistence(bucket, objectpath string) (bool, error)
 
-	// CreateBucket methods creates a new bucket
+	// CreateBucket methods creates a new bucket, it fails with ErrBucketExists if the bucket already exists
 	CreateBucket(bucket, locationConstraint string, kpRootKeyCrn string) (string, error)
 
 	// DeleteBucket methods deletes a bucket (with all of its objects)
@@ -61,25 +69,225 @@ type ObjectStorageSession interface {
 
 	// SetBucketVersioning sets the versioning state of a bucket
 	SetBucketVersioning(bucket string, enabled bool) error
+
+	// CheckBucketAccessWithContext is CheckBucketAccess bounded by ctx
+	CheckBucketAccessWithContext(ctx context.Context, bucket string) error
+
+	// CheckObjectPathExistenceWithContext is CheckObjectPathExistence bounded by ctx
+	CheckObjectPathExistenceWithContext(ctx context.Context, bucket, objectpath string) (bool, error)
+
+	// CreateBucketWithContext is CreateBucket bounded by ctx
+	CreateBucketWithContext(ctx context.Context, bucket, locationConstraint string, kpRootKeyCrn string) (string, error)
+
+	// DeleteBucketWithContext is DeleteBucket bounded by ctx
+	DeleteBucketWithContext(ctx context.Context, bucket string) error
+
+	// SetBucketVersioningWithContext is SetBucketVersioning bounded by ctx
+	SetBucketVersioningWithContext(ctx context.Context, bucket string, enabled bool) error
+
+	// GetBucketEncryptionWithContext returns the key management encryption reported by a bucket
+	GetBucketEncryptionWithContext(ctx context.Context, bucket string) (*BucketEncryption, error)
+
+	// SetBucketOwnerWithContext stamps a bucket with the ownership marker of owner
+	SetBucketOwnerWithContext(ctx context.Context, bucket string, owner *BucketOwner) error
+
+	// GetBucketOwnerWithContext returns the ownership marker of a bucket, nil if it has none
+	GetBucketOwnerWithContext(ctx context.Context, bucket string) (*BucketOwner, error)
+
+	// CopyObjectsWithContext copies, server side, the objects of bucket whose key starts
+	// with prefix to destBucket, prefixing their key with destPrefix. The versions of
+	// the objects are copied oldest first. It returns the number of copied versions.
+	CopyObjectsWithContext(ctx context.Context, bucket, prefix, destBucket, destPrefix string) (int, error)
+
+	// GetBucketVersioningWithContext reports whether versioning is enabled on a bucket
+	GetBucketVersioningWithContext(ctx context.Context, bucket string) (bool, error)
+
+	// CopyObjectsAsOfWithContext copies, server side, the versions of the objects of
+	// bucket whose key starts with prefix that were current at asOf, or when the
+	// version versionID was written if set, to destBucket, replacing prefix with
+	// destPrefix in their key. Objects larger than 5 GB are copied part by part.
+	// The keys up to startAfter, copied by an earlier call, are skipped, and
+	// copied, if not nil, is called with the key of each copied object, keys
+	// being copied in increasing order. It returns the number of copied objects.
+	CopyObjectsAsOfWithContext(ctx context.Context, bucket, prefix, destBucket, destPrefix string, asOf time.Time, versionID, startAfter string, copied func(key string) error) (int, error)
+
+	// CreateObjectPathWithContext creates the directory marker of objectpath inside bucket
+	CreateObjectPathWithContext(ctx context.Context, bucket, objectpath string) error
+
+	// DeleteObjectPathWithContext deletes objectpath inside bucket, with all of its objects
+	DeleteObjectPathWithContext(ctx context.Context, bucket, objectpath string) error
+
+	// SetObjectPathOwnerWithContext creates the directory marker of objectpath inside bucket,
+	// stamped with the ownership marker of owner
+	SetObjectPathOwnerWithContext(ctx context.Context, bucket, objectpath string, owner *BucketOwner) error
+
+	// GetObjectPathOwnerWithContext returns the ownership marker of objectpath inside bucket, nil if it has none
+	GetObjectPathOwnerWithContext(ctx context.Context, bucket, objectpath string) (*BucketOwner, error)
+
+	// GetObjectPathUsageWithContext returns the storage used by the objects of objectpath
+	// inside bucket, the whole bucket if empty, listing at most maxObjects objects
+	GetObjectPathUsageWithContext(ctx context.Context, bucket, objectpath string, maxObjects int) (*Usage, error)
+
+	// CreateObjectWithContext writes data to the object key of bucket unless an object
+	// already has that key. It reports whether the object was created.
+	CreateObjectWithContext(ctx context.Context, bucket, key string, data []byte) (bool, error)
+
+	// WriteObjectWithContext writes data to the object key of bucket
+	WriteObjectWithContext(ctx context.Context, bucket, key string, data []byte) error
+
+	// ReadObjectWithContext returns the content of the object key of bucket, nil if there is none
+	ReadObjectWithContext(ctx context.Context, bucket, key string) ([]byte, error)
+
+	// DeleteObjectWithContext deletes the object key of bucket
+	DeleteObjectWithContext(ctx context.Context, bucket, key string) error
+}
+
+// The tags of the ownership marker of the buckets and object paths created by
+// the provisioner. Object paths carry them on their directory marker object.
+const (
+	OwnerTagClusterID = "ibmc-s3fs-cluster-id"
+	OwnerTagPVName    = "ibmc-s3fs-pv-name"
+	OwnerTagClaimUID  = "ibmc-s3fs-claim-uid"
+)
+
+// ErrCodeNoSuchTagSet is the error code of GetBucketTagging on a bucket without tags
+const ErrCodeNoSuchTagSet = "NoSuchTagSet"
+
+// errCodePreconditionFailed is the error code of a conditional write of an
+// object that already exists
+const errCodePreconditionFailed = "PreconditionFailed"
+
+// deleteBatchSize is the most keys a DeleteObjects request accepts
+const deleteBatchSize = 1000
+
+var ownerTags = map[string]struct{}{OwnerTagClusterID: {}, OwnerTagPVName: {}, OwnerTagClaimUID: {}}
+
+// SnapshotPrefix is the key prefix of the point-in-time copies of the objects
+// of a versioned bucket, which are never part of another copy
+const SnapshotPrefix = ".ibmc-s3fs-as-of/"
+
+// BucketOwner identifies the volume a bucket was created for. The PV does not
+// exist yet when its bucket is created, so it is identified by its name and
+// the UID of its claim.
+type BucketOwner struct {
+	ClusterID string `json:"clusterID"`
+	PVName    string `json:"pvName"`
+	ClaimUID  string `json:"claimUID,omitempty"`
+}
+
+// tags returns the bucket tags of the ownership marker of o
+func (o *BucketOwner) tags() map[string]string {
+	return map[string]string{
+		OwnerTagClusterID: o.ClusterID,
+		OwnerTagPVName:    o.PVName,
+		OwnerTagClaimUID:  o.ClaimUID,
+	}
+}
+
+// BucketEncryption is the key management encryption of a bucket
+type BucketEncryption struct {
+	// KPEnabled is set when the bucket is encrypted with a Key Protect or
+	// Hyper Protect Crypto Services root key
+	KPEnabled bool
+	// RootKeyCRN is the CRN of the root key of the bucket
+	RootKeyCRN string
+}
+
+// Usage is the storage used by a bucket or by an object path
+type Usage struct {
+	BytesUsed   int64
+	ObjectCount int64
+	// HardQuota is the quota of the bucket, 0 if it has none or is unknown
+	HardQuota int64
+	// Truncated is set when the listing stopped at its bound, the usage is
+	// then a lower bound
+	Truncated bool
+}
+
+// OperationTimeouts bounds each session operation, in addition to any
+// deadline of the caller's context. A zero value means no extra bound.
+type OperationTimeouts struct {
+	CheckBucketAccess        time.Duration
+	CheckObjectPathExistence time.Duration
+	CreateBucket             time.Duration
+	// DeleteBucket bounds the whole deletion, including emptying the bucket
+	DeleteBucket time.Duration
+	// SetBucketVersioning bounds reading and setting the versioning state
+	SetBucketVersioning time.Duration
+	// BucketOwner bounds reading and writing the ownership marker
+	BucketOwner time.Duration
+	// CopyObjects bounds the whole copy of the objects of a bucket
+	CopyObjects time.Duration
+	// CreateObjectPath bounds the creation of a directory marker
+	CreateObjectPath time.Duration
+	// ObjectPathUsage bounds the whole listing measuring an object path
+	ObjectPathUsage time.Duration
+	// CreateObject bounds a create-only write of an object, and the other
+	// reads, writes and deletions of a single object
+	CreateObject time.Duration
+}
+
+// DefaultOperationTimeouts are the timeouts used by the provisioner and driver binaries
+var DefaultOperationTimeouts = OperationTimeouts{
+	CheckBucketAccess:        30 * time.Second,
+	CheckObjectPathExistence: 30 * time.Second,
+	CreateBucket:             30 * time.Second,
+	DeleteBucket:             10 * time.Minute,
+	SetBucketVersioning:      30 * time.Second,
+	BucketOwner:              30 * time.Second,
+	CopyObjects:              30 * time.Minute,
+	CreateObjectPath:         30 * time.Second,
+	ObjectPathUsage:          5 * time.Minute,
+	CreateObject:             30 * time.Second,
 }
 
 // COSSessionFactory represents a COS (S3) session factory
-type COSSessionFactory struct{}
+type COSSessionFactory struct {
+	// MaxRetries overrides the number of retries done by the SDK, SDK default if nil
+	MaxRetries *int
+	// Timeouts bounds the operations of the sessions created by the factory
+	Timeouts OperationTimeouts
+	// Retry retries the COS calls of the sessions, a single attempt if nil.
+	// The SDK retries are disabled when set, unless MaxRetries is set too.
+	Retry *RetryPolicy
+}
 
 type s3API interface {
-	HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error)
-	CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error)
-	ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error)
-	//ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
-	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
-	DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error)
-	PutBucketVersioning(input *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error)
+	HeadBucketWithContext(ctx aws.Context, input *s3.HeadBucketInput, opts ...request.Option) (*s3.HeadBucketOutput, error)
+	CreateBucketWithContext(ctx aws.Context, input *s3.CreateBucketInput, opts ...request.Option) (*s3.CreateBucketOutput, error)
+	ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (*s3.ListObjectsOutput, error)
+	ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error)
+	ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error)
+	DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error)
+	DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error)
+	DeleteBucketWithContext(ctx aws.Context, input *s3.DeleteBucketInput, opts ...request.Option) (*s3.DeleteBucketOutput, error)
+	PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (*s3.PutBucketVersioningOutput, error)
+	PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error)
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+	CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error)
+	CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error)
+	CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error)
+	GetBucketVersioningWithContext(ctx aws.Context, input *s3.GetBucketVersioningInput, opts ...request.Option) (*s3.GetBucketVersioningOutput, error)
+	PutBucketTaggingWithContext(ctx aws.Context, input *PutBucketTaggingInput, opts ...request.Option) (*PutBucketTaggingOutput, error)
+	GetBucketTaggingWithContext(ctx aws.Context, input *GetBucketTaggingInput, opts ...request.Option) (*GetBucketTaggingOutput, error)
+	GetObjectTaggingWithContext(ctx aws.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (*s3.GetObjectTaggingOutput, error)
 }
 
 // COSSession represents a COS (S3) session
 type COSSession struct {
-	svc    s3API
-	logger *zap.Logger
+	svc      s3API
+	logger   *zap.Logger
+	timeouts OperationTimeouts
+}
+
+// withTimeout bounds ctx by timeout, if set
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
 const (
@@ -94,50 +302,89 @@ func (s *COSSessionFactory) NewObjectStorageSession(endpoint, region string, cre
 	} else {
 		sdkCreds = credentials.NewStaticCredentials(creds.AccessKey, creds.SecretKey, "")
 	}
+	maxRetries := s.MaxRetries
+	if maxRetries == nil && s.Retry != nil {
+		maxRetries = aws.Int(0)
+	}
 	sess, _ := session.NewSession(&aws.Config{
 		S3ForcePathStyle: aws.Bool(true),
 		Endpoint:         aws.String(endpoint),
 		Credentials:      sdkCreds,
 		Region:           aws.String(region),
+		MaxRetries:       maxRetries,
 	})
 
+	var svc s3API = &cosS3API{S3: s3.New(sess)}
+	if s.Retry != nil {
+		svc = &retryingS3API{s3API: svc, policy: s.Retry, logger: logger}
+	}
 	return &COSSession{
-		svc:    s3.New(sess),
-		logger: logger,
+		svc:      svc,
+		logger:   logger,
+		timeouts: s.Timeouts,
 	}
 }
 
 // CheckBucketAccess method check that a bucket can be accessed
 func (s *COSSession) CheckBucketAccess(bucket string) error {
-	_, err := s.svc.HeadBucket(&s3.HeadBucketInput{
+	return s.CheckBucketAccessWithContext(context.Background(), bucket)
+}
+
+// CheckBucketAccessWithContext method check that a bucket can be accessed
+func (s *COSSession) CheckBucketAccessWithContext(ctx context.Context, bucket string) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CheckBucketAccess)
+	defer cancel()
+
+	_, err := s.svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
 		Bucket: aws.String(bucket),
 	})
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "RequestError" && strings.Contains(err.Error(), "Credential=") {
-			s.logger.Warn(fmt.Sprintf("Check your secret access key for bucket %s", bucket))
-			return fmt.Errorf("AccessKey/SecretKey is wrong")
-		}
+	err = ClassifyError(err)
+	if errors.Is(err, ErrBadCredentials) {
+		s.logger.Warn(fmt.Sprintf("Check your secret access key for bucket %s", bucket))
 	}
-
 	return err
 }
 
+// GetBucketEncryptionWithContext returns the key management encryption reported by a bucket
+func (s *COSSession) GetBucketEncryptionWithContext(ctx context.Context, bucket string) (*BucketEncryption, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CheckBucketAccess)
+	defer cancel()
+
+	resp, err := s.svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	return &BucketEncryption{
+		KPEnabled:  aws.BoolValue(resp.IBMSSEKPEnabled),
+		RootKeyCRN: aws.StringValue(resp.IBMSSEKPCrkId),
+	}, nil
+}
+
 // CheckObjectPathExistence method checks that object-path exists inside bucket
 func (s *COSSession) CheckObjectPathExistence(bucket, objectpath string) (bool, error) {
+	return s.CheckObjectPathExistenceWithContext(context.Background(), bucket, objectpath)
+}
+
+// CheckObjectPathExistenceWithContext method checks that object-path exists inside bucket
+func (s *COSSession) CheckObjectPathExistenceWithContext(ctx context.Context, bucket, objectpath string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CheckObjectPathExistence)
+	defer cancel()
 
 	objectpath = strings.TrimPrefix(objectpath, "/")
 	if !strings.HasSuffix(objectpath, "/") {
 		objectpath = objectpath + "/"
 	}
 
-	resp, err := s.svc.ListObjects(&s3.ListObjectsInput{
+	resp, err := s.svc.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
 		Bucket:  aws.String(bucket),
 		MaxKeys: aws.Int64(1),
 		Prefix:  aws.String(objectpath),
 	})
 
 	if err != nil {
-		return false, fmt.Errorf("cannot list bucket '%s': %v", bucket, err)
+		return false, fmt.Errorf("cannot list bucket '%s': %w", bucket, ClassifyError(err))
 	}
 
 	if len(resp.Contents) == 1 {
@@ -151,9 +398,19 @@ func (s *COSSession) CheckObjectPathExistence(bucket, objectpath string) (bool,
 
 // CreateBucket methods creates a new bucket
 func (s *COSSession) CreateBucket(bucket, locationConstraint string, kpRootKeyCrn string) (string, error) {
+	return s.CreateBucketWithContext(context.Background(), bucket, locationConstraint, kpRootKeyCrn)
+}
+
+// CreateBucketWithContext methods creates a new bucket. A bucket that
+// already exists is reported as ErrBucketExists, which also matches
+// ErrBucketNotOwned when it belongs to another service instance.
+func (s *COSSession) CreateBucketWithContext(ctx context.Context, bucket, locationConstraint string, kpRootKeyCrn string) (string, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CreateBucket)
+	defer cancel()
+
 	var err error
 	if kpRootKeyCrn != "" {
-		_, err = s.svc.CreateBucket(&s3.CreateBucketInput{
+		_, err = s.svc.CreateBucketWithContext(ctx, &s3.CreateBucketInput{
 			Bucket: aws.String(bucket),
 			CreateBucketConfiguration: &s3.CreateBucketConfiguration{
 				LocationConstraint: aws.String(locationConstraint),
@@ -162,7 +419,7 @@ func (s *COSSession) CreateBucket(bucket, locationConstraint string, kpRootKeyCr
 			IBMSSEKPEncryptionAlgorithm: aws.String(KPEncryptionAlgorithm),
 		})
 	} else {
-		_, err = s.svc.CreateBucket(&s3.CreateBucketInput{
+		_, err = s.svc.CreateBucketWithContext(ctx, &s3.CreateBucketInput{
 			Bucket: aws.String(bucket),
 			CreateBucketConfiguration: &s3.CreateBucketConfiguration{
 				LocationConstraint: aws.String(locationConstraint),
@@ -170,13 +427,13 @@ func (s *COSSession) CreateBucket(bucket, locationConstraint string, kpRootKeyCr
 		})
 	}
 
+	err = ClassifyError(err)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "BucketAlreadyOwnedByYou" {
+		if errors.Is(err, ErrBucketExists) && !errors.Is(err, ErrBucketNotOwned) {
 			s.logger.Warn(fmt.Sprintf("bucket '%s' already exists", bucket))
-			return fmt.Sprintf("bucket '%s' already exists", bucket), nil
-		} else if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "RequestError" && strings.Contains(err.Error(), "Credential=") {
+		}
+		if errors.Is(err, ErrBadCredentials) {
 			s.logger.Warn(fmt.Sprintf("Check your secret access key for bucket %s", bucket))
-			return fmt.Sprintf("Check your secret access key for bucket %s", bucket), fmt.Errorf("AccessKey/SecretKey is wrong")
 		}
 		return "", err
 	}
@@ -185,37 +442,143 @@ func (s *COSSession) CreateBucket(bucket, locationConstraint string, kpRootKeyCr
 
 // DeleteBucket methods deletes a bucket (with all of its objects)
 func (s *COSSession) DeleteBucket(bucket string) error {
-	resp, err := s.svc.ListObjects(&s3.ListObjectsInput{
-		Bucket: aws.String(bucket),
-	})
+	return s.DeleteBucketWithContext(context.Background(), bucket)
+}
 
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchBucket" {
-			s.logger.Warn(fmt.Sprintf("bucket %s is already deleted", bucket))
-			return nil
+// DeleteBucketWithContext methods deletes a bucket (with all of its objects)
+// Every page of the listing is deleted, then the versions and delete markers
+// left behind by versioning, before the bucket itself.
+func (s *COSSession) DeleteBucketWithContext(ctx context.Context, bucket string) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.DeleteBucket)
+	defer cancel()
+
+	err := s.deleteObjects(ctx, bucket, "", "")
+	if err == nil {
+		err = s.deleteObjectVersions(ctx, bucket, "", func(string) bool { return true })
+	}
+	if err == nil {
+		_, err = s.svc.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
+			Bucket: aws.String(bucket),
+		})
+		err = ClassifyError(err)
+	}
+	if errors.Is(err, ErrBucketNotFound) {
+		s.logger.Warn(fmt.Sprintf("bucket %s is already deleted", bucket))
+		return nil
+	}
+	return err
+}
+
+// deleteObjects deletes the objects of bucket whose key starts with prefix,
+// except the object skip, one page of the listing at a time
+func (s *COSSession) deleteObjects(ctx context.Context, bucket, prefix, skip string) error {
+	var token *string
+	for {
+		resp, err := s.svc.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot list bucket '%s': %w", bucket, ClassifyError(err))
+		}
+
+		var objects []*s3.ObjectIdentifier
+		for _, key := range resp.Contents {
+			if aws.StringValue(key.Key) == skip {
+				continue
+			}
+			objects = append(objects, &s3.ObjectIdentifier{Key: key.Key})
+		}
+		if err := s.deleteObjectBatches(ctx, bucket, objects); err != nil {
+			return err
 		}
 
-		return fmt.Errorf("cannot list bucket '%s': %v", bucket, err)
+		if !aws.BoolValue(resp.IsTruncated) || resp.NextContinuationToken == nil {
+			return nil
+		}
+		token = resp.NextContinuationToken
 	}
+}
 
-	for _, key := range resp.Contents {
-		_, err = s.svc.DeleteObject(&s3.DeleteObjectInput{
+// deleteObjectVersions removes the noncurrent versions and delete markers
+// left behind in a bucket that has (or had) versioning enabled, for the keys
+// starting with prefix that match. Every listed version is deleted, so each
+// page is listed again from the start.
+func (s *COSSession) deleteObjectVersions(ctx context.Context, bucket, prefix string, match func(key string) bool) error {
+	for {
+		resp, err := s.svc.ListObjectVersionsWithContext(ctx, &s3.ListObjectVersionsInput{
 			Bucket: aws.String(bucket),
-			Key:    key.Key,
+			Prefix: aws.String(prefix),
 		})
-
 		if err != nil {
-			return fmt.Errorf("cannot delete object %s/%s: %v", bucket, *key.Key, err)
+			return fmt.Errorf("cannot list object versions of bucket '%s': %w", bucket, ClassifyError(err))
+		}
+
+		var versions []*s3.ObjectIdentifier
+		for _, v := range resp.Versions {
+			if match(aws.StringValue(v.Key)) {
+				versions = append(versions, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+			}
+		}
+		for _, m := range resp.DeleteMarkers {
+			if match(aws.StringValue(m.Key)) {
+				versions = append(versions, &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+			}
+		}
+		if len(versions) == 0 {
+			return nil
+		}
+		if err := s.deleteObjectBatches(ctx, bucket, versions); err != nil {
+			return err
+		}
+
+		if !aws.BoolValue(resp.IsTruncated) {
+			return nil
 		}
 	}
+}
 
-	_, err = s.svc.DeleteBucket(&s3.DeleteBucketInput{
-		Bucket: aws.String(bucket),
-	})
-	return err
+// deleteObjectBatches deletes objects, or object versions when they carry a
+// version id, with DeleteObjects requests of at most deleteBatchSize keys
+func (s *COSSession) deleteObjectBatches(ctx context.Context, bucket string, objects []*s3.ObjectIdentifier) error {
+	for len(objects) > 0 {
+		n := len(objects)
+		if n > deleteBatchSize {
+			n = deleteBatchSize
+		}
+		batch := objects[:n]
+		objects = objects[n:]
+
+		resp, err := s.svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: batch, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("cannot delete objects of bucket '%s': %w", bucket, ClassifyError(err))
+		}
+		// a DeleteObjects request succeeds even when some of its keys failed
+		for _, e := range resp.Errors {
+			err = ClassifyError(awserr.New(aws.StringValue(e.Code), aws.StringValue(e.Message), nil))
+			if e.VersionId != nil {
+				return fmt.Errorf("cannot delete object %s/%s version %s: %w", bucket, aws.StringValue(e.Key), aws.StringValue(e.VersionId), err)
+			}
+			return fmt.Errorf("cannot delete object %s/%s: %w", bucket, aws.StringValue(e.Key), err)
+		}
+	}
+	return nil
 }
 
+// SetBucketVersioning sets the versioning state of a bucket
 func (s *COSSession) SetBucketVersioning(bucket string, enabled bool) error {
+	return s.SetBucketVersioningWithContext(context.Background(), bucket, enabled)
+}
+
+// SetBucketVersioningWithContext sets the versioning state of a bucket
+func (s *COSSession) SetBucketVersioningWithContext(ctx context.Context, bucket string, enabled bool) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.SetBucketVersioning)
+	defer cancel()
+
 	var status string
 
 	// Set the versioning status based on whether it's enabled or suspended.
@@ -231,7 +594,7 @@ func (s *COSSession) SetBucketVersioning(bucket string, enabled bool) error {
 		zap.String("versioningStatus", status))
 
 	// Make the SDK call to set the versioning status of the bucket.
-	out, err := s.svc.PutBucketVersioning(&s3.PutBucketVersioningInput{
+	out, err := s.svc.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
 		Bucket: aws.String(bucket),
 		VersioningConfiguration: &s3.VersioningConfiguration{
 			Status: aws.String(status),
@@ -246,7 +609,7 @@ func (s *COSSession) SetBucketVersioning(bucket string, enabled bool) error {
 				zap.String("versioningStatus", status),
 				zap.Error(aerr))
 		}
-		return fmt.Errorf("failed to set versioning status %s on bucket %s : %w", status, bucket, err)
+		return fmt.Errorf("failed to set versioning status %s on bucket %s : %w", status, bucket, ClassifyError(err))
 	}
 
 	// Log the output for debugging or confirmation
@@ -259,3 +622,612 @@ func (s *COSSession) SetBucketVersioning(bucket string, enabled bool) error {
 
 	return nil
 }
+
+// GetBucketVersioningWithContext reports whether versioning is enabled on a bucket
+func (s *COSSession) GetBucketVersioningWithContext(ctx context.Context, bucket string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.SetBucketVersioning)
+	defer cancel()
+
+	out, err := s.svc.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return false, fmt.Errorf("cannot read versioning status of bucket %s : %w", bucket, ClassifyError(err))
+	}
+	return aws.StringValue(out.Status) == s3.BucketVersioningStatusEnabled, nil
+}
+
+// SetBucketOwnerWithContext stamps a bucket with the ownership marker of owner.
+// The marker is kept in the bucket tags, out of reach of the s3fs mounts, the
+// other tags of the bucket are kept.
+func (s *COSSession) SetBucketOwnerWithContext(ctx context.Context, bucket string, owner *BucketOwner) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.BucketOwner)
+	defer cancel()
+
+	tags, err := s.getBucketTags(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("cannot write ownership marker of bucket '%s': %w", bucket, ClassifyError(err))
+	}
+	tagSet := []*s3.Tag{}
+	for _, tag := range tags {
+		if _, ok := ownerTags[aws.StringValue(tag.Key)]; !ok {
+			tagSet = append(tagSet, tag)
+		}
+	}
+	for key, value := range owner.tags() {
+		if value != "" {
+			tagSet = append(tagSet, &s3.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+	}
+	sort.Slice(tagSet, func(i, j int) bool { return aws.StringValue(tagSet[i].Key) < aws.StringValue(tagSet[j].Key) })
+	_, err = s.svc.PutBucketTaggingWithContext(ctx, &PutBucketTaggingInput{
+		Bucket:  aws.String(bucket),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write ownership marker of bucket '%s': %w", bucket, ClassifyError(err))
+	}
+	return nil
+}
+
+// GetBucketOwnerWithContext returns the ownership marker of a bucket, nil if it has none
+func (s *COSSession) GetBucketOwnerWithContext(ctx context.Context, bucket string) (*BucketOwner, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.BucketOwner)
+	defer cancel()
+
+	tags, err := s.getBucketTags(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ownership marker of bucket '%s': %w", bucket, ClassifyError(err))
+	}
+	return ownerFromTags(tags), nil
+}
+
+// ownerFromTags returns the ownership marker held by tags, nil if they hold none
+func ownerFromTags(tags []*s3.Tag) *BucketOwner {
+	owner := &BucketOwner{}
+	for _, tag := range tags {
+		switch aws.StringValue(tag.Key) {
+		case OwnerTagClusterID:
+			owner.ClusterID = aws.StringValue(tag.Value)
+		case OwnerTagPVName:
+			owner.PVName = aws.StringValue(tag.Value)
+		case OwnerTagClaimUID:
+			owner.ClaimUID = aws.StringValue(tag.Value)
+		}
+	}
+	if owner.PVName == "" {
+		return nil
+	}
+	return owner
+}
+
+// getBucketTags returns the tags of a bucket, empty if it has none
+func (s *COSSession) getBucketTags(ctx context.Context, bucket string) ([]*s3.Tag, error) {
+	out, err := s.svc.GetBucketTaggingWithContext(ctx, &GetBucketTaggingInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == ErrCodeNoSuchTagSet {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return out.TagSet, nil
+}
+
+// objectPathPrefix returns the key prefix of the objects under objectpath,
+// empty for the root of the bucket
+func objectPathPrefix(objectpath string) string {
+	prefix := strings.Trim(objectpath, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// SetObjectPathOwnerWithContext creates the directory marker of objectpath inside
+// bucket, stamped with the ownership marker of owner in its object tags. The
+// path is created and stamped at once, so that a path without marker is never
+// left behind.
+func (s *COSSession) SetObjectPathOwnerWithContext(ctx context.Context, bucket, objectpath string, owner *BucketOwner) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.BucketOwner)
+	defer cancel()
+
+	prefix := objectPathPrefix(objectpath)
+	if prefix == "" {
+		return fmt.Errorf("invalid object path '%s'", objectpath)
+	}
+	tags := url.Values{}
+	for key, value := range owner.tags() {
+		if value != "" {
+			tags.Set(key, value)
+		}
+	}
+	_, err := s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(prefix),
+		Body:    bytes.NewReader(nil),
+		Tagging: aws.String(tags.Encode()),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write ownership marker of bucket '%s' path '%s': %w", bucket, objectpath, ClassifyError(err))
+	}
+	return nil
+}
+
+// CreateObjectWithContext writes data to the object key of bucket unless an
+// object already has that key, which COS checks with If-None-Match so that
+// concurrent writers never overwrite each other. It reports whether the
+// object was created.
+func (s *COSSession) CreateObjectWithContext(ctx context.Context, bucket, key string, data []byte) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CreateObject)
+	defer cancel()
+
+	_, err := s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	}, request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"}))
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == errCodePreconditionFailed {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot create object '%s' in bucket '%s': %w", key, bucket, ClassifyError(err))
+	}
+	return true, nil
+}
+
+// WriteObjectWithContext writes data to the object key of bucket, replacing
+// the object of that key if any
+func (s *COSSession) WriteObjectWithContext(ctx context.Context, bucket, key string, data []byte) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CreateObject)
+	defer cancel()
+
+	_, err := s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write object '%s' in bucket '%s': %w", key, bucket, ClassifyError(err))
+	}
+	return nil
+}
+
+// ReadObjectWithContext returns the content of the object key of bucket, nil
+// if there is no such object
+func (s *COSSession) ReadObjectWithContext(ctx context.Context, bucket, key string) ([]byte, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CreateObject)
+	defer cancel()
+
+	out, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read object '%s' in bucket '%s': %w", key, bucket, ClassifyError(err))
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read object '%s' in bucket '%s': %w", key, bucket, ClassifyError(err))
+	}
+	return data, nil
+}
+
+// DeleteObjectWithContext deletes the object key of bucket, which is not an
+// error if there is no such object
+func (s *COSSession) DeleteObjectWithContext(ctx context.Context, bucket, key string) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CreateObject)
+	defer cancel()
+
+	_, err := s.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot delete object '%s' in bucket '%s': %w", key, bucket, ClassifyError(err))
+	}
+	return nil
+}
+
+// GetObjectPathOwnerWithContext returns the ownership marker of objectpath inside bucket, nil if it has none
+func (s *COSSession) GetObjectPathOwnerWithContext(ctx context.Context, bucket, objectpath string) (*BucketOwner, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.BucketOwner)
+	defer cancel()
+
+	prefix := objectPathPrefix(objectpath)
+	if prefix == "" {
+		return nil, fmt.Errorf("invalid object path '%s'", objectpath)
+	}
+	out, err := s.svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(prefix),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read ownership marker of bucket '%s' path '%s': %w", bucket, objectpath, ClassifyError(err))
+	}
+	return ownerFromTags(out.TagSet), nil
+}
+
+// CopyObjectsWithContext copies, server side, the objects of bucket whose key starts
+// with prefix to destBucket, prefixing their key with destPrefix. The versions
+// of each object are copied oldest first and its deletions are replayed, so a
+// versioned destination keeps the noncurrent versions and the others end up
+// with the current objects. The directory marker of prefix, which holds the
+// ownership marker of an object path, is not copied. It returns the number of
+// versions copied.
+func (s *COSSession) CopyObjectsWithContext(ctx context.Context, bucket, prefix, destBucket, destPrefix string) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CopyObjects)
+	defer cancel()
+
+	copied := 0
+	// the versions of the current key, newest first
+	var pending []objectVersion
+	flush := func() error {
+		for i := len(pending) - 1; i >= 0; i-- {
+			v := pending[i]
+			destKey := destPrefix + v.key
+			if v.deleteMarker {
+				_, err := s.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+					Bucket: aws.String(destBucket),
+					Key:    aws.String(destKey),
+				})
+				if err != nil {
+					return fmt.Errorf("cannot delete object %s/%s: %w", destBucket, destKey, ClassifyError(err))
+				}
+				continue
+			}
+			if err := s.copyObject(ctx, bucket, v, destBucket, destKey); err != nil {
+				return err
+			}
+			copied++
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	err := s.listObjectVersions(ctx, bucket, prefix, func(v objectVersion) error {
+		if prefix != "" && v.key == prefix {
+			return nil
+		}
+		if len(pending) > 0 && pending[0].key != v.key {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		pending = append(pending, v)
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	return copied, err
+}
+
+// copyObject copies, server side, the version v of an object of bucket to
+// destKey in destBucket. Objects too large for CopyObject are copied part by
+// part with a multipart upload.
+func (s *COSSession) copyObject(ctx context.Context, bucket string, v objectVersion, destBucket, destKey string) error {
+	source := copySource(bucket, v.key)
+	if v.id != "" && v.id != "null" {
+		source += "?versionId=" + url.QueryEscape(v.id)
+	}
+	if v.size <= maxCopyObjectSize {
+		_, err := s.svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(destBucket),
+			Key:        aws.String(destKey),
+			CopySource: aws.String(source),
+		})
+		if err != nil {
+			return fmt.Errorf("cannot copy object %s/%s to bucket '%s': %w", bucket, v.key, destBucket, ClassifyError(err))
+		}
+		return nil
+	}
+
+	upload, err := s.svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(destBucket),
+		Key:    aws.String(destKey),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot copy object %s/%s to bucket '%s': %w", bucket, v.key, destBucket, ClassifyError(err))
+	}
+	var parts []*s3.CompletedPart
+	for first := int64(0); first < v.size; first += copyPartSize {
+		last := first + copyPartSize - 1
+		if last >= v.size {
+			last = v.size - 1
+		}
+		part := int64(len(parts) + 1)
+		out, err := s.svc.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(destBucket),
+			Key:             aws.String(destKey),
+			UploadId:        upload.UploadId,
+			PartNumber:      aws.Int64(part),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+		})
+		if err == nil && out.CopyPartResult == nil {
+			err = errors.New("no part copied")
+		}
+		if err != nil {
+			s.abortMultipartUpload(destBucket, destKey, upload.UploadId)
+			return fmt.Errorf("cannot copy part %d of object %s/%s to bucket '%s': %w", part, bucket, v.key, destBucket, ClassifyError(err))
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: aws.Int64(part)})
+	}
+	_, err = s.svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(destBucket),
+		Key:             aws.String(destKey),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		s.abortMultipartUpload(destBucket, destKey, upload.UploadId)
+		return fmt.Errorf("cannot copy object %s/%s to bucket '%s': %w", bucket, v.key, destBucket, ClassifyError(err))
+	}
+	return nil
+}
+
+// abortMultipartUpload aborts a failed upload so that its parts are not
+// billed, with its own timeout as the context of the copy may be done
+func (s *COSSession) abortMultipartUpload(bucket, key string, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortUploadTimeout)
+	defer cancel()
+	_, err := s.svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		s.logger.Warn("cannot abort multipart upload", zap.String("bucket", bucket), zap.String("key", key), zap.Error(err))
+	}
+}
+
+var (
+	// maxCopyObjectSize is the largest object copied with a single CopyObject
+	maxCopyObjectSize int64 = 5 << 30
+	// copyPartSize is the part size of the multipart copies of larger objects
+	copyPartSize int64 = 512 << 20
+)
+
+// abortUploadTimeout bounds aborting a failed multipart copy
+const abortUploadTimeout = 30 * time.Second
+
+// errStopListing stops listObjectVersions without error
+var errStopListing = errors.New("stop listing")
+
+// objectVersion is a version or a delete marker of an object
+type objectVersion struct {
+	key, id      string
+	lastModified time.Time
+	deleteMarker bool
+	size         int64
+}
+
+// listObjectVersions calls fn with the versions and delete markers of the
+// objects of bucket whose key starts with prefix, in key order and newest
+// first for each key, until fn returns an error
+func (s *COSSession) listObjectVersions(ctx context.Context, bucket, prefix string, fn func(objectVersion) error) error {
+	return s.listObjectVersionsAfter(ctx, bucket, prefix, "", fn)
+}
+
+// listObjectVersionsAfter is listObjectVersions starting after the key
+// startAfter, from the first key if empty
+func (s *COSSession) listObjectVersionsAfter(ctx context.Context, bucket, prefix, startAfter string, fn func(objectVersion) error) error {
+	var keyMarker, versionMarker *string
+	if startAfter != "" {
+		keyMarker = aws.String(startAfter)
+	}
+	for {
+		resp, err := s.svc.ListObjectVersionsWithContext(ctx, &s3.ListObjectVersionsInput{
+			Bucket:          aws.String(bucket),
+			Prefix:          aws.String(prefix),
+			KeyMarker:       keyMarker,
+			VersionIdMarker: versionMarker,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot list object versions of bucket '%s': %w", bucket, ClassifyError(err))
+		}
+
+		// the versions and the delete markers of a page are listed apart
+		var versions []objectVersion
+		for _, v := range resp.Versions {
+			versions = append(versions, objectVersion{aws.StringValue(v.Key), aws.StringValue(v.VersionId), aws.TimeValue(v.LastModified), false, aws.Int64Value(v.Size)})
+		}
+		for _, m := range resp.DeleteMarkers {
+			versions = append(versions, objectVersion{aws.StringValue(m.Key), aws.StringValue(m.VersionId), aws.TimeValue(m.LastModified), true, 0})
+		}
+		sort.SliceStable(versions, func(i, j int) bool {
+			if versions[i].key != versions[j].key {
+				return versions[i].key < versions[j].key
+			}
+			return versions[i].lastModified.After(versions[j].lastModified)
+		})
+		for _, v := range versions {
+			if err := fn(v); errors.Is(err, errStopListing) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if !aws.BoolValue(resp.IsTruncated) {
+			return nil
+		}
+		keyMarker, versionMarker = resp.NextKeyMarker, resp.NextVersionIdMarker
+	}
+}
+
+// CopyObjectsAsOfWithContext copies, server side, the versions of the objects
+// of bucket whose key starts with prefix that were current at asOf, or when
+// the version versionID was written if set, to destBucket, replacing prefix
+// with destPrefix in their key. Objects deleted at that time, ownership
+// markers and copies under SnapshotPrefix are not copied, the latter being
+// left in versioned buckets by earlier releases. The copy resumes after the
+// key startAfter, calling copied after each object so that the caller can
+// checkpoint it.
+func (s *COSSession) CopyObjectsAsOfWithContext(ctx context.Context, bucket, prefix, destBucket, destPrefix string, asOf time.Time, versionID, startAfter string, copied func(key string) error) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CopyObjects)
+	defer cancel()
+
+	// a version marker stands for the time its version was written, the
+	// versions written in the same second are told apart by its key
+	markerKey := ""
+	if versionID != "" {
+		err := s.listObjectVersions(ctx, bucket, prefix, func(v objectVersion) error {
+			if v.id != versionID {
+				return nil
+			}
+			markerKey, asOf = v.key, v.lastModified
+			return errStopListing
+		})
+		if err != nil {
+			return 0, err
+		}
+		if markerKey == "" {
+			return 0, fmt.Errorf("cannot find version %s in bucket '%s': %w", versionID, bucket, ErrVersionNotFound)
+		}
+	}
+
+	n := 0
+	resolved := ""
+	err := s.listObjectVersionsAfter(ctx, bucket, prefix, startAfter, func(v objectVersion) error {
+		if v.key == resolved || strings.HasPrefix(v.key, SnapshotPrefix) || (prefix != "" && v.key == prefix) {
+			return nil
+		}
+		if v.key == markerKey {
+			if v.id != versionID {
+				return nil
+			}
+		} else if v.lastModified.After(asOf) {
+			return nil
+		}
+		// the newest version written by then is the one to copy, unless
+		// the object was deleted
+		resolved = v.key
+		if v.deleteMarker {
+			return nil
+		}
+		if err := s.copyObject(ctx, bucket, v, destBucket, destPrefix+strings.TrimPrefix(v.key, prefix)); err != nil {
+			return err
+		}
+		n++
+		if copied != nil {
+			return copied(v.key)
+		}
+		return nil
+	})
+	return n, err
+}
+
+// GetObjectPathUsageWithContext returns the storage used by the objects of
+// objectpath inside bucket, the whole bucket if empty. The ownership marker is
+// not counted and the listing stops after maxObjects objects.
+func (s *COSSession) GetObjectPathUsageWithContext(ctx context.Context, bucket, objectpath string, maxObjects int) (*Usage, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.ObjectPathUsage)
+	defer cancel()
+
+	prefix := ""
+	if objectpath != "" {
+		prefix = objectPathPrefix(objectpath)
+	}
+	usage := &Usage{}
+	var marker *string
+	for {
+		resp, err := s.svc.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+			Marker: marker,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot list bucket '%s': %w", bucket, ClassifyError(err))
+		}
+
+		for _, obj := range resp.Contents {
+			if prefix != "" && aws.StringValue(obj.Key) == prefix {
+				continue
+			}
+			if maxObjects > 0 && usage.ObjectCount >= int64(maxObjects) {
+				usage.Truncated = true
+				return usage, nil
+			}
+			usage.BytesUsed += aws.Int64Value(obj.Size)
+			usage.ObjectCount++
+		}
+
+		// ListObjects only returns NextMarker with a delimiter, the last key is the marker otherwise
+		if !aws.BoolValue(resp.IsTruncated) || len(resp.Contents) == 0 {
+			return usage, nil
+		}
+		marker = resp.Contents[len(resp.Contents)-1].Key
+	}
+}
+
+// copySource returns the URL encoded source of a CopyObject request
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		// '+' is escaped too, S3 may decode it as a space
+		segments[i] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// CreateObjectPathWithContext creates the directory marker of objectpath inside bucket
+func (s *COSSession) CreateObjectPathWithContext(ctx context.Context, bucket, objectpath string) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.CreateObjectPath)
+	defer cancel()
+
+	prefix := objectPathPrefix(objectpath)
+	if prefix == "" {
+		return fmt.Errorf("invalid object path '%s'", objectpath)
+	}
+	_, err := s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(prefix),
+		Body:   bytes.NewReader(nil),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create object path '%s' inside bucket '%s': %w", objectpath, bucket, ClassifyError(err))
+	}
+	return nil
+}
+
+// DeleteObjectPathWithContext deletes objectpath inside bucket, with all of its
+// objects and their versions. The directory marker of the path, which holds
+// its ownership marker, goes last, so that a failed deletion can be retried.
+func (s *COSSession) DeleteObjectPathWithContext(ctx context.Context, bucket, objectpath string) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.DeleteBucket)
+	defer cancel()
+
+	prefix := objectPathPrefix(objectpath)
+	if prefix == "" {
+		return fmt.Errorf("invalid object path '%s'", objectpath)
+	}
+	if err := s.deleteObjects(ctx, bucket, prefix, prefix); err != nil {
+		return err
+	}
+	notMarker := func(key string) bool { return key != prefix }
+	if err := s.deleteObjectVersions(ctx, bucket, prefix, notMarker); err != nil {
+		return err
+	}
+
+	_, err := s.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(prefix),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot delete object %s/%s: %w", bucket, prefix, ClassifyError(err))
+	}
+	isMarker := func(key string) bool { return key == prefix }
+	return s.deleteObjectVersions(ctx, bucket, prefix, isMarker)
+}
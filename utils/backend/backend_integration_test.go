@@ -0,0 +1,755 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	fakeS3 "github.com/IBM/ibmcloud-object-storage-plugin/utils/backend/fake-s3"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func getIntegrationSession(t *testing.T, retries int) (*fakeS3.Server, ObjectStorageSession) {
+	srv := fakeS3.NewServer()
+	t.Cleanup(srv.Close)
+	f := &COSSessionFactory{MaxRetries: &retries}
+	sess := f.NewObjectStorageSession(srv.URL, testRegion,
+		&ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	return srv, sess
+}
+
+func assertAWSErrorCode(t *testing.T, err error, code string) {
+	if assert.Error(t, err) {
+		var aerr awserr.Error
+		if assert.True(t, errors.As(err, &aerr), "expected awserr.Error, got %T", err) {
+			assert.Equal(t, code, aerr.Code())
+		}
+	}
+}
+
+func Test_Integration_CreateBucket_Positive(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+
+	msg, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.Empty(t, msg)
+
+	b, ok := srv.Bucket(testBucket)
+	if assert.True(t, ok) {
+		assert.Equal(t, testLocationConstraint, b.LocationConstraint)
+		assert.Empty(t, b.KPRootKeyCrn)
+	}
+}
+
+func Test_Integration_CreateBucket_KPRootKeyCrn(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, testKpRootKeyCrn)
+	assert.NoError(t, err)
+
+	b, ok := srv.Bucket(testBucket)
+	if assert.True(t, ok) {
+		assert.Equal(t, testKpRootKeyCrn, b.KPRootKeyCrn)
+		assert.Equal(t, KPEncryptionAlgorithm, b.KPAlgorithm)
+	}
+}
+
+func Test_Integration_GetBucketEncryption(t *testing.T) {
+	_, sess := getIntegrationSession(t, 0)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, testKpRootKeyCrn)
+	assert.NoError(t, err)
+
+	enc, err := sess.GetBucketEncryptionWithContext(context.Background(), testBucket)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &BucketEncryption{KPEnabled: true, RootKeyCRN: testKpRootKeyCrn}, enc)
+	}
+}
+
+func Test_Integration_GetBucketEncryption_NotEncrypted(t *testing.T) {
+	_, sess := getIntegrationSession(t, 0)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+
+	enc, err := sess.GetBucketEncryptionWithContext(context.Background(), testBucket)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &BucketEncryption{}, enc)
+	}
+}
+
+func Test_Integration_GetBucketEncryption_BucketNotFound(t *testing.T) {
+	_, sess := getIntegrationSession(t, 0)
+
+	_, err := sess.GetBucketEncryptionWithContext(context.Background(), testBucket)
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
+
+func Test_Integration_CreateBucket_BucketAlreadyOwnedByYou(t *testing.T) {
+	_, sess := getIntegrationSession(t, 0)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+
+	msg, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.ErrorIs(t, err, ErrBucketExists)
+	assert.False(t, errors.Is(err, ErrBucketNotOwned))
+	assert.Empty(t, msg)
+}
+
+func Test_Integration_CreateBucket_BucketAlreadyExists(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.AddForeignBucket(testBucket)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assertAWSErrorCode(t, err, "BucketAlreadyExists")
+	assert.ErrorIs(t, err, ErrBucketExists)
+	assert.ErrorIs(t, err, ErrBucketNotOwned)
+}
+
+func Test_Integration_CreateBucket_WrongAccessKey(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.AccessKey = "another-key"
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assertAWSErrorCode(t, err, "InvalidAccessKeyId")
+	assert.ErrorIs(t, err, ErrBadCredentials)
+}
+
+func Test_Integration_CreateBucket_ThrottledThenSucceeds(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 1)
+	srv.InjectFault(fakeS3.OpCreateBucket, fakeS3.FaultSlowDown, 1)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, srv.Count(fakeS3.OpCreateBucket))
+}
+
+func Test_Integration_CreateBucket_Throttled(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.InjectFault(fakeS3.OpCreateBucket, fakeS3.FaultSlowDown, 1)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assertAWSErrorCode(t, err, "SlowDown")
+	assert.ErrorIs(t, err, ErrThrottled)
+	_, ok := srv.Bucket(testBucket)
+	assert.False(t, ok)
+}
+
+func Test_Integration_CheckBucketAccess(t *testing.T) {
+	_, sess := getIntegrationSession(t, 0)
+
+	err := sess.CheckBucketAccess(testBucket)
+	assertAWSErrorCode(t, err, "NotFound")
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+
+	_, err = sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, sess.CheckBucketAccess(testBucket))
+}
+
+func Test_Integration_CheckBucketAccess_ForeignBucket(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.AddForeignBucket(testBucket)
+
+	err := sess.CheckBucketAccess(testBucket)
+	assertAWSErrorCode(t, err, "Forbidden")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+}
+
+func Test_Integration_CheckObjectPathExistence(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+
+	exist, err := sess.CheckObjectPathExistence(testBucket, testObjectPath)
+	assert.NoError(t, err)
+	assert.False(t, exist)
+
+	assert.NoError(t, srv.PutObject(testBucket, "test/object-path/", nil))
+	exist, err = sess.CheckObjectPathExistence(testBucket, testObjectPath)
+	assert.NoError(t, err)
+	assert.True(t, exist)
+}
+
+func Test_Integration_CheckObjectPathExistence_NoSuchBucket(t *testing.T) {
+	_, sess := getIntegrationSession(t, 0)
+
+	_, err := sess.CheckObjectPathExistence(testBucket, testObjectPath)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "NoSuchBucket")
+		assert.ErrorIs(t, err, ErrBucketNotFound)
+	}
+}
+
+func Test_Integration_DeleteBucket_Paginated(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	for i := 0; i < 2500; i++ {
+		assert.NoError(t, srv.PutObject(testBucket, fmt.Sprintf("obj-%04d", i), []byte("data")))
+	}
+
+	assert.NoError(t, sess.DeleteBucket(testBucket))
+	_, ok := srv.Bucket(testBucket)
+	assert.False(t, ok)
+	assert.Equal(t, 3, srv.Count(fakeS3.OpListObjectsV2))
+	assert.Equal(t, 3, srv.Count(fakeS3.OpDeleteObjects))
+	assert.Equal(t, 0, srv.Count(fakeS3.OpDeleteObject))
+}
+
+func Test_Integration_DeleteBucket_Versioned(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, sess.SetBucketVersioning(testBucket, true))
+
+	for i := 0; i < 1200; i++ {
+		key := fmt.Sprintf("obj-%04d", i)
+		assert.NoError(t, srv.PutObject(testBucket, key, []byte("v1")))
+		assert.NoError(t, srv.PutObject(testBucket, key, []byte("v2")))
+		if i%2 == 0 {
+			assert.NoError(t, srv.DeleteObject(testBucket, key))
+		}
+	}
+
+	assert.NoError(t, sess.DeleteBucket(testBucket))
+	_, ok := srv.Bucket(testBucket)
+	assert.False(t, ok)
+	assert.Less(t, 1, srv.Count(fakeS3.OpListObjectVersions))
+}
+
+func Test_Integration_DeleteBucket_DeleteObjectsFault(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, srv.PutObject(testBucket, "obj-a", []byte("data")))
+	srv.InjectFault(fakeS3.OpDeleteObjects, fakeS3.FaultAccessDenied, 1)
+
+	err = sess.DeleteBucket(testBucket)
+	assertAWSErrorCode(t, err, "AccessDenied")
+	assert.Equal(t, 0, srv.Count(fakeS3.OpDeleteBucket))
+	assert.Equal(t, []string{"obj-a"}, srv.Objects(testBucket))
+}
+
+func Test_Integration_DeleteBucket_NoSuchBucket(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+
+	assert.NoError(t, sess.DeleteBucket(testBucket))
+	assert.Equal(t, 0, srv.Count(fakeS3.OpDeleteBucket))
+}
+
+func Test_Integration_DeleteBucket_InjectedError(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	srv.InjectFault(fakeS3.OpDeleteBucket, fakeS3.FaultInternalError, 1)
+
+	err = sess.DeleteBucket(testBucket)
+	assertAWSErrorCode(t, err, "InternalError")
+	assert.ErrorIs(t, err, ErrTransient)
+	_, ok := srv.Bucket(testBucket)
+	assert.True(t, ok)
+}
+
+func Test_Integration_SetBucketVersioning(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, sess.SetBucketVersioning(testBucket, true))
+	b, _ := srv.Bucket(testBucket)
+	assert.Equal(t, "Enabled", b.Versioning)
+
+	assert.NoError(t, sess.SetBucketVersioning(testBucket, false))
+	b, _ = srv.Bucket(testBucket)
+	assert.Equal(t, "Suspended", b.Versioning)
+}
+
+func Test_Integration_SetBucketVersioning_NoSuchBucket(t *testing.T) {
+	_, sess := getIntegrationSession(t, 0)
+
+	err := sess.SetBucketVersioning(testBucket, true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "NoSuchBucket")
+	}
+}
+
+func Test_Integration_CreateBucket_QuotaExceeded(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.InjectFault(fakeS3.OpCreateBucket, fakeS3.FaultQuotaExceeded, 1)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, "QuotaExceeded", ErrorReason(err))
+}
+
+func Test_Integration_CreateBucket_ConnectionRefused(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.Close()
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.ErrorIs(t, err, ErrTransient)
+}
+
+func getIntegrationRetrySession(t *testing.T, policy *RetryPolicy) (*fakeS3.Server, ObjectStorageSession) {
+	srv := fakeS3.NewServer()
+	t.Cleanup(srv.Close)
+	f := &COSSessionFactory{Retry: policy}
+	sess := f.NewObjectStorageSession(srv.URL, testRegion,
+		&ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	return srv, sess
+}
+
+func Test_Integration_CreateBucket_RetryPolicy(t *testing.T) {
+	srv, sess := getIntegrationRetrySession(t, noWaitRetryPolicy(3))
+	srv.InjectFault(fakeS3.OpCreateBucket, fakeS3.FaultSlowDown, 2)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, srv.Count(fakeS3.OpCreateBucket))
+}
+
+func Test_Integration_CreateBucket_RetryPolicyResponseLost(t *testing.T) {
+	srv, sess := getIntegrationRetrySession(t, noWaitRetryPolicy(3))
+	lost := fakeS3.FaultInternalError
+	lost.Applied = true
+	srv.InjectFault(fakeS3.OpCreateBucket, lost, 1)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, srv.Count(fakeS3.OpCreateBucket))
+	assert.Equal(t, 1, srv.Count(fakeS3.OpHeadBucket))
+	_, ok := srv.Bucket(testBucket)
+	assert.True(t, ok)
+}
+
+func Test_Integration_CreateBucket_RetryPolicyOwnedBucket(t *testing.T) {
+	srv, sess := getIntegrationRetrySession(t, noWaitRetryPolicy(3))
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	srv.SetBucketTags(testBucket, map[string]string{OwnerTagPVName: "pv1", OwnerTagClaimUID: "uid1"})
+	srv.InjectFault(fakeS3.OpCreateBucket, fakeS3.FaultSlowDown, 1)
+
+	_, err = sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.ErrorIs(t, err, ErrBucketExists)
+	assert.Equal(t, 3, srv.Count(fakeS3.OpCreateBucket))
+}
+
+func Test_Integration_CreateBucket_RetryPolicyBucketWithObjects(t *testing.T) {
+	srv, sess := getIntegrationRetrySession(t, noWaitRetryPolicy(3))
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, srv.PutObject(testBucket, "obj-a", []byte("data")))
+	srv.InjectFault(fakeS3.OpCreateBucket, fakeS3.FaultSlowDown, 1)
+
+	_, err = sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.ErrorIs(t, err, ErrBucketExists)
+}
+
+func Test_Integration_CreateBucket_RetryPolicyNotCreated(t *testing.T) {
+	srv, sess := getIntegrationRetrySession(t, noWaitRetryPolicy(3))
+	srv.InjectFault(fakeS3.OpCreateBucket, fakeS3.FaultSlowDown, 1)
+
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, srv.Count(fakeS3.OpCreateBucket))
+	assert.Equal(t, 1, srv.Count(fakeS3.OpHeadBucket))
+}
+
+func Test_Integration_DeleteBucket_RetryPolicyExhausted(t *testing.T) {
+	srv, sess := getIntegrationRetrySession(t, noWaitRetryPolicy(2))
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	srv.InjectFault(fakeS3.OpDeleteBucket, fakeS3.FaultInternalError, -1)
+
+	err = sess.DeleteBucket(testBucket)
+	assert.ErrorIs(t, err, ErrTransient)
+	assert.Equal(t, 2, srv.Count(fakeS3.OpDeleteBucket))
+}
+
+func Test_Integration_CheckBucketAccess_RetryPolicyNotRetryable(t *testing.T) {
+	srv, sess := getIntegrationRetrySession(t, noWaitRetryPolicy(3))
+	srv.AddForeignBucket(testBucket)
+
+	err := sess.CheckBucketAccess(testBucket)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.Equal(t, 1, srv.Count(fakeS3.OpHeadBucket))
+}
+
+func Test_Integration_BucketOwner(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+
+	owner, err := sess.GetBucketOwnerWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.Nil(t, owner)
+
+	srv.SetBucketTags(testBucket, map[string]string{"team": "storage"})
+	want := &BucketOwner{ClusterID: "cluster", PVName: "pvc-1", ClaimUID: "uid-1"}
+	assert.NoError(t, sess.SetBucketOwnerWithContext(context.Background(), testBucket, want))
+	// the marker is in the bucket tags, not in an object the mounts can see
+	assert.Empty(t, srv.Objects(testBucket))
+	b, _ := srv.Bucket(testBucket)
+	assert.Equal(t, map[string]string{
+		"team":            "storage",
+		OwnerTagClusterID: "cluster",
+		OwnerTagPVName:    "pvc-1",
+		OwnerTagClaimUID:  "uid-1",
+	}, b.Tags)
+
+	owner, err = sess.GetBucketOwnerWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, want, owner)
+
+	// the marker goes away with the bucket
+	assert.NoError(t, sess.DeleteBucket(testBucket))
+	_, ok := srv.Bucket(testBucket)
+	assert.False(t, ok)
+}
+
+func Test_Integration_SetBucketOwner_RetryPolicy(t *testing.T) {
+	srv, sess := getIntegrationRetrySession(t, noWaitRetryPolicy(3))
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	srv.InjectFault(fakeS3.OpPutBucketTagging, fakeS3.FaultInternalError, 1)
+
+	want := &BucketOwner{ClusterID: "cluster", PVName: "pvc-1"}
+	assert.NoError(t, sess.SetBucketOwnerWithContext(context.Background(), testBucket, want))
+	owner, err := sess.GetBucketOwnerWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, want, owner)
+}
+
+func Test_Integration_CopyObjects(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.MaxKeys = 2
+	for _, bucket := range []string{testBucket, "archive-bucket"} {
+		_, err := sess.CreateBucket(bucket, testLocationConstraint, "")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, sess.SetBucketOwnerWithContext(context.Background(), testBucket, &BucketOwner{PVName: "pv1"}))
+	for _, key := range []string{"data/a", "data/b c", "data/d+e", "other"} {
+		assert.NoError(t, srv.PutObject(testBucket, key, []byte(key)))
+	}
+
+	n, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "data/", "archive-bucket", "pv1/2025/")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"pv1/2025/data/a", "pv1/2025/data/b c", "pv1/2025/data/d+e"}, srv.Objects("archive-bucket"))
+
+	// the whole bucket
+	n, err = sess.CopyObjectsWithContext(context.Background(), testBucket, "", "archive-bucket", "all/")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+}
+
+func Test_Integration_CopyObjects_Versions(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.MaxKeys = 2
+	for _, bucket := range []string{testBucket, "archive-bucket"} {
+		_, err := sess.CreateBucket(bucket, testLocationConstraint, "")
+		assert.NoError(t, err)
+		assert.NoError(t, sess.SetBucketVersioning(bucket, true))
+	}
+	for _, data := range []string{"v1", "v2", "v3"} {
+		assert.NoError(t, srv.PutObject(testBucket, "a", []byte(data)))
+	}
+	assert.NoError(t, srv.PutObject(testBucket, "b", []byte("b")))
+	assert.NoError(t, srv.DeleteObject(testBucket, "b"))
+
+	n, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "", "archive-bucket", "pv1/")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []string{"pv1/a"}, srv.Objects("archive-bucket"))
+	var data []string
+	for _, v := range srv.Versions("archive-bucket", "pv1/a") {
+		data = append(data, string(v.Data))
+	}
+	assert.Equal(t, []string{"v1", "v2", "v3"}, data)
+	versions := srv.Versions("archive-bucket", "pv1/b")
+	if assert.Len(t, versions, 2) {
+		assert.True(t, versions[1].DeleteMarker)
+	}
+}
+
+func Test_Integration_CopyObjects_Multipart(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.MaxCopySize = 10
+	oldMax, oldPart := maxCopyObjectSize, copyPartSize
+	maxCopyObjectSize, copyPartSize = 10, 4
+	defer func() { maxCopyObjectSize, copyPartSize = oldMax, oldPart }()
+	for _, bucket := range []string{testBucket, "archive-bucket"} {
+		_, err := sess.CreateBucket(bucket, testLocationConstraint, "")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, srv.PutObject(testBucket, "big", []byte("0123456789abcdef")))
+
+	n, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "", "archive-bucket", "pv1/")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	versions := srv.Versions("archive-bucket", "pv1/big")
+	if assert.Len(t, versions, 1) {
+		assert.Equal(t, "0123456789abcdef", string(versions[0].Data))
+	}
+	assert.Equal(t, 4, srv.Count(fakeS3.OpUploadPartCopy))
+	assert.Equal(t, 0, srv.Count(fakeS3.OpCopyObject))
+	assert.Equal(t, 0, srv.Uploads())
+}
+
+func Test_Integration_CopyObjects_MultipartAborted(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	oldMax := maxCopyObjectSize
+	maxCopyObjectSize = 10
+	defer func() { maxCopyObjectSize = oldMax }()
+	for _, bucket := range []string{testBucket, "archive-bucket"} {
+		_, err := sess.CreateBucket(bucket, testLocationConstraint, "")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, srv.PutObject(testBucket, "big", []byte("0123456789abcdef")))
+	srv.InjectFault(fakeS3.OpUploadPartCopy, fakeS3.FaultAccessDenied, 1)
+
+	_, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "", "archive-bucket", "pv1/")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.Empty(t, srv.Objects("archive-bucket"))
+	assert.Equal(t, 1, srv.Count(fakeS3.OpAbortMultipart))
+	assert.Equal(t, 0, srv.Uploads())
+}
+
+func Test_Integration_CopyObjects_MissingDestination(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, srv.PutObject(testBucket, "a", []byte("a")))
+
+	_, err = sess.CopyObjectsWithContext(context.Background(), testBucket, "", "missing-bucket", "")
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
+
+func Test_Integration_ObjectPath(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.MaxKeys = 2
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, srv.PutObject(testBucket, "ns/other/file", []byte("other")))
+
+	owner, err := sess.GetObjectPathOwnerWithContext(context.Background(), testBucket, "/ns/pvc")
+	assert.NoError(t, err)
+	assert.Nil(t, owner)
+
+	want := &BucketOwner{ClusterID: "cluster", PVName: "pv1"}
+	assert.NoError(t, sess.SetObjectPathOwnerWithContext(context.Background(), testBucket, "/ns/pvc", want))
+	exists, err := sess.CheckObjectPathExistenceWithContext(context.Background(), testBucket, "/ns/pvc")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	owner, err = sess.GetObjectPathOwnerWithContext(context.Background(), testBucket, "/ns/pvc")
+	assert.NoError(t, err)
+	assert.Equal(t, want, owner)
+
+	for _, key := range []string{"ns/pvc/a", "ns/pvc/dir/b", "ns/pvc/dir/c"} {
+		assert.NoError(t, srv.PutObject(testBucket, key, []byte(key)))
+	}
+	// the ownership marker is held by the directory marker, no other object shows in the mount
+	assert.Equal(t, []string{"ns/other/file", "ns/pvc/", "ns/pvc/a", "ns/pvc/dir/b", "ns/pvc/dir/c"}, srv.Objects(testBucket))
+	assert.NoError(t, sess.DeleteObjectPathWithContext(context.Background(), testBucket, "/ns/pvc"))
+	assert.Equal(t, []string{"ns/other/file"}, srv.Objects(testBucket))
+}
+
+func Test_Integration_DeleteObjectPath_Versioned(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, sess.SetBucketVersioning(testBucket, true))
+	assert.NoError(t, sess.SetObjectPathOwnerWithContext(context.Background(), testBucket, "pvc", &BucketOwner{PVName: "pv1"}))
+	assert.NoError(t, srv.PutObject(testBucket, "pvc/a", []byte("1")))
+	assert.NoError(t, srv.PutObject(testBucket, "pvc/a", []byte("2")))
+	assert.NoError(t, srv.PutObject(testBucket, "keep", []byte("keep")))
+
+	assert.NoError(t, sess.DeleteObjectPathWithContext(context.Background(), testBucket, "pvc"))
+	assert.Empty(t, srv.Versions(testBucket, "pvc/a"))
+	assert.Empty(t, srv.Versions(testBucket, "pvc/"))
+	assert.Equal(t, []string{"keep"}, srv.Objects(testBucket))
+}
+
+func Test_Integration_CopyObjectsAsOf(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.MaxKeys = 2
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv.SetClock(func() time.Time { return now })
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, sess.SetBucketVersioning(testBucket, true))
+	enabled, err := sess.GetBucketVersioningWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+
+	assert.NoError(t, srv.PutObject(testBucket, "data/a b", []byte("a1")))
+	assert.NoError(t, srv.PutObject(testBucket, "data/b", []byte("b1")))
+	now = now.Add(time.Minute)
+	asOf := now
+	assert.NoError(t, srv.PutObject(testBucket, "data/a b", []byte("a2")))
+	now = now.Add(time.Minute)
+	assert.NoError(t, srv.DeleteObject(testBucket, "data/b"))
+	assert.NoError(t, srv.PutObject(testBucket, "data/c", []byte("c1")))
+
+	_, err = sess.CreateBucket("as-of-bucket", testLocationConstraint, "")
+	assert.NoError(t, err)
+
+	n, err := sess.CopyObjectsAsOfWithContext(context.Background(), testBucket, "data/", "as-of-bucket", SnapshotPrefix+"pv1/", asOf, "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{SnapshotPrefix + "pv1/a b", SnapshotPrefix + "pv1/b"}, srv.Objects("as-of-bucket"))
+	versions := srv.Versions("as-of-bucket", SnapshotPrefix+"pv1/a b")
+	if assert.Len(t, versions, 1) {
+		assert.Equal(t, "a2", string(versions[0].Data))
+	}
+	// the versioned bucket is left as it was
+	assert.Equal(t, []string{"data/a b", "data/c"}, srv.Objects(testBucket))
+}
+
+func Test_Integration_CopyObjectsAsOf_Multipart(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.MaxCopySize = 10
+	oldMax, oldPart := maxCopyObjectSize, copyPartSize
+	maxCopyObjectSize, copyPartSize = 10, 4
+	defer func() { maxCopyObjectSize, copyPartSize = oldMax, oldPart }()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv.SetClock(func() time.Time { return now })
+	for _, bucket := range []string{testBucket, "as-of-bucket"} {
+		_, err := sess.CreateBucket(bucket, testLocationConstraint, "")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, sess.SetBucketVersioning(testBucket, true))
+	assert.NoError(t, srv.PutObject(testBucket, "big", []byte("0123456789abcdef")))
+	asOf := now
+	now = now.Add(time.Minute)
+	assert.NoError(t, srv.PutObject(testBucket, "big", []byte("fedcba9876543210")))
+
+	n, err := sess.CopyObjectsAsOfWithContext(context.Background(), testBucket, "", "as-of-bucket", SnapshotPrefix+"pv1/", asOf, "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	versions := srv.Versions("as-of-bucket", SnapshotPrefix+"pv1/big")
+	if assert.Len(t, versions, 1) {
+		assert.Equal(t, "0123456789abcdef", string(versions[0].Data))
+	}
+	assert.Equal(t, 4, srv.Count(fakeS3.OpUploadPartCopy))
+	assert.Equal(t, 0, srv.Count(fakeS3.OpCopyObject))
+}
+
+func Test_Integration_CopyObjectsAsOf_Resume(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.MaxKeys = 2
+	for _, bucket := range []string{testBucket, "as-of-bucket"} {
+		_, err := sess.CreateBucket(bucket, testLocationConstraint, "")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, sess.SetBucketVersioning(testBucket, true))
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, srv.PutObject(testBucket, key, []byte(key)))
+	}
+	asOf := time.Now().Add(time.Minute)
+
+	// the copy is interrupted after its third object
+	errInterrupted := errors.New("interrupted")
+	var checkpoints []string
+	n, err := sess.CopyObjectsAsOfWithContext(context.Background(), testBucket, "", "as-of-bucket", SnapshotPrefix+"pv1/", asOf, "", "", func(key string) error {
+		checkpoints = append(checkpoints, key)
+		if len(checkpoints) == 3 {
+			return errInterrupted
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, errInterrupted)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"a", "b", "c"}, checkpoints)
+
+	copies := srv.Count(fakeS3.OpCopyObject)
+	n, err = sess.CopyObjectsAsOfWithContext(context.Background(), testBucket, "", "as-of-bucket", SnapshotPrefix+"pv1/", asOf, "", "c", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, copies+2, srv.Count(fakeS3.OpCopyObject))
+	assert.Equal(t, []string{SnapshotPrefix + "pv1/a", SnapshotPrefix + "pv1/b", SnapshotPrefix + "pv1/c", SnapshotPrefix + "pv1/d", SnapshotPrefix + "pv1/e"},
+		srv.Objects("as-of-bucket"))
+}
+
+func Test_Integration_WriteReadDeleteObject(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	data, err := sess.ReadObjectWithContext(ctx, testBucket, "checkpoint")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	assert.NoError(t, sess.WriteObjectWithContext(ctx, testBucket, "checkpoint", []byte("first")))
+	assert.NoError(t, sess.WriteObjectWithContext(ctx, testBucket, "checkpoint", []byte("second")))
+	data, err = sess.ReadObjectWithContext(ctx, testBucket, "checkpoint")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	assert.NoError(t, sess.DeleteObjectWithContext(ctx, testBucket, "checkpoint"))
+	assert.NoError(t, sess.DeleteObjectWithContext(ctx, testBucket, "checkpoint"))
+	assert.Empty(t, srv.Objects(testBucket))
+
+	_, err = sess.ReadObjectWithContext(ctx, "missing-bucket", "checkpoint")
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
+
+func Test_Integration_GetObjectPathUsage(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	srv.MaxKeys = 2
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+	assert.NoError(t, sess.SetObjectPathOwnerWithContext(context.Background(), testBucket, "/ns/pvc", &BucketOwner{PVName: "pv1"}))
+	for _, key := range []string{"ns/pvc/a", "ns/pvc/dir/bb", "ns/pvc/dir/ccc", "ns/other/dddd"} {
+		assert.NoError(t, srv.PutObject(testBucket, key, []byte(path.Base(key))))
+	}
+
+	usage, err := sess.GetObjectPathUsageWithContext(context.Background(), testBucket, "/ns/pvc", 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Usage{BytesUsed: 6, ObjectCount: 3}, usage)
+	}
+
+	usage, err = sess.GetObjectPathUsageWithContext(context.Background(), testBucket, "", 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Usage{BytesUsed: 4, ObjectCount: 1, Truncated: true}, usage)
+	}
+}
+
+func Test_Integration_CreateObject(t *testing.T) {
+	srv, sess := getIntegrationSession(t, 0)
+	_, err := sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assert.NoError(t, err)
+
+	created, err := sess.CreateObjectWithContext(context.Background(), testBucket, "vol/gocryptfs.conf", []byte("first"))
+	assert.NoError(t, err)
+	assert.True(t, created)
+	// an existing object is never overwritten
+	created, err = sess.CreateObjectWithContext(context.Background(), testBucket, "vol/gocryptfs.conf", []byte("second"))
+	assert.NoError(t, err)
+	assert.False(t, created)
+	versions := srv.Versions(testBucket, "vol/gocryptfs.conf")
+	if assert.Len(t, versions, 1) {
+		assert.Equal(t, "first", string(versions[0].Data))
+	}
+
+	_, err = sess.CreateObjectWithContext(context.Background(), "missing-bucket", "vol/gocryptfs.conf", nil)
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
@@ -11,11 +11,16 @@
 package backend
 
 import (
+	"context"
 	"errors"
+	"io"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/IBM/ibm-cos-sdk-go/aws"
 	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
 	"github.com/IBM/ibm-cos-sdk-go/service/s3"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
@@ -25,10 +30,47 @@ type fakeS3API struct {
 	ErrHeadBucket          error
 	ErrCreateBucket        error
 	ErrListObjects         error
+	ErrListObjectVersions  error
 	ErrDeleteObject        error
 	ErrDeleteBucket        error
 	ErrPutBucketVersioning error
-	ObjectPath             string
+	ErrPutObject           error
+	ErrGetObject           error
+	ErrCopyObject          error
+	ErrGetBucketVersioning error
+	ErrPutBucketTagging    error
+	ErrGetBucketTagging    error
+	ErrGetObjectTagging    error
+	ErrUploadPartCopy      error
+	// Copied records the destination keys of CopyObject
+	Copied []string
+	// CopySources records the sources of CopyObject
+	CopySources []string
+	// Deleted records the keys of DeleteObject and DeleteObjects
+	Deleted []string
+	// DeleteErrors are the per key errors returned by DeleteObjects
+	DeleteErrors []*s3.Error
+	// CopyRanges records the source ranges of UploadPartCopy
+	CopyRanges []string
+	// Completed records the destination keys of CompleteMultipartUpload
+	Completed []string
+	// Aborted counts the calls to AbortMultipartUpload
+	Aborted int
+	// Versioning is the versioning status returned by GetBucketVersioning
+	Versioning string
+	// ObjectVersions is returned by ListObjectVersions if set
+	ObjectVersions *s3.ListObjectVersionsOutput
+	// Tags are the bucket tags returned by GetBucketTagging and replaced by PutBucketTagging
+	Tags []*s3.Tag
+	// ObjectTags are the object tags returned by GetObjectTagging
+	ObjectTags []*s3.Tag
+	// Tagging records the tagging of PutObject
+	Tagging string
+	// Object is the content returned by GetObject
+	Object     string
+	ObjectPath string
+	// Hang blocks every call until its context is done
+	Hang bool
 }
 
 const (
@@ -51,32 +93,206 @@ var (
 	errFoo     = errors.New(errFooMsg)
 )
 
-func (a *fakeS3API) HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+func (a *fakeS3API) HeadBucketWithContext(ctx aws.Context, input *s3.HeadBucketInput, opts ...request.Option) (*s3.HeadBucketOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
 	return nil, a.ErrHeadBucket
 }
 
-func (a *fakeS3API) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+func (a *fakeS3API) CreateBucketWithContext(ctx aws.Context, input *s3.CreateBucketInput, opts ...request.Option) (*s3.CreateBucketOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
 	return nil, a.ErrCreateBucket
 }
 
-func (a *fakeS3API) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+func (a *fakeS3API) ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (*s3.ListObjectsOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
 	return &s3.ListObjectsOutput{
 		Contents: []*s3.Object{{Key: &testObject}},
 	}, a.ErrListObjects
 }
 
-func (a *fakeS3API) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+func (a *fakeS3API) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &s3.ListObjectsV2Output{
+		Contents: []*s3.Object{{Key: &testObject}},
+	}, a.ErrListObjects
+}
+
+func (a *fakeS3API) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	if a.ObjectVersions != nil {
+		prefix := aws.StringValue(input.Prefix)
+		out := &s3.ListObjectVersionsOutput{}
+		for _, v := range a.ObjectVersions.Versions {
+			if strings.HasPrefix(aws.StringValue(v.Key), prefix) {
+				out.Versions = append(out.Versions, v)
+			}
+		}
+		for _, m := range a.ObjectVersions.DeleteMarkers {
+			if strings.HasPrefix(aws.StringValue(m.Key), prefix) {
+				out.DeleteMarkers = append(out.DeleteMarkers, m)
+			}
+		}
+		return out, a.ErrListObjectVersions
+	}
+	return &s3.ListObjectVersionsOutput{}, a.ErrListObjectVersions
+}
+
+func (a *fakeS3API) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	a.Deleted = append(a.Deleted, aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key))
 	return nil, a.ErrDeleteObject
 }
 
-func (a *fakeS3API) DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error) {
+func (a *fakeS3API) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	for _, o := range input.Delete.Objects {
+		a.Deleted = append(a.Deleted, aws.StringValue(input.Bucket)+"/"+aws.StringValue(o.Key))
+	}
+	return &s3.DeleteObjectsOutput{Errors: a.DeleteErrors}, a.ErrDeleteObject
+}
+
+func (a *fakeS3API) DeleteBucketWithContext(ctx aws.Context, input *s3.DeleteBucketInput, opts ...request.Option) (*s3.DeleteBucketOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
 	return nil, a.ErrDeleteBucket
 }
 
-func (a *fakeS3API) PutBucketVersioning(input *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error) {
+func (a *fakeS3API) PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (*s3.PutBucketVersioningOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
 	return &s3.PutBucketVersioningOutput{}, a.ErrPutBucketVersioning
 }
 
+func (a *fakeS3API) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	a.Tagging = aws.StringValue(input.Tagging)
+	return &s3.PutObjectOutput{}, a.ErrPutObject
+}
+
+func (a *fakeS3API) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	if a.ErrGetObject != nil {
+		return nil, a.ErrGetObject
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(a.Object))}, nil
+}
+
+func (a *fakeS3API) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	if a.ErrCopyObject != nil {
+		return nil, a.ErrCopyObject
+	}
+	a.Copied = append(a.Copied, aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key))
+	a.CopySources = append(a.CopySources, aws.StringValue(input.CopySource))
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (a *fakeS3API) GetBucketVersioningWithContext(ctx aws.Context, input *s3.GetBucketVersioningInput, opts ...request.Option) (*s3.GetBucketVersioningOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	if a.ErrGetBucketVersioning != nil {
+		return nil, a.ErrGetBucketVersioning
+	}
+	return &s3.GetBucketVersioningOutput{Status: aws.String(a.Versioning)}, nil
+}
+
+func (a *fakeS3API) PutBucketTaggingWithContext(ctx aws.Context, input *PutBucketTaggingInput, opts ...request.Option) (*PutBucketTaggingOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	if a.ErrPutBucketTagging != nil {
+		return nil, a.ErrPutBucketTagging
+	}
+	a.Tags = input.Tagging.TagSet
+	return &PutBucketTaggingOutput{}, nil
+}
+
+func (a *fakeS3API) GetBucketTaggingWithContext(ctx aws.Context, input *GetBucketTaggingInput, opts ...request.Option) (*GetBucketTaggingOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	if a.ErrGetBucketTagging != nil {
+		return nil, a.ErrGetBucketTagging
+	}
+	if len(a.Tags) == 0 {
+		return nil, awserr.New(ErrCodeNoSuchTagSet, "The TagSet does not exist", nil)
+	}
+	return &GetBucketTaggingOutput{TagSet: a.Tags}, nil
+}
+
+func (a *fakeS3API) GetObjectTaggingWithContext(ctx aws.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	if a.ErrGetObjectTagging != nil {
+		return nil, a.ErrGetObjectTagging
+	}
+	return &s3.GetObjectTaggingOutput{TagSet: a.ObjectTags}, nil
+}
+
+func (a *fakeS3API) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (a *fakeS3API) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	if a.ErrUploadPartCopy != nil {
+		return nil, a.ErrUploadPartCopy
+	}
+	a.CopyRanges = append(a.CopyRanges, aws.StringValue(input.CopySourceRange))
+	return &s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(`"etag"`)}}, nil
+}
+
+func (a *fakeS3API) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	a.Completed = append(a.Completed, aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key))
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (a *fakeS3API) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	a.Aborted++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// wait blocks until ctx is done when the fake hangs
+func (a *fakeS3API) wait(ctx aws.Context) error {
+	if !a.Hang {
+		return nil
+	}
+	<-ctx.Done()
+	return awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
 func getSession(svc s3API) ObjectStorageSession {
 	return &COSSession{
 		logger: zap.NewNop(),
@@ -152,10 +368,10 @@ func Test_CreateBucketAccess_Error(t *testing.T) {
 	}
 }
 
-func Test_CreateBucketAccess_BucketAlreadyExists_Positive(t *testing.T) {
+func Test_CreateBucketAccess_BucketAlreadyExists(t *testing.T) {
 	sess := getSession(&fakeS3API{ErrCreateBucket: awserr.New("BucketAlreadyOwnedByYou", "", errFoo)})
 	_, err := sess.CreateBucket(testBucket, testLocationConstraint, testKpRootKeyCrn)
-	assert.NoError(t, err)
+	assert.ErrorIs(t, err, ErrBucketExists)
 }
 
 func Test_CreateBucket_Positive(t *testing.T) {
@@ -186,6 +402,19 @@ func Test_DeleteBucket_DeleteObjectError(t *testing.T) {
 	}
 }
 
+func Test_DeleteBucket_DeleteObjectsKeyError(t *testing.T) {
+	sess := getSession(&fakeS3API{DeleteErrors: []*s3.Error{{
+		Key:     aws.String(testObject),
+		Code:    aws.String("AccessDenied"),
+		Message: aws.String("Access Denied"),
+	}}})
+	err := sess.DeleteBucket(testBucket)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot delete object "+testBucket+"/"+testObject)
+		assert.ErrorIs(t, err, ErrAccessDenied)
+	}
+}
+
 func Test_DeleteBucket_Error(t *testing.T) {
 	sess := getSession(&fakeS3API{ErrDeleteBucket: errFoo})
 	err := sess.DeleteBucket(testBucket)
@@ -221,3 +450,332 @@ func Test_SetBucketVersioning_Error(t *testing.T) {
 		assert.Contains(t, err.Error(), "failed to set versioning status")
 	}
 }
+
+func Test_CheckBucketAccessWithContext_Canceled(t *testing.T) {
+	sess := getSession(&fakeS3API{Hang: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := sess.CheckBucketAccessWithContext(ctx, testBucket)
+	assertAWSErrorCode(t, err, request.CanceledErrorCode)
+}
+
+func Test_CreateBucketWithContext_Deadline(t *testing.T) {
+	sess := getSession(&fakeS3API{Hang: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := sess.CreateBucketWithContext(ctx, testBucket, testLocationConstraint, "")
+	assertAWSErrorCode(t, err, request.CanceledErrorCode)
+}
+
+func Test_OperationTimeouts(t *testing.T) {
+	sess := &COSSession{
+		logger: zap.NewNop(),
+		svc:    &fakeS3API{Hang: true},
+		timeouts: OperationTimeouts{
+			CheckBucketAccess:        time.Millisecond,
+			CheckObjectPathExistence: time.Millisecond,
+			CreateBucket:             time.Millisecond,
+			DeleteBucket:             time.Millisecond,
+			SetBucketVersioning:      time.Millisecond,
+		},
+	}
+
+	assertAWSErrorCode(t, sess.CheckBucketAccess(testBucket), request.CanceledErrorCode)
+	_, err := sess.CheckObjectPathExistence(testBucket, testObjectPath)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), request.CanceledErrorCode)
+	}
+	_, err = sess.CreateBucket(testBucket, testLocationConstraint, "")
+	assertAWSErrorCode(t, err, request.CanceledErrorCode)
+	err = sess.DeleteBucket(testBucket)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), request.CanceledErrorCode)
+	}
+	err = sess.SetBucketVersioning(testBucket, true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), request.CanceledErrorCode)
+	}
+}
+
+func Test_NewObjectStorageSession_Timeouts(t *testing.T) {
+	f := &COSSessionFactory{Timeouts: DefaultOperationTimeouts}
+	sess := f.NewObjectStorageSession(testEndpoint, testRegion, &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	assert.Equal(t, DefaultOperationTimeouts, sess.(*COSSession).timeouts)
+}
+
+func Test_GetBucketOwner_Positive(t *testing.T) {
+	sess := getSession(&fakeS3API{Tags: []*s3.Tag{
+		{Key: aws.String("team"), Value: aws.String("storage")},
+		{Key: aws.String(OwnerTagClusterID), Value: aws.String("c1")},
+		{Key: aws.String(OwnerTagPVName), Value: aws.String("pv1")},
+		{Key: aws.String(OwnerTagClaimUID), Value: aws.String("uid1")},
+	}})
+	owner, err := sess.GetBucketOwnerWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, &BucketOwner{ClusterID: "c1", PVName: "pv1", ClaimUID: "uid1"}, owner)
+}
+
+func Test_GetBucketOwner_NoTags(t *testing.T) {
+	sess := getSession(&fakeS3API{})
+	owner, err := sess.GetBucketOwnerWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.Nil(t, owner)
+}
+
+func Test_GetBucketOwner_NoMarker(t *testing.T) {
+	sess := getSession(&fakeS3API{Tags: []*s3.Tag{{Key: aws.String("team"), Value: aws.String("storage")}}})
+	owner, err := sess.GetBucketOwnerWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.Nil(t, owner)
+}
+
+func Test_GetBucketOwner_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrGetBucketTagging: awserr.New("NoSuchBucket", "", nil)})
+	_, err := sess.GetBucketOwnerWithContext(context.Background(), testBucket)
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
+
+func Test_SetBucketOwner_KeepsTags(t *testing.T) {
+	api := &fakeS3API{Tags: []*s3.Tag{
+		{Key: aws.String("team"), Value: aws.String("storage")},
+		{Key: aws.String(OwnerTagPVName), Value: aws.String("old-pv")},
+	}}
+	sess := getSession(api)
+	err := sess.SetBucketOwnerWithContext(context.Background(), testBucket, &BucketOwner{ClusterID: "c1", PVName: "pv1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*s3.Tag{
+		{Key: aws.String(OwnerTagClusterID), Value: aws.String("c1")},
+		{Key: aws.String(OwnerTagPVName), Value: aws.String("pv1")},
+		{Key: aws.String("team"), Value: aws.String("storage")},
+	}, api.Tags)
+}
+
+func Test_SetBucketOwner_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrPutBucketTagging: awserr.New("AccessDenied", "", nil)})
+	err := sess.SetBucketOwnerWithContext(context.Background(), testBucket, &BucketOwner{PVName: "pv1"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot write ownership marker")
+		assert.ErrorIs(t, err, ErrAccessDenied)
+	}
+}
+
+func Test_GetObjectPathOwner_Positive(t *testing.T) {
+	sess := getSession(&fakeS3API{ObjectTags: []*s3.Tag{
+		{Key: aws.String("team"), Value: aws.String("a")},
+		{Key: aws.String(OwnerTagPVName), Value: aws.String("pv1")},
+		{Key: aws.String(OwnerTagClaimUID), Value: aws.String("uid1")},
+	}})
+	owner, err := sess.GetObjectPathOwnerWithContext(context.Background(), testBucket, testObjectPath)
+	assert.NoError(t, err)
+	assert.Equal(t, &BucketOwner{PVName: "pv1", ClaimUID: "uid1"}, owner)
+}
+
+func Test_GetObjectPathOwner_NoMarker(t *testing.T) {
+	sess := getSession(&fakeS3API{ObjectTags: []*s3.Tag{{Key: aws.String("team"), Value: aws.String("a")}}})
+	owner, err := sess.GetObjectPathOwnerWithContext(context.Background(), testBucket, testObjectPath)
+	assert.NoError(t, err)
+	assert.Nil(t, owner)
+}
+
+func Test_GetObjectPathOwner_NoDirectoryMarker(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrGetObjectTagging: awserr.New(s3.ErrCodeNoSuchKey, "", nil)})
+	owner, err := sess.GetObjectPathOwnerWithContext(context.Background(), testBucket, testObjectPath)
+	assert.NoError(t, err)
+	assert.Nil(t, owner)
+}
+
+func Test_GetObjectPathOwner_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrGetObjectTagging: awserr.New("AccessDenied", "", nil)})
+	_, err := sess.GetObjectPathOwnerWithContext(context.Background(), testBucket, testObjectPath)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot read ownership marker")
+		assert.ErrorIs(t, err, ErrAccessDenied)
+	}
+}
+
+func Test_SetObjectPathOwner_Positive(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	err := sess.SetObjectPathOwnerWithContext(context.Background(), testBucket, testObjectPath, &BucketOwner{PVName: "pv1"})
+	assert.NoError(t, err)
+	assert.Equal(t, OwnerTagPVName+"=pv1", api.Tagging)
+}
+
+func Test_SetObjectPathOwner_BucketRoot(t *testing.T) {
+	sess := getSession(&fakeS3API{})
+	err := sess.SetObjectPathOwnerWithContext(context.Background(), testBucket, "/", &BucketOwner{PVName: "pv1"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid object path '/'")
+	}
+}
+
+func Test_CopyObjects_Positive(t *testing.T) {
+	api := &fakeS3API{ObjectVersions: getObjectVersions()}
+	sess := getSession(api)
+	n, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "data/", "archive", "pv1/")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	// the versions of each object are copied oldest first, deletions replayed
+	assert.Equal(t, []string{"archive/pv1/data/a", "archive/pv1/data/a", "archive/pv1/data/b", "archive/pv1/data/c"}, api.Copied)
+	assert.Equal(t, []string{
+		testBucket + "/data/a?versionId=a1",
+		testBucket + "/data/a?versionId=a2",
+		testBucket + "/data/b?versionId=b1",
+		testBucket + "/data/c?versionId=c1",
+	}, api.CopySources)
+	assert.Equal(t, []string{"archive/pv1/data/b"}, api.Deleted)
+}
+
+func Test_CopyObjects_ListObjectVersionsError(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrListObjectVersions: awserr.New("NoSuchBucket", "", nil)})
+	_, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "", "archive", "pv1/")
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
+
+func Test_CopyObjects_CopyObjectError(t *testing.T) {
+	sess := getSession(&fakeS3API{ObjectVersions: getObjectVersions(), ErrCopyObject: awserr.New("AccessDenied", "", nil)})
+	n, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "data/", "archive", "pv1/")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot copy object "+testBucket+"/data/a")
+		assert.ErrorIs(t, err, ErrAccessDenied)
+	}
+	assert.Equal(t, 0, n)
+}
+
+func Test_CopyObjects_Multipart(t *testing.T) {
+	oldMax, oldPart := maxCopyObjectSize, copyPartSize
+	maxCopyObjectSize, copyPartSize = 10, 4
+	defer func() { maxCopyObjectSize, copyPartSize = oldMax, oldPart }()
+	api := &fakeS3API{ObjectVersions: &s3.ListObjectVersionsOutput{Versions: []*s3.ObjectVersion{
+		{Key: aws.String("big"), VersionId: aws.String("null"), Size: aws.Int64(11)},
+		{Key: aws.String("small"), VersionId: aws.String("null"), Size: aws.Int64(10)},
+	}}}
+	sess := getSession(api)
+	n, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "", "archive", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"bytes=0-3", "bytes=4-7", "bytes=8-10"}, api.CopyRanges)
+	assert.Equal(t, []string{"archive/big"}, api.Completed)
+	assert.Equal(t, []string{"archive/small"}, api.Copied)
+	assert.Equal(t, []string{testBucket + "/small"}, api.CopySources)
+}
+
+func Test_CopyObjects_MultipartError(t *testing.T) {
+	oldMax := maxCopyObjectSize
+	maxCopyObjectSize = 10
+	defer func() { maxCopyObjectSize = oldMax }()
+	api := &fakeS3API{
+		ObjectVersions:    &s3.ListObjectVersionsOutput{Versions: []*s3.ObjectVersion{{Key: aws.String("big"), Size: aws.Int64(11)}}},
+		ErrUploadPartCopy: awserr.New("AccessDenied", "", nil),
+	}
+	sess := getSession(api)
+	_, err := sess.CopyObjectsWithContext(context.Background(), testBucket, "", "archive", "")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot copy part 1 of object "+testBucket+"/big")
+		assert.ErrorIs(t, err, ErrAccessDenied)
+	}
+	assert.Equal(t, 1, api.Aborted)
+	assert.Empty(t, api.Completed)
+}
+
+func Test_GetBucketVersioning(t *testing.T) {
+	enabled, err := getSession(&fakeS3API{Versioning: "Enabled"}).GetBucketVersioningWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+
+	enabled, err = getSession(&fakeS3API{Versioning: "Suspended"}).GetBucketVersioningWithContext(context.Background(), testBucket)
+	assert.NoError(t, err)
+	assert.False(t, enabled)
+
+	_, err = getSession(&fakeS3API{ErrGetBucketVersioning: awserr.New("NoSuchBucket", "", nil)}).GetBucketVersioningWithContext(context.Background(), testBucket)
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
+
+func getObjectVersions() *s3.ListObjectVersionsOutput {
+	at := func(minute int) *time.Time {
+		t := time.Date(2025, 1, 1, 0, minute, 0, 0, time.UTC)
+		return &t
+	}
+	return &s3.ListObjectVersionsOutput{
+		Versions: []*s3.ObjectVersion{
+			{Key: aws.String("data/a"), VersionId: aws.String("a2"), LastModified: at(20)},
+			{Key: aws.String("data/a"), VersionId: aws.String("a1"), LastModified: at(0)},
+			{Key: aws.String("data/b"), VersionId: aws.String("b1"), LastModified: at(0)},
+			{Key: aws.String("data/c"), VersionId: aws.String("c1"), LastModified: at(15)},
+			{Key: aws.String("data/"), VersionId: aws.String("o1"), LastModified: at(0)},
+			{Key: aws.String(SnapshotPrefix + "pv0/a"), VersionId: aws.String("s1"), LastModified: at(0)},
+		},
+		DeleteMarkers: []*s3.DeleteMarkerEntry{
+			{Key: aws.String("data/b"), VersionId: aws.String("b2"), LastModified: at(5)},
+		},
+	}
+}
+
+func Test_CopyObjectsAsOf_Time(t *testing.T) {
+	api := &fakeS3API{ObjectVersions: getObjectVersions()}
+	sess := getSession(api)
+	n, err := sess.CopyObjectsAsOfWithContext(context.Background(), testBucket, "data/", testBucket, "snap/",
+		time.Date(2025, 1, 1, 0, 10, 0, 0, time.UTC), "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	// b is deleted and c not written yet at 00:10
+	assert.Equal(t, []string{testBucket + "/snap/a"}, api.Copied)
+	assert.Equal(t, []string{testBucket + "/data/a?versionId=a1"}, api.CopySources)
+}
+
+func Test_CopyObjectsAsOf_VersionID(t *testing.T) {
+	api := &fakeS3API{ObjectVersions: getObjectVersions()}
+	sess := getSession(api)
+	n, err := sess.CopyObjectsAsOfWithContext(context.Background(), testBucket, "data/", testBucket, "snap/", time.Time{}, "c1", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{testBucket + "/snap/a", testBucket + "/snap/c"}, api.Copied)
+	assert.Equal(t, []string{testBucket + "/data/a?versionId=a1", testBucket + "/data/c?versionId=c1"}, api.CopySources)
+}
+
+func Test_CopyObjectsAsOf_VersionNotFound(t *testing.T) {
+	api := &fakeS3API{ObjectVersions: getObjectVersions()}
+	sess := getSession(api)
+	_, err := sess.CopyObjectsAsOfWithContext(context.Background(), testBucket, "data/", testBucket, "snap/", time.Time{}, "x1", "", nil)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+	assert.Empty(t, api.Copied)
+}
+
+func Test_CopySource(t *testing.T) {
+	assert.Equal(t, "b/dir/a%20b%2Bc", copySource("b", "dir/a b+c"))
+}
+
+func Test_ObjectPathPrefix(t *testing.T) {
+	assert.Equal(t, "", objectPathPrefix("/"))
+	assert.Equal(t, "ns/pvc/", objectPathPrefix("/ns/pvc"))
+	assert.Equal(t, "ns/pvc/", objectPathPrefix("ns/pvc/"))
+}
+
+func Test_CreateObjectPath_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrPutObject: awserr.New("AccessDenied", "", nil)})
+	err := sess.CreateObjectPathWithContext(context.Background(), testBucket, testObjectPath)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot create object path")
+		assert.ErrorIs(t, err, ErrAccessDenied)
+	}
+}
+
+func Test_CreateObjectPath_InvalidPath(t *testing.T) {
+	sess := getSession(&fakeS3API{})
+	err := sess.CreateObjectPathWithContext(context.Background(), testBucket, "/")
+	assert.Error(t, err)
+}
+
+func Test_DeleteObjectPath_InvalidPath(t *testing.T) {
+	sess := getSession(&fakeS3API{})
+	err := sess.DeleteObjectPathWithContext(context.Background(), testBucket, "")
+	assert.Error(t, err)
+}
+
+func Test_DeleteObjectPath_DeleteObjectError(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrDeleteObject: errFoo})
+	err := sess.DeleteObjectPathWithContext(context.Background(), testBucket, testObjectPath)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot delete object")
+	}
+}
@@ -0,0 +1,283 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam/token"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
+)
+
+// Error classes returned by the object storage session. Errors returned by
+// COSSession wrap the SDK error in an *Error, match one of these with
+// errors.Is and still expose the awserr.Error through errors.As.
+var (
+	// ErrBucketExists is returned when a bucket to be created already exists
+	ErrBucketExists = errors.New("bucket already exists")
+	// ErrBucketNotOwned is returned when a bucket to be created already exists
+	// and belongs to another account or service instance. It also matches
+	// ErrBucketExists.
+	ErrBucketNotOwned = errors.New("bucket is owned by another account or service instance")
+	// ErrBucketNotFound is returned when a bucket does not exist
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrAccessDenied is returned when the credentials are valid but not
+	// authorized for the operation
+	ErrAccessDenied = errors.New("access denied")
+	// ErrBadCredentials is returned when the HMAC keys or the API key are wrong
+	ErrBadCredentials = errors.New("invalid credentials")
+	// ErrQuotaExceeded is returned when an account or bucket quota is exhausted
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrThrottled is returned when COS or IAM rate limits the request
+	ErrThrottled = errors.New("request throttled")
+	// ErrTransient is returned for network failures and server side errors
+	// that are expected to go away on their own
+	ErrTransient = errors.New("transient error")
+	// ErrBadEndpoint is returned when the endpoint host does not resolve or
+	// its certificate is not trusted, which retrying does not fix
+	ErrBadEndpoint = errors.New("endpoint cannot be resolved or is not trusted")
+	// ErrVersionNotFound is returned when an object version does not exist
+	ErrVersionNotFound = errors.New("object version not found")
+)
+
+// Error is a classified object storage error
+type Error struct {
+	// Kind is one of the Err* values of this package
+	Kind error
+	// Code is the COS or IAM error code, if any
+	Code string
+	// Err is the underlying error
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error belongs to the class target
+func (e *Error) Is(target error) bool {
+	if target == e.Kind {
+		return true
+	}
+	return e.Kind == ErrBucketNotOwned && target == ErrBucketExists
+}
+
+// ErrorReason returns a short CamelCase reason for err, suitable for event
+// reasons and metric labels. Unclassified errors are reported as "Unknown".
+func ErrorReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrBucketNotOwned):
+		return "BucketNotOwned"
+	case errors.Is(err, ErrBucketExists):
+		return "BucketExists"
+	case errors.Is(err, ErrBucketNotFound):
+		return "BucketNotFound"
+	case errors.Is(err, ErrAccessDenied):
+		return "AccessDenied"
+	case errors.Is(err, ErrBadCredentials):
+		return "BadCredentials"
+	case errors.Is(err, ErrQuotaExceeded):
+		return "QuotaExceeded"
+	case errors.Is(err, ErrThrottled):
+		return "Throttled"
+	case errors.Is(err, ErrTransient):
+		return "Transient"
+	case errors.Is(err, ErrBadEndpoint):
+		return "BadEndpoint"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "Timeout"
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == request.CanceledErrorCode {
+		return "Timeout"
+	}
+	return "Unknown"
+}
+
+var errorCodeKinds = map[string]error{
+	"BucketAlreadyOwnedByYou": ErrBucketExists,
+	"BucketAlreadyExists":     ErrBucketNotOwned,
+	"NoSuchBucket":            ErrBucketNotFound,
+	"NotFound":                ErrBucketNotFound,
+	"AccessDenied":            ErrAccessDenied,
+	"AllAccessDisabled":       ErrAccessDenied,
+	"Forbidden":               ErrAccessDenied,
+	"InvalidAccessKeyId":      ErrBadCredentials,
+	"SignatureDoesNotMatch":   ErrBadCredentials,
+	"InvalidToken":            ErrBadCredentials,
+	"ExpiredToken":            ErrBadCredentials,
+	"QuotaExceeded":           ErrQuotaExceeded,
+	"TooManyBuckets":          ErrQuotaExceeded,
+	"SlowDown":                ErrThrottled,
+	"Throttling":              ErrThrottled,
+	"ThrottlingException":     ErrThrottled,
+	"RequestLimitExceeded":    ErrThrottled,
+	"TooManyRequests":         ErrThrottled,
+	"InternalError":           ErrTransient,
+	"ServiceUnavailable":      ErrTransient,
+	"RequestTimeout":          ErrTransient,
+	"RequestTimeoutException": ErrTransient,
+}
+
+// ClassifyError wraps err in an *Error if its class can be determined.
+// Unknown errors, nil and already classified errors are returned unchanged.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	var code string
+	var kind error
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		code = aerr.Code()
+		kind = errorCodeKinds[code]
+		if kind == nil {
+			kind = classifyAWSError(aerr, err)
+		}
+	} else {
+		kind = classifyNetworkError(err)
+	}
+	if kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, Code: code, Err: err}
+}
+
+func classifyAWSError(aerr awserr.Error, err error) error {
+	switch aerr.Code() {
+	case request.CanceledErrorCode:
+		// the caller gave up, retrying would not help
+		return nil
+	case "IbmApiKeyIdNotFound", "InvalidCredentials":
+		return ErrBadCredentials
+	case "TokenManagerRetrieveError", "ErrFetchingIAMToken":
+		if kind := classifyEndpointError(err); kind != nil {
+			return kind
+		}
+		return classifyIAMError(aerr)
+	case request.ErrCodeRequestError, request.ErrCodeSerialization, request.ErrCodeResponseTimeout, request.ErrCodeRead:
+		// The SDK reports a rejected HMAC signature as a RequestError whose
+		// message echoes the Credential= part of the authorization header
+		if strings.Contains(err.Error(), "Credential=") {
+			return ErrBadCredentials
+		}
+		if kind := classifyEndpointError(err); kind != nil {
+			return kind
+		}
+		return ErrTransient
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return classifyStatusCode(reqErr.StatusCode())
+	}
+	return classifyNetworkError(aerr.OrigErr())
+}
+
+// classifyIAMError classifies a failure to get an IAM token for the API key.
+// IAM rejects unknown or disabled keys with a token.Error, anything else is
+// an IAM outage or a network problem.
+func classifyIAMError(aerr awserr.Error) error {
+	for orig := aerr.OrigErr(); orig != nil; {
+		var tokenErr *token.Error
+		if errors.As(orig, &tokenErr) {
+			return ErrBadCredentials
+		}
+		next, ok := orig.(awserr.Error)
+		if !ok {
+			break
+		}
+		orig = next.OrigErr()
+	}
+	return ErrTransient
+}
+
+func classifyStatusCode(status int) error {
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrBadCredentials
+	case status == http.StatusForbidden:
+		return ErrAccessDenied
+	case status == http.StatusTooManyRequests:
+		return ErrThrottled
+	case status >= http.StatusInternalServerError:
+		return ErrTransient
+	}
+	return nil
+}
+
+// classifyEndpointError returns ErrBadEndpoint if err, or an error it wraps
+// directly or through awserr.Error.OrigErr, is a DNS lookup that found no
+// host or a TLS certificate failure
+func classifyEndpointError(err error) error {
+	for err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && !dnsErr.IsTimeout && !dnsErr.IsTemporary {
+			return ErrBadEndpoint
+		}
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		var invalid x509.CertificateInvalidError
+		var verification *tls.CertificateVerificationError
+		var recordHeader tls.RecordHeaderError
+		if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) ||
+			errors.As(err, &verification) || errors.As(err, &recordHeader) {
+			return ErrBadEndpoint
+		}
+		// awserr.Error does not implement Unwrap
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return nil
+		}
+		err = aerr.OrigErr()
+	}
+	return nil
+}
+
+func classifyNetworkError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if kind := classifyEndpointError(err); kind != nil {
+		return kind
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return ErrTransient
+	}
+	return nil
+}
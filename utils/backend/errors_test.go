@@ -0,0 +1,105 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package backend
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam/token"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"owned by you", awserr.New("BucketAlreadyOwnedByYou", "", nil), ErrBucketExists},
+		{"owned by other", awserr.New("BucketAlreadyExists", "", nil), ErrBucketNotOwned},
+		{"no such bucket", awserr.NewRequestFailure(awserr.New("NoSuchBucket", "", nil), 404, ""), ErrBucketNotFound},
+		{"access denied", awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, ""), ErrAccessDenied},
+		{"forbidden status", awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 403, ""), ErrAccessDenied},
+		{"invalid access key", awserr.New("InvalidAccessKeyId", "", nil), ErrBadCredentials},
+		{"hmac request error", awserr.New(request.ErrCodeRequestError, "Credential=akey/20250101", nil), ErrBadCredentials},
+		{"iam key rejected", awserr.New("TokenManagerRetrieveError", "", awserr.New("ErrFetchingIAMToken", "", &token.Error{ErrorCode: "BXNIM0415E"})), ErrBadCredentials},
+		{"iam unavailable", awserr.New("TokenManagerRetrieveError", "", awserr.New("ErrFetchingIAMToken", "", errors.New("Response: Bad Status Code: 503"))), ErrTransient},
+		{"quota", awserr.New("QuotaExceeded", "", nil), ErrQuotaExceeded},
+		{"slow down", awserr.NewRequestFailure(awserr.New("SlowDown", "", nil), 503, ""), ErrThrottled},
+		{"too many requests status", awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 429, ""), ErrThrottled},
+		{"server error status", awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 502, ""), ErrTransient},
+		{"request error", awserr.New(request.ErrCodeRequestError, "send request failed", syscall.ECONNRESET), ErrTransient},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), ErrTransient},
+		{"net error", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrTransient},
+		{"unknown host", awserr.New(request.ErrCodeRequestError, "send request failed", &url.Error{Op: "Put", URL: "https://s3.typo.example", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "s3.typo.example", IsNotFound: true}}}), ErrBadEndpoint},
+		{"dns timeout", awserr.New(request.ErrCodeRequestError, "send request failed", &net.DNSError{Err: "i/o timeout", Name: "s3.example", IsTimeout: true}), ErrTransient},
+		{"untrusted certificate", awserr.New(request.ErrCodeRequestError, "send request failed", &url.Error{Op: "Put", URL: "https://s3.example", Err: x509.UnknownAuthorityError{}}), ErrBadEndpoint},
+		{"iam unknown host", awserr.New("TokenManagerRetrieveError", "", awserr.New("ErrFetchingIAMToken", "", &net.DNSError{Err: "no such host", Name: "iam.typo.example", IsNotFound: true})), ErrBadEndpoint},
+		{"bare unknown host", &net.DNSError{Err: "no such host", Name: "s3.typo.example", IsNotFound: true}, ErrBadEndpoint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ClassifyError(tt.err)
+			assert.ErrorIs(t, err, tt.kind)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func Test_ClassifyError_Unclassified(t *testing.T) {
+	assert.NoError(t, ClassifyError(nil))
+	assert.Equal(t, errFoo, ClassifyError(errFoo))
+
+	canceled := awserr.New(request.CanceledErrorCode, "request context canceled", context.Canceled)
+	assert.Equal(t, canceled, ClassifyError(canceled))
+
+	badRequest := awserr.NewRequestFailure(awserr.New("InvalidBucketName", "", nil), 400, "")
+	assert.Equal(t, badRequest, ClassifyError(badRequest))
+}
+
+func Test_ClassifyError_KeepsClassification(t *testing.T) {
+	err := ClassifyError(awserr.New("SlowDown", "", nil))
+	wrapped := fmt.Errorf("cannot create bucket: %w", err)
+	assert.Equal(t, wrapped, ClassifyError(wrapped))
+}
+
+func Test_Error_AsAWSError(t *testing.T) {
+	err := fmt.Errorf("cannot list bucket: %w", ClassifyError(awserr.New("NoSuchBucket", "no such bucket", nil)))
+	var aerr awserr.Error
+	if assert.True(t, errors.As(err, &aerr)) {
+		assert.Equal(t, "NoSuchBucket", aerr.Code())
+	}
+	var cerr *Error
+	if assert.True(t, errors.As(err, &cerr)) {
+		assert.Equal(t, "NoSuchBucket", cerr.Code)
+	}
+	assert.False(t, errors.Is(err, ErrBucketExists))
+}
+
+func Test_ErrorReason(t *testing.T) {
+	assert.Equal(t, "", ErrorReason(nil))
+	assert.Equal(t, "BucketNotOwned", ErrorReason(ClassifyError(awserr.New("BucketAlreadyExists", "", nil))))
+	assert.Equal(t, "BucketExists", ErrorReason(ClassifyError(awserr.New("BucketAlreadyOwnedByYou", "", nil))))
+	assert.Equal(t, "BadCredentials", ErrorReason(ClassifyError(awserr.New("SignatureDoesNotMatch", "", nil))))
+	assert.Equal(t, "BadEndpoint", ErrorReason(ClassifyError(&net.DNSError{Err: "no such host", IsNotFound: true})))
+	assert.Equal(t, "Timeout", ErrorReason(context.DeadlineExceeded))
+	assert.Equal(t, "Timeout", ErrorReason(awserr.New(request.CanceledErrorCode, "", context.Canceled)))
+	assert.Equal(t, "Unknown", ErrorReason(errFoo))
+}
@@ -0,0 +1,417 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+// Package fake_rc provides a local stand-in for the IAM token endpoint and the
+// COS Resource Configuration API, so that access policy and quota updates can
+// be exercised without IBM Cloud.
+package fake_rc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	iamTokenPath     = "/identity/token"
+	configPathPrefix = "/v1/b/"
+	apiKeyGrantType  = "urn:ibm:params:oauth:grant-type:apikey" // #nosec G101 -- not a credential
+	tokenTTLSeconds  = 3600
+	maxAllowedIPs    = 1000
+)
+
+// Operation names a request handled by the server
+type Operation string
+
+const (
+	OpGetToken           Operation = "GetToken"
+	OpGetBucketConfig    Operation = "GetBucketConfig"
+	OpUpdateBucketConfig Operation = "UpdateBucketConfig"
+)
+
+// Fault is an error returned instead of handling a request
+type Fault struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+type fault struct {
+	Fault
+	remaining int
+}
+
+// Firewall is the firewall section of a bucket configuration
+type Firewall struct {
+	AllowedIP          []string `json:"allowed_ip"`
+	DeniedIP           []string `json:"denied_ip,omitempty"`
+	AllowedNetworkType []string `json:"allowed_network_type,omitempty"`
+}
+
+// BucketConfig is the configuration stored for a bucket
+type BucketConfig struct {
+	Name        string    `json:"name"`
+	Crn         string    `json:"crn,omitempty"`
+	TimeCreated string    `json:"time_created,omitempty"`
+	TimeUpdated string    `json:"time_updated,omitempty"`
+	ObjectCount int64     `json:"object_count"`
+	BytesUsed   int64     `json:"bytes_used"`
+	HardQuota   int64     `json:"hard_quota,omitempty"`
+	Firewall    *Firewall `json:"firewall,omitempty"`
+}
+
+// Server serves the IAM token endpoint and the Resource Configuration API
+type Server struct {
+	*httptest.Server
+
+	// BucketExists, when set, decides which buckets exist in addition to
+	// the ones registered with AddBucket, e.g. by asking a fake S3 server
+	BucketExists func(name string) bool
+
+	mu      sync.Mutex
+	apiKeys map[string]bool
+	tokens  map[string]time.Time
+	buckets map[string]*BucketConfig
+	faults  map[Operation][]*fault
+	counts  map[Operation]int
+	now     func() time.Time
+}
+
+// NewServer starts a new server. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{
+		apiKeys: map[string]bool{},
+		tokens:  map[string]time.Time{},
+		buckets: map[string]*BucketConfig{},
+		faults:  map[Operation][]*fault{},
+		counts:  map[Operation]int{},
+		now:     time.Now,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// IAMEndpoint returns the IAM token URL of the server
+func (s *Server) IAMEndpoint() string {
+	return s.URL + iamTokenPath
+}
+
+// ConfigEndpoint returns the Resource Configuration URL of the server
+func (s *Server) ConfigEndpoint() string {
+	return s.URL + "/v1"
+}
+
+// AddAPIKey registers an API key that can be exchanged for tokens. When no
+// key is registered every non-empty key is accepted.
+func (s *Server) AddAPIKey(apiKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKeys[apiKey] = true
+}
+
+// AddBucket registers a bucket with an initial configuration
+func (s *Server) AddBucket(cfg BucketConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := cfg
+	s.buckets[cfg.Name] = &c
+}
+
+// SetUsage sets the usage reported for a bucket
+func (s *Server) SetUsage(name string, objectCount, bytesUsed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.bucket(name)
+	if c == nil {
+		return
+	}
+	c.ObjectCount = objectCount
+	c.BytesUsed = bytesUsed
+}
+
+// Bucket returns a copy of the stored configuration of a bucket
+func (s *Server) Bucket(name string) (BucketConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.bucket(name)
+	if c == nil {
+		return BucketConfig{}, false
+	}
+	out := *c
+	if c.Firewall != nil {
+		fw := *c.Firewall
+		out.Firewall = &fw
+	}
+	return out, true
+}
+
+// InjectFault makes the next times requests for op fail with f. A negative
+// times fails every request.
+func (s *Server) InjectFault(op Operation, f Fault, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[op] = append(s.faults[op], &fault{Fault: f, remaining: times})
+}
+
+// Count returns how many requests for op were received
+func (s *Server) Count(op Operation) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[op]
+}
+
+// ExpireTokens invalidates every token issued so far
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]time.Time{}
+}
+
+// bucket returns the stored config, creating it if BucketExists knows the bucket
+func (s *Server) bucket(name string) *BucketConfig {
+	if c, ok := s.buckets[name]; ok {
+		return c
+	}
+	if s.BucketExists != nil && s.BucketExists(name) {
+		now := s.now().UTC().Format(time.RFC3339)
+		c := &BucketConfig{
+			Name:        name,
+			Crn:         "crn:v1:bluemix:public:cloud-object-storage:global:a/fake::bucket:" + name,
+			TimeCreated: now,
+			TimeUpdated: now,
+		}
+		s.buckets[name] = c
+		return c
+	}
+	return nil
+}
+
+func (s *Server) takeFault(op Operation) *Fault {
+	for _, f := range s.faults[op] {
+		if f.remaining == 0 {
+			continue
+		}
+		if f.remaining > 0 {
+			f.remaining--
+		}
+		out := f.Fault
+		return &out
+	}
+	return nil
+}
+
+func randomToken() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.URL.Path == iamTokenPath:
+		s.counts[OpGetToken]++
+		if f := s.takeFault(OpGetToken); f != nil {
+			writeIAMError(w, f.Status, f.Code, f.Message)
+			return
+		}
+		s.getToken(w, r)
+	case strings.HasPrefix(r.URL.Path, configPathPrefix):
+		name := strings.TrimPrefix(r.URL.Path, configPathPrefix)
+		var op Operation
+		switch r.Method {
+		case http.MethodGet:
+			op = OpGetBucketConfig
+		case http.MethodPatch:
+			op = OpUpdateBucketConfig
+		default:
+			writeConfigError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+			return
+		}
+		s.counts[op]++
+		if f := s.takeFault(op); f != nil {
+			writeConfigError(w, f.Status, f.Code, f.Message)
+			return
+		}
+		if !s.authorized(r) {
+			writeConfigError(w, http.StatusUnauthorized, "unauthorized", "The token provided is not valid or has expired.")
+			return
+		}
+		c := s.bucket(name)
+		if c == nil {
+			writeConfigError(w, http.StatusNotFound, "not_found", fmt.Sprintf("The bucket %s does not exist.", name))
+			return
+		}
+		if op == OpGetBucketConfig {
+			w.Header().Set("ETag", fmt.Sprintf("%q", c.TimeUpdated))
+			writeJSON(w, http.StatusOK, c)
+			return
+		}
+		s.updateBucketConfig(w, r, c)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) getToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeIAMError(w, http.StatusMethodNotAllowed, "BXNIM0101E", "Method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeIAMError(w, http.StatusBadRequest, "BXNIM0109E", "Malformed request body")
+		return
+	}
+	if r.PostForm.Get("grant_type") != apiKeyGrantType {
+		writeIAMError(w, http.StatusBadRequest, "BXNIM0103E", "Unsupported grant type "+r.PostForm.Get("grant_type"))
+		return
+	}
+	apiKey := r.PostForm.Get("apikey")
+	if apiKey == "" {
+		writeIAMError(w, http.StatusBadRequest, "BXNIM0415E", "Provided API key could not be found.")
+		return
+	}
+	if len(s.apiKeys) > 0 && !s.apiKeys[apiKey] {
+		writeIAMError(w, http.StatusBadRequest, "BXNIM0415E", "Provided API key could not be found.")
+		return
+	}
+
+	now := s.now()
+	token := randomToken()
+	s.tokens[token] = now.Add(tokenTTLSeconds * time.Second)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  token,
+		"refresh_token": "not_supported",
+		"token_type":    "Bearer",
+		"expires_in":    tokenTTLSeconds,
+		"expiration":    now.Unix() + tokenTTLSeconds,
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	expires, ok := s.tokens[token]
+	return ok && s.now().Before(expires)
+}
+
+func (s *Server) updateBucketConfig(w http.ResponseWriter, r *http.Request, c *BucketConfig) {
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/merge-patch+json") {
+		writeConfigError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/merge-patch+json")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeConfigError(w, http.StatusBadRequest, "bad_request", "Cannot read request body")
+		return
+	}
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil {
+		writeConfigError(w, http.StatusBadRequest, "bad_request", "The request body is not valid JSON.")
+		return
+	}
+
+	updated := *c
+	for field, raw := range patch {
+		switch field {
+		case "firewall":
+			var fw Firewall
+			if err := json.Unmarshal(raw, &fw); err != nil {
+				writeConfigError(w, http.StatusBadRequest, "bad_request", "Invalid firewall: "+err.Error())
+				return
+			}
+			if msg := validateFirewall(&fw); msg != "" {
+				writeConfigError(w, http.StatusBadRequest, "bad_request", msg)
+				return
+			}
+			updated.Firewall = &fw
+		case "hard_quota":
+			var quota int64
+			if err := json.Unmarshal(raw, &quota); err != nil || quota < 0 {
+				writeConfigError(w, http.StatusBadRequest, "bad_request", "hard_quota must be a non-negative integer")
+				return
+			}
+			if quota > 0 && quota < updated.BytesUsed {
+				writeConfigError(w, http.StatusBadRequest, "bad_request", "hard_quota cannot be lower than the bytes already used by the bucket")
+				return
+			}
+			updated.HardQuota = quota
+		case "activity_tracking", "metrics_monitoring":
+			// accepted but not modelled
+		default:
+			writeConfigError(w, http.StatusBadRequest, "bad_request", "Unknown field "+field)
+			return
+		}
+	}
+	updated.TimeUpdated = s.now().UTC().Format(time.RFC3339Nano)
+	*c = updated
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validIP(v string) bool {
+	if strings.Contains(v, "/") {
+		_, _, err := net.ParseCIDR(v)
+		return err == nil
+	}
+	return net.ParseIP(v) != nil
+}
+
+func validateFirewall(fw *Firewall) string {
+	if len(fw.AllowedIP) > maxAllowedIPs {
+		return fmt.Sprintf("allowed_ip cannot have more than %d entries", maxAllowedIPs)
+	}
+	for _, ip := range append(append([]string{}, fw.AllowedIP...), fw.DeniedIP...) {
+		if !validIP(ip) {
+			return fmt.Sprintf("%q is not a valid IP address or CIDR block", ip)
+		}
+	}
+	for _, nt := range fw.AllowedNetworkType {
+		if nt != "public" && nt != "private" && nt != "direct" {
+			return fmt.Sprintf("%q is not a valid network type", nt)
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeIAMError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"errorCode":    code,
+		"errorMessage": message,
+		"context":      map[string]string{"requestId": randomToken()},
+	})
+}
+
+func writeConfigError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"errors":      []map[string]string{{"code": code, "message": message}},
+		"trace":       randomToken(),
+		"status_code": status,
+	})
+}
@@ -0,0 +1,1314 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+// Package fake_s3 provides an in-memory, S3-compatible HTTP server that the
+// COS SDK can target in tests. It understands path style requests only, which
+// is what COSSessionFactory sends.
+package fake_s3
+
+import (
+	"crypto/md5" // #nosec G501 -- ETags are MD5 digests in S3
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operation names an S3 API call handled by the server
+type Operation string
+
+const (
+	OpHeadBucket          Operation = "HeadBucket"
+	OpCreateBucket        Operation = "CreateBucket"
+	OpDeleteBucket        Operation = "DeleteBucket"
+	OpListObjects         Operation = "ListObjects"
+	OpListObjectsV2       Operation = "ListObjectsV2"
+	OpListObjectVersions  Operation = "ListObjectVersions"
+	OpGetBucketVersioning Operation = "GetBucketVersioning"
+	OpPutBucketVersioning Operation = "PutBucketVersioning"
+	OpGetBucketTagging    Operation = "GetBucketTagging"
+	OpPutBucketTagging    Operation = "PutBucketTagging"
+	OpPutObject           Operation = "PutObject"
+	OpGetObjectTagging    Operation = "GetObjectTagging"
+	OpCopyObject          Operation = "CopyObject"
+	OpGetObject           Operation = "GetObject"
+	OpHeadObject          Operation = "HeadObject"
+	OpDeleteObject        Operation = "DeleteObject"
+	OpDeleteObjects       Operation = "DeleteObjects"
+	OpCreateMultipart     Operation = "CreateMultipartUpload"
+	OpUploadPartCopy      Operation = "UploadPartCopy"
+	OpCompleteMultipart   Operation = "CompleteMultipartUpload"
+	OpAbortMultipart      Operation = "AbortMultipartUpload"
+	OpUnknown             Operation = "Unknown"
+
+	// DefaultMaxKeys is the page size used by list calls when the client asks for more
+	DefaultMaxKeys = 1000
+	// MaxDeleteObjects is the most keys a DeleteObjects request accepts
+	MaxDeleteObjects = 1000
+	// DefaultMaxCopySize is the largest source of a CopyObject, larger objects
+	// are copied with multipart uploads
+	DefaultMaxCopySize = 5 << 30
+
+	s3Namespace       = "http://s3.amazonaws.com/doc/2006-03-01/"
+	nullVersionID     = "null"
+	versionEnabled    = "Enabled"
+	versionSuspend    = "Suspended"
+	kpCrnHeader       = "ibm-sse-kp-customer-root-key-crn"
+	kpAlgHeader       = "ibm-sse-kp-encryption-algorithm"
+	kpEnabledHeader   = "ibm-sse-kp-enabled"
+	copySrcHeader     = "x-amz-copy-source"
+	copyRangeHeader   = "x-amz-copy-source-range"
+	taggingHeader     = "x-amz-tagging"
+	ifNoneMatchHeader = "If-None-Match"
+	maxBucketTags     = 50
+)
+
+// Fault is an S3 error returned instead of handling a request
+type Fault struct {
+	Code    string
+	Status  int
+	Message string
+	// Applied handles the request before the fault is returned, as when the
+	// response of a request that succeeded is lost
+	Applied bool
+}
+
+// Commonly injected faults
+var (
+	FaultNoSuchBucket            = Fault{Code: "NoSuchBucket", Status: http.StatusNotFound, Message: "The specified bucket does not exist."}
+	FaultBucketAlreadyOwnedByYou = Fault{Code: "BucketAlreadyOwnedByYou", Status: http.StatusConflict, Message: "The bucket already exists and is owned by you."}
+	FaultBucketAlreadyExists     = Fault{Code: "BucketAlreadyExists", Status: http.StatusConflict, Message: "The requested bucket name is not available."}
+	FaultAccessDenied            = Fault{Code: "AccessDenied", Status: http.StatusForbidden, Message: "Access Denied"}
+	FaultInvalidAccessKeyID      = Fault{Code: "InvalidAccessKeyId", Status: http.StatusForbidden, Message: "The AWS Access Key Id you provided does not exist in our records."}
+	FaultSlowDown                = Fault{Code: "SlowDown", Status: http.StatusServiceUnavailable, Message: "Please reduce your request rate."}
+	FaultInternalError           = Fault{Code: "InternalError", Status: http.StatusInternalServerError, Message: "We encountered an internal error. Please try again."}
+	FaultQuotaExceeded           = Fault{Code: "QuotaExceeded", Status: http.StatusForbidden, Message: "The bucket has reached its hard quota."}
+)
+
+// Request is a record of a request received by the server
+type Request struct {
+	Op     Operation
+	Method string
+	Bucket string
+	Key    string
+	Query  string
+	Header http.Header
+}
+
+// Object is a snapshot of one version of an object
+type Object struct {
+	Key          string
+	VersionID    string
+	Data         []byte
+	ETag         string
+	LastModified time.Time
+	DeleteMarker bool
+	// Tags are the object tags, by key
+	Tags map[string]string
+}
+
+// Bucket is a snapshot of a bucket held by the server
+type Bucket struct {
+	Name               string
+	LocationConstraint string
+	Versioning         string
+	KPRootKeyCrn       string
+	KPAlgorithm        string
+	Created            time.Time
+	// Tags are the bucket tags, by key
+	Tags map[string]string
+}
+
+type bucket struct {
+	Bucket
+	versions map[string][]*Object // oldest first
+}
+
+// upload is a multipart upload in progress
+type upload struct {
+	bucket, key string
+	parts       map[int][]byte
+}
+
+type fault struct {
+	Fault
+	remaining int
+}
+
+// Server is an in-memory S3-compatible server backed by httptest
+type Server struct {
+	*httptest.Server
+
+	// MaxKeys caps the page size of list calls, DefaultMaxKeys if zero
+	MaxKeys int
+	// AccessKey, when set, is the only HMAC access key accepted
+	AccessKey string
+	// MaxCopySize caps the source size of CopyObject, DefaultMaxCopySize if zero
+	MaxCopySize int
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	foreign  map[string]bool
+	faults   map[Operation][]*fault
+	uploads  map[string]*upload
+	requests []Request
+	now      func() time.Time
+}
+
+// NewServer starts a new server. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{
+		buckets: map[string]*bucket{},
+		foreign: map[string]bool{},
+		faults:  map[Operation][]*fault{},
+		uploads: map[string]*upload{},
+		now:     time.Now,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// SetClock sets the clock stamping the objects and buckets, time.Now by default
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// InjectFault makes the next times requests for op fail with f. A negative
+// times fails every request until ClearFaults is called.
+func (s *Server) InjectFault(op Operation, f Fault, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[op] = append(s.faults[op], &fault{Fault: f, remaining: times})
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = map[Operation][]*fault{}
+}
+
+// AddForeignBucket registers a bucket name owned by another account
+func (s *Server) AddForeignBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.foreign[name] = true
+}
+
+// PutObject stores an object directly, bypassing the HTTP API
+func (s *Server) PutObject(bucketName, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return fmt.Errorf("bucket %s does not exist", bucketName)
+	}
+	s.putObject(b, key, data)
+	return nil
+}
+
+// DeleteObject deletes an object directly, bypassing the HTTP API
+func (s *Server) DeleteObject(bucketName, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return fmt.Errorf("bucket %s does not exist", bucketName)
+	}
+	s.removeObject(b, key)
+	return nil
+}
+
+// SetBucketTags replaces the tags of a bucket, as done out of band by the bucket owner
+func (s *Server) SetBucketTags(bucketName string, tags map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.buckets[bucketName]; ok {
+		b.Tags = tags
+	}
+}
+
+// Bucket returns a snapshot of a bucket
+func (s *Server) Bucket(name string) (Bucket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return Bucket{}, false
+	}
+	snapshot := b.Bucket
+	if b.Tags != nil {
+		snapshot.Tags = make(map[string]string, len(b.Tags))
+		for k, v := range b.Tags {
+			snapshot.Tags[k] = v
+		}
+	}
+	return snapshot, true
+}
+
+// Objects returns the current (non deleted) object keys of a bucket, sorted
+func (s *Server) Objects(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for key := range b.versions {
+		if cur := b.current(key); cur != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Versions returns every version and delete marker of a key, oldest first
+func (s *Server) Versions(name, key string) []Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return nil
+	}
+	var out []Object
+	for _, v := range b.versions[key] {
+		out = append(out, *v)
+	}
+	return out
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Count returns how many requests for op were received
+func (s *Server) Count(op Operation) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if r.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+func (b *bucket) current(key string) *Object {
+	vs := b.versions[key]
+	if len(vs) == 0 || vs[len(vs)-1].DeleteMarker {
+		return nil
+	}
+	return vs[len(vs)-1]
+}
+
+func (b *bucket) find(key, versionID string) (*Object, int) {
+	for i, v := range b.versions[key] {
+		if v.VersionID == versionID {
+			return v, i
+		}
+	}
+	return nil, -1
+}
+
+func (b *bucket) empty() bool {
+	for _, vs := range b.versions {
+		if len(vs) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func newVersionID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// nextVersionID returns the id for a new version and drops the "null"
+// version it replaces when versioning is not enabled.
+func (b *bucket) nextVersionID(key string) string {
+	if b.Versioning == versionEnabled {
+		return newVersionID()
+	}
+	if _, i := b.find(key, nullVersionID); i >= 0 {
+		b.versions[key] = append(b.versions[key][:i], b.versions[key][i+1:]...)
+	}
+	return nullVersionID
+}
+
+func (s *Server) putObject(b *bucket, key string, data []byte) *Object {
+	sum := md5.Sum(data) // #nosec G401 -- ETags are MD5 digests in S3
+	obj := &Object{
+		Key:          key,
+		VersionID:    b.nextVersionID(key),
+		Data:         append([]byte(nil), data...),
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: s.now().UTC(),
+	}
+	b.versions[key] = append(b.versions[key], obj)
+	return obj
+}
+
+func classify(r *http.Request, bucketName, key string) Operation {
+	q := r.URL.Query()
+	if bucketName == "" {
+		return OpUnknown
+	}
+	if key == "" {
+		_, versioning := q["versioning"]
+		_, versions := q["versions"]
+		_, tagging := q["tagging"]
+		switch {
+		case r.Method == http.MethodHead:
+			return OpHeadBucket
+		case r.Method == http.MethodPut && versioning:
+			return OpPutBucketVersioning
+		case r.Method == http.MethodPut && tagging:
+			return OpPutBucketTagging
+		case r.Method == http.MethodPut:
+			return OpCreateBucket
+		case r.Method == http.MethodDelete:
+			return OpDeleteBucket
+		case r.Method == http.MethodPost && q.Has("delete"):
+			return OpDeleteObjects
+		case r.Method == http.MethodGet && versioning:
+			return OpGetBucketVersioning
+		case r.Method == http.MethodGet && tagging:
+			return OpGetBucketTagging
+		case r.Method == http.MethodGet && versions:
+			return OpListObjectVersions
+		case r.Method == http.MethodGet && q.Get("list-type") == "2":
+			return OpListObjectsV2
+		case r.Method == http.MethodGet:
+			return OpListObjects
+		}
+		return OpUnknown
+	}
+	_, uploadID := q["uploadId"]
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		return OpCreateMultipart
+	case r.Method == http.MethodPut && uploadID && r.Header.Get(copySrcHeader) != "":
+		return OpUploadPartCopy
+	case r.Method == http.MethodPost && uploadID:
+		return OpCompleteMultipart
+	case r.Method == http.MethodDelete && uploadID:
+		return OpAbortMultipart
+	case uploadID:
+		return OpUnknown
+	case r.Method == http.MethodGet && q.Has("tagging"):
+		return OpGetObjectTagging
+	case q.Has("tagging"):
+		return OpUnknown
+	}
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get(copySrcHeader) != "" {
+			return OpCopyObject
+		}
+		return OpPutObject
+	case http.MethodGet:
+		return OpGetObject
+	case http.MethodHead:
+		return OpHeadObject
+	case http.MethodDelete:
+		return OpDeleteObject
+	}
+	return OpUnknown
+}
+
+func splitPath(p string) (string, string) {
+	p = strings.TrimPrefix(p, "/")
+	parts := strings.SplitN(p, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func (s *Server) takeFault(op Operation) *Fault {
+	for _, f := range s.faults[op] {
+		if f.remaining == 0 {
+			continue
+		}
+		if f.remaining > 0 {
+			f.remaining--
+		}
+		out := f.Fault
+		return &out
+	}
+	return nil
+}
+
+func (s *Server) authorize(r *http.Request) *Fault {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return &FaultAccessDenied
+	}
+	if s.AccessKey != "" && !strings.HasPrefix(auth, "Bearer ") &&
+		!strings.Contains(auth, "Credential="+s.AccessKey+"/") {
+		return &FaultInvalidAccessKeyID
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	bucketName, key := splitPath(r.URL.Path)
+	op := classify(r, bucketName, key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, Request{
+		Op:     op,
+		Method: r.Method,
+		Bucket: bucketName,
+		Key:    key,
+		Query:  r.URL.RawQuery,
+		Header: r.Header.Clone(),
+	})
+
+	if f := s.takeFault(op); f != nil {
+		if f.Applied {
+			s.handle(httptest.NewRecorder(), r, op, bucketName, key)
+		}
+		writeError(w, r, *f)
+		return
+	}
+	s.handle(w, r, op, bucketName, key)
+}
+
+// handle serves an authorized request, s.mu is held
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, op Operation, bucketName, key string) {
+	if f := s.authorize(r); f != nil {
+		writeError(w, r, *f)
+		return
+	}
+	if op == OpUnknown {
+		writeError(w, r, Fault{Code: "NotImplemented", Status: http.StatusNotImplemented, Message: "Not implemented"})
+		return
+	}
+	if op == OpCreateBucket {
+		s.createBucket(w, r, bucketName)
+		return
+	}
+
+	if s.foreign[bucketName] {
+		writeError(w, r, FaultAccessDenied)
+		return
+	}
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, r, FaultNoSuchBucket)
+		return
+	}
+
+	switch op {
+	case OpHeadBucket:
+		if b.KPRootKeyCrn != "" {
+			w.Header().Set(kpEnabledHeader, "true")
+			w.Header().Set(kpCrnHeader, b.KPRootKeyCrn)
+		}
+		w.WriteHeader(http.StatusOK)
+	case OpDeleteBucket:
+		if !b.empty() {
+			writeError(w, r, Fault{Code: "BucketNotEmpty", Status: http.StatusConflict, Message: "The bucket you tried to delete is not empty."})
+			return
+		}
+		delete(s.buckets, bucketName)
+		w.WriteHeader(http.StatusNoContent)
+	case OpGetBucketVersioning:
+		writeXML(w, http.StatusOK, versioningConfiguration{Xmlns: s3Namespace, Status: b.Versioning})
+	case OpPutBucketVersioning:
+		s.putBucketVersioning(w, r, b)
+	case OpGetBucketTagging:
+		s.getBucketTagging(w, r, b)
+	case OpPutBucketTagging:
+		s.putBucketTagging(w, r, b)
+	case OpListObjects:
+		s.listObjects(w, r, b, false)
+	case OpListObjectsV2:
+		s.listObjects(w, r, b, true)
+	case OpListObjectVersions:
+		s.listObjectVersions(w, r, b)
+	case OpPutObject:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, FaultInternalError)
+			return
+		}
+		if r.Header.Get(ifNoneMatchHeader) == "*" && b.current(key) != nil {
+			writeError(w, r, Fault{Code: "PreconditionFailed", Status: http.StatusPreconditionFailed, Message: "At least one of the pre-conditions you specified did not hold"})
+			return
+		}
+		tags, err := url.ParseQuery(r.Header.Get(taggingHeader))
+		if err != nil {
+			writeError(w, r, Fault{Code: "InvalidArgument", Status: http.StatusBadRequest, Message: "Invalid tagging header"})
+			return
+		}
+		obj := s.putObject(b, key, data)
+		for k := range tags {
+			if obj.Tags == nil {
+				obj.Tags = map[string]string{}
+			}
+			obj.Tags[k] = tags.Get(k)
+		}
+		w.Header().Set("ETag", obj.ETag)
+		if b.Versioning != "" {
+			w.Header().Set("x-amz-version-id", obj.VersionID)
+		}
+		w.WriteHeader(http.StatusOK)
+	case OpCopyObject:
+		s.copyObject(w, r, b, key)
+	case OpGetObject, OpHeadObject:
+		s.getObject(w, r, b, key, op == OpHeadObject)
+	case OpGetObjectTagging:
+		s.getObjectTagging(w, r, b, key)
+	case OpDeleteObject:
+		s.deleteObject(w, r, b, key)
+	case OpDeleteObjects:
+		s.deleteObjects(w, r, b)
+	case OpCreateMultipart:
+		id := newVersionID()
+		s.uploads[id] = &upload{bucket: b.Name, key: key, parts: map[int][]byte{}}
+		writeXML(w, http.StatusOK, initiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: b.Name, Key: key, UploadID: id})
+	case OpUploadPartCopy:
+		s.uploadPartCopy(w, r, b, key)
+	case OpCompleteMultipart:
+		s.completeMultipart(w, r, b, key)
+	case OpAbortMultipart:
+		delete(s.uploads, r.URL.Query().Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) createBucket(w http.ResponseWriter, r *http.Request, name string) {
+	if s.foreign[name] {
+		writeError(w, r, FaultBucketAlreadyExists)
+		return
+	}
+	if _, ok := s.buckets[name]; ok {
+		writeError(w, r, FaultBucketAlreadyOwnedByYou)
+		return
+	}
+	if len(name) < 3 || len(name) > 63 || strings.ToLower(name) != name {
+		writeError(w, r, Fault{Code: "InvalidBucketName", Status: http.StatusBadRequest, Message: "The specified bucket is not valid."})
+		return
+	}
+
+	var cfg createBucketConfiguration
+	if body, _ := io.ReadAll(r.Body); len(body) > 0 {
+		if err := xml.Unmarshal(body, &cfg); err != nil {
+			writeError(w, r, Fault{Code: "MalformedXML", Status: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+	}
+
+	crn := r.Header.Get(kpCrnHeader)
+	alg := r.Header.Get(kpAlgHeader)
+	if crn != "" && alg == "" {
+		writeError(w, r, Fault{Code: "InvalidArgument", Status: http.StatusBadRequest, Message: "Missing " + kpAlgHeader})
+		return
+	}
+
+	s.buckets[name] = &bucket{
+		Bucket: Bucket{
+			Name:               name,
+			LocationConstraint: cfg.LocationConstraint,
+			KPRootKeyCrn:       crn,
+			KPAlgorithm:        alg,
+			Created:            s.now().UTC(),
+		},
+		versions: map[string][]*Object{},
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) putBucketVersioning(w http.ResponseWriter, r *http.Request, b *bucket) {
+	var cfg versioningConfiguration
+	body, _ := io.ReadAll(r.Body)
+	if err := xml.Unmarshal(body, &cfg); err != nil {
+		writeError(w, r, Fault{Code: "MalformedXML", Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	if cfg.Status != versionEnabled && cfg.Status != versionSuspend {
+		writeError(w, r, Fault{Code: "IllegalVersioningConfigurationException", Status: http.StatusBadRequest, Message: "Invalid versioning status " + cfg.Status})
+		return
+	}
+	b.Versioning = cfg.Status
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getBucketTagging(w http.ResponseWriter, r *http.Request, b *bucket) {
+	if len(b.Tags) == 0 {
+		writeError(w, r, Fault{Code: "NoSuchTagSet", Status: http.StatusNotFound, Message: "The TagSet does not exist."})
+		return
+	}
+	keys := make([]string, 0, len(b.Tags))
+	for k := range b.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	t := tagging{Xmlns: s3Namespace}
+	for _, k := range keys {
+		t.TagSet = append(t.TagSet, tag{Key: k, Value: b.Tags[k]})
+	}
+	writeXML(w, http.StatusOK, t)
+}
+
+func (s *Server) putBucketTagging(w http.ResponseWriter, r *http.Request, b *bucket) {
+	if r.Header.Get("Content-MD5") == "" {
+		writeError(w, r, Fault{Code: "InvalidRequest", Status: http.StatusBadRequest, Message: "Missing required header for this request: Content-MD5"})
+		return
+	}
+	var t tagging
+	body, _ := io.ReadAll(r.Body)
+	if err := xml.Unmarshal(body, &t); err != nil {
+		writeError(w, r, Fault{Code: "MalformedXML", Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	if len(t.TagSet) > maxBucketTags {
+		writeError(w, r, Fault{Code: "InvalidTag", Status: http.StatusBadRequest, Message: "Bucket tag count cannot be greater than 50"})
+		return
+	}
+	tags := make(map[string]string, len(t.TagSet))
+	for _, tag := range t.TagSet {
+		if _, ok := tags[tag.Key]; ok || tag.Key == "" {
+			writeError(w, r, Fault{Code: "InvalidTag", Status: http.StatusBadRequest, Message: "Invalid tag key " + tag.Key})
+			return
+		}
+		tags[tag.Key] = tag.Value
+	}
+	b.Tags = tags
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) maxKeys(r *http.Request) int {
+	limit := s.MaxKeys
+	if limit <= 0 {
+		limit = DefaultMaxKeys
+	}
+	if v := r.URL.Query().Get("max-keys"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < limit {
+			return n
+		}
+	}
+	return limit
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, b *bucket, v2 bool) {
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	delimiter := q.Get("delimiter")
+	marker := q.Get("marker")
+	if v2 {
+		marker = q.Get("start-after")
+		if token := q.Get("continuation-token"); token != "" {
+			marker = token
+		}
+	}
+	limit := s.maxKeys(r)
+
+	var keys []string
+	for key := range b.versions {
+		if strings.HasPrefix(key, prefix) && key > marker && b.current(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	res := listBucketResult{
+		Xmlns:     s3Namespace,
+		Name:      b.Name,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   limit,
+	}
+	seen := map[string]bool{}
+	last := ""
+	count := 0
+	for _, key := range keys {
+		if count == limit {
+			res.IsTruncated = true
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				cp := key[:len(prefix)+i+len(delimiter)]
+				if !seen[cp] {
+					seen[cp] = true
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: cp})
+					count++
+				}
+				last = key
+				continue
+			}
+		}
+		obj := b.current(key)
+		res.Contents = append(res.Contents, listEntry{
+			Key:          key,
+			LastModified: obj.LastModified.Format(time.RFC3339),
+			ETag:         obj.ETag,
+			Size:         len(obj.Data),
+			StorageClass: "STANDARD",
+		})
+		last = key
+		count++
+	}
+
+	if v2 {
+		res.KeyCount = count
+		res.StartAfter = q.Get("start-after")
+		res.ContinuationToken = q.Get("continuation-token")
+		if res.IsTruncated {
+			res.NextContinuationToken = last
+		}
+	} else {
+		res.Marker = marker
+		if res.IsTruncated && delimiter != "" {
+			res.NextMarker = last
+		}
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func (s *Server) listObjectVersions(w http.ResponseWriter, r *http.Request, b *bucket) {
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	keyMarker := q.Get("key-marker")
+	versionMarker := q.Get("version-id-marker")
+	limit := s.maxKeys(r)
+
+	var keys []string
+	for key, vs := range b.versions {
+		if strings.HasPrefix(key, prefix) && len(vs) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// flatten to key order, newest version first, as S3 does
+	type entry struct {
+		obj    *Object
+		latest bool
+	}
+	var entries []entry
+	for _, key := range keys {
+		vs := b.versions[key]
+		for i := len(vs) - 1; i >= 0; i-- {
+			entries = append(entries, entry{obj: vs[i], latest: i == len(vs)-1})
+		}
+	}
+
+	start := 0
+	if keyMarker != "" {
+		start = len(entries)
+		for i, e := range entries {
+			if e.obj.Key > keyMarker {
+				start = i
+				break
+			}
+			if versionMarker != "" && e.obj.Key == keyMarker && e.obj.VersionID == versionMarker {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	res := listVersionsResult{
+		Xmlns:           s3Namespace,
+		Name:            b.Name,
+		Prefix:          prefix,
+		KeyMarker:       keyMarker,
+		VersionIDMarker: versionMarker,
+		MaxKeys:         limit,
+	}
+	end := start + limit
+	if end < len(entries) {
+		res.IsTruncated = true
+		res.NextKeyMarker = entries[end-1].obj.Key
+		res.NextVersionIDMarker = entries[end-1].obj.VersionID
+	} else {
+		end = len(entries)
+	}
+	for _, e := range entries[start:end] {
+		v := e.obj
+		if v.DeleteMarker {
+			res.DeleteMarkers = append(res.DeleteMarkers, deleteMarkerEntry{
+				Key:          v.Key,
+				VersionID:    v.VersionID,
+				IsLatest:     e.latest,
+				LastModified: v.LastModified.Format(time.RFC3339),
+			})
+		} else {
+			res.Versions = append(res.Versions, versionEntry{
+				Key:          v.Key,
+				VersionID:    v.VersionID,
+				IsLatest:     e.latest,
+				LastModified: v.LastModified.Format(time.RFC3339),
+				ETag:         v.ETag,
+				Size:         len(v.Data),
+				StorageClass: "STANDARD",
+			})
+		}
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, b *bucket, key string, head bool) {
+	var obj *Object
+	if versionID := r.URL.Query().Get("versionId"); versionID != "" {
+		obj, _ = b.find(key, versionID)
+	} else {
+		obj = b.current(key)
+	}
+	if obj == nil || obj.DeleteMarker {
+		if head {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeError(w, r, Fault{Code: "NoSuchKey", Status: http.StatusNotFound, Message: "The specified key does not exist."})
+		return
+	}
+	w.Header().Set("ETag", obj.ETag)
+	w.Header().Set("Last-Modified", obj.LastModified.Format(http.TimeFormat))
+	w.Header().Set("Content-Length", strconv.Itoa(len(obj.Data)))
+	if b.Versioning != "" {
+		w.Header().Set("x-amz-version-id", obj.VersionID)
+	}
+	w.WriteHeader(http.StatusOK)
+	if !head {
+		_, _ = w.Write(obj.Data)
+	}
+}
+
+func (s *Server) getObjectTagging(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj := b.current(key)
+	if obj == nil || obj.DeleteMarker {
+		writeError(w, r, Fault{Code: "NoSuchKey", Status: http.StatusNotFound, Message: "The specified key does not exist."})
+		return
+	}
+	keys := make([]string, 0, len(obj.Tags))
+	for k := range obj.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	t := tagging{Xmlns: s3Namespace}
+	for _, k := range keys {
+		t.TagSet = append(t.TagSet, tag{Key: k, Value: obj.Tags[k]})
+	}
+	writeXML(w, http.StatusOK, t)
+}
+
+// copySource returns the object version named by the copy source header of r
+func (s *Server) copySource(r *http.Request) (*Object, *Fault) {
+	source, query, _ := strings.Cut(r.Header.Get(copySrcHeader), "?")
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		return nil, &Fault{Code: "InvalidArgument", Status: http.StatusBadRequest, Message: "Invalid copy source"}
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, &Fault{Code: "InvalidArgument", Status: http.StatusBadRequest, Message: "Invalid copy source"}
+	}
+	srcBucketName, srcKey := splitPath(source)
+	src, ok := s.buckets[srcBucketName]
+	if !ok || s.foreign[srcBucketName] {
+		return nil, &FaultNoSuchBucket
+	}
+	var obj *Object
+	if versionID := params.Get("versionId"); versionID != "" {
+		obj, _ = src.find(srcKey, versionID)
+	} else {
+		obj = src.current(srcKey)
+	}
+	if obj == nil || obj.DeleteMarker {
+		return nil, &Fault{Code: "NoSuchKey", Status: http.StatusNotFound, Message: "The specified key does not exist."}
+	}
+	return obj, nil
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj, f := s.copySource(r)
+	if f != nil {
+		writeError(w, r, *f)
+		return
+	}
+	maxCopySize := s.MaxCopySize
+	if maxCopySize <= 0 {
+		maxCopySize = DefaultMaxCopySize
+	}
+	if len(obj.Data) > maxCopySize {
+		writeError(w, r, Fault{Code: "InvalidRequest", Status: http.StatusBadRequest, Message: "The specified copy source is larger than the maximum allowable size for a copy source: " + strconv.Itoa(maxCopySize)})
+		return
+	}
+
+	copied := s.putObject(b, key, obj.Data)
+	copied.Tags = obj.Tags
+	if b.Versioning != "" {
+		w.Header().Set("x-amz-version-id", copied.VersionID)
+	}
+	writeXML(w, http.StatusOK, copyObjectResult{
+		ETag:         copied.ETag,
+		LastModified: copied.LastModified.Format(time.RFC3339),
+	})
+}
+
+func (s *Server) uploadPartCopy(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	q := r.URL.Query()
+	u, ok := s.uploads[q.Get("uploadId")]
+	if !ok || u.bucket != b.Name || u.key != key {
+		writeError(w, r, Fault{Code: "NoSuchUpload", Status: http.StatusNotFound, Message: "The specified upload does not exist."})
+		return
+	}
+	part, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || part < 1 || part > 10000 {
+		writeError(w, r, Fault{Code: "InvalidArgument", Status: http.StatusBadRequest, Message: "Part number must be an integer between 1 and 10000"})
+		return
+	}
+	obj, f := s.copySource(r)
+	if f != nil {
+		writeError(w, r, *f)
+		return
+	}
+	data := obj.Data
+	if rng := r.Header.Get(copyRangeHeader); rng != "" {
+		var first, last int
+		if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &first, &last); err != nil || first > last || last >= len(data) {
+			writeError(w, r, Fault{Code: "InvalidArgument", Status: http.StatusBadRequest, Message: "Invalid copy source range " + rng})
+			return
+		}
+		data = data[first : last+1]
+	}
+	u.parts[part] = append([]byte(nil), data...)
+	sum := md5.Sum(data) // #nosec G401 -- ETags are MD5 digests in S3
+	writeXML(w, http.StatusOK, copyPartResult{
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: s.now().UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) completeMultipart(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	id := r.URL.Query().Get("uploadId")
+	u, ok := s.uploads[id]
+	if !ok || u.bucket != b.Name || u.key != key {
+		writeError(w, r, Fault{Code: "NoSuchUpload", Status: http.StatusNotFound, Message: "The specified upload does not exist."})
+		return
+	}
+	var cfg completeMultipartUpload
+	body, _ := io.ReadAll(r.Body)
+	if err := xml.Unmarshal(body, &cfg); err != nil {
+		writeError(w, r, Fault{Code: "MalformedXML", Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	var data []byte
+	for i, p := range cfg.Parts {
+		part, ok := u.parts[p.PartNumber]
+		if !ok || (i > 0 && p.PartNumber <= cfg.Parts[i-1].PartNumber) {
+			writeError(w, r, Fault{Code: "InvalidPart", Status: http.StatusBadRequest, Message: "One or more of the specified parts could not be found."})
+			return
+		}
+		data = append(data, part...)
+	}
+	delete(s.uploads, id)
+
+	obj := s.putObject(b, key, data)
+	if b.Versioning != "" {
+		w.Header().Set("x-amz-version-id", obj.VersionID)
+	}
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{Xmlns: s3Namespace, Bucket: b.Name, Key: key, ETag: obj.ETag})
+}
+
+// Uploads returns the number of multipart uploads neither completed nor aborted
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	if versionID := r.URL.Query().Get("versionId"); versionID != "" {
+		if v := b.removeVersion(key, versionID); v != nil {
+			w.Header().Set("x-amz-version-id", versionID)
+			if v.DeleteMarker {
+				w.Header().Set("x-amz-delete-marker", "true")
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if marker := s.removeObject(b, key); marker != nil {
+		w.Header().Set("x-amz-version-id", marker.VersionID)
+		w.Header().Set("x-amz-delete-marker", "true")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteObjects deletes the objects, or object versions, of a multi-object
+// delete request. Deleting a key that does not exist succeeds, as in S3.
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, b *bucket) {
+	var req deleteRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil || xml.Unmarshal(body, &req) != nil || len(req.Objects) == 0 {
+		writeError(w, r, Fault{Code: "MalformedXML", Status: http.StatusBadRequest, Message: "The XML you provided was not well-formed."})
+		return
+	}
+	if len(req.Objects) > MaxDeleteObjects {
+		writeError(w, r, Fault{Code: "MalformedXML", Status: http.StatusBadRequest, Message: "The request may not contain more than 1000 keys."})
+		return
+	}
+
+	res := deleteResult{Xmlns: s3Namespace}
+	for _, o := range req.Objects {
+		d := deletedEntry{Key: o.Key, VersionID: o.VersionID}
+		if o.VersionID != "" {
+			if v := b.removeVersion(o.Key, o.VersionID); v != nil && v.DeleteMarker {
+				d.DeleteMarker = true
+			}
+		} else if marker := s.removeObject(b, o.Key); marker != nil {
+			d.DeleteMarker = true
+			d.DeleteMarkerVersionID = marker.VersionID
+		}
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, d)
+		}
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+// removeVersion deletes one version of an object and returns it, nil if
+// there is no such version
+func (b *bucket) removeVersion(key, versionID string) *Object {
+	v, i := b.find(key, versionID)
+	if i < 0 {
+		return nil
+	}
+	b.versions[key] = append(b.versions[key][:i], b.versions[key][i+1:]...)
+	if len(b.versions[key]) == 0 {
+		delete(b.versions, key)
+	}
+	return v
+}
+
+// removeObject deletes an object, or hides it behind a delete marker that
+// it returns if the bucket is versioned
+func (s *Server) removeObject(b *bucket, key string) *Object {
+	if b.Versioning == "" {
+		delete(b.versions, key)
+		return nil
+	}
+	if _, ok := b.versions[key]; !ok {
+		return nil
+	}
+	marker := &Object{
+		Key:          key,
+		VersionID:    b.nextVersionID(key),
+		DeleteMarker: true,
+		LastModified: s.now().UTC(),
+	}
+	b.versions[key] = append(b.versions[key], marker)
+	return marker
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, f Fault) {
+	if f.Status == 0 {
+		f.Status = http.StatusInternalServerError
+	}
+	if r.Method == http.MethodHead {
+		// HEAD responses carry no body, the SDK derives the code from the status
+		w.WriteHeader(f.Status)
+		return
+	}
+	writeXML(w, f.Status, errorResponse{
+		Code:      f.Code,
+		Message:   f.Message,
+		Resource:  r.URL.Path,
+		RequestID: newVersionID(),
+	})
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+type copyPartResult struct {
+	XMLName      xml.Name `xml:"CopyPartResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+type createBucketConfiguration struct {
+	XMLName            xml.Name `xml:"CreateBucketConfiguration"`
+	LocationConstraint string   `xml:"LocationConstraint"`
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	TagSet  []tag    `xml:"TagSet>Tag"`
+}
+
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool     `xml:"Quiet"`
+	Objects []struct {
+		Key       string `xml:"Key"`
+		VersionID string `xml:"VersionId"`
+	} `xml:"Object"`
+}
+
+type deletedEntry struct {
+	Key                   string `xml:"Key"`
+	VersionID             string `xml:"VersionId,omitempty"`
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionID string `xml:"DeleteMarkerVersionId,omitempty"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name       `xml:"DeleteResult"`
+	Xmlns   string         `xml:"xmlns,attr"`
+	Deleted []deletedEntry `xml:"Deleted"`
+}
+
+type listEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Marker                string         `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int            `xml:"KeyCount,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []listEntry    `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type versionEntry struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type deleteMarkerEntry struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+}
+
+type listVersionsResult struct {
+	XMLName             xml.Name            `xml:"ListVersionsResult"`
+	Xmlns               string              `xml:"xmlns,attr"`
+	Name                string              `xml:"Name"`
+	Prefix              string              `xml:"Prefix"`
+	KeyMarker           string              `xml:"KeyMarker"`
+	VersionIDMarker     string              `xml:"VersionIdMarker"`
+	NextKeyMarker       string              `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string              `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int                 `xml:"MaxKeys"`
+	IsTruncated         bool                `xml:"IsTruncated"`
+	Versions            []versionEntry      `xml:"Version"`
+	DeleteMarkers       []deleteMarkerEntry `xml:"DeleteMarker"`
+}
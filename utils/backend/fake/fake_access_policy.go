@@ -11,6 +11,7 @@
 package fake
 
 import (
+	"context"
 	"errors"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
 )
@@ -29,6 +30,12 @@ type FakeAccessPolicyFactory struct {
 	FailUpdateQuotaLimitErrMsg string
 	//PassUpdateAccessPolicy ...
 	PassUpdateQuotaLimit bool
+	// BucketUsage is returned by GetBucketUsage, by bucket name
+	BucketUsage map[string]*backend.Usage
+	// GetBucketUsageErr is returned by GetBucketUsage if set
+	GetBucketUsageErr error
+	// UsageReads counts the calls to GetBucketUsage
+	UsageReads int
 }
 
 var _ backend.AccessPolicyFactory = (*FakeAccessPolicyFactory)(nil)
@@ -60,3 +67,19 @@ func (c *fakeAccessPolicy) UpdateQuotaLimit(quota int64, apiKey, bucketName, osE
 	}
 	return nil
 }
+
+// GetBucketUsage method returns the usage set in BucketUsage, an empty usage if unset
+func (c *fakeAccessPolicy) GetBucketUsage(ctx context.Context, apiKey, bucketName, osEndpoint, iamEndpoint string, rcr backend.BucketConfigReader) (*backend.Usage, error) {
+	c.rcv1.UsageReads++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.rcv1.GetBucketUsageErr != nil {
+		return nil, c.rcv1.GetBucketUsageErr
+	}
+	if usage, ok := c.rcv1.BucketUsage[bucketName]; ok {
+		u := *usage
+		return &u, nil
+	}
+	return &backend.Usage{}, nil
+}
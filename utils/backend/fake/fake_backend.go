@@ -2,7 +2,7 @@
  * IBM Confidential
  * OCO Source Materials
  * IBM Cloud Container Service, 5737-D43
- * (C) Copyright IBM Corp. 2017, 2018 All Rights Reserved.
+ * (C) Copyright IBM Corp. 2017, 2025 All Rights Reserved.
  * The source code for this program is not  published or otherwise divested of
  * its trade secrets, irrespective of what has been deposited with
  * the U.S. Copyright Office.
@@ -11,8 +11,12 @@
 package fake
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"time"
 
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
 	"github.com/IBM/ibmcloud-object-storage-plugin/utils/backend"
 	"go.uber.org/zap"
 )
@@ -23,8 +27,12 @@ type ObjectStorageSessionFactory struct {
 	FailCheckBucketAccess bool
 	//FailCreateBucket ...
 	FailCreateBucket bool
-	//FailCreateBucket with specific error msg...
+	//FailCreateBucket with specific error msg, a COS error code is classified like COSSession does
 	FailCreateBucketErrMsg string
+	// CheckBucketAccessErr is returned by CheckBucketAccess if set
+	CheckBucketAccessErr error
+	// DeleteBucketErr is returned by DeleteBucket if set
+	DeleteBucketErr error
 	//FailDeleteBucket ...
 	FailDeleteBucket bool
 	//CheckObjectPathExistenceError ...
@@ -33,6 +41,51 @@ type ObjectStorageSessionFactory struct {
 	CheckObjectPathExistencePathNotFound bool
 	//FailSetBucketVersioning
 	FailSetBucketVersioning bool
+	// FailSetBucketOwner makes SetBucketOwner fail
+	FailSetBucketOwner bool
+	// GetBucketOwnerErr is returned by GetBucketOwner if set
+	GetBucketOwnerErr error
+	// CopyObjectsErr is returned by CopyObjects if set
+	CopyObjectsErr error
+	// VersionedBuckets lists the buckets GetBucketVersioning reports as versioned
+	VersionedBuckets map[string]bool
+	// GetBucketVersioningErr is returned by GetBucketVersioning if set
+	GetBucketVersioningErr error
+	// CopyObjectsAsOfErr is returned by CopyObjectsAsOf if set, once it
+	// copied CopyObjectsAsOfFailAfter objects
+	CopyObjectsAsOfErr       error
+	CopyObjectsAsOfFailAfter int
+	// AsOfKeys are the keys of the objects copied by CopyObjectsAsOf, a
+	// single object if nil
+	AsOfKeys []string
+	// CopyObjectsAsOfBlock, if set, holds CopyObjectsAsOf until it is closed
+	CopyObjectsAsOfBlock chan struct{}
+	// CreateObjectPathErr is returned by CreateObjectPath if set
+	CreateObjectPathErr error
+	// DeleteObjectPathErr is returned by DeleteObjectPath if set
+	DeleteObjectPathErr error
+	// GetBucketEncryptionErr is returned by GetBucketEncryption if set
+	GetBucketEncryptionErr error
+	// BucketEncryption is returned by GetBucketEncryption if set, instead of
+	// the encryption the bucket was created with
+	BucketEncryption *backend.BucketEncryption
+	// GetObjectPathUsageErr is returned by GetObjectPathUsage if set
+	GetObjectPathUsageErr error
+	// ObjectPathUsage is returned by GetObjectPathUsage, an empty usage if nil
+	ObjectPathUsage *backend.Usage
+	// ObjectPathUsageDelay is the time GetObjectPathUsage takes
+	ObjectPathUsageDelay time.Duration
+	// CreateObjectErr is returned by CreateObject if set
+	CreateObjectErr error
+	// WriteObjectErr is returned by WriteObject if set
+	WriteObjectErr error
+
+	// BucketOwners holds the ownership markers of the buckets, by bucket name
+	BucketOwners map[string]*backend.BucketOwner
+	// ObjectPathOwners holds the ownership markers of the object paths, by bucket:objectpath
+	ObjectPathOwners map[string]*backend.BucketOwner
+	// Objects holds the objects written by CreateObject and WriteObject, by bucket/key
+	Objects map[string][]byte
 
 	// LastEndpoint holds the endpoint of the last created session
 	LastEndpoint string
@@ -44,10 +97,39 @@ type ObjectStorageSessionFactory struct {
 	LastCheckedBucket string
 	// LastCreatedBucket stores the name of the last bucket that was created
 	LastCreatedBucket string
+	// LastRootKeyCRN stores the root key CRN of the last bucket that was created
+	LastRootKeyCRN string
 	// LastDeletedBucket stores the name of the last bucket that was deleted
 	LastDeletedBucket string
 	//LastUpdatedBucket
 	LastUpdatedBucket string
+	// LastCopiedPrefix stores the bucket and prefix of the last copy, as bucket/prefix
+	LastCopiedPrefix string
+	// LastCopyDestination stores the bucket and prefix the last copy went to, as bucket/prefix
+	LastCopyDestination string
+	// LastCopyAsOf stores the time of the last point-in-time copy
+	LastCopyAsOf time.Time
+	// LastCopyVersionID stores the version marker of the last point-in-time copy
+	LastCopyVersionID string
+	// LastCopyStartAfter stores the key the last point-in-time copy resumed after
+	LastCopyStartAfter string
+	// CopiedAsOfKeys counts the copies of each key by CopyObjectsAsOf
+	CopiedAsOfKeys map[string]int
+	// LastCreatedObjectPath stores the last object path that was created, as bucket:objectpath
+	LastCreatedObjectPath string
+	// LastDeletedObjectPath stores the last object path that was deleted, as bucket:objectpath
+	LastDeletedObjectPath string
+	// LastMeasuredObjectPath stores the last object path whose usage was read, as bucket:objectpath
+	LastMeasuredObjectPath string
+	// UsageReads counts the calls to GetObjectPathUsage
+	UsageReads int
+	// MaxUsageReadsInFlight is the highest number of concurrent calls to GetObjectPathUsage
+	MaxUsageReadsInFlight int
+
+	// mu guards the records of the sessions measuring usage or copying
+	// objects in the background
+	mu                 sync.Mutex
+	usageReadsInFlight int
 }
 
 type fakeObjectStorageSession struct {
@@ -56,6 +138,8 @@ type fakeObjectStorageSession struct {
 
 // NewObjectStorageSession method creates a new fake object store session
 func (f *ObjectStorageSessionFactory) NewObjectStorageSession(endpoint, region string, creds *backend.ObjectStorageCredentials, logger *zap.Logger) backend.ObjectStorageSession {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.LastEndpoint = endpoint
 	f.LastRegion = region
 	f.LastCredentials = creds
@@ -71,12 +155,29 @@ func (f *ObjectStorageSessionFactory) ResetStats() {
 	f.LastCredentials = &backend.ObjectStorageCredentials{}
 	f.LastCheckedBucket = ""
 	f.LastCreatedBucket = ""
+	f.LastRootKeyCRN = ""
 	f.LastDeletedBucket = ""
 	f.LastUpdatedBucket = ""
+	f.LastCopiedPrefix = ""
+	f.LastCopyDestination = ""
+	f.LastCopyAsOf = time.Time{}
+	f.LastCopyVersionID = ""
+	f.LastCreatedObjectPath = ""
+	f.LastDeletedObjectPath = ""
 }
 
 func (s *fakeObjectStorageSession) CheckBucketAccess(bucket string) error {
+	return s.CheckBucketAccessWithContext(context.Background(), bucket)
+}
+
+func (s *fakeObjectStorageSession) CheckBucketAccessWithContext(ctx context.Context, bucket string) error {
 	s.factory.LastCheckedBucket = bucket
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.factory.CheckBucketAccessErr != nil {
+		return s.factory.CheckBucketAccessErr
+	}
 	if s.factory.FailCheckBucketAccess {
 		return errors.New("")
 	}
@@ -84,6 +185,13 @@ func (s *fakeObjectStorageSession) CheckBucketAccess(bucket string) error {
 }
 
 func (s *fakeObjectStorageSession) CheckObjectPathExistence(bucket, objectpath string) (bool, error) {
+	return s.CheckObjectPathExistenceWithContext(context.Background(), bucket, objectpath)
+}
+
+func (s *fakeObjectStorageSession) CheckObjectPathExistenceWithContext(ctx context.Context, bucket, objectpath string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	if s.factory.CheckObjectPathExistenceError {
 		return false, errors.New("")
 	} else if s.factory.CheckObjectPathExistencePathNotFound {
@@ -93,15 +201,49 @@ func (s *fakeObjectStorageSession) CheckObjectPathExistence(bucket, objectpath s
 }
 
 func (s *fakeObjectStorageSession) CreateBucket(bucket, locationConstraint string, kpRootKeyCrn string) (string, error) {
+	return s.CreateBucketWithContext(context.Background(), bucket, locationConstraint, kpRootKeyCrn)
+}
+
+func (s *fakeObjectStorageSession) CreateBucketWithContext(ctx context.Context, bucket, locationConstraint string, kpRootKeyCrn string) (string, error) {
 	s.factory.LastCreatedBucket = bucket
+	s.factory.LastRootKeyCRN = kpRootKeyCrn
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	if s.factory.FailCreateBucket {
-		return "", errors.New(s.factory.FailCreateBucketErrMsg)
+		if s.factory.FailCreateBucketErrMsg == "" {
+			return "", errors.New("")
+		}
+		return "", backend.ClassifyError(awserr.New(s.factory.FailCreateBucketErrMsg, "", nil))
 	}
 	return "", nil
 }
 
+func (s *fakeObjectStorageSession) GetBucketEncryptionWithContext(ctx context.Context, bucket string) (*backend.BucketEncryption, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.factory.GetBucketEncryptionErr != nil {
+		return nil, s.factory.GetBucketEncryptionErr
+	}
+	if s.factory.BucketEncryption != nil {
+		return s.factory.BucketEncryption, nil
+	}
+	return &backend.BucketEncryption{KPEnabled: s.factory.LastRootKeyCRN != "", RootKeyCRN: s.factory.LastRootKeyCRN}, nil
+}
+
 func (s *fakeObjectStorageSession) DeleteBucket(bucket string) error {
+	return s.DeleteBucketWithContext(context.Background(), bucket)
+}
+
+func (s *fakeObjectStorageSession) DeleteBucketWithContext(ctx context.Context, bucket string) error {
 	s.factory.LastDeletedBucket = bucket
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.factory.DeleteBucketErr != nil {
+		return s.factory.DeleteBucketErr
+	}
 	if s.factory.FailDeleteBucket {
 		return errors.New("")
 	}
@@ -109,10 +251,253 @@ func (s *fakeObjectStorageSession) DeleteBucket(bucket string) error {
 }
 
 func (s *fakeObjectStorageSession) SetBucketVersioning(bucket string, enabled bool) error {
+	return s.SetBucketVersioningWithContext(context.Background(), bucket, enabled)
+}
+
+func (s *fakeObjectStorageSession) SetBucketVersioningWithContext(ctx context.Context, bucket string, enabled bool) error {
 	s.factory.LastUpdatedBucket = bucket
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if s.factory.FailSetBucketVersioning {
 		return errors.New("failed to set versioning")
 	}
 
 	return nil
 }
+
+func (s *fakeObjectStorageSession) SetBucketOwnerWithContext(ctx context.Context, bucket string, owner *backend.BucketOwner) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.factory.FailSetBucketOwner {
+		return errors.New("failed to set bucket owner")
+	}
+	if s.factory.BucketOwners == nil {
+		s.factory.BucketOwners = map[string]*backend.BucketOwner{}
+	}
+	s.factory.BucketOwners[bucket] = owner
+	return nil
+}
+
+func (s *fakeObjectStorageSession) GetBucketOwnerWithContext(ctx context.Context, bucket string) (*backend.BucketOwner, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.factory.GetBucketOwnerErr != nil {
+		return nil, s.factory.GetBucketOwnerErr
+	}
+	return s.factory.BucketOwners[bucket], nil
+}
+
+func (s *fakeObjectStorageSession) CopyObjectsWithContext(ctx context.Context, bucket, prefix, destBucket, destPrefix string) (int, error) {
+	s.factory.LastCopiedPrefix = bucket + "/" + prefix
+	s.factory.LastCopyDestination = destBucket + "/" + destPrefix
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if s.factory.CopyObjectsErr != nil {
+		return 0, s.factory.CopyObjectsErr
+	}
+	return 1, nil
+}
+
+func (s *fakeObjectStorageSession) GetBucketVersioningWithContext(ctx context.Context, bucket string) (bool, error) {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if s.factory.GetBucketVersioningErr != nil {
+		return false, s.factory.GetBucketVersioningErr
+	}
+	return s.factory.VersionedBuckets[bucket], nil
+}
+
+func (s *fakeObjectStorageSession) CopyObjectsAsOfWithContext(ctx context.Context, bucket, prefix, destBucket, destPrefix string, asOf time.Time, versionID, startAfter string, copied func(key string) error) (int, error) {
+	f := s.factory
+	f.mu.Lock()
+	f.LastCopiedPrefix = bucket + "/" + prefix
+	f.LastCopyDestination = destBucket + "/" + destPrefix
+	f.LastCopyAsOf = asOf
+	f.LastCopyVersionID = versionID
+	f.LastCopyStartAfter = startAfter
+	block, keys := f.CopyObjectsAsOfBlock, f.AsOfKeys
+	f.mu.Unlock()
+	if block != nil {
+		select {
+		case <-block:
+		case <-ctx.Done():
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if keys == nil {
+		keys = []string{prefix + "object"}
+	}
+
+	n := 0
+	for _, key := range keys {
+		if key <= startAfter {
+			continue
+		}
+		f.mu.Lock()
+		if f.CopyObjectsAsOfErr != nil && n >= f.CopyObjectsAsOfFailAfter {
+			f.mu.Unlock()
+			return n, f.CopyObjectsAsOfErr
+		}
+		if f.CopiedAsOfKeys == nil {
+			f.CopiedAsOfKeys = map[string]int{}
+		}
+		f.CopiedAsOfKeys[key]++
+		f.mu.Unlock()
+		n++
+		if copied != nil {
+			if err := copied(key); err != nil {
+				return n, err
+			}
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.CopyObjectsAsOfErr != nil {
+		return n, f.CopyObjectsAsOfErr
+	}
+	return n, nil
+}
+
+func (s *fakeObjectStorageSession) CreateObjectPathWithContext(ctx context.Context, bucket, objectpath string) error {
+	s.factory.LastCreatedObjectPath = bucket + ":" + objectpath
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.factory.CreateObjectPathErr
+}
+
+func (s *fakeObjectStorageSession) DeleteObjectPathWithContext(ctx context.Context, bucket, objectpath string) error {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	s.factory.LastDeletedObjectPath = bucket + ":" + objectpath
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.factory.DeleteObjectPathErr
+}
+
+func (s *fakeObjectStorageSession) SetObjectPathOwnerWithContext(ctx context.Context, bucket, objectpath string, owner *backend.BucketOwner) error {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	s.factory.LastCreatedObjectPath = bucket + ":" + objectpath
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.factory.FailSetBucketOwner {
+		return errors.New("failed to set object path owner")
+	}
+	if s.factory.ObjectPathOwners == nil {
+		s.factory.ObjectPathOwners = map[string]*backend.BucketOwner{}
+	}
+	s.factory.ObjectPathOwners[bucket+":"+objectpath] = owner
+	return nil
+}
+
+func (s *fakeObjectStorageSession) GetObjectPathOwnerWithContext(ctx context.Context, bucket, objectpath string) (*backend.BucketOwner, error) {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.factory.GetBucketOwnerErr != nil {
+		return nil, s.factory.GetBucketOwnerErr
+	}
+	return s.factory.ObjectPathOwners[bucket+":"+objectpath], nil
+}
+
+func (s *fakeObjectStorageSession) GetObjectPathUsageWithContext(ctx context.Context, bucket, objectpath string, maxObjects int) (*backend.Usage, error) {
+	f := s.factory
+	f.mu.Lock()
+	f.LastMeasuredObjectPath = bucket + ":" + objectpath
+	f.UsageReads++
+	f.usageReadsInFlight++
+	if f.usageReadsInFlight > f.MaxUsageReadsInFlight {
+		f.MaxUsageReadsInFlight = f.usageReadsInFlight
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.usageReadsInFlight--
+		f.mu.Unlock()
+	}()
+	time.Sleep(f.ObjectPathUsageDelay)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.factory.GetObjectPathUsageErr != nil {
+		return nil, s.factory.GetObjectPathUsageErr
+	}
+	if s.factory.ObjectPathUsage != nil {
+		usage := *s.factory.ObjectPathUsage
+		return &usage, nil
+	}
+	return &backend.Usage{}, nil
+}
+
+func (s *fakeObjectStorageSession) CreateObjectWithContext(ctx context.Context, bucket, key string, data []byte) (bool, error) {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if s.factory.CreateObjectErr != nil {
+		return false, s.factory.CreateObjectErr
+	}
+	if _, ok := s.factory.Objects[bucket+"/"+key]; ok {
+		return false, nil
+	}
+	if s.factory.Objects == nil {
+		s.factory.Objects = map[string][]byte{}
+	}
+	s.factory.Objects[bucket+"/"+key] = append([]byte(nil), data...)
+	return true, nil
+}
+
+func (s *fakeObjectStorageSession) WriteObjectWithContext(ctx context.Context, bucket, key string, data []byte) error {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.factory.WriteObjectErr != nil {
+		return s.factory.WriteObjectErr
+	}
+	if s.factory.Objects == nil {
+		s.factory.Objects = map[string][]byte{}
+	}
+	s.factory.Objects[bucket+"/"+key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *fakeObjectStorageSession) ReadObjectWithContext(ctx context.Context, bucket, key string) ([]byte, error) {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, ok := s.factory.Objects[bucket+"/"+key]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *fakeObjectStorageSession) DeleteObjectWithContext(ctx context.Context, bucket, key string) error {
+	s.factory.mu.Lock()
+	defer s.factory.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	delete(s.factory.Objects, bucket+"/"+key)
+	return nil
+}
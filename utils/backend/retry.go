@@ -0,0 +1,381 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws"
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
+	"github.com/IBM/ibm-cos-sdk-go/service/s3"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy retries COS and IAM calls that failed with a retryable error,
+// waiting an exponentially growing, jittered backoff between attempts.
+// A nil policy makes a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, values below 2 disable retries
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after each retry, 2 if zero
+	Multiplier float64
+	// Jitter randomizes each backoff by up to this fraction of it, in [0, 1]
+	Jitter float64
+	// Retryable decides which errors are retried, IsRetryable if nil
+	Retryable func(error) bool
+
+	sleep  func(ctx context.Context, d time.Duration) error
+	random func() float64
+}
+
+// DefaultRetryPolicy is the policy used by the provisioner and driver binaries
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     8 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+var (
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ibmc_s3fs",
+		Subsystem: "backend",
+		Name:      "retries_total",
+		Help:      "Number of retried COS and IAM calls, by operation and error reason.",
+	}, []string{"operation", "reason"})
+
+	retriesExhaustedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ibmc_s3fs",
+		Subsystem: "backend",
+		Name:      "retries_exhausted_total",
+		Help:      "Number of COS and IAM calls that still failed with a retryable error after the last attempt.",
+	}, []string{"operation", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(retriesTotal, retriesExhaustedTotal)
+}
+
+// IsRetryable reports whether err is worth retrying: throttling, server side
+// errors, network failures and IAM outages.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrThrottled) || errors.Is(err, ErrTransient)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the wait before retry number n, starting at 1
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(n-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		random := rand.Float64 // #nosec G404 -- jitter does not need a secure source
+		if p.random != nil {
+			random = p.random
+		}
+		d *= 1 - p.Jitter + 2*p.Jitter*random()
+	}
+	return time.Duration(d)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Do calls fn until it succeeds, fails with an error that is not retryable,
+// the attempts are used up or ctx is done. The last error of fn is returned.
+func (p *RetryPolicy) Do(ctx context.Context, logger *zap.Logger, operation string, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if p == nil || p.MaxAttempts < 2 {
+		return err
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	sleep := sleepContext
+	if p.sleep != nil {
+		sleep = p.sleep
+	}
+
+	for attempt := 1; err != nil && p.retryable(err); attempt++ {
+		reason := ErrorReason(err)
+		if attempt >= p.MaxAttempts {
+			retriesExhaustedTotal.WithLabelValues(operation, reason).Inc()
+			logger.Warn("Giving up retrying operation",
+				zap.String("operation", operation), zap.Int("attempts", attempt),
+				zap.String("reason", reason), zap.Error(err))
+			return err
+		}
+
+		wait := p.backoff(attempt)
+		logger.Info("Retrying operation",
+			zap.String("operation", operation), zap.Int("attempt", attempt+1),
+			zap.Int("maxAttempts", p.MaxAttempts), zap.Duration("backoff", wait),
+			zap.String("reason", reason), zap.Error(err))
+		if sleep(ctx, wait) != nil {
+			return err
+		}
+		retriesTotal.WithLabelValues(operation, reason).Inc()
+		err = fn(ctx)
+	}
+	return err
+}
+
+// retryingS3API retries the calls of the wrapped s3API according to policy
+type retryingS3API struct {
+	s3API
+	policy *RetryPolicy
+	logger *zap.Logger
+}
+
+func (r *retryingS3API) HeadBucketWithContext(ctx aws.Context, input *s3.HeadBucketInput, opts ...request.Option) (out *s3.HeadBucketOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "HeadBucket", func(ctx context.Context) error {
+		out, err = r.s3API.HeadBucketWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+// CreateBucketWithContext does not retry a failed attempt blindly: an attempt
+// whose response was lost may have created the bucket, and creating it again
+// would report that it already existed. A bucket found empty and without
+// ownership marker after a failed attempt was left by it and is reported
+// created instead.
+func (r *retryingS3API) CreateBucketWithContext(ctx aws.Context, input *s3.CreateBucketInput, opts ...request.Option) (out *s3.CreateBucketOutput, err error) {
+	failed := false
+	err = r.policy.Do(ctx, r.logger, "CreateBucket", func(ctx context.Context) error {
+		if failed {
+			created, err := r.createdByFailedAttempt(ctx, input.Bucket)
+			if err != nil {
+				return err
+			}
+			if created {
+				r.logger.Info("Bucket was created by an attempt that failed", zap.String("bucket", aws.StringValue(input.Bucket)))
+				out = &s3.CreateBucketOutput{}
+				return nil
+			}
+		}
+		out, err = r.s3API.CreateBucketWithContext(ctx, input, opts...)
+		err = ClassifyError(err)
+		failed = err != nil
+		return err
+	})
+	return out, err
+}
+
+// createdByFailedAttempt reports whether bucket exists the way a CreateBucket
+// attempt leaves it, without ownership marker and without any object. Only
+// retryable errors are returned, the next attempt reports the other ones.
+func (r *retryingS3API) createdByFailedAttempt(ctx context.Context, bucket *string) (bool, error) {
+	check := func(err error) (bool, error) {
+		if err = ClassifyError(err); err != nil && r.policy.retryable(err) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	if _, err := r.s3API.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: bucket}); err != nil {
+		return check(err)
+	}
+	tags, err := r.s3API.GetBucketTaggingWithContext(ctx, &GetBucketTaggingInput{Bucket: bucket})
+	var aerr awserr.Error
+	if err != nil && !(errors.As(err, &aerr) && aerr.Code() == ErrCodeNoSuchTagSet) {
+		return check(err)
+	}
+	if tags != nil && ownerFromTags(tags.TagSet) != nil {
+		return false, nil
+	}
+	versions, err := r.s3API.ListObjectVersionsWithContext(ctx, &s3.ListObjectVersionsInput{Bucket: bucket, MaxKeys: aws.Int64(1)})
+	if err != nil {
+		return check(err)
+	}
+	return len(versions.Versions) == 0 && len(versions.DeleteMarkers) == 0, nil
+}
+
+func (r *retryingS3API) ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (out *s3.ListObjectsOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "ListObjects", func(ctx context.Context) error {
+		out, err = r.s3API.ListObjectsWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (out *s3.ListObjectsV2Output, err error) {
+	err = r.policy.Do(ctx, r.logger, "ListObjectsV2", func(ctx context.Context) error {
+		out, err = r.s3API.ListObjectsV2WithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (out *s3.ListObjectVersionsOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "ListObjectVersions", func(ctx context.Context) error {
+		out, err = r.s3API.ListObjectVersionsWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (out *s3.DeleteObjectOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "DeleteObject", func(ctx context.Context) error {
+		out, err = r.s3API.DeleteObjectWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (out *s3.DeleteObjectsOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "DeleteObjects", func(ctx context.Context) error {
+		out, err = r.s3API.DeleteObjectsWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) DeleteBucketWithContext(ctx aws.Context, input *s3.DeleteBucketInput, opts ...request.Option) (out *s3.DeleteBucketOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "DeleteBucket", func(ctx context.Context) error {
+		out, err = r.s3API.DeleteBucketWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (out *s3.PutBucketVersioningOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "PutBucketVersioning", func(ctx context.Context) error {
+		out, err = r.s3API.PutBucketVersioningWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (out *s3.PutObjectOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "PutObject", func(ctx context.Context) error {
+		// a failed attempt may have consumed the body
+		if input.Body != nil {
+			if _, err := input.Body.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		out, err = r.s3API.PutObjectWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (out *s3.GetObjectOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "GetObject", func(ctx context.Context) error {
+		out, err = r.s3API.GetObjectWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (out *s3.CopyObjectOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "CopyObject", func(ctx context.Context) error {
+		out, err = r.s3API.CopyObjectWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) GetBucketVersioningWithContext(ctx aws.Context, input *s3.GetBucketVersioningInput, opts ...request.Option) (out *s3.GetBucketVersioningOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "GetBucketVersioning", func(ctx context.Context) error {
+		out, err = r.s3API.GetBucketVersioningWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) PutBucketTaggingWithContext(ctx aws.Context, input *PutBucketTaggingInput, opts ...request.Option) (out *PutBucketTaggingOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "PutBucketTagging", func(ctx context.Context) error {
+		out, err = r.s3API.PutBucketTaggingWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) GetBucketTaggingWithContext(ctx aws.Context, input *GetBucketTaggingInput, opts ...request.Option) (out *GetBucketTaggingOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "GetBucketTagging", func(ctx context.Context) error {
+		out, err = r.s3API.GetBucketTaggingWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) GetObjectTaggingWithContext(ctx aws.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (out *s3.GetObjectTaggingOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "GetObjectTagging", func(ctx context.Context) error {
+		out, err = r.s3API.GetObjectTaggingWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (out *s3.CreateMultipartUploadOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "CreateMultipartUpload", func(ctx context.Context) error {
+		out, err = r.s3API.CreateMultipartUploadWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (out *s3.UploadPartCopyOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "UploadPartCopy", func(ctx context.Context) error {
+		out, err = r.s3API.UploadPartCopyWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (out *s3.CompleteMultipartUploadOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "CompleteMultipartUpload", func(ctx context.Context) error {
+		out, err = r.s3API.CompleteMultipartUploadWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
+
+func (r *retryingS3API) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (out *s3.AbortMultipartUploadOutput, err error) {
+	err = r.policy.Do(ctx, r.logger, "AbortMultipartUpload", func(ctx context.Context) error {
+		out, err = r.s3API.AbortMultipartUploadWithContext(ctx, input, opts...)
+		return ClassifyError(err)
+	})
+	return out, err
+}
@@ -0,0 +1,138 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// noWaitRetryPolicy returns a policy that retries without sleeping
+func noWaitRetryPolicy(attempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Second,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			return ctx.Err()
+		},
+	}
+}
+
+var errThrottledTest = ClassifyError(awserr.New("SlowDown", "Please reduce your request rate.", nil))
+
+func Test_RetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	assert.Equal(t, 100*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 300*time.Millisecond, p.backoff(2))
+	assert.Equal(t, 900*time.Millisecond, p.backoff(3))
+	assert.Equal(t, time.Second, p.backoff(4))
+}
+
+func Test_RetryPolicy_Backoff_Jitter(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: time.Second, Jitter: 0.5}
+	p.random = func() float64 { return 0 }
+	assert.Equal(t, 500*time.Millisecond, p.backoff(1))
+	p.random = func() float64 { return 1 }
+	assert.Equal(t, 1500*time.Millisecond, p.backoff(1))
+	p.random = nil
+	for i := 0; i < 100; i++ {
+		d := p.backoff(2)
+		assert.True(t, d >= time.Second && d <= 3*time.Second, "backoff %v out of bounds", d)
+	}
+}
+
+func Test_RetryPolicy_Do_RetriesUntilSuccess(t *testing.T) {
+	p := noWaitRetryPolicy(4)
+	var waits []time.Duration
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	before := testutil.ToFloat64(retriesTotal.WithLabelValues("Test_Success", "Throttled"))
+
+	calls := 0
+	err := p.Do(context.Background(), nil, "Test_Success", func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errThrottledTest
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits)
+	assert.Equal(t, before+2, testutil.ToFloat64(retriesTotal.WithLabelValues("Test_Success", "Throttled")))
+}
+
+func Test_RetryPolicy_Do_NotRetryable(t *testing.T) {
+	calls := 0
+	err := noWaitRetryPolicy(4).Do(context.Background(), nil, "Test_NotRetryable", func(ctx context.Context) error {
+		calls++
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_RetryPolicy_Do_Exhausted(t *testing.T) {
+	before := testutil.ToFloat64(retriesExhaustedTotal.WithLabelValues("Test_Exhausted", "Throttled"))
+
+	calls := 0
+	err := noWaitRetryPolicy(3).Do(context.Background(), nil, "Test_Exhausted", func(ctx context.Context) error {
+		calls++
+		return errThrottledTest
+	})
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, before+1, testutil.ToFloat64(retriesExhaustedTotal.WithLabelValues("Test_Exhausted", "Throttled")))
+}
+
+func Test_RetryPolicy_Do_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := noWaitRetryPolicy(5).Do(ctx, nil, "Test_Canceled", func(ctx context.Context) error {
+		calls++
+		cancel()
+		return errThrottledTest
+	})
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_RetryPolicy_Do_CustomRetryable(t *testing.T) {
+	p := noWaitRetryPolicy(2)
+	p.Retryable = func(err error) bool { return errors.Is(err, errTest) }
+
+	calls := 0
+	err := p.Do(context.Background(), nil, "Test_Custom", func(ctx context.Context) error {
+		calls++
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 2, calls)
+}
+
+func Test_RetryPolicy_Do_NilPolicy(t *testing.T) {
+	var p *RetryPolicy
+	calls := 0
+	err := p.Do(context.Background(), nil, "Test_Nil", func(ctx context.Context) error {
+		calls++
+		return errThrottledTest
+	})
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,97 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package backend
+
+import (
+	"github.com/IBM/ibm-cos-sdk-go/aws"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
+	"github.com/IBM/ibm-cos-sdk-go/private/checksum"
+	"github.com/IBM/ibm-cos-sdk-go/service/s3"
+)
+
+// The IBM COS SDK does not model the bucket tagging operations COS supports,
+// cosS3API adds them to the SDK client the same way the SDK models the
+// object tagging operations.
+
+const (
+	opPutBucketTagging = "PutBucketTagging"
+	opGetBucketTagging = "GetBucketTagging"
+)
+
+// PutBucketTaggingInput is the input of PutBucketTagging, the tags replace
+// those of the bucket
+type PutBucketTaggingInput struct {
+	_ struct{} `locationName:"PutBucketTaggingRequest" type:"structure" payload:"Tagging"`
+
+	// Bucket is a required field
+	Bucket *string `location:"uri" locationName:"Bucket" type:"string" required:"true"`
+
+	// Tagging is a required field
+	Tagging *s3.Tagging `locationName:"Tagging" type:"structure" required:"true" xmlURI:"http://s3.amazonaws.com/doc/2006-03-01/"`
+}
+
+// PutBucketTaggingOutput is the output of PutBucketTagging
+type PutBucketTaggingOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// GetBucketTaggingInput is the input of GetBucketTagging
+type GetBucketTaggingInput struct {
+	_ struct{} `locationName:"GetBucketTaggingRequest" type:"structure"`
+
+	// Bucket is a required field
+	Bucket *string `location:"uri" locationName:"Bucket" type:"string" required:"true"`
+}
+
+// GetBucketTaggingOutput is the output of GetBucketTagging
+type GetBucketTaggingOutput struct {
+	_ struct{} `type:"structure"`
+
+	TagSet []*s3.Tag `locationNameList:"Tag" type:"list" required:"true"`
+}
+
+// cosS3API is the SDK client extended with the bucket tagging operations
+type cosS3API struct {
+	*s3.S3
+}
+
+// PutBucketTaggingWithContext replaces the tags of a bucket
+func (c *cosS3API) PutBucketTaggingWithContext(ctx aws.Context, input *PutBucketTaggingInput, opts ...request.Option) (*PutBucketTaggingOutput, error) {
+	op := &request.Operation{
+		Name:       opPutBucketTagging,
+		HTTPMethod: "PUT",
+		HTTPPath:   "/{Bucket}?tagging",
+	}
+	output := &PutBucketTaggingOutput{}
+	req := c.NewRequest(op, input, output)
+	req.Handlers.Build.PushBackNamed(request.NamedHandler{
+		Name: "contentMd5Handler",
+		Fn:   checksum.AddBodyContentMD5Handler,
+	})
+	req.SetContext(ctx)
+	req.ApplyOptions(opts...)
+	return output, req.Send()
+}
+
+// GetBucketTaggingWithContext returns the tags of a bucket, it fails with
+// NoSuchTagSet if the bucket has none
+func (c *cosS3API) GetBucketTaggingWithContext(ctx aws.Context, input *GetBucketTaggingInput, opts ...request.Option) (*GetBucketTaggingOutput, error) {
+	op := &request.Operation{
+		Name:       opGetBucketTagging,
+		HTTPMethod: "GET",
+		HTTPPath:   "/{Bucket}?tagging",
+	}
+	output := &GetBucketTaggingOutput{}
+	req := c.NewRequest(op, input, output)
+	req.SetContext(ctx)
+	req.ApplyOptions(opts...)
+	return output, req.Send()
+}
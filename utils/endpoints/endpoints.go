@@ -0,0 +1,168 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+// Package endpoints is the catalog of the IBM Cloud Object Storage, IAM and
+// Resource Configuration endpoints of each region and network type
+package endpoints
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Network types of the endpoints
+const (
+	// NetworkPublic is reachable from the internet
+	NetworkPublic = "public"
+	// NetworkPrivate is reachable from the IBM Cloud classic private network
+	NetworkPrivate = "private"
+	// NetworkDirect is reachable from IBM Cloud VPC
+	NetworkDirect = "direct"
+)
+
+// COS Resource Configuration endpoints
+const (
+	// ResourceConfigDirect is the Resource Configuration endpoint used with
+	// the public and direct networks
+	ResourceConfigDirect = "https://config.direct.cloud-object-storage.cloud.ibm.com/v1"
+	// ResourceConfigPrivate is the Resource Configuration endpoint used with
+	// the private network
+	ResourceConfigPrivate = "https://config.private.cloud-object-storage.cloud.ibm.com/v1"
+)
+
+const cosDomain = "cloud-object-storage.appdomain.cloud"
+
+// regions lists the COS regional, cross-region and single site locations
+var regions = map[string]bool{
+	// regional
+	"us-south": true,
+	"us-east":  true,
+	"eu-gb":    true,
+	"eu-de":    true,
+	"eu-es":    true,
+	"jp-tok":   true,
+	"jp-osa":   true,
+	"au-syd":   true,
+	"ca-tor":   true,
+	"br-sao":   true,
+	// cross-region
+	"us": true,
+	"eu": true,
+	"ap": true,
+	// single site
+	"ams03": true,
+	"che01": true,
+	"mil01": true,
+	"mon01": true,
+	"par01": true,
+	"sjc04": true,
+	"sng01": true,
+}
+
+// Tiers lists the storage class tiers of the COS location constraints
+var Tiers = []string{"standard", "vault", "cold", "smart", "onerate_active"}
+
+// Endpoints are the endpoints of a region reachable from a network type
+type Endpoints struct {
+	// S3 is the COS S3 endpoint
+	S3 string
+	// IAM is the IAM endpoint, without the /identity/token path
+	IAM string
+	// ResourceConfig is the COS Resource Configuration endpoint
+	ResourceConfig string
+}
+
+// Resolve returns the endpoints of region reachable from network
+func Resolve(region, network string) (Endpoints, error) {
+	if !regions[region] {
+		return Endpoints{}, fmt.Errorf("unknown COS region %q, must be one of %s", region, strings.Join(Regions(), ", "))
+	}
+	switch network {
+	case NetworkPublic:
+		return Endpoints{
+			S3:             "https://s3." + region + "." + cosDomain,
+			IAM:            "https://iam.cloud.ibm.com",
+			ResourceConfig: ResourceConfig(network),
+		}, nil
+	case NetworkPrivate, NetworkDirect:
+		return Endpoints{
+			S3:             "https://s3." + network + "." + region + "." + cosDomain,
+			IAM:            "https://private.iam.cloud.ibm.com",
+			ResourceConfig: ResourceConfig(network),
+		}, nil
+	}
+	return Endpoints{}, fmt.Errorf("unknown network type %q, must be one of %s, %s, %s", network, NetworkPublic, NetworkPrivate, NetworkDirect)
+}
+
+// ResourceConfig returns the COS Resource Configuration endpoint used with
+// network: the private endpoint for the private network, the direct one for
+// every other network
+func ResourceConfig(network string) string {
+	if network == NetworkPrivate {
+		return ResourceConfigPrivate
+	}
+	return ResourceConfigDirect
+}
+
+// Regions returns the known COS regions, sorted
+func Regions() []string {
+	list := make([]string, 0, len(regions))
+	for region := range regions {
+		list = append(list, region)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// RegionOf returns the region of a COS S3 endpoint of the catalog, or "" when
+// the endpoint is not a COS endpoint
+func RegionOf(s3Endpoint string) string {
+	_, region := parseS3Endpoint(s3Endpoint)
+	return region
+}
+
+// parseS3Endpoint returns the network type and region of a COS S3 endpoint
+// of the form https://s3[.<network>].<region>.cloud-object-storage.appdomain.cloud
+func parseS3Endpoint(s3Endpoint string) (string, string) {
+	u, err := url.Parse(s3Endpoint)
+	if err != nil || !strings.HasSuffix(u.Hostname(), "."+cosDomain) {
+		return "", ""
+	}
+	labels := strings.Split(strings.TrimSuffix(u.Hostname(), "."+cosDomain), ".")
+	switch {
+	case len(labels) == 3 && (labels[1] == NetworkPrivate || labels[1] == NetworkDirect):
+		return labels[1], labels[2]
+	case len(labels) == 2:
+		return NetworkPublic, labels[1]
+	}
+	return "", ""
+}
+
+// ParseLocationConstraint splits a location constraint such as
+// us-south-smart into its region and storage class tier
+func ParseLocationConstraint(locationConstraint string) (string, string, error) {
+	var region, tier string
+	if i := strings.LastIndex(locationConstraint, "-"); i > 0 {
+		region, tier = locationConstraint[:i], locationConstraint[i+1:]
+	}
+	if !regions[region] {
+		return "", "", fmt.Errorf("unknown region %q in location constraint %q, must be <region>-<tier> with region one of %s",
+			region, locationConstraint, strings.Join(Regions(), ", "))
+	}
+	for _, t := range Tiers {
+		if t == tier {
+			return region, tier, nil
+		}
+	}
+	return "", "", fmt.Errorf("unknown tier %q in location constraint %q, must be <region>-<tier> with tier one of %s",
+		tier, locationConstraint, strings.Join(Tiers, ", "))
+}
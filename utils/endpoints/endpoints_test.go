@@ -0,0 +1,105 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package endpoints
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Resolve_Public(t *testing.T) {
+	eps, err := Resolve("us-south", NetworkPublic)
+	assert.NoError(t, err)
+	assert.Equal(t, Endpoints{
+		S3:             "https://s3.us-south.cloud-object-storage.appdomain.cloud",
+		IAM:            "https://iam.cloud.ibm.com",
+		ResourceConfig: ResourceConfigDirect,
+	}, eps)
+}
+
+func Test_Resolve_Private(t *testing.T) {
+	eps, err := Resolve("eu-de", NetworkPrivate)
+	assert.NoError(t, err)
+	assert.Equal(t, Endpoints{
+		S3:             "https://s3.private.eu-de.cloud-object-storage.appdomain.cloud",
+		IAM:            "https://private.iam.cloud.ibm.com",
+		ResourceConfig: ResourceConfigPrivate,
+	}, eps)
+}
+
+func Test_Resolve_Direct(t *testing.T) {
+	eps, err := Resolve("jp-tok", NetworkDirect)
+	assert.NoError(t, err)
+	assert.Equal(t, Endpoints{
+		S3:             "https://s3.direct.jp-tok.cloud-object-storage.appdomain.cloud",
+		IAM:            "https://private.iam.cloud.ibm.com",
+		ResourceConfig: ResourceConfigDirect,
+	}, eps)
+}
+
+func Test_Resolve_UnknownRegion(t *testing.T) {
+	_, err := Resolve("us-soth", NetworkPublic)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown COS region \"us-soth\"")
+		assert.Contains(t, err.Error(), "us-south")
+	}
+}
+
+func Test_Resolve_UnknownNetwork(t *testing.T) {
+	_, err := Resolve("us-south", "internal")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown network type \"internal\"")
+	}
+}
+
+func Test_ResourceConfig(t *testing.T) {
+	assert.Equal(t, ResourceConfigDirect, ResourceConfig(NetworkPublic))
+	assert.Equal(t, ResourceConfigPrivate, ResourceConfig(NetworkPrivate))
+	assert.Equal(t, ResourceConfigDirect, ResourceConfig(NetworkDirect))
+}
+
+func Test_RegionOf(t *testing.T) {
+	assert.Equal(t, "us-south", RegionOf("https://s3.us-south.cloud-object-storage.appdomain.cloud"))
+	assert.Equal(t, "eu", RegionOf("https://s3.direct.eu.cloud-object-storage.appdomain.cloud"))
+	assert.Equal(t, "", RegionOf("https://test-object-store-endpoint"))
+}
+
+func Test_ParseLocationConstraint(t *testing.T) {
+	region, tier, err := ParseLocationConstraint("us-south-smart")
+	assert.NoError(t, err)
+	assert.Equal(t, "us-south", region)
+	assert.Equal(t, "smart", tier)
+
+	region, tier, err = ParseLocationConstraint("ams03-onerate_active")
+	assert.NoError(t, err)
+	assert.Equal(t, "ams03", region)
+	assert.Equal(t, "onerate_active", tier)
+}
+
+func Test_ParseLocationConstraint_UnknownRegion(t *testing.T) {
+	_, _, err := ParseLocationConstraint("us-soth-standard")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown region \"us-soth\"")
+		assert.Contains(t, err.Error(), "us-south")
+	}
+
+	_, _, err = ParseLocationConstraint("standard")
+	assert.Error(t, err)
+}
+
+func Test_ParseLocationConstraint_UnknownTier(t *testing.T) {
+	_, _, err := ParseLocationConstraint("us-south-flex")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown tier \"flex\"")
+		assert.Contains(t, err.Error(), "standard, vault, cold, smart, onerate_active")
+	}
+}
@@ -11,7 +11,45 @@
 package grpc_client
 
 import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health" // enables client side health checking
+)
+
+const (
+	// DefaultCallTimeout bounds a single RPC to the provider when the caller sets no earlier deadline
+	DefaultCallTimeout = 10 * time.Second
+	// DefaultProviderTypeCacheTTL is how long a GetProviderType result is reused
+	DefaultProviderTypeCacheTTL = 10 * time.Minute
+
+	unixScheme = "unix://"
+
+	// serviceConfig retries the provider RPCs on UNAVAILABLE, which is what the
+	// client sees while the provider sidecar restarts, and turns on client side
+	// health checking of the connection. Health checking only runs under the
+	// round_robin balancer, it is ignored by the default pick_first.
+	serviceConfig = `{
+		"loadBalancingConfig": [{"round_robin": {}}],
+		"methodConfig": [{
+			"name": [{"service": "provider.IBMProvider"}],
+			"waitForReady": true,
+			"retryPolicy": {
+				"maxAttempts": 4,
+				"initialBackoff": "0.2s",
+				"maxBackoff": "2s",
+				"backoffMultiplier": 2.0,
+				"retryableStatusCodes": ["UNAVAILABLE"]
+			}
+		}],
+		"healthCheckConfig": {"serviceName": ""}
+	}`
 )
 
 type GrpcSessionFactory interface {
@@ -22,7 +60,15 @@ type GrpcSession interface {
 	GrpcDial(cc ClientConn, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error)
 }
 
-type ConnObjFactory struct{}
+// ConnObjFactory hands out a single long-lived session, so that every
+// provision request shares one connection to the provider socket.
+type ConnObjFactory struct {
+	// CallTimeout bounds each RPC issued over the connection, DefaultCallTimeout if zero
+	CallTimeout time.Duration
+
+	mu   sync.Mutex
+	sess *GrpcSes
+}
 
 type ClientConn interface {
 	Connect(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error)
@@ -32,12 +78,58 @@ type ClientConn interface {
 type GrpcSes struct {
 	conn *grpc.ClientConn
 	cc   ClientConn
+
+	mu          sync.Mutex
+	target      string
+	callTimeout time.Duration
+}
+
+// UnixTarget returns a grpc target for a unix socket path. Targets that
+// already carry a scheme are returned unchanged.
+func UnixTarget(target string) string {
+	if strings.Contains(target, "://") || strings.HasPrefix(target, "unix:") {
+		return target
+	}
+	return unixScheme + target
+}
+
+// DefaultDialOptions returns the options used for the connection to the provider socket
+func DefaultDialOptions(callTimeout time.Duration) []grpc.DialOption {
+	if callTimeout <= 0 {
+		callTimeout = DefaultCallTimeout
+	}
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  100 * time.Millisecond,
+				Multiplier: 1.6,
+				Jitter:     0.2,
+				MaxDelay:   3 * time.Second,
+			},
+			MinConnectTimeout: callTimeout,
+		}),
+		grpc.WithUnaryInterceptor(timeoutInterceptor(callTimeout)),
+	}
+}
+
+// timeoutInterceptor applies the per-call timeout unless the caller already
+// set an earlier deadline.
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > timeout {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
 }
 
 func (gs *GrpcSes) Connect(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	var err error
-	// nolint:staticcheck // grpc.Dial is deprecated but still required until grpc.NewClient is available
-	gs.conn, err = grpc.Dial(target, opts...)
+	gs.conn, err = grpc.NewClient(UnixTarget(target), opts...)
 	return gs.conn, err
 }
 
@@ -49,16 +141,105 @@ func (gs *GrpcSes) Connect(target string, opts ...grpc.DialOption) (*grpc.Client
 //}
 
 func (c *ConnObjFactory) NewGrpcSession() GrpcSession {
-	return &GrpcSes{}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sess == nil {
+		c.sess = &GrpcSes{
+			callTimeout: c.CallTimeout,
+		}
+	}
+	return c.sess
 }
 
 //var cc ClientConn = &GrpcSes{}
 
-// GrpcDial establishes a grpc-client client server connection
+// GrpcDial returns the cached connection to target unless its state shows it
+// is closed or failing, otherwise it establishes a new grpc-client client
+// server connection. The state is kept up to date by the client side health
+// checking of the connection, so no probe is issued here.
+// The returned connection is shared and must not be closed by the caller.
 func (c *GrpcSes) GrpcDial(cc ClientConn, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil && c.target == target {
+		if c.healthy(c.conn) {
+			return c.conn, nil
+		}
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+
+	opts = append(DefaultDialOptions(c.callTimeout), opts...)
 	conn, err := cc.Connect(target, opts...)
 	if err != nil {
 		return nil, err
 	}
+	c.conn = conn
+	c.target = target
 	return conn, err
 }
+
+// healthy reports whether conn can still be used. A connection that is idle
+// or still connecting is reused, RPCs on it wait until it is ready. A provider
+// that does not implement the standard health service is treated as healthy
+// by the client side health checking once reachable.
+func (c *GrpcSes) healthy(conn *grpc.ClientConn) bool {
+	switch conn.GetState() {
+	case connectivity.Shutdown, connectivity.TransientFailure:
+		return false
+	}
+	return true
+}
+
+// ProviderTypeCache memoizes the cluster type returned by GetProviderType,
+// which does not change for the lifetime of a cluster.
+type ProviderTypeCache struct {
+	// TTL is how long a cached value is served, DefaultProviderTypeCacheTTL if zero
+	TTL time.Duration
+
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+	now     func() time.Time
+}
+
+// NewProviderTypeCache returns a cache that serves GetProviderType results for ttl
+func NewProviderTypeCache(ttl time.Duration) *ProviderTypeCache {
+	return &ProviderTypeCache{TTL: ttl}
+}
+
+func (c *ProviderTypeCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// Get returns the cached provider type, if any. A nil cache never hits.
+func (c *ProviderTypeCache) Get() (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.value == "" || !c.clock().Before(c.expires) {
+		return "", false
+	}
+	return c.value, true
+}
+
+// Set stores the provider type. Empty values and nil caches are ignored.
+func (c *ProviderTypeCache) Set(providerType string) {
+	if c == nil || providerType == "" {
+		return
+	}
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultProviderTypeCacheTTL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value = providerType
+	c.expires = c.clock().Add(ttl)
+}
@@ -11,11 +11,16 @@
 package grpc_client
 
 import (
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"net"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -106,3 +111,132 @@ func UnixConnect(addr string, t time.Duration) (net.Conn, error) {
 	conn, err := net.DialUnix("unix", nil, unix_addr)
 	return conn, err
 }
+
+func startHealthServer(t *testing.T) (string, *health.Server) {
+	sock := filepath.Join(t.TempDir(), "provider.sock")
+	lis, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("cannot listen on %s: %v", sock, err)
+	}
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return sock, hs
+}
+
+// waitForState waits until conn reaches state, driven by the client side health checking
+func waitForState(t *testing.T, conn *grpc.ClientConn, state connectivity.State) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for s := conn.GetState(); s != state; s = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, s) {
+			t.Fatalf("connection did not reach %v, last state %v", state, s)
+		}
+	}
+}
+
+func Test_GrpcDial_ReusesConnectionWithoutProbing(t *testing.T) {
+	sock, hs := startHealthServer(t)
+	f := &ConnObjFactory{}
+	sess := f.NewGrpcSession()
+
+	conn1, err := sess.GrpcDial(&GrpcSes{}, sock)
+	assert.NoError(t, err)
+	conn1.Connect()
+	waitForState(t, conn1, connectivity.Ready)
+
+	// a provider that stops serving must not block the dial
+	hs.Shutdown()
+	done := make(chan *grpc.ClientConn)
+	go func() {
+		conn2, _ := sess.GrpcDial(&GrpcSes{}, sock)
+		done <- conn2
+	}()
+	select {
+	case conn2 := <-done:
+		assert.NotNil(t, conn2)
+	case <-time.After(time.Second):
+		t.Fatal("GrpcDial blocked on the cached connection")
+	}
+}
+
+func Test_UnixTarget(t *testing.T) {
+	assert.Equal(t, "unix:///ibmprovider/provider.sock", UnixTarget("/ibmprovider/provider.sock"))
+	assert.Equal(t, "unix:///ibmprovider/provider.sock", UnixTarget("unix:///ibmprovider/provider.sock"))
+	assert.Equal(t, "passthrough:///test", UnixTarget("passthrough:///test"))
+}
+
+func Test_NewGrpcSession_Shared(t *testing.T) {
+	f := &ConnObjFactory{}
+	assert.Same(t, f.NewGrpcSession(), f.NewGrpcSession())
+}
+
+func Test_GrpcDial_ReusesHealthyConnection(t *testing.T) {
+	sock, _ := startHealthServer(t)
+	f := &ConnObjFactory{}
+	sess := f.NewGrpcSession()
+
+	conn1, err := sess.GrpcDial(&GrpcSes{}, sock)
+	assert.NoError(t, err)
+	conn2, err := sess.GrpcDial(&GrpcSes{}, sock)
+	assert.NoError(t, err)
+	assert.Same(t, conn1, conn2)
+}
+
+func Test_GrpcDial_RedialsUnhealthyConnection(t *testing.T) {
+	sock, hs := startHealthServer(t)
+	f := &ConnObjFactory{}
+	sess := f.NewGrpcSession()
+
+	conn1, err := sess.GrpcDial(&GrpcSes{}, sock)
+	assert.NoError(t, err)
+	conn1.Connect()
+	waitForState(t, conn1, connectivity.Ready)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	waitForState(t, conn1, connectivity.TransientFailure)
+
+	conn2, err := sess.GrpcDial(&GrpcSes{}, sock)
+	assert.NoError(t, err)
+	assert.NotSame(t, conn1, conn2)
+}
+
+func Test_GrpcDial_RedialsClosedConnection(t *testing.T) {
+	sock, _ := startHealthServer(t)
+	f := &ConnObjFactory{}
+	sess := f.NewGrpcSession()
+
+	conn1, err := sess.GrpcDial(&GrpcSes{}, sock)
+	assert.NoError(t, err)
+	_ = conn1.Close()
+
+	conn2, err := sess.GrpcDial(&GrpcSes{}, sock)
+	assert.NoError(t, err)
+	assert.NotSame(t, conn1, conn2)
+}
+
+func Test_ProviderTypeCache(t *testing.T) {
+	now := time.Now()
+	c := NewProviderTypeCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, ok := c.Get()
+	assert.False(t, ok)
+
+	c.Set("vpc-gen2")
+	v, ok := c.Get()
+	assert.True(t, ok)
+	assert.Equal(t, "vpc-gen2", v)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = c.Get()
+	assert.False(t, ok)
+}
+
+func Test_ProviderTypeCache_Nil(t *testing.T) {
+	var c *ProviderTypeCache
+	c.Set("vpc-gen2")
+	_, ok := c.Get()
+	assert.False(t, ok)
+}
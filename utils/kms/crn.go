@@ -0,0 +1,93 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+// Package kms parses the CRNs of the Key Protect and Hyper Protect Crypto
+// Services root keys used to encrypt COS buckets
+package kms
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Service names of the key management services in root key CRNs
+const (
+	// ServiceKeyProtect is IBM Key Protect
+	ServiceKeyProtect = "kms"
+	// ServiceHPCS is IBM Hyper Protect Crypto Services
+	ServiceHPCS = "hs-crypto"
+)
+
+// crossRegionKeyLocations is the location of the root keys of the cross-region buckets
+var crossRegionKeyLocations = map[string]string{
+	"us": "us-south",
+	"eu": "eu-de",
+	"ap": "jp-tok",
+}
+
+// RootKeyCRN is a parsed root key CRN of the form
+// crn:v1:bluemix:public:<service>:<location>:a/<account>:<instance>:key:<key-id>
+type RootKeyCRN struct {
+	Service  string
+	Location string
+	Account  string
+	Instance string
+	KeyID    string
+}
+
+// ParseRootKeyCRN parses and validates the CRN of a root key
+func ParseRootKeyCRN(crn string) (*RootKeyCRN, error) {
+	segments := strings.Split(crn, ":")
+	if len(segments) != 10 || segments[0] != "crn" || segments[1] != "v1" {
+		return nil, fmt.Errorf("bad root key CRN %q: must be of the form crn:v1:bluemix:public:<service>:<location>:a/<account>:<instance>:key:<key-id>", crn)
+	}
+	c := &RootKeyCRN{
+		Service:  segments[4],
+		Location: segments[5],
+		Account:  strings.TrimPrefix(segments[6], "a/"),
+		Instance: segments[7],
+		KeyID:    segments[9],
+	}
+	if c.Service != ServiceKeyProtect && c.Service != ServiceHPCS {
+		return nil, fmt.Errorf("bad root key CRN %q: service %q is neither %s (Key Protect) nor %s (Hyper Protect Crypto Services)",
+			crn, c.Service, ServiceKeyProtect, ServiceHPCS)
+	}
+	if segments[8] != "key" {
+		return nil, fmt.Errorf("bad root key CRN %q: resource type %q is not key", crn, segments[8])
+	}
+	if c.Location == "" || c.Instance == "" || c.KeyID == "" || !strings.HasPrefix(segments[6], "a/") {
+		return nil, fmt.Errorf("bad root key CRN %q: location, account, instance and key id must be set", crn)
+	}
+	return c, nil
+}
+
+// ServiceName returns the display name of the key management service
+func (c *RootKeyCRN) ServiceName() string {
+	if c.Service == ServiceHPCS {
+		return "Hyper Protect Crypto Services"
+	}
+	return "Key Protect"
+}
+
+// CheckBucketRegion checks that the root key can encrypt the buckets of a COS
+// region. Single site buckets are not checked.
+func (c *RootKeyCRN) CheckBucketRegion(region string) error {
+	location := region
+	if l, ok := crossRegionKeyLocations[region]; ok {
+		location = l
+	} else if !strings.Contains(region, "-") {
+		return nil
+	}
+	if c.Location != location {
+		return fmt.Errorf("%s root key of %s cannot encrypt buckets of %s, use a root key of %s",
+			c.ServiceName(), c.Location, region, location)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2025 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package kms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testKPCRN   = "crn:v1:bluemix:public:kms:us-south:a/test-account:test-instance:key:test-key"
+	testHPCSCRN = "crn:v1:bluemix:public:hs-crypto:eu-de:a/test-account:test-instance:key:test-key"
+)
+
+func Test_ParseRootKeyCRN_KeyProtect(t *testing.T) {
+	c, err := ParseRootKeyCRN(testKPCRN)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &RootKeyCRN{Service: ServiceKeyProtect, Location: "us-south", Account: "test-account", Instance: "test-instance", KeyID: "test-key"}, c)
+		assert.Equal(t, "Key Protect", c.ServiceName())
+	}
+}
+
+func Test_ParseRootKeyCRN_HPCS(t *testing.T) {
+	c, err := ParseRootKeyCRN(testHPCSCRN)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ServiceHPCS, c.Service)
+		assert.Equal(t, "Hyper Protect Crypto Services", c.ServiceName())
+	}
+}
+
+func Test_ParseRootKeyCRN_BadFormat(t *testing.T) {
+	_, err := ParseRootKeyCRN("test-key")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "must be of the form crn:v1:")
+	}
+}
+
+func Test_ParseRootKeyCRN_BadService(t *testing.T) {
+	_, err := ParseRootKeyCRN("crn:v1:bluemix:public:cloud-object-storage:us-south:a/test-account:test-instance:key:test-key")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "service \"cloud-object-storage\" is neither kms")
+	}
+}
+
+func Test_ParseRootKeyCRN_BadResourceType(t *testing.T) {
+	_, err := ParseRootKeyCRN("crn:v1:bluemix:public:kms:us-south:a/test-account:test-instance:policy:test-key")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "resource type \"policy\" is not key")
+	}
+}
+
+func Test_ParseRootKeyCRN_MissingKeyID(t *testing.T) {
+	_, err := ParseRootKeyCRN("crn:v1:bluemix:public:kms:us-south:a/test-account:test-instance:key:")
+	assert.Error(t, err)
+}
+
+func Test_CheckBucketRegion(t *testing.T) {
+	c, _ := ParseRootKeyCRN(testKPCRN)
+	assert.NoError(t, c.CheckBucketRegion("us-south"))
+	assert.NoError(t, c.CheckBucketRegion("us"))
+	assert.NoError(t, c.CheckBucketRegion("ams03"))
+
+	err := c.CheckBucketRegion("eu-de")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Key Protect root key of us-south cannot encrypt buckets of eu-de, use a root key of eu-de")
+	}
+	err = c.CheckBucketRegion("eu")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "use a root key of eu-de")
+	}
+}